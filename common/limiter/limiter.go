@@ -5,6 +5,7 @@ import (
 	_ "embed"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/go-redis/redis/v8"
@@ -13,6 +14,11 @@ import (
 //go:embed lua/rate_limit.lua
 var rateLimitScript string
 
+//go:embed lua/concurrency.lua
+var concurrencyScript string
+
+var concurrencyLuaScript = redis.NewScript(concurrencyScript)
+
 type RedisLimiter struct {
 	client         *redis.Client
 	limitScriptSHA string
@@ -40,6 +46,22 @@ func New(ctx context.Context, r *redis.Client) *RedisLimiter {
 }
 
 func (rl *RedisLimiter) Allow(ctx context.Context, key string, opts ...Option) (bool, error) {
+	allowed, _, err := rl.Reserve(ctx, key, opts...)
+	return allowed, err
+}
+
+// Reserve 与 Allow 相同，同时返回扣除后桶内剩余的令牌数
+func (rl *RedisLimiter) Reserve(ctx context.Context, key string, opts ...Option) (bool, int64, error) {
+	return rl.eval(ctx, key, false, opts...)
+}
+
+// Consume 不检查余量直接扣除令牌，Requested 为负数时返还令牌，用于请求结束后按实际用量修正
+func (rl *RedisLimiter) Consume(ctx context.Context, key string, opts ...Option) (int64, error) {
+	_, remaining, err := rl.eval(ctx, key, true, opts...)
+	return remaining, err
+}
+
+func (rl *RedisLimiter) eval(ctx context.Context, key string, force bool, opts ...Option) (bool, int64, error) {
 	// 默认配置
 	config := &Config{
 		Capacity:  10,
@@ -52,6 +74,11 @@ func (rl *RedisLimiter) Allow(ctx context.Context, key string, opts ...Option) (
 		opt(config)
 	}
 
+	forceArg := 0
+	if force {
+		forceArg = 1
+	}
+
 	// 执行限流
 	result, err := rl.client.EvalSha(
 		ctx,
@@ -60,14 +87,32 @@ func (rl *RedisLimiter) Allow(ctx context.Context, key string, opts ...Option) (
 		config.Requested,
 		config.Rate,
 		config.Capacity,
-	).Int()
+		forceArg,
+	).Int64Slice()
+
+	if err != nil {
+		return false, 0, fmt.Errorf("rate limit failed: %w", err)
+	}
+	if len(result) != 2 {
+		return false, 0, fmt.Errorf("rate limit failed: unexpected result %v", result)
+	}
+	return result[0] == 1, result[1], nil
+}
 
+// AcquireConcurrency 以 member 占用一个并发名额，ttl 后未释放的名额自动失效
+func (rl *RedisLimiter) AcquireConcurrency(ctx context.Context, key string, member string, limit int, ttl time.Duration) (bool, error) {
+	result, err := concurrencyLuaScript.Run(ctx, rl.client, []string{key}, member, limit, int64(ttl.Seconds())).Int64()
 	if err != nil {
-		return false, fmt.Errorf("rate limit failed: %w", err)
+		return false, fmt.Errorf("concurrency limit failed: %w", err)
 	}
 	return result == 1, nil
 }
 
+// ReleaseConcurrency 释放 member 占用的并发名额
+func (rl *RedisLimiter) ReleaseConcurrency(ctx context.Context, key string, member string) error {
+	return rl.client.ZRem(ctx, key, member).Err()
+}
+
 // Config 配置选项模式
 type Config struct {
 	Capacity  int64
@@ -0,0 +1,24 @@
+-- 并发计数，每个请求作为有序集合中的一个成员，分数为过期时间
+-- KEYS[1]: 并发计数唯一标识
+-- ARGV[1]: 请求成员 id
+-- ARGV[2]: 最大并发数
+-- ARGV[3]: 成员过期时间（秒），防止进程异常退出后计数无法释放
+-- 返回: 1 表示获取成功，0 表示已达上限
+
+local key = KEYS[1]
+local member = ARGV[1]
+local limit = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+
+local now = tonumber(redis.call('TIME')[1])
+
+-- 清理已过期的请求
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now)
+
+if redis.call('ZCARD', key) >= limit then
+    return 0
+end
+
+redis.call('ZADD', key, now + ttl, member)
+redis.call('EXPIRE', key, ttl)
+return 1
@@ -3,11 +3,14 @@
 -- ARGV[1]: 请求令牌数 (通常为1)
 -- ARGV[2]: 令牌生成速率 (每秒)
 -- ARGV[3]: 桶容量
+-- ARGV[4]: 为 1 时不检查余量直接扣除（可为负数，用于返还令牌）
+-- 返回: {是否允许, 剩余令牌数}
 
 local key = KEYS[1]
 local requested = tonumber(ARGV[1])
 local rate = tonumber(ARGV[2])
 local capacity = tonumber(ARGV[3])
+local force = tonumber(ARGV[4]) == 1
 
 -- 获取当前时间（Redis服务器时间）
 local now = redis.call('TIME')
@@ -32,7 +35,10 @@ end
 
 -- 判断是否允许请求
 local allowed = false
-if tokens >= requested then
+if force then
+    tokens = math.min(capacity, tokens - requested)
+    allowed = true
+elseif tokens >= requested then
     tokens = tokens - requested
     allowed = true
 end
@@ -41,4 +47,4 @@ end
 redis.call('HMSET', key, 'tokens', tokens, 'last_time', last_time)
 --redis.call('EXPIRE', key, math.ceil(capacity / rate) + 60) -- 适当延长过期时间
 
-return allowed and 1 or 0
\ No newline at end of file
+return {allowed and 1 or 0, tokens}
\ No newline at end of file
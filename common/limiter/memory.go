@@ -0,0 +1,153 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// 清理已回满的令牌桶与过期并发名额的间隔
+const memorySweepInterval = 60
+
+// MemoryLimiter 未启用 Redis 时使用的单机令牌桶，语义与 RedisLimiter 相同
+type MemoryLimiter struct {
+	mutex     sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep int64
+}
+
+type memoryBucket struct {
+	tokens   int64
+	lastTime int64
+	capacity int64
+	rate     int64
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets: make(map[string]*memoryBucket),
+	}
+}
+
+func (l *MemoryLimiter) Reserve(key string, opts ...Option) (bool, int64) {
+	return l.take(key, false, opts...)
+}
+
+func (l *MemoryLimiter) Consume(key string, opts ...Option) int64 {
+	_, remaining := l.take(key, true, opts...)
+	return remaining
+}
+
+func (l *MemoryLimiter) take(key string, force bool, opts ...Option) (bool, int64) {
+	config := &Config{
+		Capacity:  10,
+		Rate:      1,
+		Requested: 1,
+	}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now().Unix()
+	l.sweep(now)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: config.Capacity, lastTime: now}
+		l.buckets[key] = bucket
+	} else {
+		bucket.tokens = min(config.Capacity, bucket.tokens+(now-bucket.lastTime)*config.Rate)
+		bucket.lastTime = now
+	}
+	bucket.capacity = config.Capacity
+	bucket.rate = config.Rate
+
+	if force {
+		bucket.tokens = min(config.Capacity, bucket.tokens-config.Requested)
+		return true, bucket.tokens
+	}
+	if bucket.tokens >= config.Requested {
+		bucket.tokens -= config.Requested
+		return true, bucket.tokens
+	}
+	return false, bucket.tokens
+}
+
+// sweep 删除已经回满的令牌桶，回满的桶与不存在的桶等价
+func (l *MemoryLimiter) sweep(now int64) {
+	if now-l.lastSweep < memorySweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		if bucket.tokens+(now-bucket.lastTime)*bucket.rate >= bucket.capacity {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// MemoryConcurrencyLimiter 未启用 Redis 时使用的单机并发计数，每个请求单独记录过期时间
+type MemoryConcurrencyLimiter struct {
+	mutex     sync.Mutex
+	members   map[string]map[string]int64
+	lastSweep int64
+}
+
+func NewMemoryConcurrencyLimiter() *MemoryConcurrencyLimiter {
+	return &MemoryConcurrencyLimiter{
+		members: make(map[string]map[string]int64),
+	}
+}
+
+// Acquire 以 member 占用一个并发名额，ttl 后未释放的名额自动失效
+func (l *MemoryConcurrencyLimiter) Acquire(key string, member string, limit int, ttl time.Duration) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now().Unix()
+	l.sweep(now)
+	members := l.members[key]
+	for m, expireAt := range members {
+		if expireAt <= now {
+			delete(members, m)
+		}
+	}
+	if len(members) >= limit {
+		return false
+	}
+	if members == nil {
+		members = make(map[string]int64)
+		l.members[key] = members
+	}
+	members[member] = now + int64(ttl.Seconds())
+	return true
+}
+
+// Release 释放 member 占用的并发名额
+func (l *MemoryConcurrencyLimiter) Release(key string, member string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	members := l.members[key]
+	delete(members, member)
+	if len(members) == 0 {
+		delete(l.members, key)
+	}
+}
+
+func (l *MemoryConcurrencyLimiter) sweep(now int64) {
+	if now-l.lastSweep < memorySweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, members := range l.members {
+		for m, expireAt := range members {
+			if expireAt <= now {
+				delete(members, m)
+			}
+		}
+		if len(members) == 0 {
+			delete(l.members, key)
+		}
+	}
+}
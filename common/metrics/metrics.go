@@ -0,0 +1,160 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "newapi"
+
+// 首字时间与请求耗时的分桶，覆盖从几百毫秒到长时间推理的范围
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 20, 30, 60, 120, 300}
+
+var registry = prometheus.NewRegistry()
+
+var (
+	relayRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_requests_total",
+		Help:      "Relay attempts sent to upstream channels.",
+	}, []string{"relay_format", "model", "group", "channel_id", "status"})
+
+	relayDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "relay_request_duration_seconds",
+		Help:      "Duration of relay attempts.",
+		Buckets:   latencyBuckets,
+	}, []string{"relay_format", "model", "group", "channel_id"})
+
+	relayTTFT = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "relay_time_to_first_token_seconds",
+		Help:      "Time to first response chunk of streaming relay attempts.",
+		Buckets:   latencyBuckets,
+	}, []string{"relay_format", "model", "group", "channel_id"})
+
+	upstreamErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_upstream_errors_total",
+		Help:      "Failed relay attempts by error code and status code.",
+	}, []string{"channel_id", "model", "error_code", "status_code"})
+
+	relayRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_retries_total",
+		Help:      "Retries performed on other channels after a failed attempt.",
+	}, []string{"relay_format", "model", "group"})
+
+	quotaConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "quota_consumed_total",
+		Help:      "Quota consumed by relay requests.",
+	}, []string{"model", "group", "channel_id"})
+
+	tokensConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_consumed_total",
+		Help:      "Tokens consumed by relay requests.",
+	}, []string{"model", "group", "type"})
+
+	channelAutoDisabled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "channel_auto_disabled_total",
+		Help:      "Channels disabled automatically after upstream errors.",
+	}, []string{"channel_id"})
+
+	cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Cache lookups by cache name and result.",
+	}, []string{"cache", "result"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		relayRequests,
+		relayDuration,
+		relayTTFT,
+		upstreamErrors,
+		relayRetries,
+		quotaConsumed,
+		tokensConsumed,
+		channelAutoDisabled,
+		cacheRequests,
+	)
+}
+
+// MustRegister 注册其他模块提供的指标
+func MustRegister(cs ...prometheus.Collector) {
+	registry.MustRegister(cs...)
+}
+
+// Handler 以 Prometheus 文本格式输出所有指标
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRelay 记录一次渠道请求的结果、耗时与首字时间，ttft 为 0 表示非流式或未收到响应
+func ObserveRelay(relayFormat string, model string, group string, channelId int, success bool, duration time.Duration, ttft time.Duration) {
+	channel := strconv.Itoa(channelId)
+	status := "success"
+	if !success {
+		status = "error"
+	}
+	relayRequests.WithLabelValues(relayFormat, model, group, channel, status).Inc()
+	relayDuration.WithLabelValues(relayFormat, model, group, channel).Observe(duration.Seconds())
+	if ttft > 0 {
+		relayTTFT.WithLabelValues(relayFormat, model, group, channel).Observe(ttft.Seconds())
+	}
+}
+
+func RecordUpstreamError(channelId int, model string, errorCode string, statusCode int) {
+	upstreamErrors.WithLabelValues(strconv.Itoa(channelId), model, errorCode, strconv.Itoa(statusCode)).Inc()
+}
+
+func RecordRetries(relayFormat string, model string, group string, retries int) {
+	if retries > 0 {
+		relayRetries.WithLabelValues(relayFormat, model, group).Add(float64(retries))
+	}
+}
+
+func RecordConsume(model string, group string, channelId int, quota int, promptTokens int, completionTokens int) {
+	if quota > 0 {
+		quotaConsumed.WithLabelValues(model, group, strconv.Itoa(channelId)).Add(float64(quota))
+	}
+	if promptTokens > 0 {
+		tokensConsumed.WithLabelValues(model, group, "prompt").Add(float64(promptTokens))
+	}
+	if completionTokens > 0 {
+		tokensConsumed.WithLabelValues(model, group, "completion").Add(float64(completionTokens))
+	}
+}
+
+func RecordChannelAutoDisabled(channelId int) {
+	channelAutoDisabled.WithLabelValues(strconv.Itoa(channelId)).Inc()
+}
+
+// RecordCacheResult 记录缓存是否命中，cache 为缓存名称，如 user、token、response，以及数据库的内存缓存 channel、budget
+func RecordCacheResult(cache string, hit bool) {
+	result := "hit"
+	if !hit {
+		result = "miss"
+	}
+	cacheRequests.WithLabelValues(cache, result).Inc()
+}
+
+// RegisterGaugeFunc 注册在采集时才计算取值的指标
+func RegisterGaugeFunc(name string, help string, fn func() float64) {
+	registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, fn))
+}
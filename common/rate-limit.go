@@ -68,3 +68,20 @@ func (l *InMemoryRateLimiter) Request(key string, maxRequestNum int, duration in
 	}
 	return true
 }
+
+// Remaining 返回时间窗口内剩余的请求次数，以及窗口内最早的一次请求移出窗口还需的秒数
+func (l *InMemoryRateLimiter) Remaining(key string, maxRequestNum int, duration int64) (int, int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	queue, ok := l.store[key]
+	if !ok {
+		return maxRequestNum, 0
+	}
+	now := time.Now().Unix()
+	for i, t := range *queue {
+		if now-t < duration {
+			return maxRequestNum - (len(*queue) - i), t + duration - now
+		}
+	}
+	return maxRequestNum, 0
+}
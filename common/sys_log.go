@@ -8,17 +8,29 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// SysLogHook 由 logger 设置，用于按配置的格式与级别输出系统日志，返回 true 表示日志已处理
+var SysLogHook func(level string, msg string) bool
+
 func SysLog(s string) {
+	if SysLogHook != nil && SysLogHook("INFO", s) {
+		return
+	}
 	t := time.Now()
 	_, _ = fmt.Fprintf(gin.DefaultWriter, "[SYS] %v | %s \n", t.Format("2006/01/02 - 15:04:05"), s)
 }
 
 func SysError(s string) {
+	if SysLogHook != nil && SysLogHook("ERR", s) {
+		return
+	}
 	t := time.Now()
 	_, _ = fmt.Fprintf(gin.DefaultErrorWriter, "[SYS] %v | %s \n", t.Format("2006/01/02 - 15:04:05"), s)
 }
 
 func FatalLog(v ...any) {
+	if SysLogHook != nil && SysLogHook("FATAL", fmt.Sprint(v...)) {
+		os.Exit(1)
+	}
 	t := time.Now()
 	_, _ = fmt.Fprintf(gin.DefaultErrorWriter, "[FATAL] %v | %v \n", t.Format("2006/01/02 - 15:04:05"), v)
 	os.Exit(1)
@@ -0,0 +1,135 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/QuantumNous/new-api"
+
+var enabled bool
+
+// Init 在配置了 OTEL_EXPORTER_OTLP_ENDPOINT 或 OTEL_EXPORTER_OTLP_TRACES_ENDPOINT 时开启 OTLP/HTTP 链路导出，
+// 采样率等其他参数使用 OpenTelemetry 的标准环境变量配置，返回的函数用于在退出时导出剩余的 span
+func Init(version string) (func(context.Context) error, error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	ctx := context.Background()
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "new-api"
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(version),
+	))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	enabled = true
+	return provider.Shutdown, nil
+}
+
+func Enabled() bool {
+	return enabled
+}
+
+// Span 包装 trace.Span，结束时恢复请求上下文中的父 span
+type Span struct {
+	span   trace.Span
+	c      *gin.Context
+	parent context.Context
+	once   sync.Once
+}
+
+// Start 以请求上下文中的 span 为父 span 开始一个新的 span，并写回请求上下文，使后续的 span 成为它的子 span
+func Start(c *gin.Context, name string, attrs ...attribute.KeyValue) *Span {
+	if !enabled {
+		return &Span{}
+	}
+	parent := c.Request.Context()
+	ctx, span := otel.Tracer(tracerName).Start(parent, name, trace.WithAttributes(attrs...))
+	c.Request = c.Request.WithContext(ctx)
+	return &Span{span: span, c: c, parent: parent}
+}
+
+// StartServer 从请求头中提取 traceparent，开始请求的根 span
+func StartServer(c *gin.Context, name string, attrs ...attribute.KeyValue) *Span {
+	if !enabled {
+		return &Span{}
+	}
+	ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+	c.Request = c.Request.WithContext(ctx)
+	parent := ctx
+	ctx, span := otel.Tracer(tracerName).Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+	c.Request = c.Request.WithContext(ctx)
+	// 请求的根 span 结束后仍可能异步记录日志，提前保存 trace id
+	common.SetContextKey(c, constant.ContextKeyTraceId, span.SpanContext().TraceID().String())
+	return &Span{span: span, c: c, parent: parent}
+}
+
+func (s *Span) SetAttributes(attrs ...attribute.KeyValue) {
+	if s.span == nil {
+		return
+	}
+	s.span.SetAttributes(attrs...)
+}
+
+// End 结束 span，err 不为空时标记为失败，多次调用只有第一次生效
+func (s *Span) End(err error) {
+	if s.span == nil {
+		return
+	}
+	s.once.Do(func() {
+		if !isNil(err) {
+			s.span.RecordError(err)
+			s.span.SetStatus(codes.Error, err.Error())
+		}
+		s.span.End()
+		s.c.Request = s.c.Request.WithContext(s.parent)
+	})
+}
+
+// TraceID 返回当前请求的 trace id，未开启链路追踪时返回空字符串
+func TraceID(c *gin.Context) string {
+	if !enabled || c == nil {
+		return ""
+	}
+	return common.GetContextKeyString(c, constant.ContextKeyTraceId)
+}
+
+// isNil 避免值为 nil 的具体错误类型被当作非空的 error
+func isNil(err error) bool {
+	if err == nil {
+		return true
+	}
+	v := reflect.ValueOf(err)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
@@ -9,6 +9,7 @@ const (
 
 	ContextKeyOriginalModel    ContextKey = "original_model"
 	ContextKeyRequestStartTime ContextKey = "request_start_time"
+	ContextKeyRelayFormat      ContextKey = "relay_format"
 
 	/* token related keys */
 	ContextKeyTokenUnlimited         ContextKey = "token_unlimited_quota"
@@ -19,6 +20,10 @@ const (
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
 	ContextKeyTokenCrossGroupRetry   ContextKey = "token_cross_group_retry"
+	ContextKeyTokenResponseCache     ContextKey = "token_response_cache"
+	ContextKeyTokenTPMLimit          ContextKey = "token_tpm_limit"
+	ContextKeyTokenConcurrencyLimit  ContextKey = "token_concurrency_limit"
+	ContextKeyTokenOrganizationId    ContextKey = "token_organization_id"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -55,4 +60,32 @@ const (
 	ContextKeyLocalCountTokens ContextKey = "local_count_tokens"
 
 	ContextKeySystemPromptOverride ContextKey = "system_prompt_override"
+
+	/* batch related keys */
+	ContextKeyBatchId ContextKey = "batch_id"
+
+	/* responses related keys */
+	ContextKeyResponsesPreviousId ContextKey = "responses_previous_id"
+	// 上一轮所在对话的 id，本轮沿用
+	ContextKeyResponsesConversationId ContextKey = "responses_conversation_id"
+	// 展开 previous_response_id 之前客户端传入的本轮输入
+	ContextKeyResponsesDeltaInput ContextKey = "responses_delta_input"
+
+	/* session affinity related keys */
+	ContextKeySessionAffinityKey       ContextKey = "session_affinity_key"
+	ContextKeySessionAffinityChannelId ContextKey = "session_affinity_channel_id"
+	ContextKeySessionAffinityKeyIndex  ContextKey = "session_affinity_key_index"
+
+	/* response cache related keys */
+	ContextKeyResponseCacheHit ContextKey = "response_cache_hit"
+
+	/* rate limit related keys */
+	ContextKeyRateLimitReservation ContextKey = "rate_limit_reservation"
+
+	/* body capture related keys */
+	ContextKeyTokenBodyCapture ContextKey = "token_body_capture"
+	ContextKeyLogId            ContextKey = "log_id"
+
+	/* tracing related keys */
+	ContextKeyTraceId ContextKey = "trace_id"
 )
@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+func validateAlertRule(rule *model.AlertRule, userId int) error {
+	if rule.Name == "" {
+		return errors.New("规则名称不能为空")
+	}
+	if !model.IsValidAlertRuleType(rule.Type) {
+		return fmt.Errorf("不支持的告警类型：%s", rule.Type)
+	}
+	switch rule.Type {
+	case model.AlertRuleTypeSpend:
+		if rule.Threshold <= 0 {
+			return errors.New("消费阈值必须大于 0")
+		}
+		if !common.LogConsumeEnabled {
+			return errors.New("消费告警依赖消费日志，请先开启消费日志")
+		}
+	case model.AlertRuleTypeErrorRate:
+		if rule.Threshold <= 0 || rule.Threshold > 100 {
+			return errors.New("错误率阈值必须在 0 到 100 之间")
+		}
+		// 失败请求只记录在错误日志中，未开启时错误率始终为 0
+		if !constant.ErrorLogEnabled || !common.LogConsumeEnabled {
+			return errors.New("错误率告警依赖错误日志与消费日志，请先设置环境变量 ERROR_LOG_ENABLED=true 并开启消费日志")
+		}
+	}
+	if rule.WindowMinutes <= 0 {
+		rule.WindowMinutes = 60
+	}
+	if rule.WindowMinutes > 7*24*60 {
+		return errors.New("统计窗口不能超过 7 天")
+	}
+	if rule.MinRequests <= 0 {
+		rule.MinRequests = 10
+	}
+	if rule.DedupMinutes < 0 {
+		return errors.New("去重窗口不能为负数")
+	}
+	if rule.TokenId != 0 {
+		if _, err := model.GetTokenByIds(rule.TokenId, userId); err != nil {
+			return errors.New("令牌不存在")
+		}
+	}
+	if rule.Channels != "" {
+		var channels []model.AlertChannel
+		if err := common.UnmarshalJsonStr(rule.Channels, &channels); err != nil {
+			return errors.New("告警渠道格式错误")
+		}
+		for _, channel := range channels {
+			if err := service.ValidateAlertChannel(channel); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func GetSelfAlertRules(c *gin.Context) {
+	rules, err := model.GetUserAlertRules(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, rules)
+}
+
+func AddAlertRule(c *gin.Context) {
+	userId := c.GetInt("id")
+	var rule model.AlertRule
+	if err := common.DecodeJson(c.Request.Body, &rule); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	count, err := model.CountUserAlertRules(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if maxRules := operation_setting.GetAlertSetting().MaxRulesPerUser; maxRules > 0 && count >= int64(maxRules) {
+		common.ApiErrorMsg(c, fmt.Sprintf("告警规则数量不能超过 %d 条", maxRules))
+		return
+	}
+	if err = validateAlertRule(&rule, userId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	rule.Id = 0
+	rule.UserId = userId
+	rule.LastTriggeredAt = 0
+	if err = rule.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.InvalidateAlertRuleCache()
+	common.ApiSuccess(c, rule)
+}
+
+func UpdateAlertRule(c *gin.Context) {
+	userId := c.GetInt("id")
+	var rule model.AlertRule
+	if err := common.DecodeJson(c.Request.Body, &rule); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if _, err := model.GetUserAlertRuleById(rule.Id, userId); err != nil {
+		common.ApiErrorMsg(c, "告警规则不存在")
+		return
+	}
+	if err := validateAlertRule(&rule, userId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	rule.UserId = userId
+	if err := rule.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.InvalidateAlertRuleCache()
+	common.ApiSuccess(c, rule)
+}
+
+func DeleteAlertRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err = model.DeleteUserAlertRule(id, c.GetInt("id")); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.InvalidateAlertRuleCache()
+	common.ApiSuccess(c, nil)
+}
+
+// TestAlertRule 向规则配置的渠道发送测试消息
+func TestAlertRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	rule, err := model.GetUserAlertRuleById(id, c.GetInt("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "告警规则不存在")
+		return
+	}
+	if err = service.TestAlertRule(rule); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetSelfAlertEvents(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	events, total, err := model.GetUserAlertEvents(c.GetInt("id"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(events)
+	common.ApiSuccess(c, pageInfo)
+}
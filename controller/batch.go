@@ -0,0 +1,498 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const batchCompletionWindow = "24h"
+
+func checkBatchApiEnabled(c *gin.Context) bool {
+	if !operation_setting.GetBatchSetting().Enabled || !system_setting.GetFileSetting().Enabled {
+		RelayNotImplemented(c)
+		return false
+	}
+	return true
+}
+
+func getUserBatchByParam(c *gin.Context) (*model.Batch, bool) {
+	batchId := c.Param("id")
+	batch, err := model.GetUserBatchByBatchId(c.GetInt("id"), batchId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fileApiError(c, http.StatusNotFound, "batch_not_found", "No such Batch object: "+batchId)
+		} else {
+			fileApiError(c, http.StatusInternalServerError, "get_batch_failed", err.Error())
+		}
+		return nil, false
+	}
+	return batch, true
+}
+
+func CreateBatch(c *gin.Context) {
+	if !checkBatchApiEnabled(c) {
+		return
+	}
+	var req dto.OpenAIBatchCreateRequest
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		fileApiError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if _, ok := service.GetBatchRelayFormat(req.Endpoint); !ok {
+		fileApiError(c, http.StatusBadRequest, "invalid_endpoint", "unsupported batch endpoint: "+req.Endpoint)
+		return
+	}
+	if req.CompletionWindow != batchCompletionWindow {
+		fileApiError(c, http.StatusBadRequest, "invalid_completion_window", "completion_window must be "+batchCompletionWindow)
+		return
+	}
+	userId := c.GetInt("id")
+	inputFile, err := model.GetUserFileByFileId(userId, req.InputFileId)
+	if err != nil {
+		fileApiError(c, http.StatusBadRequest, "invalid_input_file", "No such File object: "+req.InputFileId)
+		return
+	}
+	if inputFile.Purpose != service.BatchFilePurpose {
+		fileApiError(c, http.StatusBadRequest, "invalid_input_file", "input file purpose must be "+service.BatchFilePurpose)
+		return
+	}
+
+	maxRequests := operation_setting.GetBatchSetting().MaxRequests
+	total := 0
+	err = service.ScanBatchInput(c.Request.Context(), inputFile, req.Endpoint, func(lineNo int, line *dto.OpenAIBatchInputLine) error {
+		total++
+		if maxRequests > 0 && total > maxRequests {
+			return fmt.Errorf("batch exceeds the maximum of %d requests", maxRequests)
+		}
+		return nil
+	})
+	if err == nil && total == 0 {
+		err = errors.New("input file is empty")
+	}
+	if err != nil {
+		fileApiError(c, http.StatusBadRequest, "invalid_input_file", err.Error())
+		return
+	}
+
+	batch := &model.Batch{
+		BatchId:          "batch_" + common.GetRandomString(24),
+		UserId:           userId,
+		TokenId:          c.GetInt("token_id"),
+		Endpoint:         req.Endpoint,
+		InputFileId:      req.InputFileId,
+		CompletionWindow: req.CompletionWindow,
+		Status:           model.BatchStatusValidating,
+		TotalCount:       total,
+		CreatedAt:        common.GetTimestamp(),
+	}
+	batch.ExpiresAt = batch.CreatedAt + int64((24 * time.Hour).Seconds())
+	if len(req.Metadata) > 0 {
+		metadata, _ := common.Marshal(req.Metadata)
+		batch.Metadata = string(metadata)
+	}
+	if err = batch.Insert(); err != nil {
+		fileApiError(c, http.StatusInternalServerError, "create_batch_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, service.BatchToOpenAIBatch(batch))
+}
+
+func ListBatches(c *gin.Context) {
+	if !checkBatchApiEnabled(c) {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	batches, hasMore, err := model.GetUserBatches(c.GetInt("id"), c.Query("after"), limit)
+	if err != nil {
+		fileApiError(c, http.StatusInternalServerError, "list_batches_failed", err.Error())
+		return
+	}
+	list := dto.OpenAIBatchList{
+		Object:  "list",
+		Data:    make([]dto.OpenAIBatch, 0, len(batches)),
+		HasMore: hasMore,
+	}
+	for _, batch := range batches {
+		list.Data = append(list.Data, service.BatchToOpenAIBatch(batch))
+	}
+	if len(list.Data) > 0 {
+		list.FirstID = list.Data[0].ID
+		list.LastID = list.Data[len(list.Data)-1].ID
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func RetrieveBatch(c *gin.Context) {
+	if !checkBatchApiEnabled(c) {
+		return
+	}
+	batch, ok := getUserBatchByParam(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, service.BatchToOpenAIBatch(batch))
+}
+
+func CancelBatch(c *gin.Context) {
+	if !checkBatchApiEnabled(c) {
+		return
+	}
+	batch, ok := getUserBatchByParam(c)
+	if !ok {
+		return
+	}
+	if batch.Status != model.BatchStatusValidating && batch.Status != model.BatchStatusInProgress {
+		fileApiError(c, http.StatusConflict, "invalid_batch_status", "Cannot cancel a batch with status "+batch.Status)
+		return
+	}
+	if err := model.CancelBatch(batch); err != nil {
+		fileApiError(c, http.StatusInternalServerError, "cancel_batch_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, service.BatchToOpenAIBatch(batch))
+}
+
+var runningBatchCount atomic.Int32
+
+// StartBatchWorker 在主节点上轮询并执行批处理任务
+func StartBatchWorker() {
+	// 服务重启前未执行完的任务从已保存的结果处继续执行
+	interrupted, err := model.GetInterruptedBatches()
+	if err != nil {
+		common.SysError("failed to get interrupted batches: " + err.Error())
+	}
+	for _, batch := range interrupted {
+		common.SysLog(fmt.Sprintf("resuming interrupted batch %s", batch.BatchId))
+		startBatch(batch)
+	}
+	for {
+		time.Sleep(5 * time.Second)
+		batchSetting := operation_setting.GetBatchSetting()
+		if !batchSetting.Enabled {
+			continue
+		}
+		free := batchSetting.MaxRunningBatches - int(runningBatchCount.Load())
+		if free <= 0 {
+			continue
+		}
+		batches, err := model.GetPendingBatches(free)
+		if err != nil {
+			common.SysError("failed to get pending batches: " + err.Error())
+			continue
+		}
+		for _, batch := range batches {
+			claimed, err := model.ClaimBatch(batch)
+			if err != nil {
+				common.SysError("failed to claim batch: " + err.Error())
+				continue
+			}
+			if !claimed {
+				continue
+			}
+			startBatch(batch)
+		}
+	}
+}
+
+func startBatch(batch *model.Batch) {
+	runningBatchCount.Add(1)
+	gopool.Go(func() {
+		defer runningBatchCount.Add(-1)
+		runBatch(batch)
+	})
+}
+
+// batchResultWriter 将批处理结果逐行保存到数据库，服务重启后据此跳过已执行的行
+type batchResultWriter struct {
+	mu        sync.Mutex
+	batchId   int
+	completed int
+	failed    int
+}
+
+func (w *batchResultWriter) write(lineNo int, line *dto.OpenAIBatchOutputLine, success bool) {
+	data, err := common.Marshal(line)
+	if err != nil {
+		return
+	}
+	result := &model.BatchResult{
+		BatchId: w.batchId,
+		LineNo:  lineNo,
+		Success: success,
+		Result:  string(data),
+	}
+	if err = result.Insert(); err != nil {
+		common.SysError(fmt.Sprintf("failed to save batch result of line %d: %s", lineNo, err.Error()))
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if success {
+		w.completed++
+	} else {
+		w.failed++
+	}
+}
+
+func (w *batchResultWriter) counts() (int, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.completed, w.failed
+}
+
+func failBatch(batch *model.Batch, err error) {
+	batch.Status = model.BatchStatusFailed
+	batch.FailedAt = common.GetTimestamp()
+	batch.Errors = err.Error()
+	if updateErr := batch.Update(); updateErr != nil {
+		common.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.BatchId, updateErr.Error()))
+	}
+	_ = model.DeleteBatchResults(batch.Id)
+}
+
+func runBatch(batch *model.Batch) {
+	ctx := context.Background()
+	inputFile, err := model.GetUserFileByFileId(batch.UserId, batch.InputFileId)
+	if err != nil {
+		failBatch(batch, fmt.Errorf("input file %s not found", batch.InputFileId))
+		return
+	}
+	token, err := model.GetTokenById(batch.TokenId)
+	if err != nil {
+		failBatch(batch, errors.New("batch token not found"))
+		return
+	}
+	relayFormat, _ := service.GetBatchRelayFormat(batch.Endpoint)
+
+	done, err := model.GetBatchResultLines(batch.Id)
+	if err != nil {
+		failBatch(batch, err)
+		return
+	}
+	writer := &batchResultWriter{batchId: batch.Id}
+	writer.completed, writer.failed, err = model.CountBatchResults(batch.Id)
+	if err != nil {
+		failBatch(batch, err)
+		return
+	}
+	engine := newBatchRelayEngine(batch, relayFormat)
+
+	concurrency := operation_setting.GetBatchSetting().Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	finalStatus := model.BatchStatusCompleted
+	lastCheck := time.Now()
+
+	err = service.ScanBatchInput(ctx, inputFile, batch.Endpoint, func(lineNo int, line *dto.OpenAIBatchInputLine) error {
+		if _, ok := done[lineNo]; ok {
+			return nil
+		}
+		// 定期检查取消与过期，并同步进度
+		if time.Since(lastCheck) >= time.Second {
+			lastCheck = time.Now()
+			if common.GetTimestamp() > batch.ExpiresAt {
+				finalStatus = model.BatchStatusExpired
+				return service.ErrBatchStopped
+			}
+			if status, err := model.GetBatchStatus(batch.BatchId); err == nil && status == model.BatchStatusCancelling {
+				finalStatus = model.BatchStatusCancelled
+				return service.ErrBatchStopped
+			}
+			completed, failed := writer.counts()
+			_ = model.UpdateBatchProgress(batch.Id, completed, failed)
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		gopool.Go(func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			result, success := executeBatchRequest(ctx, engine, batch, token.Key, line)
+			writer.write(lineNo, result, success)
+		})
+		return nil
+	})
+	wg.Wait()
+	if err != nil && !errors.Is(err, service.ErrBatchStopped) {
+		failBatch(batch, err)
+		return
+	}
+	if finalStatus == model.BatchStatusCompleted {
+		// 执行期间收到的取消请求
+		if status, err := model.GetBatchStatus(batch.BatchId); err == nil && status == model.BatchStatusCancelling {
+			finalStatus = model.BatchStatusCancelled
+		}
+	}
+
+	batch.CompletedCount, batch.FailedCount = writer.counts()
+	batch.Status = model.BatchStatusFinalizing
+	batch.FinalizingAt = common.GetTimestamp()
+	_ = model.UpdateBatchProgress(batch.Id, batch.CompletedCount, batch.FailedCount)
+
+	if err = saveBatchResultFiles(ctx, batch); err != nil {
+		failBatch(batch, err)
+		return
+	}
+
+	now := common.GetTimestamp()
+	batch.Status = finalStatus
+	switch finalStatus {
+	case model.BatchStatusCompleted:
+		batch.CompletedAt = now
+	case model.BatchStatusCancelled:
+		batch.CancelledAt = now
+		if batch.CancellingAt == 0 {
+			batch.CancellingAt = now
+		}
+	case model.BatchStatusExpired:
+		batch.ExpiredAt = now
+	}
+	if err = batch.Update(); err != nil {
+		common.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.BatchId, err.Error()))
+	}
+	if err = model.DeleteBatchResults(batch.Id); err != nil {
+		common.SysError(fmt.Sprintf("failed to delete results of batch %s: %s", batch.BatchId, err.Error()))
+	}
+}
+
+// saveBatchResultFiles 将已保存的逐行结果导出为输出文件与错误文件
+func saveBatchResultFiles(ctx context.Context, batch *model.Batch) error {
+	output, err := os.CreateTemp("", "batch-output-*.jsonl")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(output.Name())
+	defer output.Close()
+	errOutput, err := os.CreateTemp("", "batch-error-*.jsonl")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(errOutput.Name())
+	defer errOutput.Close()
+
+	err = model.ScanBatchResults(batch.Id, func(result *model.BatchResult) error {
+		target := output
+		if !result.Success {
+			target = errOutput
+		}
+		_, err := target.WriteString(result.Result + "\n")
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read batch results: %w", err)
+	}
+
+	if batch.CompletedCount > 0 {
+		file, err := saveBatchResultFile(ctx, batch, output, batch.BatchId+"_output.jsonl")
+		if err != nil {
+			return fmt.Errorf("failed to save output file: %w", err)
+		}
+		batch.OutputFileId = file.FileId
+	}
+	if batch.FailedCount > 0 {
+		file, err := saveBatchResultFile(ctx, batch, errOutput, batch.BatchId+"_error.jsonl")
+		if err != nil {
+			return fmt.Errorf("failed to save error file: %w", err)
+		}
+		batch.ErrorFileId = file.FileId
+	}
+	return nil
+}
+
+func saveBatchResultFile(ctx context.Context, batch *model.Batch, file *os.File, filename string) (*model.File, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return service.SaveSystemFile(ctx, batch.UserId, batch.TokenId, filename, "application/jsonl", service.BatchOutputFilePurpose, info.Size(), file)
+}
+
+// newBatchRelayEngine 构造与 /v1 路由相同的中间件链，每一行都会重新校验令牌、模型限制与速率限制
+func newBatchRelayEngine(batch *model.Batch, relayFormat types.RelayFormat) *gin.Engine {
+	engine := gin.New()
+	engine.POST(batch.Endpoint,
+		func(c *gin.Context) {
+			requestId := c.GetHeader(common.RequestIdKey)
+			c.Set(common.RequestIdKey, requestId)
+			c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), common.RequestIdKey, requestId))
+			common.SetContextKey(c, constant.ContextKeyBatchId, batch.BatchId)
+			c.Next()
+		},
+		middleware.TokenAuth(),
+		middleware.ModelRequestRateLimit(),
+		middleware.Distribute(),
+		func(c *gin.Context) {
+			Relay(c, relayFormat)
+		},
+	)
+	return engine
+}
+
+// executeBatchRequest 通过与在线请求相同的中间件、分发与重试流程执行批处理中的一行
+func executeBatchRequest(ctx context.Context, engine *gin.Engine, batch *model.Batch, tokenKey string, line *dto.OpenAIBatchInputLine) (*dto.OpenAIBatchOutputLine, bool) {
+	result := &dto.OpenAIBatchOutputLine{
+		ID:       "batch_req_" + common.GetRandomString(24),
+		CustomId: line.CustomId,
+	}
+	requestId := common.GetTimeString() + common.GetRandomString(8)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, batch.Endpoint, bytes.NewReader(line.Body))
+	if err != nil {
+		result.Error = &dto.OpenAIBatchOutputError{Code: "invalid_request", Message: err.Error()}
+		return result, false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sk-"+tokenKey)
+	req.Header.Set(common.RequestIdKey, requestId)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+
+	body := w.Body.Bytes()
+	if !json.Valid(body) {
+		body, _ = common.Marshal(string(body))
+	}
+	result.Response = &dto.OpenAIBatchOutputResponse{
+		StatusCode: w.Code,
+		RequestId:  requestId,
+		Body:       body,
+	}
+	return result, w.Code >= 200 && w.Code < 300
+}
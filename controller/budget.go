@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type budgetRequest struct {
+	ModelName string `json:"model_name"`
+	Period    string `json:"period"`
+	Limit     int    `json:"limit"`
+}
+
+func listBudgets(c *gin.Context, ownerType string, ownerId int) {
+	budgets, err := model.GetBudgetsByOwner(ownerType, ownerId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, budgets)
+}
+
+func addBudget(c *gin.Context, ownerType string, ownerId int) {
+	var req budgetRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !model.IsValidBudgetPeriod(req.Period) {
+		common.ApiErrorMsg(c, "预算周期无效，可选值：daily、weekly、monthly")
+		return
+	}
+	if req.Limit <= 0 {
+		common.ApiErrorMsg(c, "预算额度必须大于 0")
+		return
+	}
+	budget := &model.Budget{
+		OwnerType: ownerType,
+		OwnerId:   ownerId,
+		ModelName: req.ModelName,
+		Period:    req.Period,
+		Limit:     req.Limit,
+	}
+	if err := budget.Insert(); err != nil {
+		common.ApiErrorMsg(c, "创建预算失败，同一模型和周期只能设置一个预算")
+		return
+	}
+	common.ApiSuccess(c, budget)
+}
+
+func updateBudget(c *gin.Context, ownerType string, ownerId int) {
+	budget, err := getBudgetByParam(c, ownerType, ownerId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var req budgetRequest
+	if err = common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Limit <= 0 {
+		common.ApiErrorMsg(c, "预算额度必须大于 0")
+		return
+	}
+	if err = budget.UpdateLimit(req.Limit); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	budget.Limit = req.Limit
+	common.ApiSuccess(c, budget)
+}
+
+func deleteBudget(c *gin.Context, ownerType string, ownerId int) {
+	budget, err := getBudgetByParam(c, ownerType, ownerId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err = budget.Delete(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func getBudgetByParam(c *gin.Context, ownerType string, ownerId int) (*model.Budget, error) {
+	budgetId, err := strconv.Atoi(c.Param("budget_id"))
+	if err != nil {
+		return nil, errors.New("无效的预算 id")
+	}
+	return model.GetBudgetByOwner(budgetId, ownerType, ownerId)
+}
+
+// getOwnTokenId 校验令牌属于当前用户
+func getOwnTokenId(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return 0, false
+	}
+	token, err := model.GetTokenByIds(id, c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return 0, false
+	}
+	return token.Id, true
+}
+
+func GetTokenBudgets(c *gin.Context) {
+	if tokenId, ok := getOwnTokenId(c); ok {
+		listBudgets(c, model.BudgetOwnerToken, tokenId)
+	}
+}
+
+func AddTokenBudget(c *gin.Context) {
+	if tokenId, ok := getOwnTokenId(c); ok {
+		addBudget(c, model.BudgetOwnerToken, tokenId)
+	}
+}
+
+func UpdateTokenBudget(c *gin.Context) {
+	if tokenId, ok := getOwnTokenId(c); ok {
+		updateBudget(c, model.BudgetOwnerToken, tokenId)
+	}
+}
+
+func DeleteTokenBudget(c *gin.Context) {
+	if tokenId, ok := getOwnTokenId(c); ok {
+		deleteBudget(c, model.BudgetOwnerToken, tokenId)
+	}
+}
+
+func GetSelfBudgets(c *gin.Context) {
+	listBudgets(c, model.BudgetOwnerUser, c.GetInt("id"))
+}
+
+func getUserIdParam(c *gin.Context) (int, bool) {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return 0, false
+	}
+	return userId, true
+}
+
+func GetUserBudgets(c *gin.Context) {
+	if userId, ok := getUserIdParam(c); ok {
+		listBudgets(c, model.BudgetOwnerUser, userId)
+	}
+}
+
+func AddUserBudget(c *gin.Context) {
+	if userId, ok := getUserIdParam(c); ok {
+		addBudget(c, model.BudgetOwnerUser, userId)
+	}
+}
+
+func UpdateUserBudget(c *gin.Context) {
+	if userId, ok := getUserIdParam(c); ok {
+		updateBudget(c, model.BudgetOwnerUser, userId)
+	}
+}
+
+func DeleteUserBudget(c *gin.Context) {
+	if userId, ok := getUserIdParam(c); ok {
+		deleteBudget(c, model.BudgetOwnerUser, userId)
+	}
+}
@@ -435,6 +435,23 @@ func GetChannel(c *gin.Context) {
 	return
 }
 
+// GetChannelStats 获取当前节点上各渠道、模型的实时统计（延迟、首字时间、错误率、在途请求数）
+func GetChannelStats(c *gin.Context) {
+	common.ApiSuccess(c, model.GetAllChannelModelStats())
+}
+
+// GetChannelCircuitBreakers 获取当前节点上处于熔断、半开或有连续失败记录的熔断器
+func GetChannelCircuitBreakers(c *gin.Context) {
+	common.ApiSuccess(c, model.GetAllChannelCircuits())
+}
+
+// ResetChannelCircuitBreakers 重置熔断器，channel_id 为空时重置全部
+func ResetChannelCircuitBreakers(c *gin.Context) {
+	channelId, _ := strconv.Atoi(c.Query("channel_id"))
+	model.ResetChannelCircuits(channelId)
+	common.ApiSuccess(c, nil)
+}
+
 // GetChannelKey 获取渠道密钥（需要通过安全验证中间件）
 // 此函数依赖 SecureVerificationRequired 中间件，确保用户已通过安全验证
 func GetChannelKey(c *gin.Context) {
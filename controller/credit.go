@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type updateUserCreditRequest struct {
+	CreditLimit int `json:"credit_limit"`
+	GraceDays   int `json:"grace_days"`
+	Status      int `json:"status"`
+}
+
+type generateCreditSettlementsRequest struct {
+	Year  int `json:"year"`
+	Month int `json:"month"`
+}
+
+func listCreditSettlements(c *gin.Context, userId int) {
+	pageInfo := common.GetPageQuery(c)
+	settlements, total, err := model.GetCreditSettlements(userId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(settlements)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetSelfCredit 返回当前用户的信用额度，预付费用户返回 null
+func GetSelfCredit(c *gin.Context) {
+	credit, err := model.GetUserCredit(c.GetInt("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			common.ApiSuccess(c, nil)
+			return
+		}
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, credit)
+}
+
+func GetSelfCreditSettlements(c *gin.Context) {
+	listCreditSettlements(c, c.GetInt("id"))
+}
+
+func GetAllUserCredits(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	credits, total, err := model.GetAllUserCredits(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(credits)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// UpdateUserCredit 将用户设为后付费或修改其信用额度
+func UpdateUserCredit(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var req updateUserCreditRequest
+	if err = common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.CreditLimit < 0 || req.GraceDays < 0 {
+		common.ApiErrorMsg(c, "信用额度与宽限期不能为负数")
+		return
+	}
+	if req.Status != 0 && req.Status != model.UserCreditStatusActive && req.Status != model.UserCreditStatusSuspended {
+		common.ApiErrorMsg(c, "无效的状态")
+		return
+	}
+	if _, err = model.GetUserById(userId, false); err != nil {
+		common.ApiErrorMsg(c, "用户不存在")
+		return
+	}
+	credit := &model.UserCredit{
+		UserId:      userId,
+		CreditLimit: req.CreditLimit,
+		GraceDays:   req.GraceDays,
+		Status:      req.Status,
+	}
+	if err = model.SaveUserCredit(credit); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(userId, model.LogTypeManage, "管理员设置后付费信用额度为 "+logger.LogQuota(req.CreditLimit))
+	common.ApiSuccess(c, credit)
+}
+
+// DeleteUserCredit 将用户恢复为预付费
+func DeleteUserCredit(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err = model.DeleteUserCredit(userId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(userId, model.LogTypeManage, "管理员将用户恢复为预付费")
+	common.ApiSuccess(c, nil)
+}
+
+func GetAllCreditSettlements(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	listCreditSettlements(c, userId)
+}
+
+// GenerateCreditSettlements 手动生成某月的结算单，默认为上月
+func GenerateCreditSettlements(c *gin.Context) {
+	var req generateCreditSettlementsRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Year == 0 || req.Month < 1 || req.Month > 12 {
+		lastMonth := time.Now().AddDate(0, -1, 0)
+		req.Year, req.Month = lastMonth.Year(), int(lastMonth.Month())
+	}
+	count, err := service.GenerateCreditSettlements(req.Year, time.Month(req.Month))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, count)
+}
+
+// SettleCreditSettlement 确认结算单已线下付款
+func SettleCreditSettlement(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	settlement, err := model.GetCreditSettlementById(id)
+	if err != nil {
+		common.ApiErrorMsg(c, "结算单不存在")
+		return
+	}
+	if err = service.SettleCreditSettlement(settlement); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
@@ -0,0 +1,320 @@
+package controller
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	exportFormatCSV   = "csv"
+	exportFormatJSONL = "jsonl"
+)
+
+// exportWriter 以 CSV 或 JSONL 格式逐行写出导出内容
+type exportWriter struct {
+	c       *gin.Context
+	format  string
+	columns []string
+	csv     *csv.Writer
+}
+
+func newExportWriter(c *gin.Context, name string, format string, columns []string) (*exportWriter, error) {
+	w := &exportWriter{c: c, format: format, columns: columns}
+	filename := fmt.Sprintf("%s-%s.%s", name, time.Now().Format("20060102150405"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Cache-Control", "no-cache")
+	switch format {
+	case exportFormatCSV:
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		// 写入 BOM，使 Excel 能正确识别 UTF-8 编码
+		if _, err := c.Writer.Write([]byte("\xEF\xBB\xBF")); err != nil {
+			return nil, err
+		}
+		w.csv = csv.NewWriter(c.Writer)
+		if err := w.csv.Write(columns); err != nil {
+			return nil, err
+		}
+	default:
+		c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+	}
+	return w, nil
+}
+
+func (w *exportWriter) Write(values []any) error {
+	if w.csv != nil {
+		record := make([]string, len(values))
+		for i, value := range values {
+			switch v := value.(type) {
+			case float64:
+				record[i] = strconv.FormatFloat(v, 'f', 6, 64)
+			case string:
+				record[i] = escapeCSVFormula(v)
+			default:
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		return w.csv.Write(record)
+	}
+	row := make(map[string]any, len(values))
+	for i, value := range values {
+		row[w.columns[i]] = value
+	}
+	data, err := common.Marshal(row)
+	if err != nil {
+		return err
+	}
+	_, err = w.c.Writer.Write(append(data, '\n'))
+	return err
+}
+
+// escapeCSVFormula 用户可控的文本以公式字符开头时加上 '，避免在 Excel 中打开时被当作公式执行
+func escapeCSVFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// Flush 每批数据写完后推送给客户端
+func (w *exportWriter) Flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+	w.c.Writer.Flush()
+	return nil
+}
+
+func getExportFormat(c *gin.Context) (string, bool) {
+	format := c.DefaultQuery("format", exportFormatCSV)
+	if format != exportFormatCSV && format != exportFormatJSONL {
+		common.ApiErrorMsg(c, "导出格式无效，可选值：csv、jsonl")
+		return "", false
+	}
+	return format, true
+}
+
+// getExportGroups 解析 group_by 参数，多个维度以逗号分隔
+func getExportGroups(c *gin.Context, allowed ...string) ([]string, bool) {
+	var groups []string
+	for _, group := range strings.Split(c.Query("group_by"), ",") {
+		group = strings.TrimSpace(group)
+		if group == "" {
+			continue
+		}
+		if !model.IsValidExportGroup(group) || (len(allowed) > 0 && !common.StringsContains(allowed, group)) {
+			common.ApiErrorMsg(c, "汇总维度无效："+group)
+			return nil, false
+		}
+		groups = append(groups, group)
+	}
+	return groups, true
+}
+
+func getLogExportFilter(c *gin.Context) *model.LogExportFilter {
+	logType, _ := strconv.Atoi(c.Query("type"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	channel, _ := strconv.Atoi(c.Query("channel"))
+	return &model.LogExportFilter{
+		LogType:        logType,
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+		ModelName:      c.Query("model_name"),
+		Username:       c.Query("username"),
+		TokenName:      c.Query("token_name"),
+		Channel:        channel,
+		Group:          c.Query("group"),
+	}
+}
+
+func formatExportTime(timestamp int64) string {
+	return time.Unix(timestamp, 0).Format("2006-01-02 15:04:05")
+}
+
+// exportLogs 导出日志明细，指定 group_by 时导出汇总
+func exportLogs(c *gin.Context, filter *model.LogExportFilter, groups []string, format string, withChannel bool) {
+	if len(groups) > 0 {
+		// 汇总报表默认只统计消费日志
+		if filter.LogType == model.LogTypeUnknown {
+			filter.LogType = model.LogTypeConsume
+		}
+		summaries, err := model.GetLogUsageSummary(filter, groups)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		writeUsageSummaries(c, "usage-summary", format, groups, summaries)
+		return
+	}
+
+	columns := []string{"id", "time", "type", "username", "token_name", "model_name", "group"}
+	if withChannel {
+		columns = append(columns, "channel_id")
+	}
+	columns = append(columns, "prompt_tokens", "completion_tokens", "quota", "amount", "currency", "use_time", "is_stream", "content")
+	w, err := newExportWriter(c, "usage-logs", format, columns)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	err = model.ExportLogs(filter, func(logs []*model.Log) error {
+		for _, log := range logs {
+			amount, currency := service.QuotaToCurrency(int64(log.Quota))
+			values := []any{log.Id, formatExportTime(log.CreatedAt), log.Type, log.Username, log.TokenName, log.ModelName, log.Group}
+			if withChannel {
+				values = append(values, log.ChannelId)
+			}
+			values = append(values, log.PromptTokens, log.CompletionTokens, log.Quota, amount, currency, log.UseTime, log.IsStream, log.Content)
+			if err := w.Write(values); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	})
+	if err != nil {
+		// 响应已经开始写出，只能记录错误
+		logger.LogError(c, "failed to export logs: "+err.Error())
+	}
+}
+
+func writeUsageSummaries(c *gin.Context, name string, format string, groups []string, summaries []*model.LogUsageSummary) {
+	var columns []string
+	for _, group := range groups {
+		switch group {
+		case model.ExportGroupDay:
+			columns = append(columns, "day")
+		case model.ExportGroupUser:
+			columns = append(columns, "user_id", "username")
+		case model.ExportGroupToken:
+			columns = append(columns, "token_id", "token_name")
+		case model.ExportGroupModel:
+			columns = append(columns, "model_name")
+		case model.ExportGroupChannel:
+			columns = append(columns, "channel_id")
+		}
+	}
+	columns = append(columns, "count", "prompt_tokens", "completion_tokens", "token_used", "quota", "amount", "currency")
+	w, err := newExportWriter(c, name, format, columns)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	for _, summary := range summaries {
+		var values []any
+		for _, group := range groups {
+			switch group {
+			case model.ExportGroupDay:
+				values = append(values, time.Unix(summary.Day, 0).Format("2006-01-02"))
+			case model.ExportGroupUser:
+				values = append(values, summary.UserId, summary.Username)
+			case model.ExportGroupToken:
+				values = append(values, summary.TokenId, summary.TokenName)
+			case model.ExportGroupModel:
+				values = append(values, summary.ModelName)
+			case model.ExportGroupChannel:
+				values = append(values, summary.ChannelId)
+			}
+		}
+		amount, currency := service.QuotaToCurrency(summary.Quota)
+		values = append(values, summary.Count, summary.PromptTokens, summary.CompletionTokens, summary.TokenUsed, summary.Quota, amount, currency)
+		if err = w.Write(values); err != nil {
+			logger.LogError(c, "failed to export usage summary: "+err.Error())
+			return
+		}
+	}
+	if err = w.Flush(); err != nil {
+		logger.LogError(c, "failed to export usage summary: "+err.Error())
+	}
+}
+
+// ExportAllLogs 导出所有用户的日志明细或汇总
+func ExportAllLogs(c *gin.Context) {
+	format, ok := getExportFormat(c)
+	if !ok {
+		return
+	}
+	groups, ok := getExportGroups(c)
+	if !ok {
+		return
+	}
+	exportLogs(c, getLogExportFilter(c), groups, format, true)
+}
+
+// ExportUserLogs 导出当前用户的日志明细或汇总
+func ExportUserLogs(c *gin.Context) {
+	format, ok := getExportFormat(c)
+	if !ok {
+		return
+	}
+	groups, ok := getExportGroups(c, model.ExportGroupDay, model.ExportGroupToken, model.ExportGroupModel)
+	if !ok {
+		return
+	}
+	filter := getLogExportFilter(c)
+	filter.UserId = c.GetInt("id")
+	filter.Username = ""
+	filter.Channel = 0
+	exportLogs(c, filter, groups, format, false)
+}
+
+// ExportAllQuotaDates 从数据看板导出按天、用户、模型汇总的用量
+func ExportAllQuotaDates(c *gin.Context) {
+	format, ok := getExportFormat(c)
+	if !ok {
+		return
+	}
+	groups, ok := getExportGroups(c, model.ExportGroupDay, model.ExportGroupUser, model.ExportGroupModel)
+	if !ok {
+		return
+	}
+	userId := 0
+	if username := c.Query("username"); username != "" {
+		id, err := model.GetUserIdByUsername(username)
+		if err != nil {
+			common.ApiErrorMsg(c, "用户不存在")
+			return
+		}
+		userId = id
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	summaries, err := model.GetQuotaDataSummary(userId, startTimestamp, endTimestamp, groups)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	writeUsageSummaries(c, "quota-data", format, groups, summaries)
+}
+
+// ExportUserQuotaDates 从数据看板导出当前用户按天、模型汇总的用量
+func ExportUserQuotaDates(c *gin.Context) {
+	format, ok := getExportFormat(c)
+	if !ok {
+		return
+	}
+	groups, ok := getExportGroups(c, model.ExportGroupDay, model.ExportGroupModel)
+	if !ok {
+		return
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	summaries, err := model.GetQuotaDataSummary(c.GetInt("id"), startTimestamp, endTimestamp, groups)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	writeUsageSummaries(c, "quota-data", format, groups, summaries)
+}
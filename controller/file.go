@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func fileApiError(c *gin.Context, statusCode int, code string, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": types.OpenAIError{
+			Message: message,
+			Type:    "invalid_request_error",
+			Code:    code,
+		},
+	})
+}
+
+func checkFileApiEnabled(c *gin.Context) bool {
+	if !system_setting.GetFileSetting().Enabled {
+		RelayNotImplemented(c)
+		return false
+	}
+	return true
+}
+
+func getUserFileByParam(c *gin.Context) (*model.File, bool) {
+	fileId := c.Param("id")
+	file, err := model.GetUserFileByFileId(c.GetInt("id"), fileId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fileApiError(c, http.StatusNotFound, "file_not_found", "No such File object: "+fileId)
+		} else {
+			fileApiError(c, http.StatusInternalServerError, "get_file_failed", err.Error())
+		}
+		return nil, false
+	}
+	return file, true
+}
+
+func UploadFile(c *gin.Context) {
+	if !checkFileApiEnabled(c) {
+		return
+	}
+	purpose := c.PostForm("purpose")
+	if purpose == "" {
+		fileApiError(c, http.StatusBadRequest, "invalid_request", "purpose is required")
+		return
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		fileApiError(c, http.StatusBadRequest, "invalid_request", "file is required")
+		return
+	}
+	reader, err := fileHeader.Open()
+	if err != nil {
+		fileApiError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	defer reader.Close()
+
+	mimeType := fileHeader.Header.Get("Content-Type")
+	file, err := service.SaveUserFile(c, fileHeader.Filename, mimeType, purpose, fileHeader.Size, reader)
+	if err != nil {
+		var budgetErr *service.BudgetExceededError
+		switch {
+		case errors.Is(err, service.ErrFileTooLarge), errors.Is(err, service.ErrFileStorageExceeded):
+			fileApiError(c, http.StatusRequestEntityTooLarge, "file_too_large", err.Error())
+		case errors.Is(err, service.ErrFileInsufficientQuota):
+			fileApiError(c, http.StatusForbidden, "insufficient_user_quota", err.Error())
+		case errors.As(err, &budgetErr):
+			fileApiError(c, http.StatusTooManyRequests, "budget_exceeded", err.Error())
+		default:
+			common.SysError("failed to save file: " + err.Error())
+			fileApiError(c, http.StatusInternalServerError, "save_file_failed", "failed to save file")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, service.FileToOpenAIFile(file))
+}
+
+func ListFiles(c *gin.Context) {
+	if !checkFileApiEnabled(c) {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 10000 {
+		limit = 10000
+	}
+	asc := c.Query("order") == "asc"
+	files, hasMore, err := model.GetUserFiles(c.GetInt("id"), c.Query("purpose"), c.Query("after"), limit, asc)
+	if err != nil {
+		fileApiError(c, http.StatusInternalServerError, "list_files_failed", err.Error())
+		return
+	}
+	list := dto.OpenAIFileList{
+		Object:  "list",
+		Data:    make([]dto.OpenAIFile, 0, len(files)),
+		HasMore: hasMore,
+	}
+	for _, file := range files {
+		list.Data = append(list.Data, service.FileToOpenAIFile(file))
+	}
+	if len(list.Data) > 0 {
+		list.FirstID = list.Data[0].ID
+		list.LastID = list.Data[len(list.Data)-1].ID
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func RetrieveFile(c *gin.Context) {
+	if !checkFileApiEnabled(c) {
+		return
+	}
+	file, ok := getUserFileByParam(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, service.FileToOpenAIFile(file))
+}
+
+func DeleteFile(c *gin.Context) {
+	if !checkFileApiEnabled(c) {
+		return
+	}
+	file, ok := getUserFileByParam(c)
+	if !ok {
+		return
+	}
+	if err := service.DeleteUserFile(c.Request.Context(), file); err != nil {
+		common.SysError("failed to delete file: " + err.Error())
+		fileApiError(c, http.StatusInternalServerError, "delete_file_failed", "failed to delete file")
+		return
+	}
+	c.JSON(http.StatusOK, dto.OpenAIFileDeleted{
+		ID:      file.FileId,
+		Object:  "file",
+		Deleted: true,
+	})
+}
+
+func GetFileContent(c *gin.Context) {
+	if !checkFileApiEnabled(c) {
+		return
+	}
+	file, ok := getUserFileByParam(c)
+	if !ok {
+		return
+	}
+	reader, err := service.OpenUserFileContent(c.Request.Context(), file)
+	if err != nil {
+		if errors.Is(err, service.ErrObjectNotFound) {
+			fileApiError(c, http.StatusNotFound, "file_not_found", "file content not found")
+			return
+		}
+		common.SysError("failed to read file content: " + err.Error())
+		fileApiError(c, http.StatusInternalServerError, "read_file_failed", "failed to read file content")
+		return
+	}
+	defer reader.Close()
+	contentType := file.MimeType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Length", strconv.FormatInt(file.Bytes, 10))
+	c.Status(http.StatusOK)
+	_, _ = io.Copy(c.Writer, reader)
+}
@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type generateInvoiceRequest struct {
+	UserId int `json:"user_id"`
+	Year   int `json:"year"`
+	Month  int `json:"month"`
+}
+
+// checkInvoiceEnabled 账单功能关闭时拒绝所有账单接口
+func checkInvoiceEnabled(c *gin.Context) bool {
+	if !operation_setting.GetInvoiceSetting().Enabled {
+		common.ApiErrorMsg(c, "账单功能未开启")
+		return false
+	}
+	return true
+}
+
+func listInvoices(c *gin.Context, userId int) {
+	if !checkInvoiceEnabled(c) {
+		return
+	}
+	pageInfo := common.GetPageQuery(c)
+	invoices, total, err := model.GetInvoices(userId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(invoices)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// downloadInvoice 以 HTML 或 PDF 格式下载账单
+func downloadInvoice(c *gin.Context, invoice *model.Invoice) {
+	switch c.DefaultQuery("format", "html") {
+	case "pdf":
+		data, err := service.RenderInvoicePDF(invoice)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", invoice.Number+".pdf"))
+		c.Data(http.StatusOK, "application/pdf", data)
+	case "html":
+		content, err := service.RenderInvoiceHTML(invoice)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", invoice.Number+".html"))
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(content))
+	default:
+		common.ApiErrorMsg(c, "下载格式无效，可选值：html、pdf")
+	}
+}
+
+func getSelfInvoice(c *gin.Context) (*model.Invoice, bool) {
+	if !checkInvoiceEnabled(c) {
+		return nil, false
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	invoice, err := model.GetUserInvoiceById(id, c.GetInt("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "账单不存在")
+		return nil, false
+	}
+	return invoice, true
+}
+
+func getInvoice(c *gin.Context) (*model.Invoice, bool) {
+	if !checkInvoiceEnabled(c) {
+		return nil, false
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	invoice, err := model.GetInvoiceById(id)
+	if err != nil {
+		common.ApiErrorMsg(c, "账单不存在")
+		return nil, false
+	}
+	return invoice, true
+}
+
+func GetSelfInvoices(c *gin.Context) {
+	listInvoices(c, c.GetInt("id"))
+}
+
+func GetSelfInvoice(c *gin.Context) {
+	if invoice, ok := getSelfInvoice(c); ok {
+		common.ApiSuccess(c, invoice)
+	}
+}
+
+func DownloadSelfInvoice(c *gin.Context) {
+	if invoice, ok := getSelfInvoice(c); ok {
+		downloadInvoice(c, invoice)
+	}
+}
+
+func GetAllInvoices(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	listInvoices(c, userId)
+}
+
+func DownloadInvoice(c *gin.Context) {
+	if invoice, ok := getInvoice(c); ok {
+		downloadInvoice(c, invoice)
+	}
+}
+
+// GenerateInvoices 为指定用户或所有有账目的用户生成某月账单
+func GenerateInvoices(c *gin.Context) {
+	if !checkInvoiceEnabled(c) {
+		return
+	}
+	var req generateInvoiceRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Year == 0 || req.Month < 1 || req.Month > 12 {
+		lastMonth := time.Now().AddDate(0, -1, 0)
+		req.Year, req.Month = lastMonth.Year(), int(lastMonth.Month())
+	}
+	if req.UserId != 0 {
+		invoice, err := service.GenerateInvoice(req.UserId, req.Year, time.Month(req.Month))
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		common.ApiSuccess(c, invoice)
+		return
+	}
+	count, err := service.GenerateMonthlyInvoices(req.Year, time.Month(req.Month))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, count)
+}
+
+// SendInvoiceEmail 重新发送账单邮件
+func SendInvoiceEmail(c *gin.Context) {
+	invoice, ok := getInvoice(c)
+	if !ok {
+		return
+	}
+	if err := service.SendInvoiceEmail(invoice); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
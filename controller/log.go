@@ -6,6 +6,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -167,3 +168,64 @@ func DeleteHistoryLogs(c *gin.Context) {
 	})
 	return
 }
+
+// GetLogBody 按日志 id 或请求 id 查询记录的请求与响应内容
+func GetLogBody(c *gin.Context) {
+	var (
+		body *model.LogBody
+		err  error
+	)
+	if requestId := c.Query("request_id"); requestId != "" {
+		body, err = model.GetLogBodyByRequestId(requestId)
+	} else {
+		logId, _ := strconv.Atoi(c.Query("log_id"))
+		if logId == 0 {
+			common.ApiErrorMsg(c, "请提供日志 id 或请求 id")
+			return
+		}
+		body, err = model.GetLogBodyByLogId(logId)
+	}
+	if err != nil {
+		common.ApiErrorMsg(c, "未找到该请求的记录内容")
+		return
+	}
+	common.ApiSuccess(c, body)
+}
+
+func GetLogArchives(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	logType, _ := strconv.Atoi(c.Query("type"))
+	archives, total, err := model.GetLogArchives(logType, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(archives)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// RunLogArchive 立即执行一次日志归档
+func RunLogArchive(c *gin.Context) {
+	count, err := service.RunLogArchive(c.Request.Context())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, count)
+}
+
+// RestoreLogArchive 将归档中的日志恢复到数据库，恢复期过后自动删除
+func RestoreLogArchive(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	count, err := service.RestoreLogArchive(c.Request.Context(), id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, count)
+}
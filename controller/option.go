@@ -10,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/console_setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/setting/system_setting"
 
@@ -23,6 +24,10 @@ func GetOptions(c *gin.Context) {
 		if strings.HasSuffix(k, "Token") || strings.HasSuffix(k, "Secret") || strings.HasSuffix(k, "Key") {
 			continue
 		}
+		// 配置管理器中的密钥字段，如 file_setting.s3_secret_access_key
+		if strings.HasSuffix(k, "_secret_access_key") || strings.HasSuffix(k, ".token") {
+			continue
+		}
 		options = append(options, &model.Option{
 			Key:   k,
 			Value: common.Interface2String(v),
@@ -87,6 +92,14 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "metrics_setting.enabled":
+		if option.Value == "true" && operation_setting.GetMetricsSetting().Token == "" {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无法启用指标接口，请先填入采集令牌！",
+			})
+			return
+		}
 	case "LinuxDOOAuthEnabled":
 		if option.Value == "true" && common.LinuxDOClientId == "" {
 			c.JSON(http.StatusOK, gin.H{
@@ -200,6 +213,24 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "circuit_breaker_setting.failure_threshold", "circuit_breaker_setting.half_open_requests", "circuit_breaker_setting.cooldown_seconds":
+		err = operation_setting.ValidateCircuitBreakerOption(option.Key, option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "log_archive_setting.retention_days":
+		err = operation_setting.ValidateLogArchiveRetentionDays(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	case "console_setting.uptime_kuma_groups":
 		err = console_setting.ValidateConsoleSettings(option.Value.(string), "UptimeKumaGroups")
 		if err != nil {
@@ -0,0 +1,407 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type organizationRequest struct {
+	Name string `json:"name"`
+}
+
+type organizationMemberRequest struct {
+	Username   string `json:"username"`
+	Role       string `json:"role"`
+	QuotaLimit int    `json:"quota_limit"`
+}
+
+type organizationQuotaRequest struct {
+	Quota int `json:"quota"`
+}
+
+type organizationAdminRequest struct {
+	Group  string `json:"group"`
+	Status int    `json:"status"`
+}
+
+// getOrganizationMembership 返回路径中的组织与当前用户在组织中的成员身份
+func getOrganizationMembership(c *gin.Context) (*model.Organization, *model.OrganizationMember, bool) {
+	orgId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的组织 id")
+		return nil, nil, false
+	}
+	member, err := model.GetOrganizationMember(orgId, c.GetInt("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "你不是该组织的成员")
+		return nil, nil, false
+	}
+	org, err := model.GetOrganizationById(orgId)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, nil, false
+	}
+	return org, member, true
+}
+
+func GetSelfOrganizations(c *gin.Context) {
+	orgs, err := model.GetUserOrganizations(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, orgs)
+}
+
+func CreateOrganization(c *gin.Context) {
+	var req organizationRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 128 {
+		common.ApiErrorMsg(c, "组织名称不能为空且不能超过 128 个字符")
+		return
+	}
+	org := &model.Organization{
+		Name:    req.Name,
+		OwnerId: c.GetInt("id"),
+	}
+	if err := model.CreateOrganization(org); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, org)
+}
+
+func GetOrganization(c *gin.Context) {
+	org, member, ok := getOrganizationMembership(c)
+	if !ok {
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"organization": org,
+		"member":       member,
+	})
+}
+
+func UpdateOrganization(c *gin.Context) {
+	org, member, ok := getOrganizationMembership(c)
+	if !ok {
+		return
+	}
+	if member.Role != model.OrganizationRoleOwner {
+		common.ApiErrorMsg(c, "只有组织所有者可以修改组织信息")
+		return
+	}
+	var req organizationRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 128 {
+		common.ApiErrorMsg(c, "组织名称不能为空且不能超过 128 个字符")
+		return
+	}
+	org.Name = req.Name
+	if err := model.UpdateOrganization(org); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, org)
+}
+
+func DeleteOrganization(c *gin.Context) {
+	org, member, ok := getOrganizationMembership(c)
+	if !ok {
+		return
+	}
+	if member.Role != model.OrganizationRoleOwner {
+		common.ApiErrorMsg(c, "只有组织所有者可以删除组织")
+		return
+	}
+	if org.Quota > 0 {
+		common.ApiErrorMsg(c, "组织额度池仍有剩余额度，无法删除")
+		return
+	}
+	if err := model.DeleteOrganization(org.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetOrganizationMembers(c *gin.Context) {
+	org, _, ok := getOrganizationMembership(c)
+	if !ok {
+		return
+	}
+	members, err := model.GetOrganizationMembers(org.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, members)
+}
+
+// checkAssignRole 只有 owner 可以任命 admin，owner 身份不能通过成员接口授予
+func checkAssignRole(operator *model.OrganizationMember, role string) error {
+	if !model.IsValidOrganizationRole(role) || role == model.OrganizationRoleOwner {
+		return errors.New("无效的成员角色，可选值：admin、member")
+	}
+	if role == model.OrganizationRoleAdmin && operator.Role != model.OrganizationRoleOwner {
+		return errors.New("只有组织所有者可以设置管理员")
+	}
+	return nil
+}
+
+func AddOrganizationMember(c *gin.Context) {
+	org, operator, ok := getOrganizationMembership(c)
+	if !ok {
+		return
+	}
+	if !operator.CanManage() {
+		common.ApiErrorMsg(c, "无权管理组织成员")
+		return
+	}
+	var req organizationMemberRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Role == "" {
+		req.Role = model.OrganizationRoleMember
+	}
+	if err := checkAssignRole(operator, req.Role); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.QuotaLimit < 0 {
+		common.ApiErrorMsg(c, "成员额度上限不能为负数")
+		return
+	}
+	userId, err := model.GetUserIdByUsername(strings.TrimSpace(req.Username))
+	if err != nil {
+		common.ApiErrorMsg(c, "用户不存在")
+		return
+	}
+	member := &model.OrganizationMember{
+		OrganizationId: org.Id,
+		UserId:         userId,
+		Role:           req.Role,
+		QuotaLimit:     req.QuotaLimit,
+	}
+	if err = model.AddOrganizationMember(member); err != nil {
+		common.ApiErrorMsg(c, "添加成员失败，该用户可能已是组织成员")
+		return
+	}
+	member.Username = req.Username
+	common.ApiSuccess(c, member)
+}
+
+// getTargetMember 返回路径中 user_id 对应的组织成员
+func getTargetMember(c *gin.Context, orgId int) (*model.OrganizationMember, bool) {
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的用户 id")
+		return nil, false
+	}
+	member, err := model.GetOrganizationMember(orgId, userId)
+	if err != nil {
+		common.ApiErrorMsg(c, "该用户不是组织成员")
+		return nil, false
+	}
+	return member, true
+}
+
+func UpdateOrganizationMember(c *gin.Context) {
+	org, operator, ok := getOrganizationMembership(c)
+	if !ok {
+		return
+	}
+	if !operator.CanManage() {
+		common.ApiErrorMsg(c, "无权管理组织成员")
+		return
+	}
+	member, ok := getTargetMember(c, org.Id)
+	if !ok {
+		return
+	}
+	if member.Role == model.OrganizationRoleOwner && operator.Role != model.OrganizationRoleOwner {
+		common.ApiErrorMsg(c, "无权修改组织所有者")
+		return
+	}
+	if member.Role == model.OrganizationRoleAdmin && operator.Role != model.OrganizationRoleOwner && member.UserId != operator.UserId {
+		common.ApiErrorMsg(c, "只有组织所有者可以修改管理员")
+		return
+	}
+	var req organizationMemberRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Role != "" && req.Role != member.Role {
+		if member.Role == model.OrganizationRoleOwner {
+			common.ApiErrorMsg(c, "不能修改组织所有者的角色")
+			return
+		}
+		if err := checkAssignRole(operator, req.Role); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		member.Role = req.Role
+	}
+	if req.QuotaLimit < 0 {
+		common.ApiErrorMsg(c, "成员额度上限不能为负数")
+		return
+	}
+	member.QuotaLimit = req.QuotaLimit
+	if err := model.UpdateOrganizationMember(member); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, member)
+}
+
+// RemoveOrganizationMember 管理员移除成员，普通成员可以移除自己以退出组织
+func RemoveOrganizationMember(c *gin.Context) {
+	org, operator, ok := getOrganizationMembership(c)
+	if !ok {
+		return
+	}
+	member, ok := getTargetMember(c, org.Id)
+	if !ok {
+		return
+	}
+	if member.Role == model.OrganizationRoleOwner {
+		common.ApiErrorMsg(c, "不能移除组织所有者")
+		return
+	}
+	if member.UserId != operator.UserId {
+		if !operator.CanManage() {
+			common.ApiErrorMsg(c, "无权管理组织成员")
+			return
+		}
+		if member.Role == model.OrganizationRoleAdmin && operator.Role != model.OrganizationRoleOwner {
+			common.ApiErrorMsg(c, "只有组织所有者可以移除管理员")
+			return
+		}
+	}
+	if err := model.RemoveOrganizationMember(org.Id, member.UserId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// TransferOrganizationQuota 成员将个人额度转入组织额度池
+func TransferOrganizationQuota(c *gin.Context) {
+	org, _, ok := getOrganizationMembership(c)
+	if !ok {
+		return
+	}
+	var req organizationQuotaRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.TransferQuotaToOrganization(c.GetInt("id"), org.Id, req.Quota); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// GetOrganizationLogs 管理员可以查看所有成员的日志，普通成员只能查看自己的日志
+func GetOrganizationLogs(c *gin.Context) {
+	org, member, ok := getOrganizationMembership(c)
+	if !ok {
+		return
+	}
+	userId := member.UserId
+	if member.CanManage() {
+		userId, _ = strconv.Atoi(c.Query("user_id"))
+	}
+	pageInfo := common.GetPageQuery(c)
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	modelName := c.Query("model_name")
+	logs, total, err := model.GetOrganizationLogs(org.Id, userId, startTimestamp, endTimestamp, modelName, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(logs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetAllOrganizations(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	orgs, total, err := model.GetAllOrganizations(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(orgs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// AdminUpdateOrganization 管理员设置组织可用的分组与状态
+func AdminUpdateOrganization(c *gin.Context) {
+	orgId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的组织 id")
+		return
+	}
+	org, err := model.GetOrganizationById(orgId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var req organizationAdminRequest
+	if err = common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	org.Group = req.Group
+	if req.Status == model.OrganizationStatusEnabled || req.Status == model.OrganizationStatusDisabled {
+		org.Status = req.Status
+	}
+	if err = model.UpdateOrganization(org); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, org)
+}
+
+// AdminAdjustOrganizationQuota 管理员增减组织额度池
+func AdminAdjustOrganizationQuota(c *gin.Context) {
+	orgId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的组织 id")
+		return
+	}
+	var req organizationQuotaRequest
+	if err = common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err = model.AdjustOrganizationQuota(orgId, req.Quota); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(c.GetInt("id"), model.LogTypeManage, fmt.Sprintf("管理员调整组织 %d 额度 %s", orgId, logger.LogQuota(req.Quota)))
+	common.ApiSuccess(c, nil)
+}
@@ -8,8 +8,11 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/metrics"
+	"github.com/QuantumNous/new-api/common/tracing"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
@@ -27,6 +30,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func relayHandler(c *gin.Context, info *relaycommon.RelayInfo) *types.NewAPIError {
@@ -83,6 +87,10 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		defer ws.Close()
 	}
 
+	// 在输出错误信息的 defer 之前注册，使错误响应也能被记录
+	bodyCapture := service.StartBodyCapture(c, relayFormat)
+	defer service.FinishBodyCapture(c, bodyCapture)
+
 	defer func() {
 		if newAPIError != nil {
 			logger.LogError(c, fmt.Sprintf("relay error: %s", newAPIError.Error()))
@@ -103,7 +111,9 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 	}()
 
+	parseSpan := tracing.Start(c, "relay.parse_request")
 	request, err := helper.GetAndValidateRequest(c, relayFormat)
+	parseSpan.End(err)
 	if err != nil {
 		// Map "request body too large" to 413 so clients can handle it correctly
 		if common.IsRequestBodyTooLargeError(err) || errors.Is(err, common.ErrRequestBodyTooLarge) {
@@ -114,6 +124,20 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		return
 	}
 
+	if err = service.ResolveStoredFileReferences(c, request); err != nil {
+		if errors.Is(err, service.ErrFileInlineTooLarge) {
+			newAPIError = types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusRequestEntityTooLarge, types.ErrOptionWithSkipRetry())
+		} else {
+			newAPIError = types.NewError(err, types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+		}
+		return
+	}
+
+	if err = service.ExpandPreviousResponse(c, request); err != nil {
+		newAPIError = types.NewError(err, types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+		return
+	}
+
 	relayInfo, err := relaycommon.GenRelayInfo(c, relayFormat, request, ws)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeGenRelayInfoFailed)
@@ -139,7 +163,10 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 	}
 
+	estimateSpan := tracing.Start(c, "relay.estimate_tokens")
 	tokens, err := service.EstimateRequestToken(c, meta, relayInfo)
+	estimateSpan.SetAttributes(attribute.Int("prompt_tokens", tokens))
+	estimateSpan.End(err)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeCountTokenFailed)
 		return
@@ -147,6 +174,12 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	relayInfo.SetEstimatePromptTokens(tokens)
 
+	newAPIError = service.CheckTokenRateLimit(c, relayInfo, tokens)
+	if newAPIError != nil {
+		return
+	}
+	defer service.ReleaseTokenRateLimit(c)
+
 	priceData, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeModelPriceError)
@@ -158,7 +191,9 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	if priceData.FreeModel {
 		logger.LogInfo(c, fmt.Sprintf("模型 %s 免费，跳过预扣费", relayInfo.OriginModelName))
 	} else {
+		preConsumeSpan := tracing.Start(c, "relay.pre_consume_quota")
 		newAPIError = service.PreConsumeQuota(c, priceData.QuotaToPreConsume, relayInfo)
+		preConsumeSpan.End(newAPIError)
 		if newAPIError != nil {
 			return
 		}
@@ -199,18 +234,19 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
 
-		switch relayFormat {
-		case types.RelayFormatOpenAIRealtime:
-			newAPIError = relay.WssHelper(c, relayInfo)
-		case types.RelayFormatClaude:
-			newAPIError = relay.ClaudeHelper(c, relayInfo)
-		case types.RelayFormatGemini:
-			newAPIError = geminiRelayHandler(c, relayInfo)
-		default:
-			newAPIError = relayHandler(c, relayInfo)
-		}
+		keyIndex := getChannelKeyIndex(c)
+		attemptSpan := tracing.Start(c, "relay.attempt",
+			attribute.Int("retry", retryParam.GetRetry()),
+			attribute.Int("channel.id", channel.Id),
+			attribute.Int("channel.type", channel.Type),
+			attribute.Int("channel.key_index", keyIndex),
+			attribute.String("group", relayInfo.UsingGroup),
+		)
+		newAPIError = relayChannelAttempt(c, relayFormat, relayInfo, channel.Id, keyIndex)
+		attemptSpan.End(newAPIError)
 
 		if newAPIError == nil {
+			service.RecordSessionAffinity(c, channel.Id, keyIndex, relayInfo.UsingGroup)
 			return
 		}
 
@@ -223,6 +259,7 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	useChannel := c.GetStringSlice("use_channel")
 	if len(useChannel) > 1 {
+		metrics.RecordRetries(string(relayInfo.RelayFormat), relayInfo.OriginModelName, relayInfo.UsingGroup, len(useChannel)-1)
 		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
 		logger.LogInfo(c, retryLogStr)
 	}
@@ -241,6 +278,68 @@ func addUsedChannel(c *gin.Context, channelId int) {
 	c.Set("use_channel", useChannel)
 }
 
+func getChannelKeyIndex(c *gin.Context) int {
+	if common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) {
+		return common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
+	}
+	return 0
+}
+
+// relayChannelAttempt 向选中的渠道发起一次请求并记录结果，处理过程中发生 panic 时同样释放在途请求计数和熔断探测名额
+func relayChannelAttempt(c *gin.Context, relayFormat types.RelayFormat, relayInfo *relaycommon.RelayInfo, channelId int, keyIndex int) (newAPIError *types.NewAPIError) {
+	// 选择渠道之后其他请求可能已占满半开探测名额，此时放弃该渠道，由重试选择其他渠道
+	if !model.AcquireChannelCircuit(channelId, relayInfo.OriginModelName, keyIndex) {
+		return types.NewErrorWithStatusCode(fmt.Errorf("channel #%d circuit is open for model %s", channelId, relayInfo.OriginModelName), types.ErrorCodeCircuitOpen, http.StatusServiceUnavailable, types.ErrOptionWithNoRecordErrorLog())
+	}
+	attemptStart := time.Now()
+	model.ChannelStatsBegin(channelId, relayInfo.OriginModelName)
+	recorded := false
+	defer func() {
+		if !recorded {
+			model.ChannelStatsAbort(channelId, relayInfo.OriginModelName)
+			model.ReleaseChannelCircuit(channelId, relayInfo.OriginModelName, keyIndex)
+		}
+	}()
+
+	switch relayFormat {
+	case types.RelayFormatOpenAIRealtime:
+		newAPIError = relay.WssHelper(c, relayInfo)
+	case types.RelayFormatClaude:
+		newAPIError = relay.ClaudeHelper(c, relayInfo)
+	case types.RelayFormatGemini:
+		newAPIError = geminiRelayHandler(c, relayInfo)
+	default:
+		newAPIError = relayHandler(c, relayInfo)
+	}
+
+	// 命中响应缓存时没有请求上游，不计入渠道的耗时统计、熔断与监控指标
+	if common.GetContextKeyBool(c, constant.ContextKeyResponseCacheHit) {
+		return newAPIError
+	}
+	recordChannelResult(relayInfo, channelId, keyIndex, attemptStart, newAPIError)
+	recorded = true
+	return newAPIError
+}
+
+// recordChannelResult 记录本次尝试的耗时、首字时间和结果，供动态渠道选择策略和熔断器使用
+func recordChannelResult(info *relaycommon.RelayInfo, channelId int, keyIndex int, attemptStart time.Time, err *types.NewAPIError) {
+	var ttft time.Duration
+	if info.FirstResponseTime.After(attemptStart) {
+		ttft = info.FirstResponseTime.Sub(attemptStart)
+	}
+	metrics.ObserveRelay(string(info.RelayFormat), info.OriginModelName, info.UsingGroup, channelId, err == nil, time.Since(attemptStart), ttft)
+	if err != nil {
+		metrics.RecordUpstreamError(channelId, info.OriginModelName, string(err.GetErrorCode()), err.StatusCode)
+	}
+	model.RecordChannelCircuitResult(channelId, info.OriginModelName, keyIndex, !service.IsCircuitBreakerFailure(err))
+	if err != nil && types.IsSkipRetryError(err) && !types.IsChannelError(err) {
+		// 请求本身的问题，与渠道健康度无关
+		model.ChannelStatsAbort(channelId, info.OriginModelName)
+		return
+	}
+	model.ChannelStatsEnd(channelId, info.OriginModelName, time.Since(attemptStart), ttft, err == nil)
+}
+
 func fastTokenCountMetaForPricing(request dto.Request) *types.TokenCountMeta {
 	if request == nil {
 		return &types.TokenCountMeta{}
@@ -286,6 +385,9 @@ func getChannel(c *gin.Context, info *relaycommon.RelayInfo, retryParam *service
 
 	info.PriceData.GroupRatioInfo = helper.HandleGroupRatio(c, info)
 
+	if errors.Is(err, model.ErrAllChannelsCircuitOpen) {
+		return nil, types.NewErrorWithStatusCode(fmt.Errorf("分组 %s 下模型 %s 的渠道均已熔断（retry）", selectGroup, info.OriginModelName), types.ErrorCodeCircuitOpen, http.StatusServiceUnavailable, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+	}
 	if err != nil {
 		return nil, types.NewError(fmt.Errorf("获取分组 %s 下模型 %s 的可用渠道失败（retry）: %s", selectGroup, info.OriginModelName, err.Error()), types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
 	}
@@ -378,7 +480,8 @@ func processChannelError(c *gin.Context, channelError types.ChannelError, err *t
 			adminInfo["multi_key_index"] = common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
 		}
 		other["admin_info"] = adminInfo
-		model.RecordErrorLog(c, userId, channelId, modelName, tokenName, err.MaskSensitiveError(), tokenId, 0, false, userGroup, other)
+		logId := model.RecordErrorLog(c, userId, channelId, modelName, tokenName, err.MaskSensitiveError(), tokenId, 0, false, userGroup, other)
+		service.SetBodyCaptureLogId(c, logId)
 	}
 
 }
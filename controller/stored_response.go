@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func getUserStoredResponseByParam(c *gin.Context) (*model.StoredResponse, bool) {
+	if !operation_setting.GetResponsesStoreSetting().Enabled {
+		RelayNotImplemented(c)
+		return nil, false
+	}
+	responseId := c.Param("id")
+	response, err := model.GetUserStoredResponse(c.GetInt("id"), responseId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, model.ErrStoredResponseExpired) {
+			fileApiError(c, http.StatusNotFound, "response_not_found", "Response with id '"+responseId+"' not found.")
+		} else {
+			fileApiError(c, http.StatusInternalServerError, "get_response_failed", err.Error())
+		}
+		return nil, false
+	}
+	return response, true
+}
+
+func RetrieveResponse(c *gin.Context) {
+	response, ok := getUserStoredResponseByParam(c)
+	if !ok {
+		return
+	}
+	c.Data(http.StatusOK, "application/json", response.Response)
+}
+
+func DeleteResponse(c *gin.Context) {
+	response, ok := getUserStoredResponseByParam(c)
+	if !ok {
+		return
+	}
+	if err := response.Delete(); err != nil {
+		fileApiError(c, http.StatusInternalServerError, "delete_response_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      response.ResponseId,
+		"object":  "response",
+		"deleted": true,
+	})
+}
+
+func ListResponseInputItems(c *gin.Context) {
+	response, ok := getUserStoredResponseByParam(c)
+	if !ok {
+		return
+	}
+	items, err := service.GetStoredResponseInputItems(c.GetInt("id"), response)
+	if err != nil {
+		fileApiError(c, http.StatusInternalServerError, "get_response_failed", err.Error())
+		return
+	}
+	if items == nil {
+		items = []json.RawMessage{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object":   "list",
+		"data":     items,
+		"has_more": false,
+	})
+}
+
+// CleanExpiredStoredResponses 定期清理超过保存期限的 response
+func CleanExpiredStoredResponses() {
+	for {
+		if operation_setting.GetResponsesStoreSetting().Enabled {
+			n, err := model.DeleteExpiredStoredResponses()
+			if err != nil {
+				common.SysError("failed to clean expired responses: " + err.Error())
+			} else if n > 0 {
+				common.SysLog(fmt.Sprintf("cleaned %d expired responses", n))
+			}
+		}
+		time.Sleep(time.Hour)
+	}
+}
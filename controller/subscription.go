@@ -0,0 +1,357 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/checkout/session"
+	"github.com/stripe/stripe-go/v81/subscription"
+	"github.com/thanhpk/randstr"
+	"gorm.io/gorm"
+)
+
+type SubscribeRequest struct {
+	PlanId int `json:"plan_id"`
+}
+
+func GetSubscriptionPlans(c *gin.Context) {
+	plans, err := model.GetSubscriptionPlans(true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, plans)
+}
+
+func GetAllSubscriptionPlans(c *gin.Context) {
+	plans, err := model.GetSubscriptionPlans(false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, plans)
+}
+
+func validateSubscriptionPlan(plan *model.SubscriptionPlan) error {
+	if plan.Name == "" {
+		return errors.New("套餐名称不能为空")
+	}
+	if plan.StripePriceId == "" {
+		return errors.New("Stripe 价格 ID 不能为空")
+	}
+	if plan.Quota < 0 {
+		return errors.New("套餐额度不能为负数")
+	}
+	if plan.Group != "" && !ratio_setting.ContainsGroupRatio(plan.Group) {
+		return fmt.Errorf("分组 %s 不存在", plan.Group)
+	}
+	return nil
+}
+
+func AddSubscriptionPlan(c *gin.Context) {
+	var plan model.SubscriptionPlan
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validateSubscriptionPlan(&plan); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	plan.Id = 0
+	if err := plan.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, plan)
+}
+
+func UpdateSubscriptionPlan(c *gin.Context) {
+	var plan model.SubscriptionPlan
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if _, err := model.GetSubscriptionPlanById(plan.Id); err != nil {
+		common.ApiErrorMsg(c, "套餐不存在")
+		return
+	}
+	if err := validateSubscriptionPlan(&plan); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := plan.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, plan)
+}
+
+func DeleteSubscriptionPlan(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err = model.DeleteSubscriptionPlan(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetAllUserSubscriptions(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	pageInfo := common.GetPageQuery(c)
+	subs, total, err := model.GetUserSubscriptions(userId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(subs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// getSelfSubscription 返回用户当前的订阅，没有订阅时返回 nil
+func getSelfSubscription(userId int) (*model.UserSubscription, error) {
+	sub, err := model.GetActiveUserSubscription(userId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return sub, err
+}
+
+func GetSelfSubscription(c *gin.Context) {
+	sub, err := getSelfSubscription(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, sub)
+}
+
+// SubscribeStripe 创建 Stripe 订阅的 Checkout 支付链接
+func SubscribeStripe(c *gin.Context) {
+	var req SubscribeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	plan, err := model.GetSubscriptionPlanById(req.PlanId)
+	if err != nil || !plan.Enabled {
+		common.ApiErrorMsg(c, "套餐不存在")
+		return
+	}
+	id := c.GetInt("id")
+	if sub, err := getSelfSubscription(id); err != nil {
+		common.ApiError(c, err)
+		return
+	} else if sub != nil {
+		common.ApiErrorMsg(c, "已有生效中的订阅，请先取消当前订阅")
+		return
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	payLink, err := genStripeSubscriptionLink(user, plan)
+	if err != nil {
+		log.Println("获取Stripe订阅支付链接失败", err)
+		common.ApiErrorMsg(c, "拉起支付失败")
+		return
+	}
+	common.ApiSuccess(c, gin.H{"pay_link": payLink})
+}
+
+// CancelSelfSubscription 在当前账期结束时取消订阅，账期内仍保留套餐权益
+func CancelSelfSubscription(c *gin.Context) {
+	sub, err := getSelfSubscription(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if sub == nil {
+		common.ApiErrorMsg(c, "当前没有生效中的订阅")
+		return
+	}
+	stripe.Key = setting.StripeApiSecret
+	result, err := subscription.Update(sub.StripeSubscriptionId, &stripe.SubscriptionParams{
+		CancelAtPeriodEnd: stripe.Bool(true),
+	})
+	if err != nil {
+		log.Println("取消Stripe订阅失败", err)
+		common.ApiErrorMsg(c, "取消订阅失败")
+		return
+	}
+	syncStripeSubscription(sub, result)
+	common.ApiSuccess(c, sub)
+}
+
+func genStripeSubscriptionLink(user *model.User, plan *model.SubscriptionPlan) (string, error) {
+	if !strings.HasPrefix(setting.StripeApiSecret, "sk_") && !strings.HasPrefix(setting.StripeApiSecret, "rk_") {
+		return "", fmt.Errorf("无效的Stripe API密钥")
+	}
+	stripe.Key = setting.StripeApiSecret
+
+	reference := fmt.Sprintf("new-api-sub-%d-%d-%s", user.Id, time.Now().UnixMilli(), randstr.String(4))
+	metadata := map[string]string{
+		"user_id": strconv.Itoa(user.Id),
+		"plan_id": strconv.Itoa(plan.Id),
+	}
+	params := &stripe.CheckoutSessionParams{
+		ClientReferenceID: stripe.String("sub_" + common.Sha1([]byte(reference))),
+		SuccessURL:        stripe.String(system_setting.ServerAddress + "/console/topup"),
+		CancelURL:         stripe.String(system_setting.ServerAddress + "/console/topup"),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				Price:    stripe.String(plan.StripePriceId),
+				Quantity: stripe.Int64(1),
+			},
+		},
+		Mode: stripe.String(string(stripe.CheckoutSessionModeSubscription)),
+		SubscriptionData: &stripe.CheckoutSessionSubscriptionDataParams{
+			Metadata: metadata,
+		},
+		AllowPromotionCodes: stripe.Bool(setting.StripePromotionCodesEnabled),
+	}
+	params.Metadata = metadata
+	if user.StripeCustomer != "" {
+		params.Customer = stripe.String(user.StripeCustomer)
+	} else if user.Email != "" {
+		params.CustomerEmail = stripe.String(user.Email)
+	}
+
+	result, err := session.New(params)
+	if err != nil {
+		return "", err
+	}
+	return result.URL, nil
+}
+
+// syncStripeSubscription 将 Stripe 订阅的状态与账期同步到本地记录
+func syncStripeSubscription(sub *model.UserSubscription, stripeSub *stripe.Subscription) {
+	switch stripeSub.Status {
+	case stripe.SubscriptionStatusActive, stripe.SubscriptionStatusTrialing:
+		sub.Status = model.SubscriptionStatusActive
+	case stripe.SubscriptionStatusPastDue, stripe.SubscriptionStatusUnpaid, stripe.SubscriptionStatusIncomplete, stripe.SubscriptionStatusPaused:
+		sub.Status = model.SubscriptionStatusPastDue
+	case stripe.SubscriptionStatusCanceled, stripe.SubscriptionStatusIncompleteExpired:
+		if err := model.CancelUserSubscription(sub); err != nil {
+			log.Println("取消订阅失败", sub.StripeSubscriptionId, err)
+		}
+		return
+	}
+	sub.CurrentPeriodStart = stripeSub.CurrentPeriodStart
+	sub.CurrentPeriodEnd = stripeSub.CurrentPeriodEnd
+	sub.CancelAtPeriodEnd = stripeSub.CancelAtPeriodEnd
+	if err := model.UpdateUserSubscriptionState(sub); err != nil {
+		log.Println("更新订阅状态失败", sub.StripeSubscriptionId, err)
+	}
+}
+
+// subscriptionSessionCompleted 订阅 Checkout 完成后记录用户的 Stripe 客户 ID，额度在 invoice.paid 中发放
+func subscriptionSessionCompleted(event stripe.Event) {
+	userId, _ := strconv.Atoi(event.GetObjectValue("metadata", "user_id"))
+	customerId := event.GetObjectValue("customer")
+	if userId == 0 || customerId == "" {
+		return
+	}
+	if err := model.UpdateUserStripeCustomer(userId, customerId); err != nil {
+		log.Println("更新Stripe客户ID失败", userId, err)
+	}
+}
+
+// subscriptionInvoicePaid 订阅首期或续费付款成功，发放套餐额度并切换分组
+func subscriptionInvoicePaid(event stripe.Event) {
+	var invoice stripe.Invoice
+	if err := common.Unmarshal(event.Data.Raw, &invoice); err != nil {
+		log.Println("解析Stripe账单失败", err)
+		return
+	}
+	if invoice.Subscription == nil || invoice.Subscription.ID == "" {
+		return
+	}
+	sub, err := model.GetUserSubscriptionByStripeId(invoice.Subscription.ID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Println("查询订阅失败", invoice.Subscription.ID, err)
+			return
+		}
+		var metadata map[string]string
+		if invoice.SubscriptionDetails != nil {
+			metadata = invoice.SubscriptionDetails.Metadata
+		}
+		userId, _ := strconv.Atoi(metadata["user_id"])
+		if userId == 0 {
+			log.Println("订阅缺少用户信息", invoice.Subscription.ID)
+			return
+		}
+		sub = &model.UserSubscription{
+			UserId:               userId,
+			StripeSubscriptionId: invoice.Subscription.ID,
+		}
+		sub.PlanId, _ = strconv.Atoi(metadata["plan_id"])
+	}
+
+	// 套餐优先按账单中的价格匹配，以便在 Stripe 中升级或降级后发放新套餐的额度
+	var plan *model.SubscriptionPlan
+	if invoice.Lines != nil {
+		for _, line := range invoice.Lines.Data {
+			if line.Price == nil {
+				continue
+			}
+			if p, err := model.GetSubscriptionPlanByStripePriceId(line.Price.ID); err == nil {
+				plan = p
+				if line.Period != nil {
+					sub.CurrentPeriodStart = line.Period.Start
+					sub.CurrentPeriodEnd = line.Period.End
+				}
+				break
+			}
+		}
+	}
+	if plan == nil {
+		if plan, err = model.GetSubscriptionPlanById(sub.PlanId); err != nil {
+			log.Println("订阅套餐不存在", invoice.Subscription.ID, sub.PlanId)
+			return
+		}
+	}
+
+	money := float64(invoice.AmountPaid) / 100
+	granted, err := model.RenewUserSubscription(sub, plan, invoice.ID, money)
+	if err != nil {
+		log.Println("订阅续费失败", invoice.Subscription.ID, err)
+		return
+	}
+	if granted {
+		log.Printf("订阅续费成功：%s, 用户 %d, 套餐 %s, %.2f(%s)", invoice.Subscription.ID, sub.UserId, plan.Name, money, invoice.Currency)
+	}
+}
+
+func subscriptionUpdated(event stripe.Event) {
+	var stripeSub stripe.Subscription
+	if err := common.Unmarshal(event.Data.Raw, &stripeSub); err != nil {
+		log.Println("解析Stripe订阅失败", err)
+		return
+	}
+	sub, err := model.GetUserSubscriptionByStripeId(stripeSub.ID)
+	if err != nil {
+		// 首期账单尚未支付时本地还没有订阅记录
+		return
+	}
+	syncStripeSubscription(sub, &stripeSub)
+}
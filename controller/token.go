@@ -149,6 +149,12 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	if token.OrganizationId != 0 {
+		if _, err = model.GetOrganizationMember(token.OrganizationId, c.GetInt("id")); err != nil {
+			common.ApiErrorMsg(c, "你不是该组织的成员")
+			return
+		}
+	}
 	key, err := common.GenerateKey()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -172,6 +178,11 @@ func AddToken(c *gin.Context) {
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
 		CrossGroupRetry:    token.CrossGroupRetry,
+		ResponseCache:      token.ResponseCache,
+		BodyCapture:        token.BodyCapture,
+		TPMLimit:           token.TPMLimit,
+		ConcurrencyLimit:   token.ConcurrencyLimit,
+		OrganizationId:     token.OrganizationId,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -250,6 +261,10 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
 		cleanToken.CrossGroupRetry = token.CrossGroupRetry
+		cleanToken.ResponseCache = token.ResponseCache
+		cleanToken.BodyCapture = token.BodyCapture
+		cleanToken.TPMLimit = token.TPMLimit
+		cleanToken.ConcurrencyLimit = token.ConcurrencyLimit
 	}
 	err = cleanToken.Update()
 	if err != nil {
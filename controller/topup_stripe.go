@@ -147,9 +147,17 @@ func StripeWebhook(c *gin.Context) {
 
 	switch event.Type {
 	case stripe.EventTypeCheckoutSessionCompleted:
+		if event.GetObjectValue("mode") == string(stripe.CheckoutSessionModeSubscription) {
+			subscriptionSessionCompleted(event)
+			break
+		}
 		sessionCompleted(event)
 	case stripe.EventTypeCheckoutSessionExpired:
 		sessionExpired(event)
+	case stripe.EventTypeInvoicePaid:
+		subscriptionInvoicePaid(event)
+	case stripe.EventTypeCustomerSubscriptionUpdated, stripe.EventTypeCustomerSubscriptionDeleted:
+		subscriptionUpdated(event)
 	default:
 		log.Printf("不支持的Stripe Webhook事件类型: %s\n", event.Type)
 	}
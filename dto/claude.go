@@ -34,6 +34,19 @@ type ClaudeMediaMessage struct {
 	Input     any    `json:"input,omitempty"`
 	Content   any    `json:"content,omitempty"`
 	ToolUseId string `json:"tool_use_id,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
+	// citations 文本块的引用列表，citation 为流式 citations_delta 中的单个引用
+	Citations any `json:"citations,omitempty"`
+	Citation  any `json:"citation,omitempty"`
+}
+
+// ClaudeWebSearchCitation web_search_result_location 类型的引用
+type ClaudeWebSearchCitation struct {
+	Type           string `json:"type"`
+	Url            string `json:"url"`
+	Title          string `json:"title,omitempty"`
+	CitedText      string `json:"cited_text"`
+	EncryptedIndex string `json:"encrypted_index,omitempty"`
 }
 
 func (c *ClaudeMediaMessage) SetText(s string) {
@@ -30,6 +30,8 @@ type EmbeddingRequest struct {
 	TopP             float64  `json:"top_p,omitempty"`
 	FrequencyPenalty float64  `json:"frequency_penalty,omitempty"`
 	PresencePenalty  float64  `json:"presence_penalty,omitempty"`
+	// InputType 区分检索查询与文档，Cohere、Vertex AI 等需要区分的上游使用，如 search_query、search_document
+	InputType string `json:"input_type,omitempty"`
 }
 
 func (r *EmbeddingRequest) GetTokenCountMeta() *types.TokenCountMeta {
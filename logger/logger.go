@@ -31,6 +31,9 @@ var logCount int
 var setupLogLock sync.Mutex
 var setupLogWorking bool
 
+// currentLogFile 日志文件写入器，轮转时只切换其内部的文件，gin 的输出不需要重新设置
+var currentLogFile = &logFile{}
+
 func SetupLogger() {
 	defer func() {
 		setupLogWorking = false
@@ -49,8 +52,11 @@ func SetupLogger() {
 		if err != nil {
 			log.Fatal("failed to open log file")
 		}
-		gin.DefaultWriter = io.MultiWriter(os.Stdout, fd)
-		gin.DefaultErrorWriter = io.MultiWriter(os.Stderr, fd)
+		if currentLogFile.rotate(fd) {
+			gin.DefaultWriter = io.MultiWriter(os.Stdout, currentLogFile)
+			gin.DefaultErrorWriter = io.MultiWriter(os.Stderr, currentLogFile)
+		}
+		removeOldLogFiles(*common.LogDir, operation_setting.GetLogSetting().MaxFiles)
 	}
 }
 
@@ -67,7 +73,7 @@ func LogError(ctx context.Context, msg string) {
 }
 
 func LogDebug(ctx context.Context, msg string, args ...any) {
-	if common.DebugEnabled {
+	if common.DebugEnabled || operation_setting.GetLogSetting().Level == operation_setting.LogLevelDebug {
 		if len(args) > 0 {
 			msg = fmt.Sprintf(msg, args...)
 		}
@@ -76,18 +82,25 @@ func LogDebug(ctx context.Context, msg string, args ...any) {
 }
 
 func logHelper(ctx context.Context, level string, msg string) {
+	if !shouldLog(level) {
+		return
+	}
 	writer := gin.DefaultErrorWriter
 	if level == loggerINFO {
 		writer = gin.DefaultWriter
 	}
-	id := ctx.Value(common.RequestIdKey)
-	if id == nil {
-		id = "SYSTEM"
+	if operation_setting.GetLogSetting().IsJSON() {
+		writeJSONLog(writer, ctx, level, msg)
+	} else {
+		id := ctx.Value(common.RequestIdKey)
+		if id == nil {
+			id = "SYSTEM"
+		}
+		now := time.Now()
+		_, _ = fmt.Fprintf(writer, "[%s] %v | %s | %s \n", level, now.Format("2006/01/02 - 15:04:05"), id, msg)
 	}
-	now := time.Now()
-	_, _ = fmt.Fprintf(writer, "[%s] %v | %s | %s \n", level, now.Format("2006/01/02 - 15:04:05"), id, msg)
 	logCount++ // we don't need accurate count, so no lock here
-	if logCount > maxLogCount && !setupLogWorking {
+	if (logCount > maxLogCount || logFileTooLarge()) && !setupLogWorking {
 		logCount = 0
 		setupLogWorking = true
 		gopool.Go(func() {
@@ -0,0 +1,158 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	common.SysLogHook = sysLogHook
+}
+
+func slogLevel(level string) slog.Level {
+	switch level {
+	case loggerDebug, operation_setting.LogLevelDebug:
+		return slog.LevelDebug
+	case loggerWarn, operation_setting.LogLevelWarn:
+		return slog.LevelWarn
+	case loggerError, operation_setting.LogLevelError, "FATAL":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// shouldLog 按配置的最低级别过滤日志，debug 日志由 LogDebug 单独判断
+func shouldLog(level string) bool {
+	if level == loggerDebug {
+		return true
+	}
+	return slogLevel(level) >= slogLevel(operation_setting.GetLogSetting().Level)
+}
+
+// jsonLoggers 按输出目标缓存 JSON logger，gin 的输出只在首次打开日志文件时变化
+var jsonLoggers sync.Map
+
+func jsonLogger(writer io.Writer) *slog.Logger {
+	if l, ok := jsonLoggers.Load(writer); ok {
+		return l.(*slog.Logger)
+	}
+	l, _ := jsonLoggers.LoadOrStore(writer, slog.New(slog.NewJSONHandler(writer, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	return l.(*slog.Logger)
+}
+
+// writeJSONLog 输出一行 JSON 日志，请求上下文中的用户、令牌、模型与渠道信息作为字段输出
+func writeJSONLog(writer io.Writer, ctx context.Context, level string, msg string) {
+	attrs := make([]slog.Attr, 0, 8)
+	if id := ctx.Value(common.RequestIdKey); id != nil {
+		attrs = append(attrs, slog.Any("request_id", id))
+	}
+	if c, ok := ctx.(*gin.Context); ok {
+		if userId := common.GetContextKeyInt(c, constant.ContextKeyUserId); userId != 0 {
+			attrs = append(attrs, slog.Int("user_id", userId))
+		}
+		if tokenId := common.GetContextKeyInt(c, constant.ContextKeyTokenId); tokenId != 0 {
+			attrs = append(attrs, slog.Int("token_id", tokenId))
+		}
+		if modelName := common.GetContextKeyString(c, constant.ContextKeyOriginalModel); modelName != "" {
+			attrs = append(attrs, slog.String("model", modelName))
+		}
+		if channelId := common.GetContextKeyInt(c, constant.ContextKeyChannelId); channelId != 0 {
+			attrs = append(attrs, slog.Int("channel_id", channelId))
+		}
+		if relayFormat := common.GetContextKeyString(c, constant.ContextKeyRelayFormat); relayFormat != "" {
+			attrs = append(attrs, slog.String("relay_format", relayFormat))
+		}
+		if traceId := common.GetContextKeyString(c, constant.ContextKeyTraceId); traceId != "" {
+			attrs = append(attrs, slog.String("trace_id", traceId))
+		}
+	}
+	jsonLogger(writer).LogAttrs(context.Background(), slogLevel(level), msg, attrs...)
+}
+
+// sysLogHook 处理 common.SysLog 等系统日志，返回 false 时使用原有的文本格式输出
+func sysLogHook(level string, msg string) bool {
+	if !shouldLog(level) {
+		return true
+	}
+	if !operation_setting.GetLogSetting().IsJSON() {
+		return false
+	}
+	writer := gin.DefaultErrorWriter
+	if level == loggerINFO {
+		writer = gin.DefaultWriter
+	}
+	jsonLogger(writer).LogAttrs(context.Background(), slogLevel(level), msg, slog.String("source", "system"))
+	return true
+}
+
+// logFile 记录已写入的字节数，超过 MaxFileSizeMB 后轮转；切换文件时持有写锁，
+// 其他协程不会写入已关闭的文件
+type logFile struct {
+	mu   sync.RWMutex
+	file *os.File
+	size atomic.Int64
+}
+
+func (f *logFile) Write(p []byte) (int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.file == nil {
+		return len(p), nil
+	}
+	n, err := f.file.Write(p)
+	f.size.Add(int64(n))
+	return n, err
+}
+
+// rotate 切换到新的日志文件并关闭旧文件，首次打开文件时返回 true
+func (f *logFile) rotate(file *os.File) bool {
+	var size int64
+	if info, err := file.Stat(); err == nil {
+		size = info.Size()
+	}
+	f.mu.Lock()
+	previous := f.file
+	f.file = file
+	f.size.Store(size)
+	f.mu.Unlock()
+	if previous != nil {
+		_ = previous.Close()
+	}
+	return previous == nil
+}
+
+func logFileTooLarge() bool {
+	maxSize := operation_setting.GetLogSetting().MaxFileSizeMB
+	return maxSize > 0 && currentLogFile.size.Load() > int64(maxSize)*1024*1024
+}
+
+// removeOldLogFiles 只保留最新的 maxFiles 个日志文件
+func removeOldLogFiles(dir string, maxFiles int) {
+	if maxFiles <= 0 {
+		return
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "oneapi-*.log"))
+	if err != nil || len(files) <= maxFiles {
+		return
+	}
+	// 文件名中的时间戳保证按名称排序即为按时间排序
+	sort.Strings(files)
+	for _, file := range files[:len(files)-maxFiles] {
+		if err := os.Remove(file); err != nil {
+			common.SysError("failed to remove old log file: " + err.Error())
+		}
+	}
+}
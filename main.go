@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"fmt"
 	"log"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/tracing"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/controller"
 	"github.com/QuantumNous/new-api/logger"
@@ -46,6 +48,15 @@ func main() {
 	}
 
 	common.SysLog("New API " + common.Version + " started")
+
+	shutdownTracing, err := tracing.Init(common.Version)
+	if err != nil {
+		common.FatalLog("failed to initialize tracing: " + err.Error())
+	}
+	defer shutdownTracing(context.Background())
+	if tracing.Enabled() {
+		common.SysLog("opentelemetry tracing enabled")
+	}
 	if os.Getenv("GIN_MODE") != "debug" {
 		gin.SetMode(gin.ReleaseMode)
 	}
@@ -110,6 +121,35 @@ func main() {
 			controller.UpdateTaskBulk()
 		})
 	}
+	if common.IsMasterNode {
+		gopool.Go(func() {
+			controller.StartBatchWorker()
+		})
+		gopool.Go(func() {
+			controller.CleanExpiredStoredResponses()
+		})
+		gopool.Go(func() {
+			service.CleanExpiredLogBodies()
+		})
+		gopool.Go(func() {
+			service.LogArchiveTask()
+		})
+		gopool.Go(func() {
+			service.InvoiceTask()
+		})
+		gopool.Go(func() {
+			service.CreditSettlementTask()
+		})
+		gopool.Go(func() {
+			service.AlertTask()
+		})
+		gopool.Go(func() {
+			service.CleanExpiredResponseCaches()
+		})
+		gopool.Go(func() {
+			service.ResetBudgetsTask()
+		})
+	}
 	if os.Getenv("BATCH_UPDATE_ENABLED") == "true" {
 		common.BatchUpdateEnabled = true
 		common.SysLog("batch update enabled with interval " + strconv.Itoa(common.BatchUpdateInterval) + "s")
@@ -270,6 +270,7 @@ func TokenAuth() func(c *gin.Context) {
 		}
 
 		userCache.WriteContext(c)
+		service.CheckTokenNewIp(token.UserId, token.Id, token.Name, c.ClientIP())
 
 		userGroup := userCache.Group
 		tokenGroup := token.Group
@@ -318,6 +319,23 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 	}
 	common.SetContextKey(c, constant.ContextKeyTokenGroup, token.Group)
 	common.SetContextKey(c, constant.ContextKeyTokenCrossGroupRetry, token.CrossGroupRetry)
+	common.SetContextKey(c, constant.ContextKeyTokenResponseCache, token.ResponseCache)
+	common.SetContextKey(c, constant.ContextKeyTokenBodyCapture, token.BodyCapture)
+	common.SetContextKey(c, constant.ContextKeyTokenTPMLimit, token.TPMLimit)
+	common.SetContextKey(c, constant.ContextKeyTokenConcurrencyLimit, token.ConcurrencyLimit)
+	common.SetContextKey(c, constant.ContextKeyTokenOrganizationId, token.OrganizationId)
+	if token.OrganizationId != 0 {
+		org, err := model.GetOrganizationCache(token.OrganizationId)
+		if err != nil || org.Status != model.OrganizationStatusEnabled {
+			abortWithOpenAiMessage(c, http.StatusForbidden, "令牌所属组织不可用")
+			return fmt.Errorf("令牌所属组织不可用")
+		}
+		// 组织令牌使用组织的分组授权
+		if org.Group != "" {
+			common.SetContextKey(c, constant.ContextKeyUsingGroup, org.Group)
+			common.SetContextKey(c, constant.ContextKeyTokenGroup, org.Group)
+		}
+	}
 	if len(parts) > 1 {
 		if model.IsAdmin(token.UserId) {
 			c.Set("specific_channel_id", parts[1])
@@ -4,6 +4,8 @@ import (
 	"fmt"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/gin-gonic/gin"
 )
 
@@ -13,6 +15,9 @@ func SetUpLogger(server *gin.Engine) {
 		if param.Keys != nil {
 			requestID = param.Keys[common.RequestIdKey].(string)
 		}
+		if operation_setting.GetLogSetting().IsJSON() {
+			return formatJSONAccessLog(param, requestID)
+		}
 		return fmt.Sprintf("[GIN] %s | %s | %3d | %13v | %15s | %7s %s\n",
 			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
 			requestID,
@@ -24,3 +29,36 @@ func SetUpLogger(server *gin.Engine) {
 		)
 	}))
 }
+
+// formatJSONAccessLog 输出与 logger 结构化日志字段一致的访问日志
+func formatJSONAccessLog(param gin.LogFormatterParams, requestID string) string {
+	entry := map[string]any{
+		"time":       param.TimeStamp.Format("2006-01-02T15:04:05.000Z07:00"),
+		"level":      "INFO",
+		"msg":        "GIN",
+		"request_id": requestID,
+		"status":     param.StatusCode,
+		"latency_ms": param.Latency.Milliseconds(),
+		"client_ip":  param.ClientIP,
+		"method":     param.Method,
+		"path":       param.Path,
+	}
+	fields := map[constant.ContextKey]string{
+		constant.ContextKeyUserId:        "user_id",
+		constant.ContextKeyTokenId:       "token_id",
+		constant.ContextKeyOriginalModel: "model",
+		constant.ContextKeyChannelId:     "channel_id",
+		constant.ContextKeyRelayFormat:   "relay_format",
+		constant.ContextKeyTraceId:       "trace_id",
+	}
+	for key, field := range fields {
+		if value, ok := param.Keys[string(key)]; ok {
+			entry[field] = value
+		}
+	}
+	data, err := common.Marshal(entry)
+	if err != nil {
+		return ""
+	}
+	return string(data) + "\n"
+}
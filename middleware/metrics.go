@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsAuth 校验 Prometheus 采集令牌，未开启指标接口时返回 404
+func MetricsAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		setting := operation_setting.GetMetricsSetting()
+		if !setting.Enabled {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		// 未配置采集令牌时拒绝所有请求，避免指标接口被匿名访问
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if setting.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(setting.Token)) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Next()
+	}
+}
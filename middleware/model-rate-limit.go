@@ -21,6 +21,16 @@ const (
 	ModelRequestRateLimitSuccessCountMark = "MRRLS"
 )
 
+// setRequestRateLimitHeaders 按 OpenAI 的格式返回总请求数限制
+func setRequestRateLimitHeaders(c *gin.Context, limit int, remaining int64, reset time.Duration) {
+	if remaining < 0 {
+		remaining = 0
+	}
+	c.Header("x-ratelimit-limit-requests", strconv.Itoa(limit))
+	c.Header("x-ratelimit-remaining-requests", strconv.FormatInt(remaining, 10))
+	c.Header("x-ratelimit-reset-requests", reset.String())
+}
+
 // 检查Redis中的请求限制
 func checkRedisRateLimit(ctx context.Context, rdb *redis.Client, key string, maxCount int, duration int64) (bool, error) {
 	// 如果maxCount为0，表示不限制
@@ -99,7 +109,8 @@ func redisRateLimitHandler(duration int64, totalMaxCount, successMaxCount int) g
 			totalKey := fmt.Sprintf("rateLimit:%s", userId)
 			// 初始化
 			tb := limiter.New(ctx, rdb)
-			allowed, err = tb.Allow(
+			var remaining int64
+			allowed, remaining, err = tb.Reserve(
 				ctx,
 				totalKey,
 				limiter.WithCapacity(int64(totalMaxCount)*duration),
@@ -112,6 +123,9 @@ func redisRateLimitHandler(duration int64, totalMaxCount, successMaxCount int) g
 				abortWithOpenAiMessage(c, http.StatusInternalServerError, "rate_limit_check_failed")
 				return
 			}
+			// 每次请求消耗 duration 个令牌，每秒补充 totalMaxCount 个
+			reset := time.Duration((int64(totalMaxCount)*duration-remaining)/int64(totalMaxCount)) * time.Second
+			setRequestRateLimitHeaders(c, totalMaxCount, remaining/duration, reset)
 
 			if !allowed {
 				abortWithOpenAiMessage(c, http.StatusTooManyRequests, fmt.Sprintf("您已达到总请求数限制：%d分钟内最多请求%d次，包括失败次数，请检查您的请求是否正确", setting.ModelRequestRateLimitDurationMinutes, totalMaxCount))
@@ -138,10 +152,15 @@ func memoryRateLimitHandler(duration int64, totalMaxCount, successMaxCount int)
 		successKey := ModelRequestRateLimitSuccessCountMark + userId
 
 		// 1. 检查总请求数限制（当totalMaxCount为0时跳过）
-		if totalMaxCount > 0 && !inMemoryRateLimiter.Request(totalKey, totalMaxCount, duration) {
-			c.Status(http.StatusTooManyRequests)
-			c.Abort()
-			return
+		if totalMaxCount > 0 {
+			allowed := inMemoryRateLimiter.Request(totalKey, totalMaxCount, duration)
+			remaining, reset := inMemoryRateLimiter.Remaining(totalKey, totalMaxCount, duration)
+			setRequestRateLimitHeaders(c, totalMaxCount, int64(remaining), time.Duration(reset)*time.Second)
+			if !allowed {
+				c.Status(http.StatusTooManyRequests)
+				c.Abort()
+				return
+			}
 		}
 
 		// 2. 检查成功请求数限制
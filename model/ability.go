@@ -7,6 +7,7 @@ import (
 	"sync"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 
 	"github.com/samber/lo"
 	"gorm.io/gorm"
@@ -119,6 +120,37 @@ func GetChannel(group string, model string, retry int) (*Channel, error) {
 	if err != nil {
 		return nil, err
 	}
+	// 熔断过滤与动态选择策略都需要渠道的完整信息，数据不足时回退到加权随机
+	strategy := operation_setting.GetChannelSelectStrategy(group)
+	useStrategy := strategy != operation_setting.ChannelSelectStrategyWeightedRandom && len(abilities) > 1
+	if len(abilities) > 0 && (useStrategy || operation_setting.GetCircuitBreakerSetting().Enabled) {
+		channelIds := make([]int, 0, len(abilities))
+		for _, ability_ := range abilities {
+			channelIds = append(channelIds, ability_.ChannelId)
+		}
+		var channels []*Channel
+		if err = DB.Where("id in ?", channelIds).Find(&channels).Error; err != nil {
+			return nil, err
+		}
+		channelMap := make(map[int]*Channel, len(channels))
+		for _, channel := range channels {
+			channelMap[channel.Id] = channel
+		}
+		if abilities, err = filterAvailableAbilities(abilities, channelMap, model); err != nil {
+			return nil, err
+		}
+		if useStrategy && len(abilities) > 1 {
+			candidates := make([]*Channel, 0, len(abilities))
+			for _, ability_ := range abilities {
+				if channel, ok := channelMap[ability_.ChannelId]; ok {
+					candidates = append(candidates, channel)
+				}
+			}
+			if picked := pickChannelByStrategy(strategy, candidates, model); picked != nil {
+				return picked, nil
+			}
+		}
+	}
 	channel := Channel{}
 	if len(abilities) > 0 {
 		// Randomly choose one
@@ -0,0 +1,236 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm/clause"
+)
+
+const (
+	AlertRuleTypeSpend       = "spend"
+	AlertRuleTypeErrorRate   = "error_rate"
+	AlertRuleTypeNewIp       = "new_ip"
+	AlertRuleTypePriceChange = "price_change"
+)
+
+const (
+	AlertChannelTypeNotify   = "notify"
+	AlertChannelTypeSlack    = "slack"
+	AlertChannelTypeDiscord  = "discord"
+	AlertChannelTypeTelegram = "telegram"
+	AlertChannelTypeFeishu   = "feishu"
+	AlertChannelTypeDingTalk = "dingtalk"
+)
+
+func IsValidAlertRuleType(t string) bool {
+	switch t {
+	case AlertRuleTypeSpend, AlertRuleTypeErrorRate, AlertRuleTypeNewIp, AlertRuleTypePriceChange:
+		return true
+	}
+	return false
+}
+
+// AlertChannel 告警的发送渠道，notify 使用用户在个人设置中配置的通知方式
+type AlertChannel struct {
+	Type string `json:"type"`
+	Url  string `json:"url,omitempty"`
+	// Telegram 的 Bot Token
+	Token string `json:"token,omitempty"`
+	// Telegram 的 chat_id
+	ChatId string `json:"chat_id,omitempty"`
+	// 飞书与钉钉机器人的签名密钥
+	Secret string `json:"secret,omitempty"`
+}
+
+// AlertRule 用户的告警规则
+// spend: 窗口内消费超过 Threshold（货币单位）；error_rate: 窗口内错误率超过 Threshold（百分比）；
+// new_ip: 令牌被新的 IP 使用；price_change: 模型价格变动
+type AlertRule struct {
+	Id        int     `json:"id"`
+	UserId    int     `json:"user_id" gorm:"index"`
+	Name      string  `json:"name" gorm:"type:varchar(64)"`
+	Type      string  `json:"type" gorm:"type:varchar(32);index"`
+	Enabled   bool    `json:"enabled"`
+	TokenId   int     `json:"token_id" gorm:"default:0"`
+	ModelName string  `json:"model_name" gorm:"type:varchar(255)"`
+	Threshold float64 `json:"threshold"`
+	// 统计窗口（分钟）
+	WindowMinutes int `json:"window_minutes" gorm:"default:60"`
+	// 错误率规则的最少请求数，避免样本过少时误报
+	MinRequests     int    `json:"min_requests" gorm:"default:10"`
+	DedupMinutes    int    `json:"dedup_minutes" gorm:"default:0"`
+	Channels        string `json:"channels" gorm:"type:text"`
+	LastTriggeredAt int64  `json:"last_triggered_at" gorm:"bigint;default:0"`
+	CreatedAt       int64  `json:"created_at" gorm:"bigint"`
+	UpdatedAt       int64  `json:"updated_at" gorm:"bigint"`
+}
+
+// AlertEvent 已发送的告警记录
+type AlertEvent struct {
+	Id        int    `json:"id"`
+	RuleId    int    `json:"rule_id" gorm:"index"`
+	UserId    int    `json:"user_id" gorm:"index"`
+	Type      string `json:"type" gorm:"type:varchar(32)"`
+	Title     string `json:"title" gorm:"type:varchar(255)"`
+	Content   string `json:"content" gorm:"type:text"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// AlertTokenIp 令牌使用过的 IP，用于新 IP 告警
+type AlertTokenIp struct {
+	Id        int    `json:"id"`
+	TokenId   int    `json:"token_id" gorm:"uniqueIndex:idx_alert_token_ip,priority:1"`
+	Ip        string `json:"ip" gorm:"type:varchar(64);uniqueIndex:idx_alert_token_ip,priority:2"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint"`
+}
+
+func (rule *AlertRule) GetChannels() []AlertChannel {
+	var channels []AlertChannel
+	if rule.Channels == "" {
+		return channels
+	}
+	if err := common.UnmarshalJsonStr(rule.Channels, &channels); err != nil {
+		common.SysError("failed to unmarshal alert channels: " + err.Error())
+	}
+	return channels
+}
+
+func (rule *AlertRule) SetChannels(channels []AlertChannel) {
+	data, err := common.Marshal(channels)
+	if err != nil {
+		return
+	}
+	rule.Channels = string(data)
+}
+
+func (rule *AlertRule) Insert() error {
+	rule.CreatedAt = common.GetTimestamp()
+	rule.UpdatedAt = rule.CreatedAt
+	return DB.Create(rule).Error
+}
+
+func (rule *AlertRule) Update() error {
+	rule.UpdatedAt = common.GetTimestamp()
+	return DB.Model(rule).Select("name", "type", "enabled", "token_id", "model_name", "threshold", "window_minutes",
+		"min_requests", "dedup_minutes", "channels", "updated_at").Updates(rule).Error
+}
+
+func GetUserAlertRules(userId int) ([]*AlertRule, error) {
+	var rules []*AlertRule
+	err := DB.Where("user_id = ?", userId).Order("id desc").Find(&rules).Error
+	return rules, err
+}
+
+func GetUserAlertRuleById(id int, userId int) (*AlertRule, error) {
+	var rule AlertRule
+	if err := DB.Where("id = ? and user_id = ?", id, userId).First(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func CountUserAlertRules(userId int) (int64, error) {
+	var count int64
+	err := DB.Model(&AlertRule{}).Where("user_id = ?", userId).Count(&count).Error
+	return count, err
+}
+
+func DeleteUserAlertRule(id int, userId int) error {
+	result := DB.Where("id = ? and user_id = ?", id, userId).Delete(&AlertRule{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("告警规则不存在")
+	}
+	return nil
+}
+
+// GetEnabledAlertRules types 为空时返回所有类型
+func GetEnabledAlertRules(types ...string) ([]*AlertRule, error) {
+	var rules []*AlertRule
+	tx := DB.Where("enabled = ?", true)
+	if len(types) > 0 {
+		tx = tx.Where("type in ?", types)
+	}
+	err := tx.Find(&rules).Error
+	return rules, err
+}
+
+func UpdateAlertRuleTriggeredAt(id int) error {
+	return DB.Model(&AlertRule{}).Where("id = ?", id).Update("last_triggered_at", common.GetTimestamp()).Error
+}
+
+func (event *AlertEvent) Insert() error {
+	event.CreatedAt = common.GetTimestamp()
+	return DB.Create(event).Error
+}
+
+func GetUserAlertEvents(userId int, startIdx int, num int) (events []*AlertEvent, total int64, err error) {
+	tx := DB.Model(&AlertEvent{}).Where("user_id = ?", userId)
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&events).Error
+	return events, total, err
+}
+
+// DeleteAlertEventsBefore 清理过期的告警记录
+func DeleteAlertEventsBefore(timestamp int64) (int64, error) {
+	result := DB.Where("created_at < ?", timestamp).Delete(&AlertEvent{})
+	return result.RowsAffected, result.Error
+}
+
+// GetAlertTokenIps 返回令牌使用过的所有 IP
+func GetAlertTokenIps(tokenId int) ([]string, error) {
+	var ips []string
+	err := DB.Model(&AlertTokenIp{}).Where("token_id = ?", tokenId).Pluck("ip", &ips).Error
+	return ips, err
+}
+
+// InsertAlertTokenIp 记录令牌使用的 IP，返回该 IP 是否首次写入，其他节点已写入时返回 false
+func InsertAlertTokenIp(tokenId int, ip string) (bool, error) {
+	result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&AlertTokenIp{
+		TokenId:   tokenId,
+		Ip:        ip,
+		CreatedAt: common.GetTimestamp(),
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+// AlertLogStat 按用户、令牌与日志类型汇总的请求数与额度
+type AlertLogStat struct {
+	UserId  int
+	TokenId int
+	Type    int
+	Count   int64
+	Quota   int64
+}
+
+// GetAlertLogStats 汇总多个用户在时间窗口内的消费与失败请求，失败请求依赖错误日志记录。
+// 重试会为同一请求写入多条错误日志，失败请求按请求 id 去重，且不计入最终成功的请求
+func GetAlertLogStats(userIds []int, since time.Time) ([]*AlertLogStat, error) {
+	var stats []*AlertLogStat
+	err := LOG_DB.Model(&Log{}).
+		Select("user_id, token_id, type, count(*) as count, coalesce(sum(quota), 0) as quota").
+		Where("user_id in ? and type = ? and created_at >= ?", userIds, LogTypeConsume, since.Unix()).
+		Group("user_id, token_id, type").
+		Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+	succeeded := LOG_DB.Model(&Log{}).
+		Select("request_id").
+		Where("user_id in ? and type = ? and created_at >= ? and request_id <> ''", userIds, LogTypeConsume, since.Unix())
+	var failed []*AlertLogStat
+	err = LOG_DB.Model(&Log{}).
+		Select("user_id, token_id, type, count(distinct request_id) as count, 0 as quota").
+		Where("user_id in ? and type = ? and created_at >= ?", userIds, LogTypeError, since.Unix()).
+		Where("request_id not in (?)", succeeded).
+		Group("user_id, token_id, type").
+		Scan(&failed).Error
+	return append(stats, failed...), err
+}
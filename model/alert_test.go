@@ -0,0 +1,33 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetAlertLogStatsCountsFailedRequestsOnce(t *testing.T) {
+	SetupTestDB(t, &Log{})
+	now := time.Now().Unix()
+	logs := []*Log{
+		// 重试两次后成功的请求只算一次成功
+		{UserId: 1, Type: LogTypeError, RequestId: "a", CreatedAt: now},
+		{UserId: 1, Type: LogTypeError, RequestId: "a", CreatedAt: now},
+		{UserId: 1, Type: LogTypeConsume, RequestId: "a", Quota: 10, CreatedAt: now},
+		// 重试后仍失败的请求只算一次失败
+		{UserId: 1, Type: LogTypeError, RequestId: "b", CreatedAt: now},
+		{UserId: 1, Type: LogTypeError, RequestId: "b", CreatedAt: now},
+	}
+	CreateTestRecords(t, &logs)
+
+	stats, err := GetAlertLogStats([]int{1}, time.Unix(now-60, 0))
+	if err != nil {
+		t.Fatalf("get stats: %v", err)
+	}
+	counts := make(map[int]int64)
+	for _, stat := range stats {
+		counts[stat.Type] += stat.Count
+	}
+	if counts[LogTypeConsume] != 1 || counts[LogTypeError] != 1 {
+		t.Fatalf("counts = %v, want 1 success and 1 failure", counts)
+	}
+}
@@ -0,0 +1,228 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+// Batch /v1/batches 批处理任务，由主节点在后台逐行执行
+type Batch struct {
+	Id               int    `json:"id"`
+	BatchId          string `json:"batch_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId           int    `json:"user_id" gorm:"index"`
+	TokenId          int    `json:"token_id" gorm:"index"`
+	Endpoint         string `json:"endpoint" gorm:"type:varchar(64)"`
+	InputFileId      string `json:"input_file_id" gorm:"type:varchar(64)"`
+	OutputFileId     string `json:"output_file_id" gorm:"type:varchar(64)"`
+	ErrorFileId      string `json:"error_file_id" gorm:"type:varchar(64)"`
+	CompletionWindow string `json:"completion_window" gorm:"type:varchar(16)"`
+	Status           string `json:"status" gorm:"type:varchar(20);index"`
+	Errors           string `json:"errors" gorm:"type:text"`
+	Metadata         string `json:"metadata" gorm:"type:text"`
+	TotalCount       int    `json:"total_count"`
+	CompletedCount   int    `json:"completed_count"`
+	FailedCount      int    `json:"failed_count"`
+	CreatedAt        int64  `json:"created_at" gorm:"bigint;index"`
+	InProgressAt     int64  `json:"in_progress_at" gorm:"bigint"`
+	ExpiresAt        int64  `json:"expires_at" gorm:"bigint"`
+	FinalizingAt     int64  `json:"finalizing_at" gorm:"bigint"`
+	CompletedAt      int64  `json:"completed_at" gorm:"bigint"`
+	FailedAt         int64  `json:"failed_at" gorm:"bigint"`
+	ExpiredAt        int64  `json:"expired_at" gorm:"bigint"`
+	CancellingAt     int64  `json:"cancelling_at" gorm:"bigint"`
+	CancelledAt      int64  `json:"cancelled_at" gorm:"bigint"`
+}
+
+func (batch *Batch) Insert() error {
+	if batch.CreatedAt == 0 {
+		batch.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(batch).Error
+}
+
+func (batch *Batch) Update() error {
+	return DB.Save(batch).Error
+}
+
+func GetUserBatchByBatchId(userId int, batchId string) (*Batch, error) {
+	if batchId == "" {
+		return nil, errors.New("batch id is empty")
+	}
+	var batch Batch
+	err := DB.Where("user_id = ? and batch_id = ?", userId, batchId).First(&batch).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+func GetBatchByBatchId(batchId string) (*Batch, error) {
+	var batch Batch
+	err := DB.Where("batch_id = ?", batchId).First(&batch).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+func GetBatchStatus(batchId string) (string, error) {
+	var status string
+	err := DB.Model(&Batch{}).Where("batch_id = ?", batchId).Select("status").Scan(&status).Error
+	return status, err
+}
+
+// GetUserBatches 按 OpenAI 的游标分页方式查询，after 为上一页最后一个批处理 id
+func GetUserBatches(userId int, after string, limit int) ([]*Batch, bool, error) {
+	tx := DB.Where("user_id = ?", userId)
+	if after != "" {
+		afterBatch, err := GetUserBatchByBatchId(userId, after)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return []*Batch{}, false, nil
+			}
+			return nil, false, err
+		}
+		tx = tx.Where("id < ?", afterBatch.Id)
+	}
+	var batches []*Batch
+	err := tx.Order("id desc").Limit(limit + 1).Find(&batches).Error
+	if err != nil {
+		return nil, false, err
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	return batches, hasMore, nil
+}
+
+// GetPendingBatches 返回等待执行的批处理任务，按创建顺序
+func GetPendingBatches(limit int) ([]*Batch, error) {
+	var batches []*Batch
+	err := DB.Where("status = ?", BatchStatusValidating).Order("id asc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// ClaimBatch 将批处理任务从 validating 切换为 in_progress，返回是否抢占成功
+func ClaimBatch(batch *Batch) (bool, error) {
+	now := common.GetTimestamp()
+	result := DB.Model(&Batch{}).Where("id = ? and status = ?", batch.Id, BatchStatusValidating).
+		Updates(map[string]any{"status": BatchStatusInProgress, "in_progress_at": now})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	batch.Status = BatchStatusInProgress
+	batch.InProgressAt = now
+	return true, nil
+}
+
+// CancelBatch 请求取消批处理任务，未开始的任务直接取消，执行中的任务由执行方在下一次检查时结束
+func CancelBatch(batch *Batch) error {
+	now := common.GetTimestamp()
+	result := DB.Model(&Batch{}).Where("id = ? and status = ?", batch.Id, BatchStatusValidating).
+		Updates(map[string]any{"status": BatchStatusCancelled, "cancelling_at": now, "cancelled_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		result = DB.Model(&Batch{}).Where("id = ? and status = ?", batch.Id, BatchStatusInProgress).
+			Updates(map[string]any{"status": BatchStatusCancelling, "cancelling_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+	return DB.Where("id = ?", batch.Id).First(batch).Error
+}
+
+func UpdateBatchProgress(id int, completed int, failed int) error {
+	return DB.Model(&Batch{}).Where("id = ?", id).
+		Updates(map[string]any{"completed_count": completed, "failed_count": failed}).Error
+}
+
+// GetInterruptedBatches 返回服务重启前未执行完的批处理任务，由执行方跳过已有结果的行继续执行
+func GetInterruptedBatches() ([]*Batch, error) {
+	var batches []*Batch
+	err := DB.Where("status in ?", []string{BatchStatusInProgress, BatchStatusFinalizing, BatchStatusCancelling}).
+		Order("id asc").Find(&batches).Error
+	return batches, err
+}
+
+// CountUnfinishedBatches 统计等待执行或执行中的批处理任务数量
+func CountUnfinishedBatches() (int64, error) {
+	var count int64
+	err := DB.Model(&Batch{}).Where("status in ?", []string{BatchStatusValidating, BatchStatusInProgress, BatchStatusFinalizing, BatchStatusCancelling}).Count(&count).Error
+	return count, err
+}
+
+// BatchResult 批处理中单行请求的执行结果，逐行落库，服务重启后跳过已执行的行，避免重复计费
+type BatchResult struct {
+	Id      int    `json:"id"`
+	BatchId int    `json:"batch_id" gorm:"uniqueIndex:idx_batch_result_line"`
+	LineNo  int    `json:"line_no" gorm:"uniqueIndex:idx_batch_result_line"`
+	Success bool   `json:"success"`
+	Result  string `json:"result" gorm:"type:text"`
+}
+
+func (result *BatchResult) Insert() error {
+	return DB.Create(result).Error
+}
+
+// GetBatchResultLines 返回已有执行结果的行号
+func GetBatchResultLines(batchId int) (map[int]struct{}, error) {
+	var lines []int
+	err := DB.Model(&BatchResult{}).Where("batch_id = ?", batchId).Pluck("line_no", &lines).Error
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[int]struct{}, len(lines))
+	for _, line := range lines {
+		done[line] = struct{}{}
+	}
+	return done, nil
+}
+
+// CountBatchResults 统计已执行成功与失败的行数
+func CountBatchResults(batchId int) (int, int, error) {
+	var completed, failed int64
+	if err := DB.Model(&BatchResult{}).Where("batch_id = ? and success = ?", batchId, true).Count(&completed).Error; err != nil {
+		return 0, 0, err
+	}
+	if err := DB.Model(&BatchResult{}).Where("batch_id = ? and success = ?", batchId, false).Count(&failed).Error; err != nil {
+		return 0, 0, err
+	}
+	return int(completed), int(failed), nil
+}
+
+// ScanBatchResults 按写入顺序分批读取执行结果
+func ScanBatchResults(batchId int, fn func(result *BatchResult) error) error {
+	var results []*BatchResult
+	return DB.Where("batch_id = ?", batchId).FindInBatches(&results, 500, func(tx *gorm.DB, batch int) error {
+		for _, result := range results {
+			if err := fn(result); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+func DeleteBatchResults(batchId int) error {
+	return DB.Where("batch_id = ?", batchId).Delete(&BatchResult{}).Error
+}
@@ -0,0 +1,295 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/metrics"
+
+	"gorm.io/gorm"
+)
+
+const (
+	BudgetOwnerToken = "token"
+	BudgetOwnerUser  = "user"
+)
+
+// 预算配置的本地缓存时间，其他节点修改预算后最多延迟该时间生效
+const budgetCacheSeconds = 60
+
+var errBudgetExceeded = errors.New("budget exceeded")
+
+const (
+	BudgetPeriodDaily   = "daily"
+	BudgetPeriodWeekly  = "weekly"
+	BudgetPeriodMonthly = "monthly"
+)
+
+// Budget 令牌或用户在一个周期内的花费上限，ModelName 为空时对所有模型生效
+type Budget struct {
+	Id          int    `json:"id"`
+	OwnerType   string `json:"owner_type" gorm:"type:varchar(16);uniqueIndex:idx_budget_owner_model_period,priority:1"`
+	OwnerId     int    `json:"owner_id" gorm:"uniqueIndex:idx_budget_owner_model_period,priority:2"`
+	ModelName   string `json:"model_name" gorm:"type:varchar(255);default:'';uniqueIndex:idx_budget_owner_model_period,priority:3"`
+	Period      string `json:"period" gorm:"type:varchar(16);uniqueIndex:idx_budget_owner_model_period,priority:4"`
+	Limit       int    `json:"limit" gorm:"column:quota_limit"`
+	Used        int    `json:"used" gorm:"default:0"`
+	PeriodStart int64  `json:"period_start" gorm:"bigint;index"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint"`
+}
+
+func IsValidBudgetPeriod(period string) bool {
+	switch period {
+	case BudgetPeriodDaily, BudgetPeriodWeekly, BudgetPeriodMonthly:
+		return true
+	}
+	return false
+}
+
+// GetBudgetPeriodStart 返回 t 所在周期的开始时间，按服务器时区计算，每周从周一开始
+func GetBudgetPeriodStart(period string, t time.Time) time.Time {
+	year, month, day := t.Date()
+	switch period {
+	case BudgetPeriodWeekly:
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, t.Location())
+	case BudgetPeriodMonthly:
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// GetBudgetPeriodEnd 返回周期的结束时间，即下一次重置的时间
+func GetBudgetPeriodEnd(period string, start time.Time) time.Time {
+	switch period {
+	case BudgetPeriodWeekly:
+		return start.AddDate(0, 0, 7)
+	case BudgetPeriodMonthly:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+func (budget *Budget) ResetAt() time.Time {
+	return GetBudgetPeriodEnd(budget.Period, time.Unix(budget.PeriodStart, 0))
+}
+
+func (budget *Budget) Insert() error {
+	now := time.Now()
+	budget.CreatedAt = now.Unix()
+	budget.PeriodStart = GetBudgetPeriodStart(budget.Period, now).Unix()
+	defer InvalidateBudgetCache(budget.OwnerType, budget.OwnerId)
+	return DB.Create(budget).Error
+}
+
+func (budget *Budget) Delete() error {
+	defer InvalidateBudgetCache(budget.OwnerType, budget.OwnerId)
+	return DB.Delete(budget).Error
+}
+
+func GetBudgetsByOwner(ownerType string, ownerId int) ([]*Budget, error) {
+	var budgets []*Budget
+	err := DB.Where("owner_type = ? and owner_id = ?", ownerType, ownerId).Order("id asc").Find(&budgets).Error
+	return budgets, err
+}
+
+func GetBudgetByOwner(id int, ownerType string, ownerId int) (*Budget, error) {
+	var budget Budget
+	err := DB.Where("id = ? and owner_type = ? and owner_id = ?", id, ownerType, ownerId).First(&budget).Error
+	if err != nil {
+		return nil, err
+	}
+	return &budget, nil
+}
+
+// UpdateLimit 修改预算额度
+func (budget *Budget) UpdateLimit(limit int) error {
+	defer InvalidateBudgetCache(budget.OwnerType, budget.OwnerId)
+	return DB.Model(&Budget{}).Where("id = ?", budget.Id).Update("quota_limit", limit).Error
+}
+
+type budgetCacheEntry struct {
+	budgets  []*Budget
+	expireAt int64
+}
+
+var (
+	budgetCache          = make(map[string]budgetCacheEntry)
+	budgetCacheLock      sync.RWMutex
+	budgetCacheLastSweep int64
+)
+
+func budgetCacheKey(ownerType string, ownerId int) string {
+	return fmt.Sprintf("%s:%d", ownerType, ownerId)
+}
+
+// getCachedOwnerBudgets 返回缓存的预算配置，用量以数据库为准，不从缓存读取
+func getCachedOwnerBudgets(ownerType string, ownerId int) ([]*Budget, error) {
+	key := budgetCacheKey(ownerType, ownerId)
+	now := common.GetTimestamp()
+	budgetCacheLock.RLock()
+	entry, ok := budgetCache[key]
+	budgetCacheLock.RUnlock()
+	hit := ok && entry.expireAt > now
+	metrics.RecordCacheResult("budget", hit)
+	if hit {
+		return entry.budgets, nil
+	}
+	budgets, err := GetBudgetsByOwner(ownerType, ownerId)
+	if err != nil {
+		return nil, err
+	}
+	budgetCacheLock.Lock()
+	defer budgetCacheLock.Unlock()
+	if now-budgetCacheLastSweep >= budgetCacheSeconds {
+		budgetCacheLastSweep = now
+		for k, e := range budgetCache {
+			if e.expireAt <= now {
+				delete(budgetCache, k)
+			}
+		}
+	}
+	budgetCache[key] = budgetCacheEntry{budgets: budgets, expireAt: now + budgetCacheSeconds}
+	return budgets, nil
+}
+
+func InvalidateBudgetCache(ownerType string, ownerId int) {
+	budgetCacheLock.Lock()
+	defer budgetCacheLock.Unlock()
+	delete(budgetCache, budgetCacheKey(ownerType, ownerId))
+}
+
+// matchingBudgets 从缓存中取出对本次请求生效的令牌与用户预算
+func matchingBudgets(tokenId int, userId int, modelName string) ([]*Budget, error) {
+	var owners []*Budget
+	if tokenId > 0 {
+		tokenBudgets, err := getCachedOwnerBudgets(BudgetOwnerToken, tokenId)
+		if err != nil {
+			return nil, err
+		}
+		owners = append(owners, tokenBudgets...)
+	}
+	userBudgets, err := getCachedOwnerBudgets(BudgetOwnerUser, userId)
+	if err != nil {
+		return nil, err
+	}
+	owners = append(owners, userBudgets...)
+	var budgets []*Budget
+	for _, budget := range owners {
+		if budget.ModelName == "" || budget.ModelName == modelName {
+			budgets = append(budgets, budget)
+		}
+	}
+	return budgets, nil
+}
+
+// ReserveBudgets 在匹配的令牌与用户预算中原子地预占 quota，预算按 now 所在周期计算，已进入新周期的预算会先重置；
+// 任一预算不足时回滚全部预占并返回该预算
+func ReserveBudgets(tokenId int, userId int, modelName string, quota int, now time.Time) (*Budget, error) {
+	budgets, err := matchingBudgets(tokenId, userId, modelName)
+	if err != nil || len(budgets) == 0 {
+		return nil, err
+	}
+
+	var exceeded *Budget
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		for _, budget := range budgets {
+			ok, err := reserveBudget(tx, budget, quota, now)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				exceeded = budget
+				return errBudgetExceeded
+			}
+		}
+		return nil
+	})
+	if exceeded != nil {
+		// 读取最新的用量用于提示
+		var current Budget
+		if DB.First(&current, exceeded.Id).Error == nil {
+			return &current, nil
+		}
+		return exceeded, nil
+	}
+	return nil, err
+}
+
+// reserveBudget 以条件更新预占额度，并发请求之间不会超出限额
+func reserveBudget(tx *gorm.DB, budget *Budget, quota int, now time.Time) (bool, error) {
+	periodStart := GetBudgetPeriodStart(budget.Period, now).Unix()
+	reserve := func() (bool, error) {
+		query := tx.Model(&Budget{}).Where("id = ? and period_start = ? and used < quota_limit and used + ? <= quota_limit", budget.Id, periodStart, quota)
+		if quota == 0 {
+			// 额度不变的 UPDATE 在 MySQL 中影响行数为 0，这里只检查
+			var count int64
+			err := query.Count(&count).Error
+			return count > 0, err
+		}
+		result := query.Update("used", gorm.Expr("used + ?", quota))
+		return result.RowsAffected > 0, result.Error
+	}
+	ok, err := reserve()
+	if err != nil || ok {
+		return ok, err
+	}
+	// 预算可能尚未重置到当前周期
+	result := tx.Model(&Budget{}).Where("id = ? and period_start < ?", budget.Id, periodStart).
+		Updates(map[string]interface{}{"used": 0, "period_start": periodStart})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return reserve()
+	}
+	// 缓存中的预算可能已被删除
+	var count int64
+	if err = tx.Model(&Budget{}).Where("id = ?", budget.Id).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+// ChargeBudgets 将本次消耗计入匹配的预算，quota 为负数时返还；只修改 reservedAt 所在周期的用量，
+// 预算已重置到新周期后到达的补扣或返还不再计入
+func ChargeBudgets(tokenId int, userId int, modelName string, quota int, reservedAt time.Time) error {
+	if quota == 0 {
+		return nil
+	}
+	budgets, err := matchingBudgets(tokenId, userId, modelName)
+	if err != nil || len(budgets) == 0 {
+		return err
+	}
+	ids := make([]int, 0, len(budgets))
+	for _, budget := range budgets {
+		ids = append(ids, budget.Id)
+	}
+	return DB.Model(&Budget{}).
+		Where("id in ? and ((period = ? and period_start = ?) or (period = ? and period_start = ?) or (period = ? and period_start = ?))", ids,
+			BudgetPeriodDaily, GetBudgetPeriodStart(BudgetPeriodDaily, reservedAt).Unix(),
+			BudgetPeriodWeekly, GetBudgetPeriodStart(BudgetPeriodWeekly, reservedAt).Unix(),
+			BudgetPeriodMonthly, GetBudgetPeriodStart(BudgetPeriodMonthly, reservedAt).Unix()).
+		Update("used", gorm.Expr("used + ?", quota)).Error
+}
+
+// ResetExpiredBudgets 重置所有已进入新周期的预算
+func ResetExpiredBudgets() (int64, error) {
+	now := time.Now()
+	var total int64
+	for _, period := range []string{BudgetPeriodDaily, BudgetPeriodWeekly, BudgetPeriodMonthly} {
+		periodStart := GetBudgetPeriodStart(period, now).Unix()
+		result := DB.Model(&Budget{}).Where("period = ? and period_start < ?", period, periodStart).
+			Updates(map[string]interface{}{"used": 0, "period_start": periodStart})
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+	}
+	return total, nil
+}
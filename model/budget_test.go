@@ -0,0 +1,147 @@
+package model
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReserveBudgetsRejectsOverLimit(t *testing.T) {
+	SetupTestDB(t, &Budget{})
+	budget := &Budget{OwnerType: BudgetOwnerToken, OwnerId: 1, Period: BudgetPeriodDaily, Limit: 100}
+	CreateTestRecords(t, budget)
+
+	exceeded, err := ReserveBudgets(1, 10, "gpt-4o", 60, time.Now())
+	if err != nil || exceeded != nil {
+		t.Fatalf("first reserve: exceeded=%v err=%v", exceeded, err)
+	}
+	exceeded, err = ReserveBudgets(1, 10, "gpt-4o", 60, time.Now())
+	if err != nil {
+		t.Fatalf("second reserve: %v", err)
+	}
+	if exceeded == nil || exceeded.Id != budget.Id || exceeded.Used != 60 {
+		t.Fatalf("expected budget %d exceeded with used 60, got %+v", budget.Id, exceeded)
+	}
+	if used := GetTestRecord[Budget](t, budget.Id).Used; used != 60 {
+		t.Fatalf("used = %d, want 60", used)
+	}
+}
+
+func TestReserveBudgetsRollsBackAllOnFailure(t *testing.T) {
+	SetupTestDB(t, &Budget{})
+	tokenBudget := &Budget{OwnerType: BudgetOwnerToken, OwnerId: 1, Period: BudgetPeriodDaily, Limit: 1000}
+	userBudget := &Budget{OwnerType: BudgetOwnerUser, OwnerId: 10, Period: BudgetPeriodDaily, Limit: 50}
+	CreateTestRecords(t, tokenBudget, userBudget)
+
+	exceeded, err := ReserveBudgets(1, 10, "gpt-4o", 80, time.Now())
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	if exceeded == nil || exceeded.Id != userBudget.Id {
+		t.Fatalf("expected user budget exceeded, got %+v", exceeded)
+	}
+	if used := GetTestRecord[Budget](t, tokenBudget.Id).Used; used != 0 {
+		t.Fatalf("token budget used = %d, want 0 after rollback", used)
+	}
+}
+
+func TestReserveBudgetsMatchesModel(t *testing.T) {
+	SetupTestDB(t, &Budget{})
+	budget := &Budget{OwnerType: BudgetOwnerUser, OwnerId: 10, ModelName: "claude-sonnet-4", Period: BudgetPeriodDaily, Limit: 10}
+	CreateTestRecords(t, budget)
+
+	exceeded, err := ReserveBudgets(0, 10, "gpt-4o", 100, time.Now())
+	if err != nil || exceeded != nil {
+		t.Fatalf("budget for another model should not apply: exceeded=%v err=%v", exceeded, err)
+	}
+}
+
+func TestReserveBudgetsZeroQuotaChecksExhausted(t *testing.T) {
+	SetupTestDB(t, &Budget{})
+	budget := &Budget{OwnerType: BudgetOwnerUser, OwnerId: 10, Period: BudgetPeriodDaily, Limit: 100}
+	CreateTestRecords(t, budget)
+	if exceeded, _ := ReserveBudgets(0, 10, "gpt-4o", 0, time.Now()); exceeded != nil {
+		t.Fatalf("unused budget should allow zero quota")
+	}
+	DB.Model(&Budget{}).Where("id = ?", budget.Id).Update("used", 100)
+	if exceeded, _ := ReserveBudgets(0, 10, "gpt-4o", 0, time.Now()); exceeded == nil {
+		t.Fatalf("exhausted budget should reject zero quota")
+	}
+}
+
+func TestReserveBudgetsResetsNewPeriod(t *testing.T) {
+	SetupTestDB(t, &Budget{})
+	budget := &Budget{OwnerType: BudgetOwnerUser, OwnerId: 10, Period: BudgetPeriodDaily, Limit: 100}
+	CreateTestRecords(t, budget)
+	yesterday := GetBudgetPeriodStart(BudgetPeriodDaily, time.Now().AddDate(0, 0, -1)).Unix()
+	DB.Model(&Budget{}).Where("id = ?", budget.Id).Updates(map[string]interface{}{"used": 100, "period_start": yesterday})
+
+	exceeded, err := ReserveBudgets(0, 10, "gpt-4o", 30, time.Now())
+	if err != nil || exceeded != nil {
+		t.Fatalf("budget of a past period should be reset: exceeded=%v err=%v", exceeded, err)
+	}
+	if used := GetTestRecord[Budget](t, budget.Id).Used; used != 30 {
+		t.Fatalf("used = %d, want 30", used)
+	}
+}
+
+func TestReserveBudgetsConcurrent(t *testing.T) {
+	SetupTestDB(t, &Budget{})
+	budget := &Budget{OwnerType: BudgetOwnerUser, OwnerId: 10, Period: BudgetPeriodDaily, Limit: 100}
+	CreateTestRecords(t, budget)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			exceeded, err := ReserveBudgets(0, 10, "gpt-4o", 10, time.Now())
+			if err == nil && exceeded == nil {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if reserved != 10 {
+		t.Fatalf("reserved %d times, want 10", reserved)
+	}
+	if used := GetTestRecord[Budget](t, budget.Id).Used; used != 100 {
+		t.Fatalf("used = %d, want 100", used)
+	}
+}
+
+func TestDeletedBudgetIsSkipped(t *testing.T) {
+	SetupTestDB(t, &Budget{})
+	budget := &Budget{OwnerType: BudgetOwnerUser, OwnerId: 10, Period: BudgetPeriodDaily, Limit: 10}
+	CreateTestRecords(t, budget)
+	// 预热缓存后直接在数据库中删除，模拟其他节点删除预算
+	if exceeded, _ := ReserveBudgets(0, 10, "gpt-4o", 5, time.Now()); exceeded != nil {
+		t.Fatalf("unexpected exceeded")
+	}
+	DB.Delete(&Budget{}, budget.Id)
+	if exceeded, err := ReserveBudgets(0, 10, "gpt-4o", 50, time.Now()); err != nil || exceeded != nil {
+		t.Fatalf("deleted budget should not block: exceeded=%v err=%v", exceeded, err)
+	}
+}
+
+func TestChargeBudgetsOnlyAffectsReservedPeriod(t *testing.T) {
+	SetupTestDB(t, &Budget{})
+	budget := &Budget{OwnerType: BudgetOwnerUser, OwnerId: 10, Period: BudgetPeriodDaily, Limit: 100}
+	CreateTestRecords(t, budget)
+	yesterday := time.Now().AddDate(0, 0, -1)
+
+	if err := ChargeBudgets(0, 10, "gpt-4o", 40, time.Now()); err != nil {
+		t.Fatalf("charge: %v", err)
+	}
+	// 上一周期预占的请求在预算重置后返还，不能把新周期的用量扣成负数
+	if err := ChargeBudgets(0, 10, "gpt-4o", -60, yesterday); err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	if used := GetTestRecord[Budget](t, budget.Id).Used; used != 40 {
+		t.Fatalf("used = %d, want 40", used)
+	}
+}
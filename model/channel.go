@@ -103,6 +103,11 @@ func (channel *Channel) GetKeys() []string {
 }
 
 func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
+	return channel.GetNextEnabledKeyForModel("")
+}
+
+// GetNextEnabledKeyForModel 与 GetNextEnabledKey 相同，但会跳过该模型下已被熔断的 key
+func (channel *Channel) GetNextEnabledKeyForModel(modelName string) (string, int, *types.NewAPIError) {
 	// If not in multi-key mode, return the original key string directly.
 	if !channel.ChannelInfo.IsMultiKey {
 		return channel.Key, 0, nil
@@ -144,6 +149,18 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 	if len(enabledIdx) == 0 {
 		return "", 0, types.NewError(errors.New("no enabled keys"), types.ErrorCodeChannelNoAvailableKey)
 	}
+	// Skip keys whose circuit is open for this model, unless all of them are.
+	if modelName != "" {
+		available := lo.Filter(enabledIdx, func(idx int, _ int) bool {
+			return IsChannelCircuitAvailable(channel.Id, modelName, idx)
+		})
+		if len(available) > 0 {
+			enabledIdx = available
+		}
+	}
+	isSelectable := func(idx int) bool {
+		return lo.Contains(enabledIdx, idx)
+	}
 
 	switch channel.ChannelInfo.MultiKeyMode {
 	case constant.MultiKeyModeRandom:
@@ -175,7 +192,7 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		}
 		for i := 0; i < len(keys); i++ {
 			idx := (start + i) % len(keys)
-			if getStatus(idx) == common.ChannelStatusEnabled {
+			if isSelectable(idx) {
 				// update polling index for next call (point to the next position)
 				channel.ChannelInfo.MultiKeyPollingIndex = (idx + 1) % len(keys)
 				return keys[idx], idx, nil
@@ -189,6 +206,24 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 	}
 }
 
+// GetPreferredEnabledKeyForModel 优先使用指定下标的 key（会话亲和），该 key 被禁用或熔断时按正常方式选择
+func (channel *Channel) GetPreferredEnabledKeyForModel(modelName string, preferredIdx int) (string, int, *types.NewAPIError) {
+	if !channel.ChannelInfo.IsMultiKey {
+		return channel.GetNextEnabledKeyForModel(modelName)
+	}
+	keys := channel.GetKeys()
+	if preferredIdx >= 0 && preferredIdx < len(keys) {
+		status := common.ChannelStatusEnabled
+		if s, ok := channel.ChannelInfo.MultiKeyStatusList[preferredIdx]; ok {
+			status = s
+		}
+		if status == common.ChannelStatusEnabled && IsChannelCircuitAvailable(channel.Id, modelName, preferredIdx) {
+			return keys[preferredIdx], preferredIdx, nil
+		}
+	}
+	return channel.GetNextEnabledKeyForModel(modelName)
+}
+
 func (channel *Channel) SaveChannelInfo() error {
 	return DB.Model(channel).Update("channel_info", channel.ChannelInfo).Error
 }
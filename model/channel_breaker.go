@@ -0,0 +1,268 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// 熔断器状态
+const (
+	CircuitStateClosed   = "closed"
+	CircuitStateOpen     = "open"
+	CircuitStateHalfOpen = "half_open"
+)
+
+// channelCircuit 渠道 + 模型 + key 维度的熔断器（仅保存在当前节点内存中）
+type channelCircuit struct {
+	channelId int
+	modelName string
+	keyIndex  int
+
+	mu               sync.Mutex
+	state            string
+	consecutiveFails int
+	openedAt         time.Time
+	probing          int // 半开状态下正在进行的探测请求数
+	probeSuccesses   int // 半开状态下已成功的探测请求数
+}
+
+// ChannelCircuitInfo 熔断器状态快照
+type ChannelCircuitInfo struct {
+	ChannelId        int    `json:"channel_id"`
+	Model            string `json:"model"`
+	KeyIndex         int    `json:"key_index"`
+	State            string `json:"state"`
+	ConsecutiveFails int    `json:"consecutive_fails"`
+	OpenedAt         int64  `json:"opened_at"`
+}
+
+var channelCircuitMap sync.Map // key: channelId:model:keyIndex -> *channelCircuit
+
+// ErrAllChannelsCircuitOpen 指定模型的所有候选渠道均已熔断，直接失败而不是向熔断中的渠道重试
+var ErrAllChannelsCircuitOpen = errors.New("all channels for this model are circuit open, please try again later")
+
+func getChannelCircuit(channelId int, modelName string, keyIndex int) *channelCircuit {
+	key := fmt.Sprintf("%d:%s:%d", channelId, modelName, keyIndex)
+	if v, ok := channelCircuitMap.Load(key); ok {
+		return v.(*channelCircuit)
+	}
+	v, _ := channelCircuitMap.LoadOrStore(key, &channelCircuit{
+		channelId: channelId,
+		modelName: modelName,
+		keyIndex:  keyIndex,
+		state:     CircuitStateClosed,
+	})
+	return v.(*channelCircuit)
+}
+
+// refresh 冷却结束后从熔断切换到半开，调用方需持有锁
+func (cc *channelCircuit) refresh(now time.Time, setting *operation_setting.CircuitBreakerSetting) {
+	if cc.state == CircuitStateOpen && now.Sub(cc.openedAt) >= time.Duration(setting.CooldownSeconds)*time.Second {
+		cc.state = CircuitStateHalfOpen
+		cc.probing = 0
+		cc.probeSuccesses = 0
+	}
+}
+
+func (cc *channelCircuit) available(setting *operation_setting.CircuitBreakerSetting) bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.refresh(time.Now(), setting)
+	switch cc.state {
+	case CircuitStateOpen:
+		return false
+	case CircuitStateHalfOpen:
+		return cc.probing+cc.probeSuccesses < setting.GetHalfOpenRequests()
+	default:
+		return true
+	}
+}
+
+// IsChannelCircuitAvailable 判断渠道的指定模型和 key 当前是否允许请求通过，不占用半开探测名额
+func IsChannelCircuitAvailable(channelId int, modelName string, keyIndex int) bool {
+	setting := operation_setting.GetCircuitBreakerSetting()
+	if !setting.Enabled {
+		return true
+	}
+	if v, ok := channelCircuitMap.Load(fmt.Sprintf("%d:%s:%d", channelId, modelName, keyIndex)); ok {
+		return v.(*channelCircuit).available(setting)
+	}
+	return true
+}
+
+// IsChannelModelAvailable 判断渠道的指定模型是否至少有一个 key 没有被熔断
+func IsChannelModelAvailable(channel *Channel, modelName string) bool {
+	if !operation_setting.GetCircuitBreakerSetting().Enabled {
+		return true
+	}
+	if !channel.ChannelInfo.IsMultiKey {
+		return IsChannelCircuitAvailable(channel.Id, modelName, 0)
+	}
+	for i := range channel.GetKeys() {
+		if IsChannelCircuitAvailable(channel.Id, modelName, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// AcquireChannelCircuit 请求真正发往上游前调用，半开状态下原子地占用一个探测名额；
+// 熔断中或探测名额已被占满时返回 false，调用方不应发出请求
+func AcquireChannelCircuit(channelId int, modelName string, keyIndex int) bool {
+	setting := operation_setting.GetCircuitBreakerSetting()
+	if !setting.Enabled {
+		return true
+	}
+	cc := getChannelCircuit(channelId, modelName, keyIndex)
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.refresh(time.Now(), setting)
+	switch cc.state {
+	case CircuitStateOpen:
+		return false
+	case CircuitStateHalfOpen:
+		if cc.probing+cc.probeSuccesses >= setting.GetHalfOpenRequests() {
+			return false
+		}
+		cc.probing++
+	}
+	return true
+}
+
+// ReleaseChannelCircuit 已占用探测名额的请求没有产生结果时（例如处理过程中 panic）归还名额
+func ReleaseChannelCircuit(channelId int, modelName string, keyIndex int) {
+	if !operation_setting.GetCircuitBreakerSetting().Enabled {
+		return
+	}
+	cc := getChannelCircuit(channelId, modelName, keyIndex)
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.state == CircuitStateHalfOpen && cc.probing > 0 {
+		cc.probing--
+	}
+}
+
+// RecordChannelCircuitResult 记录请求结果，驱动熔断器状态变化
+func RecordChannelCircuitResult(channelId int, modelName string, keyIndex int, success bool) {
+	setting := operation_setting.GetCircuitBreakerSetting()
+	if !setting.Enabled {
+		return
+	}
+	cc := getChannelCircuit(channelId, modelName, keyIndex)
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	now := time.Now()
+	cc.refresh(now, setting)
+	switch cc.state {
+	case CircuitStateHalfOpen:
+		if cc.probing > 0 {
+			cc.probing--
+		}
+		if !success {
+			cc.trip(now)
+			return
+		}
+		cc.probeSuccesses++
+		if cc.probeSuccesses >= setting.GetHalfOpenRequests() {
+			cc.state = CircuitStateClosed
+			cc.consecutiveFails = 0
+			common.SysLog(fmt.Sprintf("circuit closed: channel #%d, model %s, key index %d", cc.channelId, cc.modelName, cc.keyIndex))
+		}
+	case CircuitStateOpen:
+		// 熔断期间仍在进行的请求，结果不影响状态
+	default:
+		if success {
+			cc.consecutiveFails = 0
+			return
+		}
+		cc.consecutiveFails++
+		if cc.consecutiveFails >= setting.GetFailureThreshold() {
+			cc.trip(now)
+		}
+	}
+}
+
+// trip 切换到熔断状态，调用方需持有锁
+func (cc *channelCircuit) trip(now time.Time) {
+	cc.state = CircuitStateOpen
+	cc.openedAt = now
+	cc.probing = 0
+	cc.probeSuccesses = 0
+	common.SysLog(fmt.Sprintf("circuit opened: channel #%d, model %s, key index %d, consecutive fails %d", cc.channelId, cc.modelName, cc.keyIndex, cc.consecutiveFails))
+}
+
+// GetAllChannelCircuits 获取所有非关闭状态的熔断器
+func GetAllChannelCircuits() []ChannelCircuitInfo {
+	setting := operation_setting.GetCircuitBreakerSetting()
+	result := make([]ChannelCircuitInfo, 0)
+	now := time.Now()
+	channelCircuitMap.Range(func(key, value any) bool {
+		cc := value.(*channelCircuit)
+		cc.mu.Lock()
+		cc.refresh(now, setting)
+		if cc.state != CircuitStateClosed || cc.consecutiveFails > 0 {
+			result = append(result, ChannelCircuitInfo{
+				ChannelId:        cc.channelId,
+				Model:            cc.modelName,
+				KeyIndex:         cc.keyIndex,
+				State:            cc.state,
+				ConsecutiveFails: cc.consecutiveFails,
+				OpenedAt:         cc.openedAt.Unix(),
+			})
+		}
+		cc.mu.Unlock()
+		return true
+	})
+	return result
+}
+
+// ResetChannelCircuits 重置熔断器，channelId 为 0 时重置全部
+func ResetChannelCircuits(channelId int) {
+	channelCircuitMap.Range(func(key, value any) bool {
+		if channelId == 0 || value.(*channelCircuit).channelId == channelId {
+			channelCircuitMap.Delete(key)
+		}
+		return true
+	})
+}
+
+// filterAvailableChannels 过滤掉指定模型已被熔断的渠道，全部被熔断时返回 ErrAllChannelsCircuitOpen
+func filterAvailableChannels(channelIds []int, modelName string) ([]int, error) {
+	if !operation_setting.GetCircuitBreakerSetting().Enabled {
+		return channelIds, nil
+	}
+	available := make([]int, 0, len(channelIds))
+	for _, channelId := range channelIds {
+		channel, ok := channelsIDM[channelId]
+		if !ok || IsChannelModelAvailable(channel, modelName) {
+			available = append(available, channelId)
+		}
+	}
+	if len(available) == 0 && len(channelIds) > 0 {
+		return nil, ErrAllChannelsCircuitOpen
+	}
+	return available, nil
+}
+
+// filterAvailableAbilities 数据库查询路径下过滤掉指定模型已被熔断的渠道，全部被熔断时返回 ErrAllChannelsCircuitOpen
+func filterAvailableAbilities(abilities []Ability, channels map[int]*Channel, modelName string) ([]Ability, error) {
+	if !operation_setting.GetCircuitBreakerSetting().Enabled {
+		return abilities, nil
+	}
+	available := make([]Ability, 0, len(abilities))
+	for _, ability := range abilities {
+		channel, ok := channels[ability.ChannelId]
+		if !ok || IsChannelModelAvailable(channel, modelName) {
+			available = append(available, ability)
+		}
+	}
+	if len(available) == 0 && len(abilities) > 0 {
+		return nil, ErrAllChannelsCircuitOpen
+	}
+	return available, nil
+}
@@ -0,0 +1,129 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+func withCircuitBreakerSetting(t *testing.T, setting operation_setting.CircuitBreakerSetting) {
+	t.Helper()
+	current := operation_setting.GetCircuitBreakerSetting()
+	saved := *current
+	*current = setting
+	t.Cleanup(func() {
+		*current = saved
+		ResetChannelCircuits(0)
+	})
+}
+
+func TestCircuitBreakerHalfOpenReservesProbeSlots(t *testing.T) {
+	withCircuitBreakerSetting(t, operation_setting.CircuitBreakerSetting{
+		Enabled:          true,
+		FailureThreshold: 1,
+		CooldownSeconds:  0,
+		HalfOpenRequests: 2,
+	})
+	const channelId, modelName = 9501, "breaker-model"
+
+	if !AcquireChannelCircuit(channelId, modelName, 0) {
+		t.Fatal("closed circuit should accept requests")
+	}
+	RecordChannelCircuitResult(channelId, modelName, 0, false)
+
+	// 冷却时间为 0，熔断后立即进入半开状态，只允许两个探测请求同时通过
+	if !AcquireChannelCircuit(channelId, modelName, 0) || !AcquireChannelCircuit(channelId, modelName, 0) {
+		t.Fatal("half-open circuit should accept probe requests")
+	}
+	if AcquireChannelCircuit(channelId, modelName, 0) {
+		t.Fatal("half-open circuit should reject requests beyond the probe limit")
+	}
+	if IsChannelCircuitAvailable(channelId, modelName, 0) {
+		t.Fatal("circuit with all probe slots taken should not be available")
+	}
+
+	// 探测请求没有产生结果时归还名额
+	ReleaseChannelCircuit(channelId, modelName, 0)
+	if !AcquireChannelCircuit(channelId, modelName, 0) {
+		t.Fatal("released probe slot should be reusable")
+	}
+
+	RecordChannelCircuitResult(channelId, modelName, 0, true)
+	RecordChannelCircuitResult(channelId, modelName, 0, true)
+	cc := getChannelCircuit(channelId, modelName, 0)
+	cc.mu.Lock()
+	state := cc.state
+	cc.mu.Unlock()
+	if state != CircuitStateClosed {
+		t.Fatalf("expected closed after successful probes, got %s", state)
+	}
+}
+
+func TestCircuitBreakerZeroSettingsAreClamped(t *testing.T) {
+	withCircuitBreakerSetting(t, operation_setting.CircuitBreakerSetting{
+		Enabled:          true,
+		FailureThreshold: 0,
+		CooldownSeconds:  0,
+		HalfOpenRequests: 0,
+	})
+	const channelId, modelName = 9502, "breaker-zero-model"
+
+	RecordChannelCircuitResult(channelId, modelName, 0, true)
+	if !IsChannelCircuitAvailable(channelId, modelName, 0) {
+		t.Fatal("success should not trip the circuit")
+	}
+	RecordChannelCircuitResult(channelId, modelName, 0, false)
+	time.Sleep(time.Millisecond)
+	// HalfOpenRequests 为 0 时按 1 处理，一次成功的探测即可恢复
+	if !AcquireChannelCircuit(channelId, modelName, 0) {
+		t.Fatal("half-open circuit should accept one probe")
+	}
+	RecordChannelCircuitResult(channelId, modelName, 0, true)
+	if !IsChannelCircuitAvailable(channelId, modelName, 0) {
+		t.Fatal("circuit should close after the probe succeeds")
+	}
+}
+
+func TestFilterAvailableChannelsFailsFastWhenAllTripped(t *testing.T) {
+	withCircuitBreakerSetting(t, operation_setting.CircuitBreakerSetting{
+		Enabled:          true,
+		FailureThreshold: 1,
+		CooldownSeconds:  60,
+		HalfOpenRequests: 1,
+	})
+	const modelName = "breaker-filter-model"
+	RecordChannelCircuitResult(9503, modelName, 0, false)
+	abilities := []Ability{{ChannelId: 9503}, {ChannelId: 9504}}
+	channels := map[int]*Channel{9503: {Id: 9503}, 9504: {Id: 9504}}
+	available, err := filterAvailableAbilities(abilities, channels, modelName)
+	if err != nil || len(available) != 1 || available[0].ChannelId != 9504 {
+		t.Fatalf("available = %v, err = %v", available, err)
+	}
+
+	RecordChannelCircuitResult(9504, modelName, 0, false)
+	if _, err = filterAvailableAbilities(abilities, channels, modelName); !errors.Is(err, ErrAllChannelsCircuitOpen) {
+		t.Fatalf("err = %v, want ErrAllChannelsCircuitOpen", err)
+	}
+}
+
+func TestValidateCircuitBreakerOption(t *testing.T) {
+	cases := []struct {
+		key, value string
+		wantErr    bool
+	}{
+		{"circuit_breaker_setting.failure_threshold", "0", true},
+		{"circuit_breaker_setting.failure_threshold", "3", false},
+		{"circuit_breaker_setting.half_open_requests", "0", true},
+		{"circuit_breaker_setting.half_open_requests", "abc", true},
+		{"circuit_breaker_setting.cooldown_seconds", "0", false},
+		{"circuit_breaker_setting.cooldown_seconds", "-1", true},
+	}
+	for _, tc := range cases {
+		err := operation_setting.ValidateCircuitBreakerOption(tc.key, tc.value)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s=%s: got err %v, wantErr %v", tc.key, tc.value, err, tc.wantErr)
+		}
+	}
+}
@@ -10,8 +10,12 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/metrics"
 	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/samber/lo"
 )
 
 var group2model2channels map[string]map[string][]int // enabled channel
@@ -115,6 +119,12 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 		return nil, nil
 	}
 
+	// skip channels whose circuit is open for this model
+	channels, err := filterAvailableChannels(channels, model)
+	if err != nil {
+		return nil, err
+	}
+
 	if len(channels) == 1 {
 		if channel, ok := channelsIDM[channels[0]]; ok {
 			return channel, nil
@@ -159,6 +169,11 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 		return nil, errors.New(fmt.Sprintf("no channel found, group: %s, model: %s, priority: %d", group, model, targetPriority))
 	}
 
+	// dynamic strategies fall back to weighted random when there is not enough data
+	if channel := pickChannelByStrategy(operation_setting.GetChannelSelectStrategy(group), targetChannels, model); channel != nil {
+		return channel, nil
+	}
+
 	// smoothing factor and adjustment
 	smoothingFactor := 1
 	smoothingAdjustment := 0
@@ -190,6 +205,41 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	return nil, errors.New("channel not found")
 }
 
+// GetSatisfiedChannelById 返回指定渠道，要求其在分组下启用了该模型且没有被熔断，否则返回 nil
+func GetSatisfiedChannelById(group string, model string, channelId int) (*Channel, error) {
+	if !common.MemoryCacheEnabled {
+		var count int64
+		err := DB.Model(&Ability{}).Where(commonGroupCol+" = ? and model = ? and channel_id = ? and enabled = ?", group, model, channelId, true).Count(&count).Error
+		if err != nil || count == 0 {
+			return nil, err
+		}
+		channel, err := GetChannelById(channelId, true)
+		if err != nil {
+			return nil, err
+		}
+		if !IsChannelModelAvailable(channel, model) {
+			return nil, nil
+		}
+		return channel, nil
+	}
+
+	channelSyncLock.RLock()
+	defer channelSyncLock.RUnlock()
+
+	channels := group2model2channels[group][model]
+	if !lo.Contains(channels, channelId) {
+		channels = group2model2channels[group][ratio_setting.FormatMatchingModelName(model)]
+		if !lo.Contains(channels, channelId) {
+			return nil, nil
+		}
+	}
+	channel, ok := channelsIDM[channelId]
+	if !ok || !IsChannelModelAvailable(channel, model) {
+		return nil, nil
+	}
+	return channel, nil
+}
+
 func CacheGetChannel(id int) (*Channel, error) {
 	if !common.MemoryCacheEnabled {
 		return GetChannelById(id, true)
@@ -198,6 +248,7 @@ func CacheGetChannel(id int) (*Channel, error) {
 	defer channelSyncLock.RUnlock()
 
 	c, ok := channelsIDM[id]
+	metrics.RecordCacheResult("channel", ok)
 	if !ok {
 		return nil, fmt.Errorf("渠道# %d，已不存在", id)
 	}
@@ -216,6 +267,7 @@ func CacheGetChannelInfo(id int) (*ChannelInfo, error) {
 	defer channelSyncLock.RUnlock()
 
 	c, ok := channelsIDM[id]
+	metrics.RecordCacheResult("channel", ok)
 	if !ok {
 		return nil, fmt.Errorf("渠道# %d，已不存在", id)
 	}
@@ -0,0 +1,270 @@
+package model
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// channelModelStats 渠道 + 模型维度的实时统计（仅保存在当前节点内存中）
+type channelModelStats struct {
+	channelId   int
+	modelName   string
+	mu          sync.Mutex
+	latencyEWMA float64 // 整体耗时，毫秒
+	ttftEWMA    float64 // 首字时间，毫秒
+	errorEWMA   float64 // 错误率，0 ~ 1
+	samples     int64
+	lastUpdate  time.Time
+	inflight    atomic.Int64
+}
+
+// ChannelModelStats 渠道统计快照
+type ChannelModelStats struct {
+	ChannelId int     `json:"channel_id"`
+	Model     string  `json:"model"`
+	LatencyMs float64 `json:"latency_ms"`
+	TTFTMs    float64 `json:"ttft_ms"`
+	ErrorRate float64 `json:"error_rate"`
+	Samples   int64   `json:"samples"`
+	Inflight  int64   `json:"inflight"`
+}
+
+var channelStatsMap sync.Map // key: channelId:model -> *channelModelStats
+
+func channelStatsKey(channelId int, modelName string) string {
+	return fmt.Sprintf("%d:%s", channelId, modelName)
+}
+
+func getChannelModelStats(channelId int, modelName string) *channelModelStats {
+	key := channelStatsKey(channelId, modelName)
+	if v, ok := channelStatsMap.Load(key); ok {
+		return v.(*channelModelStats)
+	}
+	v, _ := channelStatsMap.LoadOrStore(key, &channelModelStats{channelId: channelId, modelName: modelName})
+	return v.(*channelModelStats)
+}
+
+// ChannelStatsBegin 记录一次请求开始，增加在途请求数
+func ChannelStatsBegin(channelId int, modelName string) {
+	getChannelModelStats(channelId, modelName).inflight.Add(1)
+}
+
+// ChannelStatsEnd 记录一次请求结束，更新延迟、首字时间和错误率的滑动平均
+// ttft 为 0 表示上游没有返回任何内容
+func ChannelStatsEnd(channelId int, modelName string, latency time.Duration, ttft time.Duration, success bool) {
+	stats := getChannelModelStats(channelId, modelName)
+	stats.inflight.Add(-1)
+
+	setting := operation_setting.GetChannelSelectSetting()
+	alpha := setting.EWMAAlpha
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.3
+	}
+	errorValue := 0.0
+	if !success {
+		errorValue = 1
+	}
+
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	now := time.Now()
+	if stats.isExpired(now, setting.StatsWindowSeconds) {
+		stats.latencyEWMA, stats.ttftEWMA, stats.errorEWMA, stats.samples = 0, 0, 0, 0
+	}
+	if stats.samples == 0 {
+		stats.errorEWMA = errorValue
+	} else {
+		stats.errorEWMA = alpha*errorValue + (1-alpha)*stats.errorEWMA
+	}
+	// 失败请求的耗时不代表渠道的真实速度，只计入错误率
+	if success {
+		latencyMs := float64(latency.Milliseconds())
+		if stats.latencyEWMA == 0 {
+			stats.latencyEWMA = latencyMs
+		} else {
+			stats.latencyEWMA = alpha*latencyMs + (1-alpha)*stats.latencyEWMA
+		}
+		if ttft > 0 {
+			ttftMs := float64(ttft.Milliseconds())
+			if stats.ttftEWMA == 0 {
+				stats.ttftEWMA = ttftMs
+			} else {
+				stats.ttftEWMA = alpha*ttftMs + (1-alpha)*stats.ttftEWMA
+			}
+		}
+	}
+	stats.samples++
+	stats.lastUpdate = now
+}
+
+func (s *channelModelStats) isExpired(now time.Time, windowSeconds int) bool {
+	if windowSeconds <= 0 || s.lastUpdate.IsZero() {
+		return false
+	}
+	return now.Sub(s.lastUpdate) > time.Duration(windowSeconds)*time.Second
+}
+
+// GetChannelModelStats 获取渠道 + 模型的统计快照
+func GetChannelModelStats(channelId int, modelName string) ChannelModelStats {
+	stats := getChannelModelStats(channelId, modelName)
+	snapshot := ChannelModelStats{
+		ChannelId: channelId,
+		Model:     modelName,
+		Inflight:  stats.inflight.Load(),
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	if stats.isExpired(time.Now(), operation_setting.GetChannelSelectSetting().StatsWindowSeconds) {
+		return snapshot
+	}
+	snapshot.LatencyMs = stats.latencyEWMA
+	snapshot.TTFTMs = stats.ttftEWMA
+	snapshot.ErrorRate = stats.errorEWMA
+	snapshot.Samples = stats.samples
+	return snapshot
+}
+
+// GetAllChannelModelStats 获取所有渠道统计快照
+func GetAllChannelModelStats() []ChannelModelStats {
+	result := make([]ChannelModelStats, 0)
+	channelStatsMap.Range(func(key, value any) bool {
+		stats := value.(*channelModelStats)
+		result = append(result, GetChannelModelStats(stats.channelId, stats.modelName))
+		return true
+	})
+	return result
+}
+
+// score 计算渠道得分，越小越好；样本不足时返回 false
+func (s ChannelModelStats) score(minSamples int, errorPenalty float64) (float64, bool) {
+	if s.Samples < int64(minSamples) {
+		return 0, false
+	}
+	latency := s.TTFTMs
+	if latency <= 0 {
+		latency = s.LatencyMs
+	}
+	if latency <= 0 {
+		// 只有失败样本，用 1 秒作为基准延迟，让错误率惩罚生效
+		latency = 1000
+	}
+	return latency * (1 + s.ErrorRate*errorPenalty), true
+}
+
+// channelBaseWeights 返回渠道的静态权重，全部为 0 时视为等权
+func channelBaseWeights(channels []*Channel) []float64 {
+	weights := make([]float64, len(channels))
+	sum := 0.0
+	for i, channel := range channels {
+		weights[i] = float64(channel.GetWeight())
+		sum += weights[i]
+	}
+	if sum == 0 {
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+	return weights
+}
+
+func pickChannelByWeights(channels []*Channel, weights []float64) *Channel {
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	if total <= 0 {
+		return nil
+	}
+	r := rand.Float64() * total
+	for i, channel := range channels {
+		r -= weights[i]
+		if r < 0 {
+			return channel
+		}
+	}
+	return channels[len(channels)-1]
+}
+
+// pickChannelByStrategy 按动态选择策略挑选渠道，加权随机策略或数据不足时返回 nil，由调用方回退到加权随机
+func pickChannelByStrategy(strategy string, channels []*Channel, modelName string) *Channel {
+	switch strategy {
+	case operation_setting.ChannelSelectStrategyEWMA:
+		return pickChannelByEWMA(channels, modelName)
+	case operation_setting.ChannelSelectStrategyLeastRequests:
+		return pickChannelByLeastRequests(channels, modelName)
+	}
+	return nil
+}
+
+// pickChannelByEWMA 按静态权重 * (最优得分 / 渠道得分) 随机选择渠道，
+// 慢或者频繁出错的渠道会按比例减少流量，但不会完全失去流量以便恢复后重新被发现。
+// 所有渠道都没有足够样本时返回 nil，由调用方回退到加权随机。
+func pickChannelByEWMA(channels []*Channel, modelName string) *Channel {
+	setting := operation_setting.GetChannelSelectSetting()
+	scores := make([]float64, len(channels))
+	warm := make([]bool, len(channels))
+	bestScore, sumScore, warmCount := 0.0, 0.0, 0
+	for i, channel := range channels {
+		score, ok := GetChannelModelStats(channel.Id, modelName).score(setting.MinSamples, setting.ErrorPenalty)
+		if !ok || score <= 0 {
+			continue
+		}
+		scores[i], warm[i] = score, true
+		if warmCount == 0 || score < bestScore {
+			bestScore = score
+		}
+		sumScore += score
+		warmCount++
+	}
+	if warmCount == 0 {
+		return nil
+	}
+	// 冷启动的渠道按平均得分参与选择
+	avgScore := sumScore / float64(warmCount)
+	weights := channelBaseWeights(channels)
+	for i := range channels {
+		score := avgScore
+		if warm[i] {
+			score = scores[i]
+		}
+		weights[i] = weights[i] * bestScore / score
+	}
+	return pickChannelByWeights(channels, weights)
+}
+
+// pickChannelByLeastRequests 选择 在途请求数 / 静态权重 最小的渠道，相同时按权重随机
+func pickChannelByLeastRequests(channels []*Channel, modelName string) *Channel {
+	weights := channelBaseWeights(channels)
+	var candidates []*Channel
+	var candidateWeights []float64
+	minLoad := -1.0
+	for i, channel := range channels {
+		if weights[i] <= 0 {
+			continue
+		}
+		load := float64(GetChannelModelStats(channel.Id, modelName).Inflight) / weights[i]
+		if minLoad < 0 || load < minLoad {
+			minLoad = load
+			candidates = candidates[:0]
+			candidateWeights = candidateWeights[:0]
+		}
+		if load == minLoad {
+			candidates = append(candidates, channel)
+			candidateWeights = append(candidateWeights, weights[i])
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	return pickChannelByWeights(candidates, candidateWeights)
+}
+
+// ChannelStatsAbort 结束一次请求但不计入统计，用于与渠道无关的失败（例如请求参数错误）
+func ChannelStatsAbort(channelId int, modelName string) {
+	getChannelModelStats(channelId, modelName).inflight.Add(-1)
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+func newTestChannel(id int, weight uint) *Channel {
+	return &Channel{Id: id, Weight: &weight}
+}
+
+func TestPickChannelByStrategyWeightedRandomReturnsNil(t *testing.T) {
+	channels := []*Channel{newTestChannel(9101, 1), newTestChannel(9102, 1)}
+	if picked := pickChannelByStrategy(operation_setting.ChannelSelectStrategyWeightedRandom, channels, "test-model"); picked != nil {
+		t.Fatalf("weighted random should fall back to caller, got channel #%d", picked.Id)
+	}
+}
+
+func TestPickChannelByLeastRequests(t *testing.T) {
+	const modelName = "least-requests-model"
+	busy, idle := newTestChannel(9201, 1), newTestChannel(9202, 1)
+	ChannelStatsBegin(busy.Id, modelName)
+	ChannelStatsBegin(busy.Id, modelName)
+	defer ChannelStatsAbort(busy.Id, modelName)
+	defer ChannelStatsAbort(busy.Id, modelName)
+
+	for i := 0; i < 20; i++ {
+		picked := pickChannelByStrategy(operation_setting.ChannelSelectStrategyLeastRequests, []*Channel{busy, idle}, modelName)
+		if picked == nil || picked.Id != idle.Id {
+			t.Fatalf("expected idle channel #%d, got %v", idle.Id, picked)
+		}
+	}
+}
+
+func TestPickChannelByEWMAColdStart(t *testing.T) {
+	channels := []*Channel{newTestChannel(9301, 1), newTestChannel(9302, 1)}
+	if picked := pickChannelByStrategy(operation_setting.ChannelSelectStrategyEWMA, channels, "cold-model"); picked != nil {
+		t.Fatalf("ewma without samples should fall back to weighted random, got channel #%d", picked.Id)
+	}
+}
+
+func TestChannelStatsAbortReleasesInflight(t *testing.T) {
+	const modelName = "abort-model"
+	ChannelStatsBegin(9401, modelName)
+	ChannelStatsAbort(9401, modelName)
+	if inflight := GetChannelModelStats(9401, modelName).Inflight; inflight != 0 {
+		t.Fatalf("expected inflight 0, got %d", inflight)
+	}
+}
@@ -0,0 +1,141 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	FileStatusUploaded  = "uploaded"
+	FileStatusProcessed = "processed"
+	FileStatusError     = "error"
+)
+
+// File 用户通过 /v1/files 上传的文件，内容保存在对象存储中
+type File struct {
+	Id             int    `json:"id"`
+	FileId         string `json:"file_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId         int    `json:"user_id" gorm:"index"`
+	TokenId        int    `json:"token_id" gorm:"index"`
+	OrganizationId int    `json:"organization_id" gorm:"default:0"` // 扣费的组织额度池，删除时退还到此处
+	Filename       string `json:"filename" gorm:"type:varchar(255)"`
+	Purpose        string `json:"purpose" gorm:"type:varchar(64);index"`
+	Bytes          int64  `json:"bytes" gorm:"bigint"`
+	MimeType       string `json:"mime_type" gorm:"type:varchar(255)"`
+	StorageKey     string `json:"-" gorm:"type:varchar(512)"`
+	Status         string `json:"status" gorm:"type:varchar(32)"`
+	Quota          int    `json:"quota" gorm:"default:0"` // 上传时扣除的存储额度
+	CreatedAt      int64  `json:"created_at" gorm:"bigint;index"`
+	ExpiresAt      int64  `json:"expires_at" gorm:"bigint;default:0"`
+}
+
+func (file *File) Insert() error {
+	if file.CreatedAt == 0 {
+		file.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(file).Error
+}
+
+func (file *File) Delete() error {
+	return DB.Delete(file).Error
+}
+
+func GetUserFileByFileId(userId int, fileId string) (*File, error) {
+	if fileId == "" {
+		return nil, errors.New("file id is empty")
+	}
+	var file File
+	err := DB.Where("user_id = ? and file_id = ?", userId, fileId).First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// GetUserFiles 按 OpenAI 的游标分页方式查询用户文件，after 为上一页最后一个文件 id
+func GetUserFiles(userId int, purpose string, after string, limit int, asc bool) ([]*File, bool, error) {
+	tx := DB.Where("user_id = ?", userId)
+	if purpose != "" {
+		tx = tx.Where("purpose = ?", purpose)
+	}
+	if after != "" {
+		afterFile, err := GetUserFileByFileId(userId, after)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return []*File{}, false, nil
+			}
+			return nil, false, err
+		}
+		if asc {
+			tx = tx.Where("id > ?", afterFile.Id)
+		} else {
+			tx = tx.Where("id < ?", afterFile.Id)
+		}
+	}
+	if asc {
+		tx = tx.Order("id asc")
+	} else {
+		tx = tx.Order("id desc")
+	}
+	var files []*File
+	// 多查一条用于判断是否还有下一页
+	err := tx.Limit(limit + 1).Find(&files).Error
+	if err != nil {
+		return nil, false, err
+	}
+	hasMore := len(files) > limit
+	if hasMore {
+		files = files[:limit]
+	}
+	return files, hasMore, nil
+}
+
+func SumUserFileBytes(userId int) (int64, error) {
+	var total int64
+	err := DB.Model(&File{}).Where("user_id = ?", userId).Select("COALESCE(SUM(bytes), 0)").Scan(&total).Error
+	return total, err
+}
+
+// FileStorageUsage 用户文件占用的存储空间，上传时通过条件更新预占，避免并发上传绕过存储上限
+type FileStorageUsage struct {
+	UserId int   `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	Bytes  int64 `json:"bytes" gorm:"bigint;default:0"`
+}
+
+// ReserveUserFileStorage 预占 size 字节的存储空间，limit 大于 0 时超出上限返回 false
+func ReserveUserFileStorage(userId int, size int64, limit int64) (bool, error) {
+	var count int64
+	if err := DB.Model(&FileStorageUsage{}).Where("user_id = ?", userId).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count == 0 {
+		// 首次使用时以已有文件的大小初始化
+		used, err := SumUserFileBytes(userId)
+		if err != nil {
+			return false, err
+		}
+		err = DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&FileStorageUsage{UserId: userId, Bytes: used}).Error
+		if err != nil {
+			return false, err
+		}
+	}
+	tx := DB.Model(&FileStorageUsage{}).Where("user_id = ?", userId)
+	if limit > 0 {
+		tx = tx.Where("bytes + ? <= ?", size, limit)
+	}
+	result := tx.Update("bytes", gorm.Expr("bytes + ?", size))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ReleaseUserFileStorage 释放文件删除或保存失败时预占的存储空间
+func ReleaseUserFileStorage(userId int, size int64) error {
+	return DB.Model(&FileStorageUsage{}).Where("user_id = ? and bytes >= ?", userId, size).
+		Update("bytes", gorm.Expr("bytes - ?", size)).Error
+}
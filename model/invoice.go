@@ -0,0 +1,217 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Invoice 用户的月度账单，金额按生成时的额度展示设置换算
+type Invoice struct {
+	Id          int    `json:"id"`
+	Number      string `json:"number" gorm:"type:varchar(64);uniqueIndex"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex:idx_invoice_user_period,priority:1"`
+	PeriodStart int64  `json:"period_start" gorm:"bigint;uniqueIndex:idx_invoice_user_period,priority:2"`
+	PeriodEnd   int64  `json:"period_end" gorm:"bigint"`
+	// 在线充值
+	TopUpCount int64   `json:"top_up_count"`
+	TopUpMoney float64 `json:"top_up_money"`
+	// 兑换码充值
+	RedemptionCount int64 `json:"redemption_count"`
+	RedemptionQuota int64 `json:"redemption_quota"`
+	// 失败任务等退还的额度
+	RefundQuota int64 `json:"refund_quota"`
+	// 消费
+	ConsumeCount int64  `json:"consume_count"`
+	ConsumeQuota int64  `json:"consume_quota"`
+	Items        string `json:"items" gorm:"type:text"`
+	// 金额
+	Currency    string  `json:"currency" gorm:"type:varchar(16)"`
+	Subtotal    float64 `json:"subtotal"`
+	TaxRate     float64 `json:"tax_rate"`
+	Tax         float64 `json:"tax"`
+	Total       float64 `json:"total"`
+	CreatedAt   int64   `json:"created_at" gorm:"bigint;index"`
+	EmailSentAt int64   `json:"email_sent_at" gorm:"bigint;default:0"`
+}
+
+// InvoiceItem 账单中按模型汇总的消费明细
+type InvoiceItem struct {
+	ModelName        string  `json:"model_name"`
+	Count            int64   `json:"count"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Quota            int64   `json:"quota"`
+	Amount           float64 `json:"amount"`
+}
+
+// InvoiceSequence 每个账单编号前缀独立递增的序号，保证同一开票方的编号连续
+type InvoiceSequence struct {
+	Prefix     string `json:"prefix" gorm:"type:varchar(64);primaryKey"`
+	LastNumber int64  `json:"last_number" gorm:"default:0"`
+}
+
+// nextInvoiceNumber 在事务中递增前缀对应的序号，更新语句持有行锁，并发生成时不会得到相同编号
+func nextInvoiceNumber(tx *gorm.DB, prefix string) (int64, error) {
+	var count int64
+	if err := tx.Model(&InvoiceSequence{}).Where("prefix = ?", prefix).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		// 旧版本按账单 id 编号，首次使用序号时从已有编号之后继续
+		var lastId int64
+		err := tx.Model(&Invoice{}).Select("coalesce(max(id), 0)").Where("number like ?", prefix+"%").Scan(&lastId).Error
+		if err != nil {
+			return 0, err
+		}
+		err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&InvoiceSequence{Prefix: prefix, LastNumber: lastId}).Error
+		if err != nil {
+			return 0, err
+		}
+	}
+	err := tx.Model(&InvoiceSequence{}).Where("prefix = ?", prefix).
+		Update("last_number", gorm.Expr("last_number + ?", 1)).Error
+	if err != nil {
+		return 0, err
+	}
+	var sequence InvoiceSequence
+	if err = tx.Where("prefix = ?", prefix).First(&sequence).Error; err != nil {
+		return 0, err
+	}
+	return sequence.LastNumber, nil
+}
+
+// Insert 写入账单并按编号前缀生成连续的账单编号
+func (invoice *Invoice) Insert(numberPrefix string) error {
+	invoice.CreatedAt = common.GetTimestamp()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		number, err := nextInvoiceNumber(tx, numberPrefix)
+		if err != nil {
+			return err
+		}
+		invoice.Number = fmt.Sprintf("%s%08d", numberPrefix, number)
+		return tx.Create(invoice).Error
+	})
+}
+
+func (invoice *Invoice) GetItems() []InvoiceItem {
+	var items []InvoiceItem
+	if invoice.Items != "" {
+		_ = common.UnmarshalJsonStr(invoice.Items, &items)
+	}
+	return items
+}
+
+func GetInvoiceById(id int) (*Invoice, error) {
+	var invoice Invoice
+	if err := DB.First(&invoice, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+func GetUserInvoiceById(id int, userId int) (*Invoice, error) {
+	var invoice Invoice
+	if err := DB.Where("id = ? and user_id = ?", id, userId).First(&invoice).Error; err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+func GetInvoiceByPeriod(userId int, periodStart int64) (*Invoice, error) {
+	var invoice Invoice
+	if err := DB.Where("user_id = ? and period_start = ?", userId, periodStart).First(&invoice).Error; err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// GetInvoices userId 为 0 时返回所有用户的账单
+func GetInvoices(userId int, startIdx int, num int) (invoices []*Invoice, total int64, err error) {
+	tx := DB.Model(&Invoice{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&invoices).Error
+	return invoices, total, err
+}
+
+func MarkInvoiceEmailSent(id int) error {
+	return DB.Model(&Invoice{}).Where("id = ?", id).Update("email_sent_at", common.GetTimestamp()).Error
+}
+
+// GetTopUpStats 统计用户在时间范围内成功的在线充值
+func GetTopUpStats(userId int, startTime int64, endTime int64) (count int64, money float64, err error) {
+	var result struct {
+		Count int64
+		Money float64
+	}
+	err = DB.Model(&TopUp{}).Select("count(*) as count, coalesce(sum(money), 0) as money").
+		Where("user_id = ? and status = ? and complete_time >= ? and complete_time < ?", userId, common.TopUpStatusSuccess, startTime, endTime).
+		Scan(&result).Error
+	return result.Count, result.Money, err
+}
+
+// GetRedemptionStats 统计用户在时间范围内使用的兑换码，已删除的兑换码同样计入
+func GetRedemptionStats(userId int, startTime int64, endTime int64) (count int64, quota int64, err error) {
+	var result struct {
+		Count int64
+		Quota int64
+	}
+	err = DB.Unscoped().Model(&Redemption{}).Select("count(*) as count, coalesce(sum(quota), 0) as quota").
+		Where("used_user_id = ? and redeemed_time >= ? and redeemed_time < ?", userId, startTime, endTime).
+		Scan(&result).Error
+	return result.Count, result.Quota, err
+}
+
+// SumUserLogQuota 统计用户在时间范围内某类日志的额度，组织额度池的消费与退款不计入个人
+func SumUserLogQuota(userId int, logType int, startTime int64, endTime int64) (int64, error) {
+	var quota int64
+	err := LOG_DB.Model(&Log{}).Select("coalesce(sum(quota), 0)").
+		Where("user_id = ? and type = ? and organization_id = 0 and created_at >= ? and created_at < ?", userId, logType, startTime, endTime).
+		Scan(&quota).Error
+	return quota, err
+}
+
+// GetBillableUserIds 返回时间范围内有消费、充值或兑换记录的用户
+func GetBillableUserIds(startTime int64, endTime int64) ([]int, error) {
+	ids := types.NewSet[int]()
+	var userIds []int
+	err := LOG_DB.Model(&Log{}).Distinct("user_id").
+		Where("type in ? and organization_id = 0 and created_at >= ? and created_at < ?", []int{LogTypeConsume, LogTypeRefund}, startTime, endTime).
+		Pluck("user_id", &userIds).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range userIds {
+		ids.Add(id)
+	}
+	userIds = nil
+	err = DB.Model(&TopUp{}).Distinct("user_id").
+		Where("status = ? and complete_time >= ? and complete_time < ?", common.TopUpStatusSuccess, startTime, endTime).
+		Pluck("user_id", &userIds).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range userIds {
+		ids.Add(id)
+	}
+	userIds = nil
+	err = DB.Unscoped().Model(&Redemption{}).Distinct("used_user_id").
+		Where("redeemed_time >= ? and redeemed_time < ?", startTime, endTime).
+		Pluck("used_user_id", &userIds).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range userIds {
+		ids.Add(id)
+	}
+	return ids.Items(), nil
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestInvoiceNumbersArePerPrefixSequential(t *testing.T) {
+	SetupTestDB(t, &Invoice{}, &InvoiceSequence{})
+	// 旧版本按 id 生成的编号
+	legacy := &Invoice{Id: 3, Number: "INV00000003", UserId: 9, PeriodStart: 1}
+	CreateTestRecords(t, legacy)
+
+	want := []string{"INV00000004", "ACME00000001", "INV00000005", "ACME00000002"}
+	prefixes := []string{"INV", "ACME", "INV", "ACME"}
+	for i, prefix := range prefixes {
+		invoice := &Invoice{UserId: i + 1, PeriodStart: 1}
+		if err := invoice.Insert(prefix); err != nil {
+			t.Fatalf("insert invoice: %v", err)
+		}
+		if invoice.Number != want[i] {
+			t.Fatalf("invoice %d number = %s, want %s", i, invoice.Number, want[i])
+		}
+	}
+}
+
+func TestParseLegacyRefundQuota(t *testing.T) {
+	tests := []struct {
+		content string
+		quota   int
+		ok      bool
+	}{
+		{"异步任务执行失败 task_1，补偿 ＄0.002000 额度", 1000, true},
+		{"构图失败 123，补偿 1500 点额度", 1500, true},
+		{"视频任务成功退还多扣费用，模型倍率 1.00，分组倍率 1.00，tokens 10，预扣费 ＄1.000000 额度，实际扣费 ＄0.500000 额度，退还 ＄0.500000 额度", 250000, true},
+		{"Video async task failed task_2, refund ＄0.010000 额度", 5000, true},
+		{"异步任务执行失败 task_3，补偿 未知", 0, false},
+	}
+	for _, tt := range tests {
+		quota, ok := parseLegacyRefundQuota(tt.content)
+		if ok != tt.ok || quota != tt.quota {
+			t.Fatalf("parseLegacyRefundQuota(%q) = %d, %v, want %d, %v", tt.content, quota, ok, tt.quota, tt.ok)
+		}
+	}
+}
+
+func TestMigrateLegacyRefundLogs(t *testing.T) {
+	SetupTestDB(t, &Log{})
+	logs := []*Log{
+		{UserId: 1, Type: LogTypeSystem, Content: "构图失败 mj_1，补偿 200 点额度"},
+		{UserId: 1, Type: LogTypeSystem, Content: "开始设置两步验证"},
+	}
+	CreateTestRecords(t, &logs)
+	migrateLegacyRefundLogs()
+
+	var refund, system Log
+	if err := LOG_DB.First(&refund, logs[0].Id).Error; err != nil {
+		t.Fatalf("get refund log: %v", err)
+	}
+	if refund.Type != LogTypeRefund || refund.Quota != 200 {
+		t.Fatalf("refund log type=%d quota=%d", refund.Type, refund.Quota)
+	}
+	if err := LOG_DB.First(&system, logs[1].Id).Error; err != nil {
+		t.Fatalf("get system log: %v", err)
+	}
+	if system.Type != LogTypeSystem {
+		t.Fatalf("system log type changed to %d", system.Type)
+	}
+}
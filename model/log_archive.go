@@ -0,0 +1,118 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LogArchive 一个归档文件的元数据，文件中为按 id 排序的同一类型日志
+type LogArchive struct {
+	Id         int    `json:"id"`
+	LogType    int    `json:"log_type" gorm:"index"`
+	FirstId    int    `json:"first_id"`
+	LastId     int    `json:"last_id"`
+	StartTime  int64  `json:"start_time" gorm:"bigint"`
+	EndTime    int64  `json:"end_time" gorm:"bigint"`
+	Count      int    `json:"count"`
+	Size       int64  `json:"size"`
+	Storage    string `json:"storage" gorm:"type:varchar(16)"`
+	Location   string `json:"location" gorm:"type:varchar(512)"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+	RestoredAt int64  `json:"restored_at" gorm:"bigint;default:0"`
+}
+
+// 日志类型与归档配置中的名称
+var LogTypeNames = map[int]string{
+	LogTypeTopup:   "topup",
+	LogTypeConsume: "consume",
+	LogTypeManage:  "manage",
+	LogTypeSystem:  "system",
+	LogTypeError:   "error",
+	LogTypeRefund:  "refund",
+}
+
+func (archive *LogArchive) Insert() error {
+	archive.CreatedAt = common.GetTimestamp()
+	return LOG_DB.Create(archive).Error
+}
+
+func GetLogArchives(logType int, startIdx int, num int) (archives []*LogArchive, total int64, err error) {
+	tx := LOG_DB.Model(&LogArchive{})
+	if logType != LogTypeUnknown {
+		tx = tx.Where("log_type = ?", logType)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&archives).Error
+	return archives, total, err
+}
+
+func GetLogArchiveById(id int) (*LogArchive, error) {
+	var archive LogArchive
+	if err := LOG_DB.First(&archive, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &archive, nil
+}
+
+// GetRestoredLogArchives 返回已恢复到数据库中的归档
+func GetRestoredLogArchives() ([]*LogArchive, error) {
+	var archives []*LogArchive
+	err := LOG_DB.Where("restored_at > 0").Find(&archives).Error
+	return archives, err
+}
+
+// HasArchivedLogsInRange 判断时间范围内是否有已归档且未恢复的日志
+func HasArchivedLogsInRange(logTypes []int, startTime int64, endTime int64) (bool, error) {
+	var count int64
+	err := LOG_DB.Model(&LogArchive{}).
+		Where("log_type in ? and start_time < ? and end_time >= ? and restored_at = 0", logTypes, endTime, startTime).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// GetLogsForArchive 按 id 顺序读取需要归档的日志，excluded 中的归档范围内的日志已被恢复，暂不归档
+func GetLogsForArchive(logType int, before int64, afterId int, limit int, excluded []*LogArchive) ([]*Log, error) {
+	tx := LOG_DB.Where("type = ? and created_at < ? and id > ?", logType, before, afterId)
+	for _, archive := range excluded {
+		if archive.LogType == logType {
+			tx = tx.Where("id not between ? and ?", archive.FirstId, archive.LastId)
+		}
+	}
+	var logs []*Log
+	err := tx.Order("id asc").Limit(limit).Find(&logs).Error
+	return logs, err
+}
+
+func DeleteLogsByIds(ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return LOG_DB.Where("id in ?", ids).Delete(&Log{}).Error
+}
+
+// RestoreArchivedLogs 将归档中的日志写回数据库，已存在的日志会被跳过
+func RestoreArchivedLogs(archive *LogArchive, logs []*Log) error {
+	return LOG_DB.Transaction(func(tx *gorm.DB) error {
+		if len(logs) > 0 {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(logs, 500).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(archive).Update("restored_at", common.GetTimestamp()).Error
+	})
+}
+
+// ExpireRestoredLogs 删除恢复期已过的日志，这些日志已有归档文件，不需要再次导出
+func ExpireRestoredLogs(archive *LogArchive) error {
+	return LOG_DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("type = ? and id between ? and ?", archive.LogType, archive.FirstId, archive.LastId).Delete(&Log{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(archive).Update("restored_at", 0).Error
+	})
+}
@@ -0,0 +1,44 @@
+package model
+
+import "github.com/QuantumNous/new-api/common"
+
+// LogBody 请求与响应的完整内容，保存在日志库中，通过日志 id 或请求 id 关联
+type LogBody struct {
+	Id           int    `json:"id"`
+	LogId        int    `json:"log_id" gorm:"index"`
+	RequestId    string `json:"request_id" gorm:"type:varchar(64);index"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	TokenId      int    `json:"token_id"`
+	ModelName    string `json:"model_name" gorm:"default:''"`
+	RequestBody  string `json:"request_body" gorm:"type:text"`
+	ResponseBody string `json:"response_body" gorm:"type:text"`
+	Truncated    bool   `json:"truncated"`
+	CreatedAt    int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func (body *LogBody) Insert() error {
+	body.CreatedAt = common.GetTimestamp()
+	return LOG_DB.Create(body).Error
+}
+
+func GetLogBodyByLogId(logId int) (*LogBody, error) {
+	var body LogBody
+	if err := LOG_DB.Where("log_id = ?", logId).Order("id desc").First(&body).Error; err != nil {
+		return nil, err
+	}
+	return &body, nil
+}
+
+func GetLogBodyByRequestId(requestId string) (*LogBody, error) {
+	var body LogBody
+	if err := LOG_DB.Where("request_id = ?", requestId).Order("id desc").First(&body).Error; err != nil {
+		return nil, err
+	}
+	return &body, nil
+}
+
+// DeleteLogBodiesBefore 删除指定时间之前的记录
+func DeleteLogBodiesBefore(timestamp int64) (int64, error) {
+	result := LOG_DB.Where("created_at < ?", timestamp).Delete(&LogBody{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,199 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const logExportBatchSize = 1000
+
+// 导出时支持的汇总维度
+const (
+	ExportGroupDay     = "day"
+	ExportGroupUser    = "user"
+	ExportGroupToken   = "token"
+	ExportGroupModel   = "model"
+	ExportGroupChannel = "channel"
+)
+
+// LogExportFilter 导出日志的筛选条件，与日志查询接口一致，UserId 不为 0 时只导出该用户的日志
+type LogExportFilter struct {
+	UserId         int
+	LogType        int
+	StartTimestamp int64
+	EndTimestamp   int64
+	ModelName      string
+	Username       string
+	TokenName      string
+	Channel        int
+	Group          string
+	// PersonalOnly 只统计个人额度的日志，排除组织额度池的消费
+	PersonalOnly bool
+}
+
+// LogUsageSummary 按维度汇总的用量，未参与汇总的维度为零值
+type LogUsageSummary struct {
+	Day              int64  `json:"day" gorm:"column:day"`
+	UserId           int    `json:"user_id"`
+	Username         string `json:"username"`
+	TokenId          int    `json:"token_id"`
+	TokenName        string `json:"token_name"`
+	ModelName        string `json:"model_name"`
+	ChannelId        int    `json:"channel_id"`
+	Count            int64  `json:"count"`
+	Quota            int64  `json:"quota"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TokenUsed        int64  `json:"token_used"`
+}
+
+func IsValidExportGroup(group string) bool {
+	switch group {
+	case ExportGroupDay, ExportGroupUser, ExportGroupToken, ExportGroupModel, ExportGroupChannel:
+		return true
+	}
+	return false
+}
+
+func (filter *LogExportFilter) apply(tx *gorm.DB) *gorm.DB {
+	if filter.UserId != 0 {
+		tx = tx.Where("logs.user_id = ?", filter.UserId)
+	}
+	if filter.LogType != LogTypeUnknown {
+		tx = tx.Where("logs.type = ?", filter.LogType)
+	}
+	if filter.ModelName != "" {
+		tx = tx.Where("logs.model_name like ?", filter.ModelName)
+	}
+	if filter.Username != "" {
+		tx = tx.Where("logs.username = ?", filter.Username)
+	}
+	if filter.TokenName != "" {
+		tx = tx.Where("logs.token_name = ?", filter.TokenName)
+	}
+	if filter.StartTimestamp != 0 {
+		tx = tx.Where("logs.created_at >= ?", filter.StartTimestamp)
+	}
+	if filter.EndTimestamp != 0 {
+		tx = tx.Where("logs.created_at <= ?", filter.EndTimestamp)
+	}
+	if filter.Channel != 0 {
+		tx = tx.Where("logs.channel_id = ?", filter.Channel)
+	}
+	if filter.Group != "" {
+		tx = tx.Where("logs."+logGroupCol+" = ?", filter.Group)
+	}
+	if filter.PersonalOnly {
+		tx = tx.Where("logs.organization_id = 0")
+	}
+	return tx
+}
+
+// ExportLogs 按 id 顺序分批读取日志，避免一次性加载整个时间范围
+func ExportLogs(filter *LogExportFilter, fn func(logs []*Log) error) error {
+	lastId := 0
+	for {
+		var logs []*Log
+		err := filter.apply(LOG_DB.Model(&Log{})).Where("logs.id > ?", lastId).
+			Order("logs.id asc").Limit(logExportBatchSize).Find(&logs).Error
+		if err != nil {
+			return err
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+		if err = fn(logs); err != nil {
+			return err
+		}
+		if len(logs) < logExportBatchSize {
+			return nil
+		}
+		lastId = logs[len(logs)-1].Id
+	}
+}
+
+// dayBucketExpr 返回按服务器时区计算的当天零点时间戳表达式
+func dayBucketExpr(column string) string {
+	_, offset := time.Now().Zone()
+	return fmt.Sprintf("%s - (%s + %d) %% 86400", column, column, offset)
+}
+
+// GetLogUsageSummary 按指定维度汇总日志中的用量
+func GetLogUsageSummary(filter *LogExportFilter, groups []string) ([]*LogUsageSummary, error) {
+	selects := []string{
+		"count(*) as count",
+		"coalesce(sum(logs.quota), 0) as quota",
+		"coalesce(sum(logs.prompt_tokens), 0) as prompt_tokens",
+		"coalesce(sum(logs.completion_tokens), 0) as completion_tokens",
+		"coalesce(sum(logs.prompt_tokens + logs.completion_tokens), 0) as token_used",
+	}
+	var groupBy []string
+	for _, group := range groups {
+		switch group {
+		case ExportGroupDay:
+			selects = append(selects, dayBucketExpr("logs.created_at")+" as day")
+			groupBy = append(groupBy, "day")
+		case ExportGroupUser:
+			selects = append(selects, "logs.user_id as user_id", "logs.username as username")
+			groupBy = append(groupBy, "logs.user_id", "logs.username")
+		case ExportGroupToken:
+			selects = append(selects, "logs.token_id as token_id", "logs.token_name as token_name")
+			groupBy = append(groupBy, "logs.token_id", "logs.token_name")
+		case ExportGroupModel:
+			selects = append(selects, "logs.model_name as model_name")
+			groupBy = append(groupBy, "logs.model_name")
+		case ExportGroupChannel:
+			selects = append(selects, "logs.channel_id as channel_id")
+			groupBy = append(groupBy, "logs.channel_id")
+		}
+	}
+	tx := filter.apply(LOG_DB.Model(&Log{})).Select(strings.Join(selects, ", "))
+	if len(groupBy) > 0 {
+		tx = tx.Group(strings.Join(groupBy, ", ")).Order(strings.Join(groupBy, ", "))
+	}
+	var summaries []*LogUsageSummary
+	err := tx.Find(&summaries).Error
+	return summaries, err
+}
+
+// GetQuotaDataSummary 按天、用户、模型汇总数据看板中的用量，quota_data 只精确到小时，适合较长的时间范围
+func GetQuotaDataSummary(userId int, startTime int64, endTime int64, groups []string) ([]*LogUsageSummary, error) {
+	selects := []string{
+		"coalesce(sum(count), 0) as count",
+		"coalesce(sum(quota), 0) as quota",
+		"coalesce(sum(token_used), 0) as token_used",
+	}
+	var groupBy []string
+	for _, group := range groups {
+		switch group {
+		case ExportGroupDay:
+			selects = append(selects, dayBucketExpr("created_at")+" as day")
+			groupBy = append(groupBy, "day")
+		case ExportGroupUser:
+			selects = append(selects, "user_id as user_id", "username as username")
+			groupBy = append(groupBy, "user_id", "username")
+		case ExportGroupModel:
+			selects = append(selects, "model_name as model_name")
+			groupBy = append(groupBy, "model_name")
+		}
+	}
+	tx := DB.Table("quota_data").Select(strings.Join(selects, ", "))
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if startTime != 0 {
+		tx = tx.Where("created_at >= ?", startTime)
+	}
+	if endTime != 0 {
+		tx = tx.Where("created_at <= ?", endTime)
+	}
+	if len(groupBy) > 0 {
+		tx = tx.Group(strings.Join(groupBy, ", ")).Order(strings.Join(groupBy, ", "))
+	}
+	var summaries []*LogUsageSummary
+	err := tx.Find(&summaries).Error
+	return summaries, err
+}
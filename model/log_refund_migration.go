@@ -0,0 +1,100 @@
+package model
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"gorm.io/gorm"
+)
+
+// legacyRefundLogPrefixes 旧版本以系统日志记录的任务退款，退还的额度位于内容末尾
+var legacyRefundLogPrefixes = []string{
+	"异步任务执行失败 ",
+	"构图失败 ",
+	"视频任务成功退还多扣费用",
+	"Video async task failed ",
+}
+
+// legacyRefundQuotaMarkers 退还额度前的标记，取内容中最后一次出现的位置
+var legacyRefundQuotaMarkers = []string{"补偿 ", "退还 ", "refund "}
+
+// migrateLegacyRefundLogs 将旧版本记录为系统日志的任务退款转换为退款日志，使其计入账单
+func migrateLegacyRefundLogs() {
+	tx := LOG_DB.Where("type = ?", LogTypeSystem)
+	conds := LOG_DB
+	for i, prefix := range legacyRefundLogPrefixes {
+		if i == 0 {
+			conds = conds.Where("content like ?", prefix+"%")
+		} else {
+			conds = conds.Or("content like ?", prefix+"%")
+		}
+	}
+	var logs []*Log
+	migrated := 0
+	err := tx.Where(conds).Select("id", "content").FindInBatches(&logs, 500, func(batch *gorm.DB, _ int) error {
+		for _, log := range logs {
+			quota, ok := parseLegacyRefundQuota(log.Content)
+			if !ok {
+				continue
+			}
+			err := LOG_DB.Model(&Log{}).Where("id = ?", log.Id).
+				Updates(map[string]interface{}{"type": LogTypeRefund, "quota": quota}).Error
+			if err != nil {
+				return err
+			}
+			migrated++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		common.SysError("failed to migrate legacy refund logs: " + err.Error())
+		return
+	}
+	if migrated > 0 {
+		common.SysLog("migrated " + strconv.Itoa(migrated) + " legacy refund logs")
+	}
+}
+
+// parseLegacyRefundQuota 从退款日志内容中解析退还的额度，金额按货币符号对应的汇率换算回额度
+func parseLegacyRefundQuota(content string) (int, bool) {
+	pos := -1
+	for _, marker := range legacyRefundQuotaMarkers {
+		if idx := strings.LastIndex(content, marker); idx >= 0 && idx+len(marker) > pos {
+			pos = idx + len(marker)
+		}
+	}
+	if pos < 0 {
+		return 0, false
+	}
+	amount := strings.TrimSpace(content[pos:])
+	if tokens, ok := strings.CutSuffix(amount, " 点额度"); ok {
+		quota, err := strconv.Atoi(tokens)
+		return quota, err == nil
+	}
+	amount, ok := strings.CutSuffix(amount, " 额度")
+	if !ok {
+		return 0, false
+	}
+	digits := strings.IndexAny(amount, "-0123456789.")
+	if digits < 0 {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(amount[digits:], 64)
+	if err != nil {
+		return 0, false
+	}
+	switch symbol := amount[:digits]; symbol {
+	case "＄", "$":
+	case "¥":
+		value /= operation_setting.USDExchangeRate
+	default:
+		if rate := operation_setting.GetGeneralSetting().CustomCurrencyExchangeRate; rate > 0 {
+			value /= rate
+		}
+	}
+	return int(math.Round(value * common.QuotaPerUnit)), true
+}
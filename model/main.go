@@ -213,6 +213,9 @@ func InitDB() (err error) {
 func InitLogDB() (err error) {
 	if os.Getenv("LOG_SQL_DSN") == "" {
 		LOG_DB = DB
+		if common.IsMasterNode {
+			migrateLegacyRefundLogs()
+		}
 		return
 	}
 	db, err := chooseDB("LOG_SQL_DSN", true)
@@ -267,6 +270,24 @@ func migrateDB() error {
 		&Setup{},
 		&TwoFA{},
 		&TwoFABackupCode{},
+		&File{},
+		&FileStorageUsage{},
+		&Batch{},
+		&BatchResult{},
+		&StoredResponse{},
+		&ResponseCache{},
+		&Budget{},
+		&Organization{},
+		&OrganizationMember{},
+		&Invoice{},
+		&InvoiceSequence{},
+		&UserCredit{},
+		&CreditSettlement{},
+		&SubscriptionPlan{},
+		&UserSubscription{},
+		&AlertRule{},
+		&AlertEvent{},
+		&AlertTokenIp{},
 	)
 	if err != nil {
 		return err
@@ -300,6 +321,24 @@ func migrateDBFast() error {
 		{&Setup{}, "Setup"},
 		{&TwoFA{}, "TwoFA"},
 		{&TwoFABackupCode{}, "TwoFABackupCode"},
+		{&File{}, "File"},
+		{&FileStorageUsage{}, "FileStorageUsage"},
+		{&Batch{}, "Batch"},
+		{&BatchResult{}, "BatchResult"},
+		{&StoredResponse{}, "StoredResponse"},
+		{&ResponseCache{}, "ResponseCache"},
+		{&Budget{}, "Budget"},
+		{&Organization{}, "Organization"},
+		{&OrganizationMember{}, "OrganizationMember"},
+		{&Invoice{}, "Invoice"},
+		{&InvoiceSequence{}, "InvoiceSequence"},
+		{&UserCredit{}, "UserCredit"},
+		{&CreditSettlement{}, "CreditSettlement"},
+		{&SubscriptionPlan{}, "SubscriptionPlan"},
+		{&UserSubscription{}, "UserSubscription"},
+		{&AlertRule{}, "AlertRule"},
+		{&AlertEvent{}, "AlertEvent"},
+		{&AlertTokenIp{}, "AlertTokenIp"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -330,9 +369,10 @@ func migrateDBFast() error {
 
 func migrateLOGDB() error {
 	var err error
-	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
+	if err = LOG_DB.AutoMigrate(&Log{}, &LogBody{}, &LogArchive{}); err != nil {
 		return err
 	}
+	migrateLegacyRefundLogs()
 	return nil
 }
 
@@ -0,0 +1,312 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+
+	"gorm.io/gorm"
+)
+
+const (
+	OrganizationRoleOwner  = "owner"
+	OrganizationRoleAdmin  = "admin"
+	OrganizationRoleMember = "member"
+)
+
+const (
+	OrganizationStatusEnabled  = 1
+	OrganizationStatusDisabled = 2
+)
+
+// Organization 组织拥有共享的额度池，组织令牌的消耗从额度池中扣除
+type Organization struct {
+	Id        int    `json:"id"`
+	Name      string `json:"name" gorm:"type:varchar(128);index"`
+	OwnerId   int    `json:"owner_id" gorm:"index"`
+	Quota     int    `json:"quota" gorm:"default:0"`
+	UsedQuota int    `json:"used_quota" gorm:"default:0"`
+	// 组织令牌可以使用的分组，为空时使用成员自己的分组
+	Group     string `json:"group" gorm:"type:varchar(64);default:''"`
+	Status    int    `json:"status" gorm:"default:1"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint"`
+}
+
+// OrganizationMember 组织成员，QuotaLimit 为成员在组织额度池中的累计消费上限，0 表示不限制
+type OrganizationMember struct {
+	Id             int    `json:"id"`
+	OrganizationId int    `json:"organization_id" gorm:"uniqueIndex:idx_org_member,priority:1"`
+	UserId         int    `json:"user_id" gorm:"uniqueIndex:idx_org_member,priority:2;index"`
+	Username       string `json:"username" gorm:"-:all"`
+	Role           string `json:"role" gorm:"type:varchar(16)"`
+	QuotaLimit     int    `json:"quota_limit" gorm:"default:0"`
+	UsedQuota      int    `json:"used_quota" gorm:"default:0"`
+	CreatedAt      int64  `json:"created_at" gorm:"bigint"`
+}
+
+func IsValidOrganizationRole(role string) bool {
+	switch role {
+	case OrganizationRoleOwner, OrganizationRoleAdmin, OrganizationRoleMember:
+		return true
+	}
+	return false
+}
+
+// CanManage owner 与 admin 可以管理成员、令牌与额度
+func (member *OrganizationMember) CanManage() bool {
+	return member.Role == OrganizationRoleOwner || member.Role == OrganizationRoleAdmin
+}
+
+// RemainQuota 返回成员还能消费的额度，-1 表示不限制
+func (member *OrganizationMember) RemainQuota() int {
+	if member.QuotaLimit <= 0 {
+		return -1
+	}
+	return max(member.QuotaLimit-member.UsedQuota, 0)
+}
+
+// CreateOrganization 创建组织，创建者成为 owner
+func CreateOrganization(org *Organization) error {
+	now := common.GetTimestamp()
+	org.CreatedAt = now
+	org.Status = OrganizationStatusEnabled
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrganizationMember{
+			OrganizationId: org.Id,
+			UserId:         org.OwnerId,
+			Role:           OrganizationRoleOwner,
+			CreatedAt:      now,
+		}).Error
+	})
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	if id == 0 {
+		return nil, errors.New("组织 id 为空！")
+	}
+	var org Organization
+	if err := DB.First(&org, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func GetAllOrganizations(startIdx int, num int) (orgs []*Organization, total int64, err error) {
+	if err = DB.Model(&Organization{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = DB.Order("id desc").Limit(num).Offset(startIdx).Find(&orgs).Error
+	return orgs, total, err
+}
+
+// GetUserOrganizations 返回用户加入的组织及其角色
+func GetUserOrganizations(userId int) ([]map[string]interface{}, error) {
+	var members []*OrganizationMember
+	if err := DB.Where("user_id = ?", userId).Find(&members).Error; err != nil {
+		return nil, err
+	}
+	result := make([]map[string]interface{}, 0, len(members))
+	for _, member := range members {
+		org, err := GetOrganizationById(member.OrganizationId)
+		if err != nil {
+			continue
+		}
+		result = append(result, map[string]interface{}{
+			"organization": org,
+			"member":       member,
+		})
+	}
+	return result, nil
+}
+
+func UpdateOrganization(org *Organization) error {
+	if err := DB.Model(org).Select("name", "group", "status").Updates(org).Error; err != nil {
+		return err
+	}
+	return invalidateOrganizationCache(org.Id)
+}
+
+// DeleteOrganization 删除组织及其成员，组织令牌一并删除
+func DeleteOrganization(id int) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ?", id).Delete(&OrganizationMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("organization_id = ?", id).Delete(&Token{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Organization{}, "id = ?", id).Error
+	})
+	if err != nil {
+		return err
+	}
+	return invalidateOrganizationCache(id)
+}
+
+func GetOrganizationMember(orgId int, userId int) (*OrganizationMember, error) {
+	var member OrganizationMember
+	err := DB.Where("organization_id = ? and user_id = ?", orgId, userId).First(&member).Error
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func GetOrganizationMembers(orgId int) ([]*OrganizationMember, error) {
+	var members []*OrganizationMember
+	if err := DB.Where("organization_id = ?", orgId).Order("id asc").Find(&members).Error; err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		member.Username, _ = GetUsernameById(member.UserId, false)
+	}
+	return members, nil
+}
+
+// GetUserIdByUsername 按用户名查找用户，用于邀请组织成员
+func GetUserIdByUsername(username string) (int, error) {
+	var user User
+	if err := DB.Select("id").Where("username = ?", username).First(&user).Error; err != nil {
+		return 0, err
+	}
+	return user.Id, nil
+}
+
+func AddOrganizationMember(member *OrganizationMember) error {
+	member.CreatedAt = common.GetTimestamp()
+	return DB.Create(member).Error
+}
+
+func UpdateOrganizationMember(member *OrganizationMember) error {
+	return DB.Model(member).Select("role", "quota_limit").Updates(member).Error
+}
+
+// RemoveOrganizationMember 移除成员，并删除其创建的组织令牌
+func RemoveOrganizationMember(orgId int, userId int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ? and user_id = ?", orgId, userId).Delete(&Token{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("organization_id = ? and user_id = ?", orgId, userId).Delete(&OrganizationMember{}).Error
+	})
+}
+
+// TransferQuotaToOrganization 将用户个人额度转入组织额度池
+func TransferQuotaToOrganization(userId int, orgId int, quota int) error {
+	if quota <= 0 {
+		return errors.New("转入额度必须大于 0")
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ? and quota >= ?", userId, quota).Update("quota", gorm.Expr("quota - ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("用户额度不足")
+		}
+		return tx.Model(&Organization{}).Where("id = ?", orgId).Update("quota", gorm.Expr("quota + ?", quota)).Error
+	})
+	if err != nil {
+		return err
+	}
+	// 刷新用户额度缓存
+	if common.RedisEnabled {
+		if err := cacheDecrUserQuota(userId, int64(quota)); err != nil {
+			common.SysLog("failed to decrease user quota cache: " + err.Error())
+		}
+	}
+	RecordLog(userId, LogTypeManage, fmt.Sprintf("转入组织 %d 额度 %s", orgId, logger.LogQuota(quota)))
+	return nil
+}
+
+// AdjustOrganizationQuota 管理员直接调整组织额度池
+func AdjustOrganizationQuota(orgId int, delta int) error {
+	return DB.Model(&Organization{}).Where("id = ?", orgId).Update("quota", gorm.Expr("quota + ?", delta)).Error
+}
+
+var ErrOrganizationQuotaNotEnough = errors.New("组织额度不足")
+
+// DecreaseOrganizationQuota 从组织额度池扣费，同时累计成员的消费
+func DecreaseOrganizationQuota(orgId int, userId int, quota int) error {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	return changeOrganizationQuota(orgId, userId, -quota)
+}
+
+// IncreaseOrganizationQuota 返还组织额度池，同时扣减成员的消费
+func IncreaseOrganizationQuota(orgId int, userId int, quota int) error {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	return changeOrganizationQuota(orgId, userId, quota)
+}
+
+func changeOrganizationQuota(orgId int, userId int, delta int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&Organization{}).Where("id = ?", orgId)
+		if delta < 0 {
+			// 条件扣减，避免并发请求把额度池扣成负数
+			query = query.Where("quota >= ?", -delta)
+		}
+		result := query.Updates(map[string]interface{}{
+			"quota":      gorm.Expr("quota + ?", delta),
+			"used_quota": gorm.Expr("used_quota - ?", delta),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 && delta < 0 {
+			return ErrOrganizationQuotaNotEnough
+		}
+		return tx.Model(&OrganizationMember{}).Where("organization_id = ? and user_id = ?", orgId, userId).
+			Update("used_quota", gorm.Expr("used_quota - ?", delta)).Error
+	})
+}
+
+// DecreaseBillingQuota 按扣费目标扣除额度，orgId 不为 0 时扣除组织额度池
+func DecreaseBillingQuota(orgId int, userId int, quota int) error {
+	if orgId == 0 {
+		return DecreaseUserQuota(userId, quota)
+	}
+	return DecreaseOrganizationQuota(orgId, userId, quota)
+}
+
+var ErrUserQuotaNotEnough = errors.New("用户额度不足")
+
+// ConsumeBillingQuota 按扣费目标条件扣除额度，不走批量更新；个人额度最多透支到可透支额度，余额不足时不扣除并返回错误
+func ConsumeBillingQuota(orgId int, userId int, quota int) error {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	if orgId != 0 {
+		return DecreaseOrganizationQuota(orgId, userId, quota)
+	}
+	result := DB.Model(&User{}).Where("id = ? and quota + ? >= ?", userId, GetUserCreditQuota(userId), quota).
+		Update("quota", gorm.Expr("quota - ?", quota))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserQuotaNotEnough
+	}
+	if common.RedisEnabled {
+		if err := cacheDecrUserQuota(userId, int64(quota)); err != nil {
+			common.SysLog("failed to decrease user quota cache: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// IncreaseBillingQuota 按扣费目标返还额度，orgId 不为 0 时返还组织额度池
+func IncreaseBillingQuota(orgId int, userId int, quota int) error {
+	if orgId == 0 {
+		return IncreaseUserQuota(userId, quota, false)
+	}
+	return IncreaseOrganizationQuota(orgId, userId, quota)
+}
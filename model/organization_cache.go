@@ -0,0 +1,81 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/metrics"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// OrganizationBase 组织令牌鉴权时需要的组织信息，额度池余额变化频繁，不进入缓存
+type OrganizationBase struct {
+	Id     int    `json:"id"`
+	Group  string `json:"group"`
+	Status int    `json:"status"`
+}
+
+func getOrganizationCacheKey(orgId int) string {
+	return fmt.Sprintf("organization:%d", orgId)
+}
+
+func invalidateOrganizationCache(orgId int) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	return common.RedisDelKey(getOrganizationCacheKey(orgId))
+}
+
+func updateOrganizationCache(org Organization) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	return common.RedisHSetObj(
+		getOrganizationCacheKey(org.Id),
+		&OrganizationBase{Id: org.Id, Group: org.Group, Status: org.Status},
+		time.Duration(common.RedisKeyCacheSeconds())*time.Second,
+	)
+}
+
+// GetOrganizationCache 优先从 Redis 读取组织信息，未命中时查询数据库并异步写回缓存
+func GetOrganizationCache(orgId int) (orgCache *OrganizationBase, err error) {
+	var org *Organization
+	var fromDB bool
+	defer func() {
+		if shouldUpdateRedis(fromDB, err) && org != nil {
+			gopool.Go(func() {
+				if err := updateOrganizationCache(*org); err != nil {
+					common.SysLog("failed to update organization cache: " + err.Error())
+				}
+			})
+		}
+	}()
+
+	orgCache, err = cacheGetOrganizationBase(orgId)
+	if common.RedisEnabled {
+		metrics.RecordCacheResult("organization", err == nil)
+	}
+	if err == nil {
+		return orgCache, nil
+	}
+
+	fromDB = true
+	org, err = GetOrganizationById(orgId)
+	if err != nil {
+		return nil, err
+	}
+	return &OrganizationBase{Id: org.Id, Group: org.Group, Status: org.Status}, nil
+}
+
+func cacheGetOrganizationBase(orgId int) (*OrganizationBase, error) {
+	if !common.RedisEnabled {
+		return nil, fmt.Errorf("redis is not enabled")
+	}
+	var orgCache OrganizationBase
+	if err := common.RedisHGetObj(getOrganizationCacheKey(orgId), &orgCache); err != nil {
+		return nil, err
+	}
+	return &orgCache, nil
+}
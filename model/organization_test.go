@@ -0,0 +1,92 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBillingQuotaChargesAndRefundsOrganizationPool(t *testing.T) {
+	SetupTestDB(t, &User{}, &Organization{}, &OrganizationMember{})
+	user := &User{Id: 1, Username: "member", Quota: 1000}
+	CreateTestRecords(t, user)
+	org := &Organization{Name: "test", OwnerId: user.Id, Quota: 500}
+	if err := CreateOrganization(org); err != nil {
+		t.Fatalf("create organization: %v", err)
+	}
+
+	if err := DecreaseBillingQuota(org.Id, user.Id, 200); err != nil {
+		t.Fatalf("decrease billing quota: %v", err)
+	}
+	if got := GetTestRecord[Organization](t, org.Id); got.Quota != 300 || got.UsedQuota != 200 {
+		t.Fatalf("after charge: quota=%d used=%d", got.Quota, got.UsedQuota)
+	}
+	if member, err := GetOrganizationMember(org.Id, user.Id); err != nil || member.UsedQuota != 200 {
+		t.Fatalf("after charge: member=%+v err=%v", member, err)
+	}
+
+	// 任务失败退款返还到组织额度池，而不是成员的个人额度
+	if err := IncreaseBillingQuota(org.Id, user.Id, 200); err != nil {
+		t.Fatalf("increase billing quota: %v", err)
+	}
+	if got := GetTestRecord[Organization](t, org.Id); got.Quota != 500 || got.UsedQuota != 0 {
+		t.Fatalf("after refund: quota=%d used=%d", got.Quota, got.UsedQuota)
+	}
+	if member, err := GetOrganizationMember(org.Id, user.Id); err != nil || member.UsedQuota != 0 {
+		t.Fatalf("after refund: member=%+v err=%v", member, err)
+	}
+	if got := GetTestRecord[User](t, user.Id); got.Quota != 1000 {
+		t.Fatalf("user quota changed to %d", got.Quota)
+	}
+}
+
+func TestBillingQuotaWithoutOrganizationUsesUserQuota(t *testing.T) {
+	SetupTestDB(t, &User{})
+	user := &User{Id: 1, Username: "user", Quota: 1000}
+	CreateTestRecords(t, user)
+
+	if err := DecreaseBillingQuota(0, user.Id, 300); err != nil {
+		t.Fatalf("decrease billing quota: %v", err)
+	}
+	if err := IncreaseBillingQuota(0, user.Id, 100); err != nil {
+		t.Fatalf("increase billing quota: %v", err)
+	}
+	if got := GetTestRecord[User](t, user.Id); got.Quota != 800 {
+		t.Fatalf("user quota = %d, want 800", got.Quota)
+	}
+}
+
+func TestGetOrganizationCacheReadsDatabaseWithoutRedis(t *testing.T) {
+	SetupTestDB(t, &Organization{}, &OrganizationMember{})
+	org := &Organization{Name: "test", OwnerId: 1}
+	if err := CreateOrganization(org); err != nil {
+		t.Fatalf("create organization: %v", err)
+	}
+	org.Group = "vip"
+	org.Status = OrganizationStatusDisabled
+	if err := UpdateOrganization(org); err != nil {
+		t.Fatalf("update organization: %v", err)
+	}
+
+	cached, err := GetOrganizationCache(org.Id)
+	if err != nil {
+		t.Fatalf("get organization cache: %v", err)
+	}
+	if cached.Group != "vip" || cached.Status != OrganizationStatusDisabled {
+		t.Fatalf("cached organization = %+v", cached)
+	}
+}
+
+func TestDecreaseOrganizationQuotaRejectsOverdraft(t *testing.T) {
+	SetupTestDB(t, &Organization{}, &OrganizationMember{})
+	org := &Organization{Name: "test", OwnerId: 1, Quota: 100}
+	if err := CreateOrganization(org); err != nil {
+		t.Fatalf("create organization: %v", err)
+	}
+
+	if err := DecreaseOrganizationQuota(org.Id, 1, 150); !errors.Is(err, ErrOrganizationQuotaNotEnough) {
+		t.Fatalf("decrease = %v, want ErrOrganizationQuotaNotEnough", err)
+	}
+	if got := GetTestRecord[Organization](t, org.Id); got.Quota != 100 || got.UsedQuota != 0 {
+		t.Fatalf("after rejected charge: quota=%d used=%d", got.Quota, got.UsedQuota)
+	}
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm/clause"
+)
+
+// ResponseCache 未启用 Redis 时保存在数据库中的响应缓存
+type ResponseCache struct {
+	Id        int             `json:"id"`
+	CacheKey  string          `json:"cache_key" gorm:"type:varchar(64);uniqueIndex"`
+	Response  json.RawMessage `json:"response" gorm:"type:json"`
+	CreatedAt int64           `json:"created_at" gorm:"bigint"`
+	ExpiresAt int64           `json:"expires_at" gorm:"bigint;index"`
+}
+
+func GetResponseCache(cacheKey string) (*ResponseCache, error) {
+	var cache ResponseCache
+	err := DB.Where("cache_key = ?", cacheKey).First(&cache).Error
+	if err != nil {
+		return nil, err
+	}
+	if cache.ExpiresAt < common.GetTimestamp() {
+		return nil, errors.New("response cache has expired")
+	}
+	return &cache, nil
+}
+
+// SaveResponseCache 写入缓存，key 已存在时覆盖
+func SaveResponseCache(cache *ResponseCache) error {
+	if cache.CreatedAt == 0 {
+		cache.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "cache_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"response", "created_at", "expires_at"}),
+	}).Create(cache).Error
+}
+
+func DeleteExpiredResponseCaches() (int64, error) {
+	result := DB.Where("expires_at < ?", common.GetTimestamp()).Delete(&ResponseCache{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,97 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// 沿 previous_response_id 回溯的最大轮数，防止异常数据形成环
+const storedResponseMaxChainLength = 1000
+
+var ErrStoredResponseExpired = errors.New("response has expired")
+
+// StoredResponse 网关保存的 Responses API 结果，Input 只保存本轮客户端传入的输入，
+// 完整对话通过 PreviousResponseId 逐轮回溯拼接；同一对话各轮共用首轮的 response id 作为 ConversationId，一次查出整段对话
+type StoredResponse struct {
+	Id                 int             `json:"id"`
+	ResponseId         string          `json:"response_id" gorm:"type:varchar(128);uniqueIndex"`
+	PreviousResponseId string          `json:"previous_response_id" gorm:"type:varchar(128)"`
+	ConversationId     string          `json:"conversation_id" gorm:"type:varchar(128);index"`
+	UserId             int             `json:"user_id" gorm:"index"`
+	ModelName          string          `json:"model_name" gorm:"type:varchar(255)"`
+	ChannelId          int             `json:"channel_id"`
+	Input              json.RawMessage `json:"input" gorm:"type:json"`
+	Response           json.RawMessage `json:"response" gorm:"type:json"`
+	CreatedAt          int64           `json:"created_at" gorm:"bigint;index"`
+	ExpiresAt          int64           `json:"expires_at" gorm:"bigint;index;default:0"`
+}
+
+func (r *StoredResponse) Insert() error {
+	if r.CreatedAt == 0 {
+		r.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(r).Error
+}
+
+func (r *StoredResponse) Delete() error {
+	return DB.Delete(r).Error
+}
+
+func GetUserStoredResponse(userId int, responseId string) (*StoredResponse, error) {
+	if responseId == "" {
+		return nil, errors.New("response id is empty")
+	}
+	var response StoredResponse
+	err := DB.Where("user_id = ? and response_id = ?", userId, responseId).First(&response).Error
+	if err != nil {
+		return nil, err
+	}
+	if response.ExpiresAt > 0 && response.ExpiresAt < common.GetTimestamp() {
+		return nil, ErrStoredResponseExpired
+	}
+	return &response, nil
+}
+
+// GetUserStoredResponseChain 从 responseId 沿 previous_response_id 回溯整段对话，按时间先后返回；
+// 同一对话的各轮按 conversationId 一次查出，未记录对话 id 的旧数据逐轮查询。链上任意一轮缺失或过期时返回对应错误
+func GetUserStoredResponseChain(userId int, conversationId string, responseId string) ([]*StoredResponse, error) {
+	byId := make(map[string]*StoredResponse)
+	if conversationId != "" && responseId != "" {
+		var responses []*StoredResponse
+		if err := DB.Where("user_id = ? and conversation_id = ?", userId, conversationId).Find(&responses).Error; err != nil {
+			return nil, err
+		}
+		for _, response := range responses {
+			byId[response.ResponseId] = response
+		}
+	}
+	now := common.GetTimestamp()
+	var chain []*StoredResponse
+	for responseId != "" {
+		if len(chain) >= storedResponseMaxChainLength {
+			return nil, errors.New("response chain is too long")
+		}
+		response, ok := byId[responseId]
+		if !ok {
+			var err error
+			if response, err = GetUserStoredResponse(userId, responseId); err != nil {
+				return nil, err
+			}
+		} else if response.ExpiresAt > 0 && response.ExpiresAt < now {
+			return nil, ErrStoredResponseExpired
+		}
+		chain = append(chain, response)
+		responseId = response.PreviousResponseId
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
+
+func DeleteExpiredStoredResponses() (int64, error) {
+	result := DB.Where("expires_at > 0 and expires_at < ?", common.GetTimestamp()).Delete(&StoredResponse{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGetUserStoredResponseChainByConversation(t *testing.T) {
+	SetupTestDB(t, &StoredResponse{})
+	// resp_1 为未记录对话 id 的旧数据，之后的轮次沿用它作为对话 id
+	responses := []*StoredResponse{
+		{ResponseId: "resp_1", UserId: 1},
+		{ResponseId: "resp_2", PreviousResponseId: "resp_1", ConversationId: "resp_1", UserId: 1},
+		{ResponseId: "resp_3", PreviousResponseId: "resp_2", ConversationId: "resp_1", UserId: 1},
+		{ResponseId: "resp_3b", PreviousResponseId: "resp_2", ConversationId: "resp_1", UserId: 1},
+	}
+	for _, response := range responses {
+		if err := response.Insert(); err != nil {
+			t.Fatalf("insert response: %v", err)
+		}
+	}
+
+	chain, err := GetUserStoredResponseChain(1, "resp_1", "resp_3")
+	if err != nil {
+		t.Fatalf("get chain: %v", err)
+	}
+	if len(chain) != 3 || chain[0].ResponseId != "resp_1" || chain[1].ResponseId != "resp_2" || chain[2].ResponseId != "resp_3" {
+		t.Fatalf("chain = %v", chain)
+	}
+
+	if err := DB.Model(&StoredResponse{}).Where("response_id = ?", "resp_2").Update("expires_at", 1).Error; err != nil {
+		t.Fatalf("expire response: %v", err)
+	}
+	if _, err := GetUserStoredResponseChain(1, "resp_1", "resp_3"); !errors.Is(err, ErrStoredResponseExpired) {
+		t.Fatalf("chain with expired turn = %v, want ErrStoredResponseExpired", err)
+	}
+	if _, err := GetUserStoredResponseChain(2, "resp_1", "resp_3"); err == nil {
+		t.Fatalf("expected other user's chain to be missing")
+	}
+}
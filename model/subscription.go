@@ -0,0 +1,242 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+
+	"gorm.io/gorm"
+)
+
+const (
+	SubscriptionStatusActive   = "active"
+	SubscriptionStatusPastDue  = "past_due"
+	SubscriptionStatusCanceled = "canceled"
+)
+
+const PaymentMethodStripeSubscription = "stripe_subscription"
+
+// SubscriptionPlan 订阅套餐，每次续费时发放 Quota 并将用户切换到 Group
+type SubscriptionPlan struct {
+	Id            int     `json:"id"`
+	Name          string  `json:"name" gorm:"type:varchar(64)"`
+	Description   string  `json:"description" gorm:"type:text"`
+	Price         float64 `json:"price"`
+	Currency      string  `json:"currency" gorm:"type:varchar(8)"`
+	Interval      string  `json:"interval" gorm:"type:varchar(16);default:'month'"`
+	StripePriceId string  `json:"stripe_price_id" gorm:"type:varchar(128);index"`
+	Quota         int     `json:"quota"`
+	Group         string  `json:"group" gorm:"type:varchar(64)"`
+	Enabled       bool    `json:"enabled"`
+	CreatedAt     int64   `json:"created_at" gorm:"bigint"`
+	UpdatedAt     int64   `json:"updated_at" gorm:"bigint"`
+}
+
+// UserSubscription 用户的订阅记录，PreviousGroup 为订阅前的分组，取消后恢复
+type UserSubscription struct {
+	Id                   int    `json:"id"`
+	UserId               int    `json:"user_id" gorm:"index"`
+	PlanId               int    `json:"plan_id" gorm:"index"`
+	StripeSubscriptionId string `json:"stripe_subscription_id" gorm:"type:varchar(128);uniqueIndex"`
+	Status               string `json:"status" gorm:"type:varchar(16);index"`
+	PreviousGroup        string `json:"previous_group" gorm:"type:varchar(64)"`
+	CurrentPeriodStart   int64  `json:"current_period_start" gorm:"bigint"`
+	CurrentPeriodEnd     int64  `json:"current_period_end" gorm:"bigint"`
+	CancelAtPeriodEnd    bool   `json:"cancel_at_period_end"`
+	CanceledAt           int64  `json:"canceled_at" gorm:"bigint;default:0"`
+	CreatedAt            int64  `json:"created_at" gorm:"bigint"`
+	UpdatedAt            int64  `json:"updated_at" gorm:"bigint"`
+	PlanName             string `json:"plan_name" gorm:"-:all"`
+}
+
+func GetSubscriptionPlans(enabledOnly bool) ([]*SubscriptionPlan, error) {
+	var plans []*SubscriptionPlan
+	tx := DB.Order("price asc, id asc")
+	if enabledOnly {
+		tx = tx.Where("enabled = ?", true)
+	}
+	err := tx.Find(&plans).Error
+	return plans, err
+}
+
+func GetSubscriptionPlanById(id int) (*SubscriptionPlan, error) {
+	var plan SubscriptionPlan
+	if err := DB.First(&plan, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+func GetSubscriptionPlanByStripePriceId(priceId string) (*SubscriptionPlan, error) {
+	var plan SubscriptionPlan
+	if err := DB.Where("stripe_price_id = ?", priceId).First(&plan).Error; err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+func (plan *SubscriptionPlan) Insert() error {
+	plan.CreatedAt = common.GetTimestamp()
+	plan.UpdatedAt = plan.CreatedAt
+	return DB.Create(plan).Error
+}
+
+func (plan *SubscriptionPlan) Update() error {
+	plan.UpdatedAt = common.GetTimestamp()
+	return DB.Model(plan).Select("name", "description", "price", "currency", "interval", "stripe_price_id", "quota", "group", "enabled", "updated_at").Updates(plan).Error
+}
+
+// DeleteSubscriptionPlan 仍有生效中的订阅时不允许删除
+func DeleteSubscriptionPlan(id int) error {
+	var count int64
+	if err := DB.Model(&UserSubscription{}).Where("plan_id = ? and status <> ?", id, SubscriptionStatusCanceled).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("该套餐仍有生效中的订阅，请先停用")
+	}
+	return DB.Delete(&SubscriptionPlan{}, id).Error
+}
+
+func GetUserSubscriptionByStripeId(stripeSubscriptionId string) (*UserSubscription, error) {
+	var sub UserSubscription
+	if err := DB.Where("stripe_subscription_id = ?", stripeSubscriptionId).First(&sub).Error; err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// GetActiveUserSubscription 返回用户当前未取消的订阅
+func GetActiveUserSubscription(userId int) (*UserSubscription, error) {
+	var sub UserSubscription
+	if err := DB.Where("user_id = ? and status <> ?", userId, SubscriptionStatusCanceled).Order("id desc").First(&sub).Error; err != nil {
+		return nil, err
+	}
+	if plan, err := GetSubscriptionPlanById(sub.PlanId); err == nil {
+		sub.PlanName = plan.Name
+	}
+	return &sub, nil
+}
+
+// GetUserSubscriptions userId 为 0 时返回所有用户的订阅
+func GetUserSubscriptions(userId int, startIdx int, num int) (subs []*UserSubscription, total int64, err error) {
+	tx := DB.Model(&UserSubscription{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&subs).Error; err != nil {
+		return nil, 0, err
+	}
+	planNames := make(map[int]string)
+	for _, sub := range subs {
+		if _, ok := planNames[sub.PlanId]; !ok {
+			if plan, err := GetSubscriptionPlanById(sub.PlanId); err == nil {
+				planNames[sub.PlanId] = plan.Name
+			}
+		}
+		sub.PlanName = planNames[sub.PlanId]
+	}
+	return subs, total, nil
+}
+
+// UpdateUserSubscriptionState 同步 Stripe 订阅的状态与当前账期
+func UpdateUserSubscriptionState(sub *UserSubscription) error {
+	sub.UpdatedAt = common.GetTimestamp()
+	return DB.Model(sub).Select("status", "current_period_start", "current_period_end", "cancel_at_period_end", "updated_at").Updates(sub).Error
+}
+
+// RenewUserSubscription 订阅首次付款或续费成功时发放套餐额度并切换分组，以账单号作为充值订单号保证每期只发放一次
+func RenewUserSubscription(sub *UserSubscription, plan *SubscriptionPlan, invoiceId string, money float64) (granted bool, err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&TopUp{}).Where("trade_no = ?", invoiceId).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+		var user User
+		if err := tx.Select("id", "group").Where("id = ?", sub.UserId).First(&user).Error; err != nil {
+			return err
+		}
+		now := common.GetTimestamp()
+		if sub.Id == 0 {
+			sub.PreviousGroup = user.Group
+			sub.CreatedAt = now
+		}
+		sub.PlanId = plan.Id
+		sub.Status = SubscriptionStatusActive
+		sub.UpdatedAt = now
+		if err := tx.Save(sub).Error; err != nil {
+			return err
+		}
+		topUp := &TopUp{
+			UserId:        sub.UserId,
+			Amount:        int64(float64(plan.Quota) / common.QuotaPerUnit),
+			Money:         money,
+			TradeNo:       invoiceId,
+			PaymentMethod: PaymentMethodStripeSubscription,
+			CreateTime:    now,
+			CompleteTime:  now,
+			Status:        common.TopUpStatusSuccess,
+		}
+		if err := tx.Create(topUp).Error; err != nil {
+			return err
+		}
+		updates := map[string]interface{}{"quota": gorm.Expr("quota + ?", plan.Quota)}
+		if plan.Group != "" {
+			updates["group"] = plan.Group
+		}
+		if err := tx.Model(&User{}).Where("id = ?", sub.UserId).Updates(updates).Error; err != nil {
+			return err
+		}
+		granted = true
+		return nil
+	})
+	if err != nil || !granted {
+		return granted, err
+	}
+	if err = invalidateUserCache(sub.UserId); err != nil {
+		common.SysLog("failed to invalidate user cache: " + err.Error())
+	}
+	RecordLog(sub.UserId, LogTypeTopup, fmt.Sprintf("订阅套餐 %s 续费成功，发放额度 %s，支付金额 %.2f", plan.Name, logger.LogQuota(plan.Quota), money))
+	return true, nil
+}
+
+// CancelUserSubscription 订阅结束后恢复用户订阅前的分组，管理员已手动调整过分组时不再覆盖
+func CancelUserSubscription(sub *UserSubscription) error {
+	if sub.Status == SubscriptionStatusCanceled {
+		return nil
+	}
+	plan, _ := GetSubscriptionPlanById(sub.PlanId)
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		now := common.GetTimestamp()
+		sub.Status = SubscriptionStatusCanceled
+		sub.CanceledAt = now
+		sub.UpdatedAt = now
+		if err := tx.Model(sub).Select("status", "canceled_at", "updated_at").Updates(sub).Error; err != nil {
+			return err
+		}
+		if plan == nil || plan.Group == "" || sub.PreviousGroup == "" {
+			return nil
+		}
+		return tx.Model(&User{}).Where("id = ? and "+commonGroupCol+" = ?", sub.UserId, plan.Group).Update("group", sub.PreviousGroup).Error
+	})
+	if err != nil {
+		return err
+	}
+	if err = invalidateUserCache(sub.UserId); err != nil {
+		common.SysLog("failed to invalidate user cache: " + err.Error())
+	}
+	RecordLog(sub.UserId, LogTypeManage, "订阅已取消，恢复为分组 "+sub.PreviousGroup)
+	return nil
+}
+
+func UpdateUserStripeCustomer(userId int, customerId string) error {
+	return DB.Model(&User{}).Where("id = ?", userId).Update("stripe_customer", customerId).Error
+}
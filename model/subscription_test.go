@@ -0,0 +1,88 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestRenewUserSubscriptionGrantsOncePerInvoice(t *testing.T) {
+	SetupTestDB(t, &User{}, &TopUp{}, &Log{}, &SubscriptionPlan{}, &UserSubscription{})
+	user := &User{Id: 1, Username: "subscriber", Group: "default", Quota: 100}
+	plan := &SubscriptionPlan{Name: "Pro", Price: 20, Quota: 1000, Group: "vip", Enabled: true}
+	CreateTestRecords(t, user, plan)
+	sub := &UserSubscription{UserId: user.Id, StripeSubscriptionId: "sub_1"}
+
+	granted, err := RenewUserSubscription(sub, plan, "in_1", 20)
+	if err != nil || !granted {
+		t.Fatalf("first renewal: granted=%v err=%v", granted, err)
+	}
+	// Stripe 重复投递同一张账单的事件时不重复发放
+	granted, err = RenewUserSubscription(sub, plan, "in_1", 20)
+	if err != nil || granted {
+		t.Fatalf("duplicate renewal: granted=%v err=%v", granted, err)
+	}
+	if got := GetTestRecord[User](t, user.Id); got.Quota != 1100 || got.Group != "vip" {
+		t.Fatalf("after renewal quota=%d group=%s", got.Quota, got.Group)
+	}
+
+	granted, err = RenewUserSubscription(sub, plan, "in_2", 20)
+	if err != nil || !granted {
+		t.Fatalf("second renewal: granted=%v err=%v", granted, err)
+	}
+	if got := GetTestRecord[User](t, user.Id); got.Quota != 2100 {
+		t.Fatalf("after second renewal quota=%d", got.Quota)
+	}
+	stored, err := GetUserSubscriptionByStripeId("sub_1")
+	if err != nil {
+		t.Fatalf("get subscription: %v", err)
+	}
+	if stored.PreviousGroup != "default" || stored.Status != SubscriptionStatusActive {
+		t.Fatalf("subscription previous group=%s status=%s", stored.PreviousGroup, stored.Status)
+	}
+}
+
+func TestCancelUserSubscriptionRestoresPreviousGroup(t *testing.T) {
+	SetupTestDB(t, &User{}, &TopUp{}, &Log{}, &SubscriptionPlan{}, &UserSubscription{})
+	user := &User{Id: 1, Username: "subscriber", Group: "default", Quota: 100}
+	plan := &SubscriptionPlan{Name: "Pro", Price: 20, Quota: 1000, Group: "vip", Enabled: true}
+	CreateTestRecords(t, user, plan)
+	sub := &UserSubscription{UserId: user.Id, StripeSubscriptionId: "sub_1"}
+	if _, err := RenewUserSubscription(sub, plan, "in_1", 20); err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+	if err := DeleteSubscriptionPlan(plan.Id); err == nil {
+		t.Fatalf("expected plan with active subscription to be kept")
+	}
+
+	if err := CancelUserSubscription(sub); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if got := GetTestRecord[User](t, user.Id); got.Group != "default" || got.Quota != 1100 {
+		t.Fatalf("after cancel group=%s quota=%d", got.Group, got.Quota)
+	}
+	if _, err := GetActiveUserSubscription(user.Id); err == nil {
+		t.Fatalf("expected no active subscription")
+	}
+	if err := DeleteSubscriptionPlan(plan.Id); err != nil {
+		t.Fatalf("delete plan: %v", err)
+	}
+}
+
+func TestCancelUserSubscriptionKeepsManuallyChangedGroup(t *testing.T) {
+	SetupTestDB(t, &User{}, &TopUp{}, &Log{}, &SubscriptionPlan{}, &UserSubscription{})
+	user := &User{Id: 1, Username: "subscriber", Group: "default", Quota: 100}
+	plan := &SubscriptionPlan{Name: "Pro", Price: 20, Quota: 1000, Group: "vip", Enabled: true}
+	CreateTestRecords(t, user, plan)
+	sub := &UserSubscription{UserId: user.Id, StripeSubscriptionId: "sub_1"}
+	if _, err := RenewUserSubscription(sub, plan, "in_1", 20); err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+	if err := DB.Model(&User{}).Where("id = ?", user.Id).Update("group", "enterprise").Error; err != nil {
+		t.Fatalf("update group: %v", err)
+	}
+	if err := CancelUserSubscription(sub); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if got := GetTestRecord[User](t, user.Id); got.Group != "enterprise" {
+		t.Fatalf("after cancel group=%s", got.Group)
+	}
+}
@@ -40,23 +40,25 @@ const (
 )
 
 type Task struct {
-	ID         int64                 `json:"id" gorm:"primary_key;AUTO_INCREMENT"`
-	CreatedAt  int64                 `json:"created_at" gorm:"index"`
-	UpdatedAt  int64                 `json:"updated_at"`
-	TaskID     string                `json:"task_id" gorm:"type:varchar(191);index"` // 第三方id，不一定有/ song id\ Task id
-	Platform   constant.TaskPlatform `json:"platform" gorm:"type:varchar(30);index"` // 平台
-	UserId     int                   `json:"user_id" gorm:"index"`
-	Group      string                `json:"group" gorm:"type:varchar(50)"` // 修正计费用
-	ChannelId  int                   `json:"channel_id" gorm:"index"`
-	Quota      int                   `json:"quota"`
-	Action     string                `json:"action" gorm:"type:varchar(40);index"` // 任务类型, song, lyrics, description-mode
-	Status     TaskStatus            `json:"status" gorm:"type:varchar(20);index"` // 任务状态
-	FailReason string                `json:"fail_reason"`
-	SubmitTime int64                 `json:"submit_time" gorm:"index"`
-	StartTime  int64                 `json:"start_time" gorm:"index"`
-	FinishTime int64                 `json:"finish_time" gorm:"index"`
-	Progress   string                `json:"progress" gorm:"type:varchar(20);index"`
-	Properties Properties            `json:"properties" gorm:"type:json"`
+	ID        int64                 `json:"id" gorm:"primary_key;AUTO_INCREMENT"`
+	CreatedAt int64                 `json:"created_at" gorm:"index"`
+	UpdatedAt int64                 `json:"updated_at"`
+	TaskID    string                `json:"task_id" gorm:"type:varchar(191);index"` // 第三方id，不一定有/ song id\ Task id
+	Platform  constant.TaskPlatform `json:"platform" gorm:"type:varchar(30);index"` // 平台
+	UserId    int                   `json:"user_id" gorm:"index"`
+	// 组织令牌提交的任务记录扣费的组织，退款返还组织额度池
+	OrganizationId int        `json:"organization_id" gorm:"default:0"`
+	Group          string     `json:"group" gorm:"type:varchar(50)"` // 修正计费用
+	ChannelId      int        `json:"channel_id" gorm:"index"`
+	Quota          int        `json:"quota"`
+	Action         string     `json:"action" gorm:"type:varchar(40);index"` // 任务类型, song, lyrics, description-mode
+	Status         TaskStatus `json:"status" gorm:"type:varchar(20);index"` // 任务状态
+	FailReason     string     `json:"fail_reason"`
+	SubmitTime     int64      `json:"submit_time" gorm:"index"`
+	StartTime      int64      `json:"start_time" gorm:"index"`
+	FinishTime     int64      `json:"finish_time" gorm:"index"`
+	Progress       string     `json:"progress" gorm:"type:varchar(20);index"`
+	Properties     Properties `json:"properties" gorm:"type:json"`
 	// 禁止返回给用户，内部可能包含key等隐私信息
 	PrivateData TaskPrivateData `json:"-" gorm:"column:private_data;type:json"`
 	Data        json.RawMessage `json:"data" gorm:"type:json"`
@@ -142,15 +144,16 @@ func InitTask(platform constant.TaskPlatform, relayInfo *commonRelay.RelayInfo)
 	}
 
 	t := &Task{
-		UserId:      relayInfo.UserId,
-		Group:       relayInfo.UsingGroup,
-		SubmitTime:  time.Now().Unix(),
-		Status:      TaskStatusNotStart,
-		Progress:    "0%",
-		ChannelId:   relayInfo.ChannelId,
-		Platform:    platform,
-		Properties:  properties,
-		PrivateData: privateData,
+		UserId:         relayInfo.UserId,
+		OrganizationId: relayInfo.OrganizationId,
+		Group:          relayInfo.UsingGroup,
+		SubmitTime:     time.Now().Unix(),
+		Status:         TaskStatusNotStart,
+		Progress:       "0%",
+		ChannelId:      relayInfo.ChannelId,
+		Platform:       platform,
+		Properties:     properties,
+		PrivateData:    privateData,
 	}
 	return t
 }
@@ -440,3 +443,22 @@ func (t *Task) ToOpenAIVideo() *dto.OpenAIVideo {
 	openAIVideo.SetMetadata("url", t.FailReason)
 	return openAIVideo
 }
+
+// CountUnfinishedTasksByPlatform 按平台统计未完成的异步任务数量
+func CountUnfinishedTasksByPlatform() (map[string]int64, error) {
+	var rows []struct {
+		Platform string
+		Count    int64
+	}
+	err := DB.Model(&Task{}).Select("platform, count(*) as count").
+		Where("progress != ?", "100%").Where("status not in ?", []TaskStatus{TaskStatusFailure, TaskStatusSuccess}).
+		Group("platform").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		result[row.Platform] = row.Count
+	}
+	return result, nil
+}
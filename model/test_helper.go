@@ -0,0 +1,79 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// SetupTestDB 供各包测试使用：为单个测试创建独立的内存 SQLite 数据库并迁移所需的表，
+// 清空进程内缓存，测试结束后恢复原来的数据库
+func SetupTestDB(t testing.TB, models ...any) {
+	t.Helper()
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", name)), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	if err = db.AutoMigrate(models...); err != nil {
+		t.Fatalf("migrate test db: %v", err)
+	}
+	initCol()
+	oldDB, oldLogDB, oldRedisEnabled := DB, LOG_DB, common.RedisEnabled
+	DB, LOG_DB = db, db
+	// 测试不连接 Redis，缓存读写直接回落到数据库
+	common.RedisEnabled = false
+	resetLocalCaches()
+	t.Cleanup(func() {
+		DB, LOG_DB = oldDB, oldLogDB
+		common.RedisEnabled = oldRedisEnabled
+		resetLocalCaches()
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+}
+
+// resetLocalCaches 清空进程内缓存，切换数据库后缓存中的数据已失效
+func resetLocalCaches() {
+	budgetCacheLock.Lock()
+	budgetCache = make(map[string]budgetCacheEntry)
+	budgetCacheLock.Unlock()
+	creditCacheLock.Lock()
+	creditCache = make(map[int]creditCacheEntry)
+	creditCacheLock.Unlock()
+}
+
+// CreateTestRecords 在测试数据库中插入记录，实现了 Insert 的模型走 Insert 以补齐默认字段，失败时终止测试
+func CreateTestRecords(t testing.TB, records ...any) {
+	t.Helper()
+	for _, record := range records {
+		var err error
+		if inserter, ok := record.(interface{ Insert() error }); ok {
+			err = inserter.Insert()
+		} else {
+			err = DB.Create(record).Error
+		}
+		if err != nil {
+			t.Fatalf("create %T: %v", record, err)
+		}
+	}
+}
+
+// GetTestRecord 按主键读取测试数据库中的记录，失败时终止测试
+func GetTestRecord[T any](t testing.TB, id int) *T {
+	t.Helper()
+	var record T
+	if err := DB.First(&record, id).Error; err != nil {
+		t.Fatalf("get %T %d: %v", record, id, err)
+	}
+	return &record
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/metrics"
 	"github.com/bytedance/gopkg/util/gopool"
 	"gorm.io/gorm"
 )
@@ -27,6 +28,11 @@ type Token struct {
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
 	CrossGroupRetry    bool           `json:"cross_group_retry" gorm:"default:false"` // 跨分组重试，仅auto分组有效
+	ResponseCache      bool           `json:"response_cache" gorm:"default:false"`    // 开启网关响应缓存
+	BodyCapture        bool           `json:"body_capture" gorm:"default:false"`      // 记录请求与响应内容
+	TPMLimit           int            `json:"tpm_limit" gorm:"default:0"`             // 每分钟 token 数限制，0 表示不限制
+	ConcurrencyLimit   int            `json:"concurrency_limit" gorm:"default:0"`     // 并发请求数限制，0 表示不限制
+	OrganizationId     int            `json:"organization_id" gorm:"default:0;index"` // 所属组织，消耗从组织额度池中扣除
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -156,6 +162,7 @@ func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
 	if !fromDB && common.RedisEnabled {
 		// Try Redis first
 		token, err := cacheGetTokenByKey(key)
+		metrics.RecordCacheResult("token", err == nil)
 		if err == nil {
 			return token, nil
 		}
@@ -185,7 +192,7 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry", "response_cache", "body_capture", "tpm_limit", "concurrency_limit").Updates(token).Error
 	return err
 }
 
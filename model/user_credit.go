@@ -0,0 +1,292 @@
+package model
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/metrics"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	UserCreditStatusActive    = 1
+	UserCreditStatusSuspended = 2
+)
+
+const (
+	SettlementStatusPending = "pending"
+	SettlementStatusPaid    = "paid"
+	SettlementStatusOverdue = "overdue"
+	// 欠款已计入之后账期的结算单，不再单独结清
+	SettlementStatusSuperseded = "superseded"
+)
+
+// 信用额度的本地缓存时间，其他节点修改信用额度后最多延迟该时间生效
+const creditCacheSeconds = 60
+
+// UserCredit 后付费用户的信用额度，允许用户额度透支到 -CreditLimit，没有记录的用户为预付费
+type UserCredit struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex"`
+	CreditLimit int    `json:"credit_limit"`
+	GraceDays   int    `json:"grace_days" gorm:"default:0"`
+	Status      int    `json:"status" gorm:"default:1"`
+	SuspendedAt int64  `json:"suspended_at" gorm:"bigint;default:0"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint"`
+	UpdatedAt   int64  `json:"updated_at" gorm:"bigint"`
+	Username    string `json:"username" gorm:"-:all"`
+	Quota       int    `json:"quota" gorm:"-:all"`
+}
+
+// CreditSettlement 后付费用户的月度结算单，Amount 为账期结束时的全部欠款，包含被取代的旧结算单
+type CreditSettlement struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex:idx_settlement_user_period,priority:1"`
+	PeriodStart int64  `json:"period_start" gorm:"bigint;uniqueIndex:idx_settlement_user_period,priority:2"`
+	PeriodEnd   int64  `json:"period_end" gorm:"bigint"`
+	Amount      int    `json:"amount"`
+	InvoiceId   int    `json:"invoice_id" gorm:"default:0"`
+	DueAt       int64  `json:"due_at" gorm:"bigint"`
+	Status      string `json:"status" gorm:"type:varchar(16);index"`
+	PaidAt      int64  `json:"paid_at" gorm:"bigint;default:0"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint"`
+}
+
+func GetUserCredit(userId int) (*UserCredit, error) {
+	var credit UserCredit
+	if err := DB.Where("user_id = ?", userId).First(&credit).Error; err != nil {
+		return nil, err
+	}
+	return &credit, nil
+}
+
+type creditCacheEntry struct {
+	quota    int
+	expireAt int64
+}
+
+var (
+	creditCache          = make(map[int]creditCacheEntry)
+	creditCacheLock      sync.RWMutex
+	creditCacheLastSweep int64
+)
+
+func invalidateCreditCache(userId int) {
+	creditCacheLock.Lock()
+	defer creditCacheLock.Unlock()
+	delete(creditCache, userId)
+}
+
+// GetUserCreditQuota 返回用户可透支的额度，预付费或已暂停的用户为 0；每次请求都会调用，结果在本地缓存
+func GetUserCreditQuota(userId int) int {
+	now := common.GetTimestamp()
+	creditCacheLock.RLock()
+	entry, ok := creditCache[userId]
+	creditCacheLock.RUnlock()
+	hit := ok && entry.expireAt > now
+	metrics.RecordCacheResult("credit", hit)
+	if hit {
+		return entry.quota
+	}
+
+	quota := 0
+	credit, err := GetUserCredit(userId)
+	if err == nil && credit.Status == UserCreditStatusActive {
+		quota = credit.CreditLimit
+	} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		// 查询失败时不缓存，按预付费处理
+		return 0
+	}
+	creditCacheLock.Lock()
+	defer creditCacheLock.Unlock()
+	if now-creditCacheLastSweep >= creditCacheSeconds {
+		creditCacheLastSweep = now
+		for k, e := range creditCache {
+			if e.expireAt <= now {
+				delete(creditCache, k)
+			}
+		}
+	}
+	creditCache[userId] = creditCacheEntry{quota: quota, expireAt: now + creditCacheSeconds}
+	return quota
+}
+
+// GetUserAvailableQuota 返回用户额度与可透支额度之和
+func GetUserAvailableQuota(userId int) (int, error) {
+	quota, err := GetUserQuota(userId, false)
+	if err != nil {
+		return 0, err
+	}
+	return quota + GetUserCreditQuota(userId), nil
+}
+
+func GetAllUserCredits(startIdx int, num int) (credits []*UserCredit, total int64, err error) {
+	if err = DB.Model(&UserCredit{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err = DB.Order("id desc").Limit(num).Offset(startIdx).Find(&credits).Error; err != nil {
+		return nil, 0, err
+	}
+	for _, credit := range credits {
+		credit.Username, _ = GetUsernameById(credit.UserId, false)
+		credit.Quota, _ = GetUserQuota(credit.UserId, false)
+	}
+	return credits, total, nil
+}
+
+func GetUserCredits() ([]*UserCredit, error) {
+	var credits []*UserCredit
+	err := DB.Find(&credits).Error
+	return credits, err
+}
+
+// SaveUserCredit 创建或更新用户的信用额度
+func SaveUserCredit(credit *UserCredit) error {
+	now := common.GetTimestamp()
+	credit.CreatedAt = now
+	credit.UpdatedAt = now
+	if credit.Status == 0 {
+		credit.Status = UserCreditStatusActive
+	}
+	defer invalidateCreditCache(credit.UserId)
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"credit_limit", "grace_days", "status", "suspended_at", "updated_at"}),
+	}).Create(credit).Error
+}
+
+// DeleteUserCredit 恢复为预付费，仍有欠款时不允许
+func DeleteUserCredit(userId int) error {
+	quota, err := GetUserQuota(userId, true)
+	if err != nil {
+		return err
+	}
+	if quota < 0 {
+		return errors.New("用户仍有欠款，结清后才能恢复为预付费")
+	}
+	defer invalidateCreditCache(userId)
+	return DB.Where("user_id = ?", userId).Delete(&UserCredit{}).Error
+}
+
+func SetUserCreditStatus(userId int, status int) error {
+	updates := map[string]interface{}{"status": status, "updated_at": common.GetTimestamp()}
+	if status == UserCreditStatusSuspended {
+		updates["suspended_at"] = common.GetTimestamp()
+	} else {
+		updates["suspended_at"] = 0
+	}
+	defer invalidateCreditCache(userId)
+	return DB.Model(&UserCredit{}).Where("user_id = ?", userId).Updates(updates).Error
+}
+
+// Insert 写入结算单；之前未结清的结算单欠款已计入本结算单，标记为已取代，本结算单沿用其中最早的到期时间
+func (settlement *CreditSettlement) Insert() error {
+	settlement.CreatedAt = common.GetTimestamp()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var unpaid []*CreditSettlement
+		err := tx.Where("user_id = ? and period_start < ? and status in ?", settlement.UserId, settlement.PeriodStart,
+			[]string{SettlementStatusPending, SettlementStatusOverdue}).Find(&unpaid).Error
+		if err != nil {
+			return err
+		}
+		ids := make([]int, 0, len(unpaid))
+		for _, old := range unpaid {
+			ids = append(ids, old.Id)
+			if settlement.Status != SettlementStatusPaid && old.DueAt < settlement.DueAt {
+				settlement.DueAt = old.DueAt
+			}
+		}
+		if settlement.Status == SettlementStatusPending && settlement.DueAt < settlement.CreatedAt {
+			settlement.Status = SettlementStatusOverdue
+		}
+		if len(ids) > 0 {
+			err = tx.Model(&CreditSettlement{}).Where("id in ?", ids).Update("status", SettlementStatusSuperseded).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Create(settlement).Error
+	})
+}
+
+func GetCreditSettlementById(id int) (*CreditSettlement, error) {
+	var settlement CreditSettlement
+	if err := DB.First(&settlement, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &settlement, nil
+}
+
+// GetLatestCreditSettlement 返回用户账期最晚的结算单
+func GetLatestCreditSettlement(userId int) (*CreditSettlement, error) {
+	var settlement CreditSettlement
+	if err := DB.Where("user_id = ?", userId).Order("period_start desc").First(&settlement).Error; err != nil {
+		return nil, err
+	}
+	return &settlement, nil
+}
+
+// GetCreditSettlements userId 为 0 时返回所有用户的结算单
+func GetCreditSettlements(userId int, startIdx int, num int) (settlements []*CreditSettlement, total int64, err error) {
+	tx := DB.Model(&CreditSettlement{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&settlements).Error
+	return settlements, total, err
+}
+
+// GetUnpaidCreditSettlements 返回待支付与已逾期的结算单
+func GetUnpaidCreditSettlements() ([]*CreditSettlement, error) {
+	var settlements []*CreditSettlement
+	err := DB.Where("status in ?", []string{SettlementStatusPending, SettlementStatusOverdue}).Find(&settlements).Error
+	return settlements, err
+}
+
+func CountOverdueCreditSettlements(userId int) (int64, error) {
+	var count int64
+	err := DB.Model(&CreditSettlement{}).Where("user_id = ? and status = ?", userId, SettlementStatusOverdue).Count(&count).Error
+	return count, err
+}
+
+func UpdateCreditSettlementStatus(id int, status string) error {
+	updates := map[string]interface{}{"status": status}
+	if status == SettlementStatusPaid {
+		updates["paid_at"] = common.GetTimestamp()
+	}
+	return DB.Model(&CreditSettlement{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// SettleCreditSettlement 管理员确认线下付款，将结算金额计入用户额度；已取代的结算单欠款已计入新结算单，不能结清
+func SettleCreditSettlement(settlement *CreditSettlement) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&CreditSettlement{}).Where("id = ? and status in ?", settlement.Id,
+			[]string{SettlementStatusPending, SettlementStatusOverdue}).
+			Updates(map[string]interface{}{"status": SettlementStatusPaid, "paid_at": common.GetTimestamp()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("结算单已支付或已被取代")
+		}
+		if settlement.Amount > 0 {
+			return tx.Model(&User{}).Where("id = ?", settlement.UserId).Update("quota", gorm.Expr("quota + ?", settlement.Amount)).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if common.RedisEnabled && settlement.Amount > 0 {
+		if err = cacheIncrUserQuota(settlement.UserId, int64(settlement.Amount)); err != nil {
+			common.SysLog("failed to increase user quota cache: " + err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCreditSettlementInsertSupersedesUnpaid(t *testing.T) {
+	SetupTestDB(t, &CreditSettlement{})
+	now := int64(2000000000)
+	first := &CreditSettlement{UserId: 1, PeriodStart: 100, PeriodEnd: 200, Amount: 300, DueAt: now, Status: SettlementStatusPending}
+	CreateTestRecords(t, first)
+	second := &CreditSettlement{UserId: 1, PeriodStart: 200, PeriodEnd: 300, Amount: 500, DueAt: now + 100, Status: SettlementStatusPending}
+	CreateTestRecords(t, second)
+
+	if got := GetTestRecord[CreditSettlement](t, first.Id); got.Status != SettlementStatusSuperseded {
+		t.Fatalf("first settlement status = %s", got.Status)
+	}
+	// 新结算单沿用旧结算单的到期时间，逾期不会因为生成新账期而延后
+	if got := GetTestRecord[CreditSettlement](t, second.Id); got.Status != SettlementStatusPending || got.DueAt != now {
+		t.Fatalf("second settlement status=%s due=%d", got.Status, got.DueAt)
+	}
+
+	overdue := &CreditSettlement{UserId: 2, PeriodStart: 100, PeriodEnd: 200, Amount: 100, DueAt: 1, Status: SettlementStatusOverdue}
+	CreateTestRecords(t, overdue)
+	next := &CreditSettlement{UserId: 2, PeriodStart: 200, PeriodEnd: 300, Amount: 100, DueAt: now, Status: SettlementStatusPending}
+	CreateTestRecords(t, next)
+	if got := GetTestRecord[CreditSettlement](t, next.Id); got.Status != SettlementStatusOverdue {
+		t.Fatalf("settlement after overdue status = %s", got.Status)
+	}
+}
+
+func TestSettleCreditSettlementCreditsOnlyLatestDebt(t *testing.T) {
+	SetupTestDB(t, &User{}, &CreditSettlement{})
+	user := &User{Id: 1, Username: "postpaid", Quota: -800}
+	CreateTestRecords(t, user)
+	first := &CreditSettlement{UserId: 1, PeriodStart: 100, Amount: 300, DueAt: 2000000000, Status: SettlementStatusPending}
+	CreateTestRecords(t, first)
+	second := &CreditSettlement{UserId: 1, PeriodStart: 200, Amount: 800, DueAt: 2000000000, Status: SettlementStatusPending}
+	CreateTestRecords(t, second)
+
+	if err := SettleCreditSettlement(GetTestRecord[CreditSettlement](t, first.Id)); err == nil {
+		t.Fatalf("expected superseded settlement to be rejected")
+	}
+	if err := SettleCreditSettlement(GetTestRecord[CreditSettlement](t, second.Id)); err != nil {
+		t.Fatalf("settle: %v", err)
+	}
+	if got := GetTestRecord[User](t, user.Id); got.Quota != 0 {
+		t.Fatalf("user quota = %d, want 0", got.Quota)
+	}
+}
+
+func TestGetUserCreditQuotaCachesAndInvalidates(t *testing.T) {
+	SetupTestDB(t, &UserCredit{})
+	if quota := GetUserCreditQuota(1); quota != 0 {
+		t.Fatalf("prepaid credit quota = %d", quota)
+	}
+	// 绕过 SaveUserCredit 写入，缓存未失效时仍返回旧值
+	if err := DB.Create(&UserCredit{UserId: 1, CreditLimit: 1000, Status: UserCreditStatusActive}).Error; err != nil {
+		t.Fatalf("create credit: %v", err)
+	}
+	if quota := GetUserCreditQuota(1); quota != 0 {
+		t.Fatalf("cached credit quota = %d", quota)
+	}
+	if err := SaveUserCredit(&UserCredit{UserId: 1, CreditLimit: 2000}); err != nil {
+		t.Fatalf("save credit: %v", err)
+	}
+	if quota := GetUserCreditQuota(1); quota != 2000 {
+		t.Fatalf("credit quota after save = %d", quota)
+	}
+	if err := SetUserCreditStatus(1, UserCreditStatusSuspended); err != nil {
+		t.Fatalf("suspend credit: %v", err)
+	}
+	if quota := GetUserCreditQuota(1); quota != 0 {
+		t.Fatalf("suspended credit quota = %d", quota)
+	}
+}
+
+func TestConsumeBillingQuotaStopsAtCreditLimit(t *testing.T) {
+	SetupTestDB(t, &User{}, &UserCredit{})
+	CreateTestRecords(t, &User{Id: 1, Username: "postpaid", Quota: 100}, &UserCredit{UserId: 1, CreditLimit: 500, Status: UserCreditStatusActive})
+
+	if err := ConsumeBillingQuota(0, 1, 400); err != nil {
+		t.Fatalf("consume within credit: %v", err)
+	}
+	// 余额 -300，可透支 500，再扣 300 会超出可透支额度
+	if err := ConsumeBillingQuota(0, 1, 300); !errors.Is(err, ErrUserQuotaNotEnough) {
+		t.Fatalf("consume over credit = %v, want ErrUserQuotaNotEnough", err)
+	}
+	if got := GetTestRecord[User](t, 1); got.Quota != -300 {
+		t.Fatalf("user quota = %d, want -300", got.Quota)
+	}
+}
@@ -1,6 +1,7 @@
 package channel
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -11,6 +12,8 @@ import (
 	"time"
 
 	common2 "github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/tracing"
+	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/relay/constant"
@@ -22,6 +25,7 @@ import (
 	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func SetupApiRequestHeader(info *common.RelayInfo, c *gin.Context, req *http.Header) {
@@ -89,6 +93,62 @@ func DoApiRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 	return resp, nil
 }
 
+// DoBatchApiRequest 依次发送拆分后的多个请求体，全部成功时由 merge 将各批次的响应体合并，作为一个响应返回给 DoResponse 处理；
+// 任一批次失败时直接返回该响应或错误
+func DoBatchApiRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, bodies [][]byte, merge func(bodies [][]byte) ([]byte, error)) (*http.Response, error) {
+	return DoBatchApiRequestWithUsage(a, c, info, bodies, merge, nil)
+}
+
+// DoBatchApiRequestWithUsage 同 DoBatchApiRequest，任一批次失败时此前已成功的批次由 usageOf 根据合并后的响应体计算用量，记录到 info.BatchPartialUsage
+func DoBatchApiRequestWithUsage(a Adaptor, c *gin.Context, info *common.RelayInfo, bodies [][]byte, merge func(bodies [][]byte) ([]byte, error), usageOf func(c *gin.Context, info *common.RelayInfo, body []byte) (*dto.Usage, error)) (*http.Response, error) {
+	if len(bodies) == 1 {
+		return DoApiRequest(a, c, info, bytes.NewReader(bodies[0]))
+	}
+	var lastResp *http.Response
+	responseBodies := make([][]byte, 0, len(bodies))
+	for _, body := range bodies {
+		resp, err := DoApiRequest(a, c, info, bytes.NewReader(body))
+		if err != nil {
+			recordBatchPartialUsage(c, info, responseBodies, merge, usageOf)
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			recordBatchPartialUsage(c, info, responseBodies, merge, usageOf)
+			return resp, nil
+		}
+		responseBody, err := io.ReadAll(resp.Body)
+		service.CloseResponseBodyGracefully(resp)
+		if err != nil {
+			recordBatchPartialUsage(c, info, responseBodies, merge, usageOf)
+			return nil, fmt.Errorf("read batch response failed: %w", err)
+		}
+		responseBodies = append(responseBodies, responseBody)
+		lastResp = resp
+	}
+	merged, err := merge(responseBodies)
+	if err != nil {
+		return nil, fmt.Errorf("merge batch responses failed: %w", err)
+	}
+	lastResp.Header.Del("Content-Length")
+	lastResp.ContentLength = int64(len(merged))
+	lastResp.Body = io.NopCloser(bytes.NewReader(merged))
+	return lastResp, nil
+}
+
+// recordBatchPartialUsage 上游已经为成功的批次计费，失败时记录这部分用量以便核对渠道成本
+func recordBatchPartialUsage(c *gin.Context, info *common.RelayInfo, responseBodies [][]byte, merge func(bodies [][]byte) ([]byte, error), usageOf func(c *gin.Context, info *common.RelayInfo, body []byte) (*dto.Usage, error)) {
+	if len(responseBodies) == 0 || usageOf == nil {
+		return
+	}
+	merged, err := merge(responseBodies)
+	if err == nil {
+		info.BatchPartialUsage, err = usageOf(c, info, merged)
+	}
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to count usage of %d completed batch requests: %s", len(responseBodies), err.Error()))
+	}
+}
+
 func DoFormRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody io.Reader) (*http.Response, error) {
 	fullRequestURL, err := a.GetRequestURL(info)
 	if err != nil {
@@ -284,7 +344,12 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 		}
 	}
 
+	span := tracing.Start(c, "upstream.request", attribute.String("http.url", req.URL.Host+req.URL.Path))
 	resp, err := client.Do(req)
+	if resp != nil {
+		span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	}
+	span.End(err)
 	if err != nil {
 		logger.LogError(c, "do request failed: "+err.Error())
 		return nil, types.NewError(err, types.ErrorCodeDoRequestFailed, types.ErrOptionWithHideErrMsg("upstream error: do request failed"))
@@ -28,6 +28,18 @@ var awsModelIDMap = map[string]string{
 	"nova-reel-v1:0":    "amazon.nova-reel-v1:0",
 	"nova-reel-v1:1":    "amazon.nova-reel-v1:1",
 	"nova-sonic-v1:0":   "amazon.nova-sonic-v1:0",
+	// Embedding models
+	"titan-embed-text-v1":          "amazon.titan-embed-text-v1",
+	"titan-embed-text-v2":          "amazon.titan-embed-text-v2:0",
+	"cohere-embed-english-v3":      "cohere.embed-english-v3",
+	"cohere-embed-multilingual-v3": "cohere.embed-multilingual-v3",
+	"cohere-embed-v4":              "cohere.embed-v4:0",
+	// Image generation models
+	"titan-image-generator-v1":   "amazon.titan-image-generator-v1",
+	"titan-image-generator-v2":   "amazon.titan-image-generator-v2:0",
+	"stable-diffusion-3-5-large": "stability.sd3-5-large-v1:0",
+	"stable-image-core":          "stability.stable-image-core-v1:1",
+	"stable-image-ultra":         "stability.stable-image-ultra-v1:1",
 }
 
 var awsModelCanCrossRegionMap = map[string]map[string]bool{
@@ -134,6 +146,33 @@ var awsRegionCrossModelPrefixMap = map[string]string{
 
 var ChannelName = "aws"
 
+// Cohere embed 单次请求允许的最大文本数，Titan 每次只接受一条输入
+const awsCohereEmbedMaxTexts = 96
+
+func isTitanEmbeddingModel(modelId string) bool {
+	return strings.Contains(modelId, "titan-embed-text")
+}
+
+func isCohereEmbeddingModel(modelId string) bool {
+	return strings.Contains(modelId, "cohere.embed")
+}
+
+const (
+	// 单个图片生成请求允许的最大张数，与 OpenAI 一致
+	awsImageMaxN = 10
+	// Titan Image Generator 与 Nova Canvas 单次调用最多生成的张数，Stability 模型每次只生成一张
+	awsTitanImageMaxN = 5
+)
+
+// Titan Image Generator 与 Nova Canvas 使用相同的请求格式
+func isTitanImageModel(modelId string) bool {
+	return strings.Contains(modelId, "titan-image-generator") || strings.Contains(modelId, "nova-canvas")
+}
+
+func isStabilityImageModel(modelId string) bool {
+	return strings.HasPrefix(modelId, "stability.")
+}
+
 // 判断是否为Nova模型
 func isNovaModel(modelId string) bool {
 	return strings.Contains(modelId, "nova-")
@@ -141,3 +141,71 @@ func parseStopSequences(stop any) []string {
 	}
 	return nil
 }
+
+type AwsTitanEmbeddingRequest struct {
+	InputText  string `json:"inputText"`
+	Dimensions int    `json:"dimensions,omitempty"`
+}
+
+// AwsTitanEmbeddingBatch Titan 每次只接受一条输入，转换后的请求先按输入展开，发送时逐条调用
+type AwsTitanEmbeddingBatch struct {
+	Requests []AwsTitanEmbeddingRequest `json:"requests"`
+}
+
+type AwsTitanEmbeddingResponse struct {
+	Embedding           []float64 `json:"embedding"`
+	InputTextTokenCount int       `json:"inputTextTokenCount"`
+}
+
+type AwsCohereEmbeddingRequest struct {
+	Texts           []string `json:"texts"`
+	InputType       string   `json:"input_type"`
+	EmbeddingTypes  []string `json:"embedding_types"`
+	Truncate        string   `json:"truncate,omitempty"`
+	OutputDimension int      `json:"output_dimension,omitempty"`
+}
+
+type AwsCohereEmbeddingResponse struct {
+	Embeddings struct {
+		Float [][]float64 `json:"float"`
+	} `json:"embeddings"`
+}
+
+// AwsImageBatch 上游单次调用生成的图片数有限，转换后的请求按调用次数展开，发送时逐条调用
+type AwsImageBatch struct {
+	Requests []json.RawMessage `json:"requests"`
+}
+
+// AwsTitanImageRequest Titan Image Generator 与 Nova Canvas 共用的文生图请求
+type AwsTitanImageRequest struct {
+	TaskType              string                        `json:"taskType"`
+	TextToImageParams     AwsTitanTextToImageParams     `json:"textToImageParams"`
+	ImageGenerationConfig AwsTitanImageGenerationConfig `json:"imageGenerationConfig"`
+}
+
+type AwsTitanTextToImageParams struct {
+	Text string `json:"text"`
+}
+
+type AwsTitanImageGenerationConfig struct {
+	NumberOfImages int    `json:"numberOfImages"`
+	Width          int    `json:"width,omitempty"`
+	Height         int    `json:"height,omitempty"`
+	Quality        string `json:"quality,omitempty"`
+}
+
+type AwsTitanImageResponse struct {
+	Images []string `json:"images"`
+	Error  string   `json:"error,omitempty"`
+}
+
+type AwsStabilityImageRequest struct {
+	Prompt       string `json:"prompt"`
+	AspectRatio  string `json:"aspect_ratio,omitempty"`
+	OutputFormat string `json:"output_format,omitempty"`
+}
+
+type AwsStabilityImageResponse struct {
+	Images        []string  `json:"images"`
+	FinishReasons []*string `json:"finish_reasons"`
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/relay/channel/claude"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/types"
@@ -318,3 +319,296 @@ func handleNovaRequest(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor)
 	c.JSON(http.StatusOK, response)
 	return nil, &response.Usage
 }
+
+func convertEmbeddingRequest(info *relaycommon.RelayInfo, request dto.EmbeddingRequest) (any, error) {
+	inputs := request.ParseInput()
+	if len(inputs) == 0 {
+		return nil, errors.New("input is empty")
+	}
+	awsModelId := getAwsModelID(info.UpstreamModelName)
+	switch {
+	case isTitanEmbeddingModel(awsModelId):
+		titanReqs := make([]AwsTitanEmbeddingRequest, 0, len(inputs))
+		for _, input := range inputs {
+			titanReq := AwsTitanEmbeddingRequest{InputText: input}
+			// 仅 v2 支持指定输出维度（256/512/1024）
+			if strings.Contains(awsModelId, "v2") {
+				titanReq.Dimensions = request.Dimensions
+			}
+			titanReqs = append(titanReqs, titanReq)
+		}
+		return AwsTitanEmbeddingBatch{Requests: titanReqs}, nil
+	case isCohereEmbeddingModel(awsModelId):
+		cohereReq := AwsCohereEmbeddingRequest{
+			Texts:          inputs,
+			InputType:      service.CohereEmbeddingInputType(request.InputType),
+			EmbeddingTypes: []string{"float"},
+			Truncate:       "END",
+		}
+		if strings.Contains(awsModelId, "embed-v4") {
+			cohereReq.OutputDimension = request.Dimensions
+		}
+		return cohereReq, nil
+	default:
+		return nil, fmt.Errorf("model %s does not support embeddings on bedrock", info.UpstreamModelName)
+	}
+}
+
+// doAwsEmbeddingRequest 按模型的单次输入上限拆分为多个 InvokeModel 请求，实际调用在 awsEmbeddingHandler 中完成
+func doAwsEmbeddingRequest(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor, requestBody io.Reader) (any, error) {
+	awsCli, err := newAwsClient(c, info)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeChannelAwsClientError)
+	}
+	a.AwsClient = awsCli
+	a.AwsModelId = getAwsModelID(info.UpstreamModelName)
+
+	var bodies [][]byte
+	if isTitanEmbeddingModel(a.AwsModelId) {
+		var titanBatch AwsTitanEmbeddingBatch
+		if err = common.DecodeJson(requestBody, &titanBatch); err != nil {
+			return nil, types.NewError(errors.Wrap(err, "decode titan embedding request fail"), types.ErrorCodeBadRequestBody)
+		}
+		for _, titanReq := range titanBatch.Requests {
+			body, err := common.Marshal(titanReq)
+			if err != nil {
+				return nil, types.NewError(errors.Wrap(err, "marshal titan embedding request fail"), types.ErrorCodeBadRequestBody)
+			}
+			bodies = append(bodies, body)
+		}
+	} else {
+		var cohereReq AwsCohereEmbeddingRequest
+		if err = common.DecodeJson(requestBody, &cohereReq); err != nil {
+			return nil, types.NewError(errors.Wrap(err, "decode cohere embedding request fail"), types.ErrorCodeBadRequestBody)
+		}
+		for _, texts := range service.SplitEmbeddingInputs(cohereReq.Texts, awsCohereEmbedMaxTexts) {
+			cohereReq.Texts = texts
+			body, err := common.Marshal(cohereReq)
+			if err != nil {
+				return nil, types.NewError(errors.Wrap(err, "marshal cohere embedding request fail"), types.ErrorCodeBadRequestBody)
+			}
+			bodies = append(bodies, body)
+		}
+	}
+
+	a.AwsReq = newAwsInvokeModelInputs(a.AwsModelId, bodies)
+	return nil, nil
+}
+
+func newAwsInvokeModelInputs(awsModelId string, bodies [][]byte) []*bedrockruntime.InvokeModelInput {
+	awsReqs := make([]*bedrockruntime.InvokeModelInput, 0, len(bodies))
+	for _, body := range bodies {
+		awsReqs = append(awsReqs, &bedrockruntime.InvokeModelInput{
+			ModelId:     aws.String(awsModelId),
+			Accept:      aws.String("application/json"),
+			ContentType: aws.String("application/json"),
+			Body:        body,
+		})
+	}
+	return awsReqs
+}
+
+func awsEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	awsReqs, ok := a.AwsReq.([]*bedrockruntime.InvokeModelInput)
+	if !ok {
+		return types.NewError(errors.New("invalid aws embedding request"), types.ErrorCodeInvalidRequest), nil
+	}
+	var embeddings [][]float64
+	promptTokens := 0
+	buildUsage := func() dto.Usage {
+		tokens := promptTokens
+		// Bedrock 上的 Cohere 模型响应体中不包含 token 数
+		if tokens == 0 {
+			tokens = service.EstimateEmbeddingPromptTokens(info, len(embeddings))
+		}
+		return dto.Usage{
+			PromptTokens: tokens,
+			TotalTokens:  tokens,
+		}
+	}
+	// 后续请求失败时，已成功的请求仍按实际用量结算
+	fail := func(newAPIError *types.NewAPIError) (*types.NewAPIError, *dto.Usage) {
+		if len(embeddings) > 0 {
+			usage := buildUsage()
+			info.BatchPartialUsage = &usage
+		}
+		return newAPIError, nil
+	}
+	for _, awsReq := range awsReqs {
+		awsResp, err := a.AwsClient.InvokeModel(c.Request.Context(), awsReq)
+		if err != nil {
+			statusCode := getAwsErrorStatusCode(err)
+			return fail(types.NewOpenAIError(errors.Wrap(err, "InvokeModel"), types.ErrorCodeAwsInvokeError, statusCode))
+		}
+		if isTitanEmbeddingModel(a.AwsModelId) {
+			var titanResp AwsTitanEmbeddingResponse
+			if err = common.Unmarshal(awsResp.Body, &titanResp); err != nil {
+				return fail(types.NewError(errors.Wrap(err, "unmarshal titan embedding response"), types.ErrorCodeBadResponseBody))
+			}
+			embeddings = append(embeddings, titanResp.Embedding)
+			promptTokens += titanResp.InputTextTokenCount
+		} else {
+			var cohereResp AwsCohereEmbeddingResponse
+			if err = common.Unmarshal(awsResp.Body, &cohereResp); err != nil {
+				return fail(types.NewError(errors.Wrap(err, "unmarshal cohere embedding response"), types.ErrorCodeBadResponseBody))
+			}
+			embeddings = append(embeddings, cohereResp.Embeddings.Float...)
+		}
+	}
+	usage := buildUsage()
+	c.JSON(http.StatusOK, service.BuildEmbeddingResponse(info, embeddings, usage))
+	return nil, &usage
+}
+
+func convertImageRequest(info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
+	if info.RelayMode != constant.RelayModeImagesGenerations {
+		return nil, errors.New("only image generation is supported on bedrock")
+	}
+	n := max(int(request.N), 1)
+	if n > awsImageMaxN {
+		return nil, fmt.Errorf("n must be between 1 and %d", awsImageMaxN)
+	}
+	if err := service.CheckImageResponseFormat(request); err != nil {
+		return nil, err
+	}
+	awsModelId := getAwsModelID(info.UpstreamModelName)
+	var requests []any
+	switch {
+	case isTitanImageModel(awsModelId):
+		// size 为宽高比或无法解析时使用模型默认尺寸
+		var width, height int
+		if _, err := fmt.Sscanf(request.Size, "%dx%d", &width, &height); err != nil {
+			width, height = 0, 0
+		}
+		quality := "standard"
+		if request.Quality == "hd" || request.Quality == "high" {
+			quality = "premium"
+		}
+		for remaining := n; remaining > 0; remaining -= awsTitanImageMaxN {
+			requests = append(requests, AwsTitanImageRequest{
+				TaskType:          "TEXT_IMAGE",
+				TextToImageParams: AwsTitanTextToImageParams{Text: request.Prompt},
+				ImageGenerationConfig: AwsTitanImageGenerationConfig{
+					NumberOfImages: min(remaining, awsTitanImageMaxN),
+					Width:          width,
+					Height:         height,
+					Quality:        quality,
+				},
+			})
+		}
+	case isStabilityImageModel(awsModelId):
+		stabilityReq := AwsStabilityImageRequest{
+			Prompt:       request.Prompt,
+			AspectRatio:  service.ImageSizeToAspectRatio(request.Size),
+			OutputFormat: "png",
+		}
+		for i := 0; i < n; i++ {
+			requests = append(requests, stabilityReq)
+		}
+	default:
+		return nil, fmt.Errorf("model %s does not support image generation on bedrock", info.UpstreamModelName)
+	}
+
+	batch := AwsImageBatch{Requests: make([]json.RawMessage, 0, len(requests))}
+	for _, req := range requests {
+		body, err := common.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		batch.Requests = append(batch.Requests, body)
+	}
+	return batch, nil
+}
+
+// doAwsImageRequest 将展开后的图片生成请求逐条转为 InvokeModel 请求，实际调用在 awsImageHandler 中完成
+func doAwsImageRequest(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor, requestBody io.Reader) (any, error) {
+	awsCli, err := newAwsClient(c, info)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeChannelAwsClientError)
+	}
+	a.AwsClient = awsCli
+	a.AwsModelId = getAwsModelID(info.UpstreamModelName)
+
+	var batch AwsImageBatch
+	if err = common.DecodeJson(requestBody, &batch); err != nil {
+		return nil, types.NewError(errors.Wrap(err, "decode image request fail"), types.ErrorCodeBadRequestBody)
+	}
+	bodies := make([][]byte, 0, len(batch.Requests))
+	for _, req := range batch.Requests {
+		bodies = append(bodies, req)
+	}
+	a.AwsReq = newAwsInvokeModelInputs(a.AwsModelId, bodies)
+	return nil, nil
+}
+
+func awsImageHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	awsReqs, ok := a.AwsReq.([]*bedrockruntime.InvokeModelInput)
+	if !ok {
+		return types.NewError(errors.New("invalid aws image request"), types.ErrorCodeInvalidRequest), nil
+	}
+	var images []string
+	// Bedrock 图片模型的响应中不包含 token 数
+	buildUsage := func() dto.Usage {
+		helper.ImagePriceHelperPerCall(info, len(images))
+		promptTokens := info.GetEstimatePromptTokens()
+		return dto.Usage{
+			PromptTokens: promptTokens,
+			TotalTokens:  promptTokens,
+		}
+	}
+	// 后续请求失败时，已生成的图片仍需计费
+	fail := func(newAPIError *types.NewAPIError) (*types.NewAPIError, *dto.Usage) {
+		if len(images) > 0 {
+			usage := buildUsage()
+			info.BatchPartialUsage = &usage
+		}
+		return newAPIError, nil
+	}
+	for _, awsReq := range awsReqs {
+		awsResp, err := a.AwsClient.InvokeModel(c.Request.Context(), awsReq)
+		if err != nil {
+			statusCode := getAwsErrorStatusCode(err)
+			return fail(types.NewOpenAIError(errors.Wrap(err, "InvokeModel"), types.ErrorCodeAwsInvokeError, statusCode))
+		}
+		if isTitanImageModel(a.AwsModelId) {
+			var titanResp AwsTitanImageResponse
+			if err = common.Unmarshal(awsResp.Body, &titanResp); err != nil {
+				return fail(types.NewError(errors.Wrap(err, "unmarshal titan image response"), types.ErrorCodeBadResponseBody))
+			}
+			if titanResp.Error != "" {
+				return fail(types.NewOpenAIError(errors.New(titanResp.Error), types.ErrorCodeBadResponseBody, http.StatusBadRequest))
+			}
+			images = append(images, titanResp.Images...)
+		} else {
+			var stabilityResp AwsStabilityImageResponse
+			if err = common.Unmarshal(awsResp.Body, &stabilityResp); err != nil {
+				return fail(types.NewError(errors.Wrap(err, "unmarshal stability image response"), types.ErrorCodeBadResponseBody))
+			}
+			for i, image := range stabilityResp.Images {
+				// finish_reasons 不为空表示该图片被内容过滤
+				if i < len(stabilityResp.FinishReasons) && stabilityResp.FinishReasons[i] != nil {
+					continue
+				}
+				images = append(images, image)
+			}
+		}
+	}
+	if len(images) == 0 {
+		return types.NewOpenAIError(errors.New("no images generated"), types.ErrorCodeEmptyResponse, http.StatusInternalServerError), nil
+	}
+
+	imageResponse := dto.ImageResponse{
+		Created: common.GetTimestamp(),
+		Data:    make([]dto.ImageData, 0, len(images)),
+	}
+	for _, image := range images {
+		imageData, err := service.BuildImageData(c, info, "image/png", image)
+		if err != nil {
+			return fail(types.NewError(err, types.ErrorCodeBadResponseBody))
+		}
+		imageResponse.Data = append(imageResponse.Data, imageData)
+	}
+	usage := buildUsage()
+	c.JSON(http.StatusOK, imageResponse)
+	return nil, &usage
+}
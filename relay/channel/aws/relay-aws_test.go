@@ -0,0 +1,27 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
+
+func TestConvertEmbeddingRequestCohereInputType(t *testing.T) {
+	info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{UpstreamModelName: "cohere.embed-english-v3"}}
+	tests := map[string]string{
+		"":             "search_document",
+		"query":        "search_query",
+		"search_query": "search_query",
+		"clustering":   "clustering",
+	}
+	for inputType, want := range tests {
+		converted, err := convertEmbeddingRequest(info, dto.EmbeddingRequest{Input: "a", InputType: inputType})
+		if err != nil {
+			t.Fatalf("convert: %v", err)
+		}
+		if got := converted.(AwsCohereEmbeddingRequest).InputType; got != want {
+			t.Fatalf("input_type %q -> %q, want %q", inputType, got, want)
+		}
+	}
+}
@@ -44,6 +44,24 @@ type CohereRerankResponseResult struct {
 	Meta    CohereMeta                 `json:"meta"`
 }
 
+type CohereEmbeddingRequest struct {
+	Model           string   `json:"model"`
+	Texts           []string `json:"texts"`
+	InputType       string   `json:"input_type"`
+	EmbeddingTypes  []string `json:"embedding_types"`
+	OutputDimension int      `json:"output_dimension,omitempty"`
+	Truncate        string   `json:"truncate,omitempty"`
+}
+
+type CohereEmbeddingResponse struct {
+	Id         string `json:"id"`
+	Embeddings struct {
+		Float  [][]float64 `json:"float,omitempty"`
+		Base64 []string    `json:"base64,omitempty"`
+	} `json:"embeddings"`
+	Meta CohereMeta `json:"meta"`
+}
+
 type CohereMeta struct {
 	//Tokens CohereTokens `json:"tokens"`
 	BilledUnits CohereBilledUnits `json:"billed_units"`
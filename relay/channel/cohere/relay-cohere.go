@@ -3,6 +3,7 @@ package cohere
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"strings"
@@ -68,6 +69,84 @@ func requestConvertRerank2Cohere(rerankRequest dto.RerankRequest) *CohereRerankR
 	return &cohereReq
 }
 
+func requestConvertEmbedding2Cohere(request dto.EmbeddingRequest) (*CohereEmbeddingRequest, error) {
+	texts := request.ParseInput()
+	if len(texts) == 0 {
+		return nil, errors.New("input is empty")
+	}
+	cohereReq := CohereEmbeddingRequest{
+		Model:          request.Model,
+		Texts:          texts,
+		InputType:      service.CohereEmbeddingInputType(request.InputType),
+		EmbeddingTypes: []string{"float"},
+		Truncate:       "END",
+	}
+	// base64 与 OpenAI 相同，均为 float32 小端序编码，直接由上游返回
+	if request.EncodingFormat == "base64" {
+		cohereReq.EmbeddingTypes = []string{"base64"}
+	}
+	// 仅 embed-v4 支持指定输出维度
+	if request.Dimensions > 0 && strings.HasPrefix(request.Model, "embed-v4") {
+		cohereReq.OutputDimension = request.Dimensions
+	}
+	return &cohereReq, nil
+}
+
+// splitCohereEmbeddingRequest 按 embed 接口的单次上限拆分文本
+func splitCohereEmbeddingRequest(requestBody io.Reader) ([][]byte, error) {
+	var cohereReq CohereEmbeddingRequest
+	if err := common.DecodeJson(requestBody, &cohereReq); err != nil {
+		return nil, err
+	}
+	batches := service.SplitEmbeddingInputs(cohereReq.Texts, embedMaxTexts)
+	bodies := make([][]byte, 0, len(batches))
+	for _, batch := range batches {
+		cohereReq.Texts = batch
+		body, err := common.Marshal(cohereReq)
+		if err != nil {
+			return nil, err
+		}
+		bodies = append(bodies, body)
+	}
+	return bodies, nil
+}
+
+func mergeCohereEmbeddingResponses(bodies [][]byte) ([]byte, error) {
+	var merged CohereEmbeddingResponse
+	for _, body := range bodies {
+		var cohereResp CohereEmbeddingResponse
+		if err := common.Unmarshal(body, &cohereResp); err != nil {
+			return nil, err
+		}
+		merged.Id = cohereResp.Id
+		merged.Embeddings.Float = append(merged.Embeddings.Float, cohereResp.Embeddings.Float...)
+		merged.Embeddings.Base64 = append(merged.Embeddings.Base64, cohereResp.Embeddings.Base64...)
+		merged.Meta.BilledUnits.InputTokens += cohereResp.Meta.BilledUnits.InputTokens
+	}
+	return common.Marshal(merged)
+}
+
+func cohereEmbeddingUsage(info *relaycommon.RelayInfo, cohereResp *CohereEmbeddingResponse) dto.Usage {
+	promptTokens := cohereResp.Meta.BilledUnits.InputTokens
+	if promptTokens == 0 {
+		promptTokens = service.EstimateEmbeddingPromptTokens(info, len(cohereResp.Embeddings.Float)+len(cohereResp.Embeddings.Base64))
+	}
+	return dto.Usage{
+		PromptTokens: promptTokens,
+		TotalTokens:  promptTokens,
+	}
+}
+
+// cohereEmbeddingPartialUsage 计算拆分请求中已成功批次的用量
+func cohereEmbeddingPartialUsage(c *gin.Context, info *relaycommon.RelayInfo, body []byte) (*dto.Usage, error) {
+	var cohereResp CohereEmbeddingResponse
+	if err := common.Unmarshal(body, &cohereResp); err != nil {
+		return nil, err
+	}
+	usage := cohereEmbeddingUsage(info, &cohereResp)
+	return &usage, nil
+}
+
 func stopReasonCohere2OpenAI(reason string) string {
 	switch reason {
 	case "COMPLETE":
@@ -247,3 +326,26 @@ func cohereRerankHandler(c *gin.Context, resp *http.Response, info *relaycommon.
 	_, err = c.Writer.Write(jsonResponse)
 	return &usage, nil
 }
+
+func cohereEmbeddingHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.Usage, *types.NewAPIError) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+	}
+	service.CloseResponseBodyGracefully(resp)
+	var cohereResp CohereEmbeddingResponse
+	if err = common.Unmarshal(responseBody, &cohereResp); err != nil {
+		return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+	}
+	usage := cohereEmbeddingUsage(info, &cohereResp)
+	embeddingResponse := service.BuildEmbeddingResponse(info, cohereResp.Embeddings.Float, usage)
+	if len(cohereResp.Embeddings.Base64) > 0 {
+		embeddingResponse = service.BuildBase64EmbeddingResponse(info, cohereResp.Embeddings.Base64, usage)
+	}
+	jsonResponse, err := common.Marshal(embeddingResponse)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+	}
+	service.IOCopyBytesGracefully(c, resp, jsonResponse)
+	return &usage, nil
+}
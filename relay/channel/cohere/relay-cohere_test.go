@@ -0,0 +1,123 @@
+package cohere
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestConvertEmbedding2Cohere(t *testing.T) {
+	tests := []struct {
+		name           string
+		request        dto.EmbeddingRequest
+		inputType      string
+		embeddingTypes []string
+	}{
+		{"default", dto.EmbeddingRequest{Input: "a"}, "search_document", []string{"float"}},
+		{"query", dto.EmbeddingRequest{Input: "a", InputType: "query"}, "search_query", []string{"float"}},
+		{"passthrough", dto.EmbeddingRequest{Input: "a", InputType: "classification"}, "classification", []string{"float"}},
+		{"base64", dto.EmbeddingRequest{Input: "a", InputType: "search_query", EncodingFormat: "base64"}, "search_query", []string{"base64"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cohereReq, err := requestConvertEmbedding2Cohere(tt.request)
+			if err != nil {
+				t.Fatalf("convert: %v", err)
+			}
+			if cohereReq.InputType != tt.inputType || !reflect.DeepEqual(cohereReq.EmbeddingTypes, tt.embeddingTypes) {
+				t.Fatalf("input_type=%s embedding_types=%v", cohereReq.InputType, cohereReq.EmbeddingTypes)
+			}
+		})
+	}
+}
+
+func TestCohereEmbeddingHandlerReturnsUpstreamBase64(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	info := &relaycommon.RelayInfo{
+		Request:     &dto.EmbeddingRequest{Input: []any{"a", "b"}, EncodingFormat: "base64"},
+		ChannelMeta: &relaycommon.ChannelMeta{UpstreamModelName: "embed-v4.0"},
+	}
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(`{"id":"1","embeddings":{"base64":["AACAPw==","AAAAQA=="]},"meta":{"billed_units":{"input_tokens":4}}}`)),
+	}
+	usage, newAPIError := cohereEmbeddingHandler(c, resp, info)
+	if newAPIError != nil {
+		t.Fatalf("handler: %v", newAPIError)
+	}
+	if usage.PromptTokens != 4 {
+		t.Fatalf("prompt tokens = %d", usage.PromptTokens)
+	}
+	var response dto.FlexibleEmbeddingResponse
+	if err := common.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if len(response.Data) != 2 || response.Data[0].Embedding != "AACAPw==" || response.Data[1].Index != 1 {
+		t.Fatalf("data = %+v", response.Data)
+	}
+}
+
+func TestDoRequestRecordsPartialUsage(t *testing.T) {
+	service.InitHttpClient()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests > 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"message":"internal error"}`))
+			return
+		}
+		var cohereReq CohereEmbeddingRequest
+		if err := common.DecodeJson(r.Body, &cohereReq); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		cohereResp := CohereEmbeddingResponse{Id: "1"}
+		for range cohereReq.Texts {
+			cohereResp.Embeddings.Float = append(cohereResp.Embeddings.Float, []float64{1})
+		}
+		cohereResp.Meta.BilledUnits.InputTokens = len(cohereReq.Texts)
+		body, _ := common.Marshal(cohereResp)
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/embeddings", nil)
+	info := &relaycommon.RelayInfo{
+		RelayMode:   constant.RelayModeEmbeddings,
+		ChannelMeta: &relaycommon.ChannelMeta{ChannelBaseUrl: server.URL},
+	}
+	texts := make([]string, embedMaxTexts+4)
+	for i := range texts {
+		texts[i] = fmt.Sprintf("text %d", i)
+	}
+	body, _ := common.Marshal(CohereEmbeddingRequest{Model: "embed-v4.0", Texts: texts, EmbeddingTypes: []string{"float"}})
+
+	adaptor := &Adaptor{}
+	resp, err := adaptor.DoRequest(c, info, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	if httpResp := resp.(*http.Response); httpResp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("status = %d", httpResp.StatusCode)
+	}
+	// 第一批已由上游计费，第二批失败
+	if info.BatchPartialUsage == nil || info.BatchPartialUsage.PromptTokens != embedMaxTexts {
+		t.Fatalf("partial usage = %+v", info.BatchPartialUsage)
+	}
+}
@@ -21,6 +21,9 @@ var ModelList = []string{
 	"gemini-2.5-pro-preview-03-25",
 	// imagen models
 	"imagen-3.0-generate-002",
+	"imagen-4.0-generate-001", "imagen-4.0-ultra-generate-001", "imagen-4.0-fast-generate-001",
+	// image generation models
+	"gemini-2.5-flash-image", "gemini-3-pro-image-preview",
 	// embedding models
 	"gemini-embedding-exp-03-07",
 	"text-embedding-004",
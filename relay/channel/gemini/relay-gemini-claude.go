@@ -0,0 +1,786 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+type claudeToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type claudeFunctionTool struct {
+	Type        string         `json:"type"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type claudeOutputFormat struct {
+	Type   string `json:"type"`
+	Schema any    `json:"schema"`
+}
+
+// claudeSignaturePrefix 标记由 Gemini 签发并经本转换输出给客户端的思考签名，回传时只有带此前缀的签名才还原给 Gemini
+const claudeSignaturePrefix = "gemini."
+
+// ConvertClaude2Gemini 将 Claude Messages 请求直接转换为 Gemini generateContent 请求，
+// Gemini 签发的思考签名会回填到 thoughtSignature，tool_use/tool_result 通过 tool_use_id 关联函数名
+func ConvertClaude2Gemini(c *gin.Context, claudeRequest *dto.ClaudeRequest, info *relaycommon.RelayInfo) (*dto.GeminiChatRequest, error) {
+	geminiRequest := dto.GeminiChatRequest{
+		Contents: make([]dto.GeminiChatContent, 0, len(claudeRequest.Messages)),
+		GenerationConfig: dto.GeminiChatGenerationConfig{
+			Temperature:     claudeRequest.Temperature,
+			TopP:            claudeRequest.TopP,
+			TopK:            float64(claudeRequest.TopK),
+			MaxOutputTokens: claudeRequest.MaxTokens,
+			StopSequences:   claudeRequest.StopSequences,
+		},
+		SafetySettings: buildSafetySettings(),
+	}
+
+	if model_setting.IsGeminiModelSupportImagine(info.UpstreamModelName) {
+		geminiRequest.GenerationConfig.ResponseModalities = []string{
+			"TEXT",
+			"IMAGE",
+		}
+	}
+
+	if claudeRequest.Thinking != nil && claudeRequest.Thinking.Type == "enabled" {
+		thinkingConfig := &dto.GeminiThinkingConfig{IncludeThoughts: true}
+		if claudeRequest.Thinking.BudgetTokens != nil {
+			thinkingConfig.ThinkingBudget = common.GetPointer(clampThinkingBudget(info.UpstreamModelName, claudeRequest.Thinking.GetBudgetTokens()))
+		}
+		geminiRequest.GenerationConfig.ThinkingConfig = thinkingConfig
+	} else if claudeRequest.Thinking != nil && claudeRequest.Thinking.Type == "disabled" {
+		// 新版 2.5 Pro 不允许关闭思考
+		if !isNew25ProModel(info.UpstreamModelName) {
+			geminiRequest.GenerationConfig.ThinkingConfig = &dto.GeminiThinkingConfig{
+				ThinkingBudget: common.GetPointer(0),
+			}
+		}
+	} else {
+		ThinkingAdaptor(&geminiRequest, info)
+	}
+
+	if len(claudeRequest.OutputFormat) > 0 {
+		var outputFormat claudeOutputFormat
+		if err := common.Unmarshal(claudeRequest.OutputFormat, &outputFormat); err == nil && outputFormat.Type == "json_schema" {
+			geminiRequest.GenerationConfig.ResponseMimeType = "application/json"
+			if outputFormat.Schema != nil {
+				geminiRequest.GenerationConfig.ResponseSchema = removeAdditionalPropertiesWithDepth(outputFormat.Schema, 0)
+			}
+		}
+	}
+
+	if err := convertClaudeTools2Gemini(claudeRequest, &geminiRequest); err != nil {
+		return nil, err
+	}
+
+	var systemParts []dto.GeminiPart
+	if claudeRequest.IsStringSystem() {
+		if system := claudeRequest.GetStringSystem(); system != "" {
+			systemParts = append(systemParts, dto.GeminiPart{Text: system})
+		}
+	} else {
+		for _, block := range claudeRequest.ParseSystem() {
+			if block.Type == dto.ContentTypeText && block.GetText() != "" {
+				systemParts = append(systemParts, dto.GeminiPart{Text: block.GetText()})
+			}
+		}
+	}
+	if len(systemParts) > 0 {
+		geminiRequest.SystemInstructions = &dto.GeminiChatContent{Parts: systemParts}
+	}
+
+	attachThoughtSignature := (info.ChannelType == constant.ChannelTypeGemini ||
+		info.ChannelType == constant.ChannelTypeVertexAi) &&
+		model_setting.GetGeminiSettings().FunctionCallThoughtSignatureEnabled
+
+	toolNames := make(map[string]string)
+	imageNum := 0
+	for _, message := range claudeRequest.Messages {
+		role := "user"
+		if message.Role == "assistant" {
+			role = "model"
+		}
+		var parts []dto.GeminiPart
+		if message.IsStringContent() {
+			if text := message.GetStringContent(); text != "" {
+				parts = append(parts, dto.GeminiPart{Text: text})
+			}
+		} else {
+			blocks, err := message.ParseContent()
+			if err != nil {
+				return nil, fmt.Errorf("invalid message content: %w", err)
+			}
+			// 思考块本身不回传给 Gemini，只把签名挂到紧随其后的 part 上
+			var pendingSignature string
+			signatureAttached := false
+			appendPart := func(part dto.GeminiPart) {
+				if pendingSignature != "" {
+					part.ThoughtSignature = json.RawMessage(strconv.Quote(pendingSignature))
+					pendingSignature = ""
+				}
+				parts = append(parts, part)
+			}
+			for _, block := range blocks {
+				switch block.Type {
+				case dto.ContentTypeText:
+					if block.GetText() == "" {
+						continue
+					}
+					appendPart(dto.GeminiPart{Text: block.GetText()})
+				case "thinking":
+					if signature, ok := strings.CutPrefix(block.Signature, claudeSignaturePrefix); ok && signature != "" {
+						pendingSignature = signature
+					} else if block.Signature != "" {
+						// 其他渠道签发的签名 Gemini 无法校验，改用跳过校验的占位签名
+						pendingSignature = thoughtSignatureBypassValue
+					}
+				case "image", "document":
+					if block.Type == "image" {
+						imageNum++
+					}
+					if constant.GeminiVisionMaxImageNum != -1 && imageNum > constant.GeminiVisionMaxImageNum {
+						return nil, fmt.Errorf("too many images in the message, max allowed is %d", constant.GeminiVisionMaxImageNum)
+					}
+					part, err := claudeSourceToGeminiPart(c, block.Source)
+					if err != nil {
+						return nil, err
+					}
+					if part != nil {
+						appendPart(*part)
+					}
+				case "tool_use":
+					toolCall := dto.GeminiPart{
+						FunctionCall: &dto.FunctionCall{
+							FunctionName: block.Name,
+							Arguments:    block.Input,
+						},
+					}
+					if toolCall.FunctionCall.Arguments == nil {
+						toolCall.FunctionCall.Arguments = map[string]any{}
+					}
+					if pendingSignature != "" {
+						signatureAttached = true
+					} else if attachThoughtSignature && !signatureAttached {
+						toolCall.ThoughtSignature = json.RawMessage(strconv.Quote(thoughtSignatureBypassValue))
+						signatureAttached = true
+					}
+					appendPart(toolCall)
+					toolNames[block.Id] = block.Name
+				case "tool_result":
+					name, ok := toolNames[block.ToolUseId]
+					if !ok {
+						return nil, types.NewErrorWithStatusCode(
+							fmt.Errorf("tool_result references unknown tool_use_id '%s'", block.ToolUseId),
+							types.ErrorCodeInvalidRequest,
+							http.StatusBadRequest,
+							types.ErrOptionWithSkipRetry(),
+						)
+					}
+					resultParts, err := claudeToolResultToGeminiParts(c, block, name)
+					if err != nil {
+						return nil, err
+					}
+					parts = append(parts, resultParts...)
+				}
+			}
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		// Gemini 要求 user/model 交替出现，连续的同角色消息需要合并
+		if last := len(geminiRequest.Contents) - 1; last >= 0 && geminiRequest.Contents[last].Role == role {
+			geminiRequest.Contents[last].Parts = append(geminiRequest.Contents[last].Parts, parts...)
+		} else {
+			geminiRequest.Contents = append(geminiRequest.Contents, dto.GeminiChatContent{
+				Role:  role,
+				Parts: parts,
+			})
+		}
+	}
+
+	return &geminiRequest, nil
+}
+
+func buildSafetySettings() []dto.GeminiChatSafetySettings {
+	safetySettings := make([]dto.GeminiChatSafetySettings, 0, len(SafetySettingList))
+	for _, category := range SafetySettingList {
+		safetySettings = append(safetySettings, dto.GeminiChatSafetySettings{
+			Category:  category,
+			Threshold: model_setting.GetGeminiSafetySetting(category),
+		})
+	}
+	return safetySettings
+}
+
+// convertClaudeTools2Gemini 自定义工具转为 functionDeclarations，web_search 工具转为 googleSearch，其他服务端工具忽略
+func convertClaudeTools2Gemini(claudeRequest *dto.ClaudeRequest, geminiRequest *dto.GeminiChatRequest) error {
+	tools := claudeRequest.GetTools()
+	if len(tools) == 0 {
+		return nil
+	}
+	functions := make([]dto.FunctionRequest, 0, len(tools))
+	googleSearch := false
+	for _, rawTool := range tools {
+		tool, err := common.Any2Type[claudeFunctionTool](rawTool)
+		if err != nil {
+			return fmt.Errorf("invalid tool: %w", err)
+		}
+		if strings.HasPrefix(tool.Type, "web_search") {
+			googleSearch = true
+			continue
+		}
+		if tool.Type != "" && tool.Type != "custom" {
+			continue
+		}
+		var params any
+		if tool.InputSchema != nil {
+			if props, ok := tool.InputSchema["properties"].(map[string]any); !ok || len(props) > 0 {
+				params = cleanFunctionParameters(tool.InputSchema)
+			}
+		}
+		functions = append(functions, dto.FunctionRequest{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  params,
+		})
+	}
+	geminiTools := geminiRequest.GetTools()
+	if googleSearch {
+		geminiTools = append(geminiTools, dto.GeminiChatTool{
+			GoogleSearch: make(map[string]string),
+		})
+	}
+	if len(functions) > 0 {
+		geminiTools = append(geminiTools, dto.GeminiChatTool{
+			FunctionDeclarations: functions,
+		})
+		if claudeRequest.ToolChoice != nil {
+			toolChoice, err := common.Any2Type[claudeToolChoice](claudeRequest.ToolChoice)
+			if err == nil {
+				config := &dto.FunctionCallingConfig{}
+				switch toolChoice.Type {
+				case "auto":
+					config.Mode = "AUTO"
+				case "any":
+					config.Mode = "ANY"
+				case "tool":
+					config.Mode = "ANY"
+					config.AllowedFunctionNames = []string{toolChoice.Name}
+				case "none":
+					config.Mode = "NONE"
+				}
+				if config.Mode != "" {
+					geminiRequest.ToolConfig = &dto.ToolConfig{FunctionCallingConfig: config}
+				}
+			}
+		}
+	}
+	if len(geminiTools) > 0 {
+		geminiRequest.SetTools(geminiTools)
+	}
+	return nil
+}
+
+// claudeSourceToGeminiPart 将 image/document 块的 source 转为 inlineData，纯文本文档直接作为文本
+func claudeSourceToGeminiPart(c *gin.Context, source *dto.ClaudeMessageSource) (*dto.GeminiPart, error) {
+	if source == nil {
+		return nil, nil
+	}
+	switch source.Type {
+	case "base64":
+		data, _ := source.Data.(string)
+		return &dto.GeminiPart{
+			InlineData: &dto.GeminiInlineData{
+				MimeType: source.MediaType,
+				Data:     data,
+			},
+		}, nil
+	case "url":
+		fileData, err := service.GetFileBase64FromUrl(c, source.Url, "formatting image for Gemini")
+		if err != nil {
+			return nil, fmt.Errorf("get file base64 from url '%s' failed: %w", source.Url, err)
+		}
+		if _, ok := geminiSupportedMimeTypes[strings.ToLower(fileData.MimeType)]; !ok {
+			return nil, fmt.Errorf("mime type is not supported by Gemini: '%s', url: '%s', supported types are: %v", fileData.MimeType, source.Url, getSupportedMimeTypesList())
+		}
+		return &dto.GeminiPart{
+			InlineData: &dto.GeminiInlineData{
+				MimeType: fileData.MimeType,
+				Data:     fileData.Base64Data,
+			},
+		}, nil
+	case "text":
+		if text, ok := source.Data.(string); ok && text != "" {
+			return &dto.GeminiPart{Text: text}, nil
+		}
+	case "content":
+		blocks, _ := common.Any2Type[[]dto.ClaudeMediaMessage](source.Data)
+		texts := make([]string, 0, len(blocks))
+		for _, block := range blocks {
+			if block.Type == dto.ContentTypeText && block.GetText() != "" {
+				texts = append(texts, block.GetText())
+			}
+		}
+		if len(texts) > 0 {
+			return &dto.GeminiPart{Text: strings.Join(texts, "\n")}, nil
+		}
+	}
+	return nil, nil
+}
+
+// claudeToolResultToGeminiParts tool_result 转为 functionResponse，结果中的图片作为额外的 inlineData part
+func claudeToolResultToGeminiParts(c *gin.Context, block dto.ClaudeMediaMessage, name string) ([]dto.GeminiPart, error) {
+	var texts []string
+	var mediaParts []dto.GeminiPart
+	if block.IsStringContent() {
+		texts = append(texts, block.GetStringContent())
+	} else {
+		for _, item := range block.ParseMediaContent() {
+			switch item.Type {
+			case dto.ContentTypeText:
+				texts = append(texts, item.GetText())
+			case "image", "document":
+				part, err := claudeSourceToGeminiPart(c, item.Source)
+				if err != nil {
+					return nil, err
+				}
+				if part != nil {
+					mediaParts = append(mediaParts, *part)
+				}
+			}
+		}
+	}
+	content := strings.Join(texts, "\n")
+	var response map[string]any
+	if block.IsError {
+		response = map[string]any{"error": content}
+	} else if err := common.UnmarshalJsonStr(content, &response); err != nil || response == nil {
+		response = map[string]any{"content": content}
+	}
+	parts := []dto.GeminiPart{{
+		FunctionResponse: &dto.GeminiFunctionResponse{
+			Name:     name,
+			Response: response,
+		},
+	}}
+	return append(parts, mediaParts...), nil
+}
+
+func stopReasonGemini2Claude(finishReason string, hasToolUse bool) string {
+	if hasToolUse {
+		return "tool_use"
+	}
+	switch finishReason {
+	case "", "STOP", "FINISH_REASON_UNSPECIFIED":
+		return "end_turn"
+	case "MAX_TOKENS":
+		return "max_tokens"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "refusal"
+	default:
+		return "end_turn"
+	}
+}
+
+// geminiPartText 返回非思考、非函数调用 part 对应的文本，图片等媒体以 data URL 的 markdown 形式输出
+func geminiPartText(part *dto.GeminiPart) string {
+	if part.InlineData != nil {
+		if strings.HasPrefix(part.InlineData.MimeType, "image") {
+			return "![image](data:" + part.InlineData.MimeType + ";base64," + part.InlineData.Data + ")"
+		}
+		return fmt.Sprintf("[media](data:%s;base64,%s)", part.InlineData.MimeType, part.InlineData.Data)
+	}
+	if part.ExecutableCode != nil {
+		return "```" + part.ExecutableCode.Language + "\n" + part.ExecutableCode.Code + "\n```"
+	}
+	if part.CodeExecutionResult != nil {
+		return "```output\n" + part.CodeExecutionResult.Output + "\n```"
+	}
+	return part.Text
+}
+
+// geminiThoughtSignature 返回加上 claudeSignaturePrefix 的思考签名，没有签名时返回空字符串
+func geminiThoughtSignature(part *dto.GeminiPart) string {
+	if len(part.ThoughtSignature) == 0 {
+		return ""
+	}
+	var signature string
+	if err := common.Unmarshal(part.ThoughtSignature, &signature); err != nil || signature == "" {
+		return ""
+	}
+	return claudeSignaturePrefix + signature
+}
+
+// geminiGroundingCitation 一个检索片段对应的引用，text 为 Gemini 标注的被引用文本
+type geminiGroundingCitation struct {
+	text     string
+	citation dto.ClaudeWebSearchCitation
+}
+
+// geminiGroundingCitations 将 groundingMetadata 中每个 groundingSupport 引用的网页转为 web_search_result_location 引用
+func geminiGroundingCitations(metadata *dto.GeminiGroundingMetadata) []geminiGroundingCitation {
+	if metadata == nil {
+		return nil
+	}
+	var citations []geminiGroundingCitation
+	for _, support := range metadata.GroundingSupports {
+		for _, index := range support.GroundingChunkIndices {
+			if index < 0 || index >= len(metadata.GroundingChunks) || metadata.GroundingChunks[index].Web == nil {
+				continue
+			}
+			web := metadata.GroundingChunks[index].Web
+			citations = append(citations, geminiGroundingCitation{
+				text: support.Segment.Text,
+				citation: dto.ClaudeWebSearchCitation{
+					Type:      "web_search_result_location",
+					Url:       web.Uri,
+					Title:     web.Title,
+					CitedText: support.Segment.Text,
+				},
+			})
+		}
+	}
+	return citations
+}
+
+// attachGroundingCitations 把引用挂到包含被引用文本的文本块上，找不到时挂到最后一个文本块
+func attachGroundingCitations(contents []dto.ClaudeMediaMessage, citations []geminiGroundingCitation) {
+	blockCitations := make(map[int][]dto.ClaudeWebSearchCitation)
+	lastText := -1
+	for i := range contents {
+		if contents[i].Type == dto.ContentTypeText {
+			lastText = i
+		}
+	}
+	if lastText < 0 {
+		return
+	}
+	for _, item := range citations {
+		target := lastText
+		if item.text != "" {
+			for i := range contents {
+				if contents[i].Type == dto.ContentTypeText && strings.Contains(contents[i].GetText(), item.text) {
+					target = i
+					break
+				}
+			}
+		}
+		blockCitations[target] = append(blockCitations[target], item.citation)
+	}
+	for i, items := range blockCitations {
+		contents[i].Citations = items
+	}
+}
+
+func geminiUsage2Claude(usage *dto.Usage, metadata *dto.GeminiUsageMetadata) *dto.ClaudeUsage {
+	cached := metadata.CachedContentTokenCount
+	return &dto.ClaudeUsage{
+		InputTokens:          usage.PromptTokens - cached,
+		CacheReadInputTokens: cached,
+		OutputTokens:         usage.CompletionTokens,
+	}
+}
+
+func responseGemini2Claude(c *gin.Context, geminiResponse *dto.GeminiChatResponse, info *relaycommon.RelayInfo) *dto.ClaudeResponse {
+	claudeResponse := &dto.ClaudeResponse{
+		Id:    "msg_" + c.GetString(common.RequestIdKey),
+		Type:  "message",
+		Role:  "assistant",
+		Model: info.UpstreamModelName,
+	}
+	contents := make([]dto.ClaudeMediaMessage, 0)
+	hasToolUse := false
+	finishReason := ""
+	if len(geminiResponse.Candidates) > 0 {
+		candidate := geminiResponse.Candidates[0]
+		if candidate.FinishReason != nil {
+			finishReason = *candidate.FinishReason
+		}
+		for i := range candidate.Content.Parts {
+			part := &candidate.Content.Parts[i]
+			signature := geminiThoughtSignature(part)
+			if part.Thought {
+				contents = append(contents, dto.ClaudeMediaMessage{
+					Type:      "thinking",
+					Thinking:  common.GetPointer(part.Text),
+					Signature: signature,
+				})
+				continue
+			}
+			if signature != "" {
+				// 签名挂在普通 part 上时，回写到前一个思考块，没有则补一个空思考块承载签名
+				if last := len(contents) - 1; last >= 0 && contents[last].Type == "thinking" && contents[last].Signature == "" {
+					contents[last].Signature = signature
+				} else {
+					contents = append(contents, dto.ClaudeMediaMessage{
+						Type:      "thinking",
+						Thinking:  common.GetPointer(""),
+						Signature: signature,
+					})
+				}
+			}
+			if part.FunctionCall != nil {
+				hasToolUse = true
+				input := part.FunctionCall.Arguments
+				if input == nil {
+					input = map[string]any{}
+				}
+				contents = append(contents, dto.ClaudeMediaMessage{
+					Type:  "tool_use",
+					Id:    "toolu_" + common.GetUUID(),
+					Name:  part.FunctionCall.FunctionName,
+					Input: input,
+				})
+				continue
+			}
+			text := geminiPartText(part)
+			if text == "" {
+				continue
+			}
+			if last := len(contents) - 1; last >= 0 && contents[last].Type == dto.ContentTypeText {
+				contents[last].SetText(contents[last].GetText() + text)
+			} else {
+				block := dto.ClaudeMediaMessage{Type: dto.ContentTypeText}
+				block.SetText(text)
+				contents = append(contents, block)
+			}
+		}
+		attachGroundingCitations(contents, geminiGroundingCitations(candidate.GroundingMetadata))
+	}
+	claudeResponse.Content = contents
+	claudeResponse.StopReason = stopReasonGemini2Claude(finishReason, hasToolUse)
+	return claudeResponse
+}
+
+// GeminiClaudeHandler 将 Gemini 非流式响应直接转换为 Claude Messages 响应
+func GeminiClaudeHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	service.CloseResponseBodyGracefully(resp)
+	if common.DebugEnabled {
+		println(string(responseBody))
+	}
+	var geminiResponse dto.GeminiChatResponse
+	if err = common.Unmarshal(responseBody, &geminiResponse); err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+
+	usage := dto.Usage{
+		PromptTokens: geminiResponse.UsageMetadata.PromptTokenCount,
+		TotalTokens:  geminiResponse.UsageMetadata.TotalTokenCount,
+	}
+	usage.CompletionTokenDetails.ReasoningTokens = geminiResponse.UsageMetadata.ThoughtsTokenCount
+	usage.CompletionTokens = usage.TotalTokens - usage.PromptTokens
+	for _, detail := range geminiResponse.UsageMetadata.PromptTokensDetails {
+		if detail.Modality == "AUDIO" {
+			usage.PromptTokensDetails.AudioTokens = detail.TokenCount
+		} else if detail.Modality == "TEXT" {
+			usage.PromptTokensDetails.TextTokens = detail.TokenCount
+		}
+	}
+
+	claudeResponse := responseGemini2Claude(c, &geminiResponse, info)
+	claudeResponse.Usage = geminiUsage2Claude(&usage, &geminiResponse.UsageMetadata)
+	responseBody, err = common.Marshal(claudeResponse)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+	}
+	service.IOCopyBytesGracefully(c, resp, responseBody)
+	return &usage, nil
+}
+
+// geminiClaudeStreamState 记录流式转换过程中当前打开的内容块
+type geminiClaudeStreamState struct {
+	c          *gin.Context
+	index      int
+	blockType  string
+	hasToolUse bool
+}
+
+func (s *geminiClaudeStreamState) send(resp dto.ClaudeResponse) {
+	if err := helper.ClaudeData(s.c, resp); err != nil {
+		logger.LogError(s.c, err.Error())
+	}
+}
+
+func (s *geminiClaudeStreamState) closeBlock() {
+	if s.blockType == "" {
+		return
+	}
+	s.send(dto.ClaudeResponse{
+		Type:  "content_block_stop",
+		Index: common.GetPointer(s.index),
+	})
+	s.blockType = ""
+	s.index++
+}
+
+func (s *geminiClaudeStreamState) openBlock(block *dto.ClaudeMediaMessage) {
+	s.closeBlock()
+	s.blockType = block.Type
+	s.send(dto.ClaudeResponse{
+		Type:         "content_block_start",
+		Index:        common.GetPointer(s.index),
+		ContentBlock: block,
+	})
+}
+
+func (s *geminiClaudeStreamState) delta(delta *dto.ClaudeMediaMessage) {
+	s.send(dto.ClaudeResponse{
+		Type:  "content_block_delta",
+		Index: common.GetPointer(s.index),
+		Delta: delta,
+	})
+}
+
+func (s *geminiClaudeStreamState) handlePart(part *dto.GeminiPart) {
+	signature := geminiThoughtSignature(part)
+	if part.Thought {
+		if s.blockType != "thinking" {
+			s.openBlock(&dto.ClaudeMediaMessage{Type: "thinking", Thinking: common.GetPointer("")})
+		}
+		if part.Text != "" {
+			s.delta(&dto.ClaudeMediaMessage{Type: "thinking_delta", Thinking: common.GetPointer(part.Text)})
+		}
+		if signature != "" {
+			s.delta(&dto.ClaudeMediaMessage{Type: "signature_delta", Signature: signature})
+			s.closeBlock()
+		}
+		return
+	}
+	if signature != "" {
+		if s.blockType != "thinking" {
+			s.openBlock(&dto.ClaudeMediaMessage{Type: "thinking", Thinking: common.GetPointer("")})
+		}
+		s.delta(&dto.ClaudeMediaMessage{Type: "signature_delta", Signature: signature})
+		s.closeBlock()
+	}
+	if part.FunctionCall != nil {
+		s.hasToolUse = true
+		s.openBlock(&dto.ClaudeMediaMessage{
+			Type:  "tool_use",
+			Id:    "toolu_" + common.GetUUID(),
+			Name:  part.FunctionCall.FunctionName,
+			Input: map[string]any{},
+		})
+		args := "{}"
+		if part.FunctionCall.Arguments != nil {
+			if data, err := common.Marshal(part.FunctionCall.Arguments); err == nil {
+				args = string(data)
+			}
+		}
+		s.delta(&dto.ClaudeMediaMessage{Type: "input_json_delta", PartialJson: common.GetPointer(args)})
+		s.closeBlock()
+		return
+	}
+	text := geminiPartText(part)
+	if text == "" {
+		return
+	}
+	if s.blockType != dto.ContentTypeText {
+		s.openBlock(&dto.ClaudeMediaMessage{Type: dto.ContentTypeText, Text: common.GetPointer("")})
+	}
+	s.delta(&dto.ClaudeMediaMessage{Type: "text_delta", Text: common.GetPointer(text)})
+}
+
+// handleGrounding 检索来源通常随最后的响应块到达，以 citations_delta 挂到当前文本块上
+func (s *geminiClaudeStreamState) handleGrounding(metadata *dto.GeminiGroundingMetadata) {
+	citations := geminiGroundingCitations(metadata)
+	if len(citations) == 0 {
+		return
+	}
+	if s.blockType != dto.ContentTypeText {
+		s.openBlock(&dto.ClaudeMediaMessage{Type: dto.ContentTypeText, Text: common.GetPointer("")})
+	}
+	for _, item := range citations {
+		s.delta(&dto.ClaudeMediaMessage{Type: "citations_delta", Citation: item.citation})
+	}
+}
+
+// GeminiClaudeStreamHandler 将 Gemini 流式响应直接转换为 Claude Messages 事件流，
+// 思考内容对应 thinking 块，thoughtSignature 以 signature_delta 输出，函数调用一次性输出完整参数
+func GeminiClaudeStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	state := &geminiClaudeStreamState{c: c}
+	started := false
+	finishReason := ""
+	var usageMetadata dto.GeminiUsageMetadata
+	sendStart := func() {
+		if started {
+			return
+		}
+		started = true
+		msg := &dto.ClaudeMediaMessage{
+			Id:    "msg_" + c.GetString(common.RequestIdKey),
+			Model: info.UpstreamModelName,
+			Type:  "message",
+			Role:  "assistant",
+			Usage: &dto.ClaudeUsage{
+				InputTokens: info.GetEstimatePromptTokens(),
+			},
+		}
+		msg.SetContent(make([]any, 0))
+		state.send(dto.ClaudeResponse{
+			Type:    "message_start",
+			Message: msg,
+		})
+	}
+
+	usage, err := geminiStreamHandler(c, info, resp, func(data string, geminiResponse *dto.GeminiChatResponse) bool {
+		sendStart()
+		if geminiResponse.UsageMetadata.TotalTokenCount != 0 {
+			usageMetadata = geminiResponse.UsageMetadata
+		}
+		if len(geminiResponse.Candidates) == 0 {
+			return true
+		}
+		candidate := geminiResponse.Candidates[0]
+		for i := range candidate.Content.Parts {
+			state.handlePart(&candidate.Content.Parts[i])
+		}
+		state.handleGrounding(candidate.GroundingMetadata)
+		if candidate.FinishReason != nil && *candidate.FinishReason != "" {
+			finishReason = *candidate.FinishReason
+		}
+		return true
+	})
+	if err != nil {
+		return usage, err
+	}
+
+	sendStart()
+	state.closeBlock()
+	state.send(dto.ClaudeResponse{
+		Type:  "message_delta",
+		Usage: geminiUsage2Claude(usage, &usageMetadata),
+		Delta: &dto.ClaudeMediaMessage{
+			StopReason: common.GetPointer(stopReasonGemini2Claude(finishReason, state.hasToolUse)),
+		},
+	})
+	state.send(dto.ClaudeResponse{
+		Type: "message_stop",
+	})
+	return usage, nil
+}
@@ -0,0 +1,372 @@
+package gemini
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestClaudeContext(t *testing.T) (*gin.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	return c, recorder
+}
+
+func newTestClaudeInfo() *relaycommon.RelayInfo {
+	return &relaycommon.RelayInfo{
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ChannelType:       constant.ChannelTypeGemini,
+			UpstreamModelName: "gemini-2.5-flash",
+		},
+	}
+}
+
+func geminiSignatureOf(part dto.GeminiPart) string {
+	var signature string
+	_ = common.Unmarshal(part.ThoughtSignature, &signature)
+	return signature
+}
+
+func TestConvertClaude2Gemini(t *testing.T) {
+	const imageUrl = "https://example.com/cat.png"
+	maxImageNum := constant.GeminiVisionMaxImageNum
+	constant.GeminiVisionMaxImageNum = 16
+	t.Cleanup(func() { constant.GeminiVisionMaxImageNum = maxImageNum })
+	tests := []struct {
+		name  string
+		body  string
+		check func(t *testing.T, req *dto.GeminiChatRequest)
+	}{
+		{
+			name: "thinking with gemini signature",
+			body: `{"model":"m","max_tokens":1024,"thinking":{"type":"enabled","budget_tokens":2048},"messages":[
+				{"role":"user","content":"hi"},
+				{"role":"assistant","content":[{"type":"thinking","thinking":"hmm","signature":"gemini.c2lnLTE="},{"type":"text","text":"hello"}]},
+				{"role":"user","content":"again"}]}`,
+			check: func(t *testing.T, req *dto.GeminiChatRequest) {
+				config := req.GenerationConfig.ThinkingConfig
+				if config == nil || !config.IncludeThoughts || config.ThinkingBudget == nil || *config.ThinkingBudget != 2048 {
+					t.Fatalf("thinking config = %+v", config)
+				}
+				model := req.Contents[1]
+				if model.Role != "model" || len(model.Parts) != 1 || model.Parts[0].Text != "hello" {
+					t.Fatalf("model content = %+v", model)
+				}
+				if signature := geminiSignatureOf(model.Parts[0]); signature != "c2lnLTE=" {
+					t.Fatalf("signature = %q", signature)
+				}
+			},
+		},
+		{
+			name: "thinking with foreign signature",
+			body: `{"model":"m","messages":[
+				{"role":"user","content":"hi"},
+				{"role":"assistant","content":[{"type":"thinking","thinking":"hmm","signature":"EqQBCkgIARAB"},{"type":"text","text":"hello"}]}]}`,
+			check: func(t *testing.T, req *dto.GeminiChatRequest) {
+				if signature := geminiSignatureOf(req.Contents[1].Parts[0]); signature != thoughtSignatureBypassValue {
+					t.Fatalf("signature = %q, want bypass value", signature)
+				}
+			},
+		},
+		{
+			name: "tool use and tool result",
+			body: `{"model":"m","messages":[
+				{"role":"user","content":"weather?"},
+				{"role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}]},
+				{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"{\"temp\":20}"},{"type":"tool_result","tool_use_id":"toolu_1","is_error":true,"content":[{"type":"text","text":"boom"}]}]}]}`,
+			check: func(t *testing.T, req *dto.GeminiChatRequest) {
+				call := req.Contents[1].Parts[0].FunctionCall
+				if call == nil || call.FunctionName != "get_weather" {
+					t.Fatalf("function call = %+v", call)
+				}
+				if args, _ := call.Arguments.(map[string]any); args["city"] != "Paris" {
+					t.Fatalf("args = %v", call.Arguments)
+				}
+				if geminiSignatureOf(req.Contents[1].Parts[0]) != thoughtSignatureBypassValue {
+					t.Fatalf("first function call of gemini channel should carry bypass signature")
+				}
+				results := req.Contents[2].Parts
+				if len(results) != 2 || results[0].FunctionResponse == nil || results[0].FunctionResponse.Name != "get_weather" {
+					t.Fatalf("function responses = %+v", results)
+				}
+				if results[0].FunctionResponse.Response["temp"] != float64(20) || results[1].FunctionResponse.Response["error"] != "boom" {
+					t.Fatalf("responses = %v / %v", results[0].FunctionResponse.Response, results[1].FunctionResponse.Response)
+				}
+			},
+		},
+		{
+			name: "base64 and url images",
+			body: `{"model":"m","messages":[{"role":"user","content":[
+				{"type":"image","source":{"type":"base64","media_type":"image/jpeg","data":"/9j/AA=="}},
+				{"type":"image","source":{"type":"url","url":"` + imageUrl + `"}},
+				{"type":"text","text":"compare"}]}]}`,
+			check: func(t *testing.T, req *dto.GeminiChatRequest) {
+				parts := req.Contents[0].Parts
+				if len(parts) != 3 {
+					t.Fatalf("parts = %+v", parts)
+				}
+				if parts[0].InlineData == nil || parts[0].InlineData.MimeType != "image/jpeg" || parts[0].InlineData.Data != "/9j/AA==" {
+					t.Fatalf("base64 image = %+v", parts[0].InlineData)
+				}
+				if parts[1].InlineData == nil || parts[1].InlineData.MimeType != "image/png" || parts[1].InlineData.Data != "iVBORw==" {
+					t.Fatalf("url image = %+v", parts[1].InlineData)
+				}
+			},
+		},
+		{
+			name: "pdf and text documents",
+			body: `{"model":"m","messages":[{"role":"user","content":[
+				{"type":"document","source":{"type":"base64","media_type":"application/pdf","data":"JVBERi0="}},
+				{"type":"document","source":{"type":"text","media_type":"text/plain","data":"plain notes"}},
+				{"type":"text","text":"summarize"}]}]}`,
+			check: func(t *testing.T, req *dto.GeminiChatRequest) {
+				parts := req.Contents[0].Parts
+				if parts[0].InlineData == nil || parts[0].InlineData.MimeType != "application/pdf" || parts[0].InlineData.Data != "JVBERi0=" {
+					t.Fatalf("pdf = %+v", parts[0].InlineData)
+				}
+				if parts[1].Text != "plain notes" {
+					t.Fatalf("text document = %+v", parts[1])
+				}
+			},
+		},
+		{
+			name: "tool choice",
+			body: `{"model":"m","messages":[{"role":"user","content":"hi"}],
+				"tools":[{"name":"get_weather","description":"weather","input_schema":{"type":"object","properties":{"city":{"type":"string"}}}},{"type":"web_search_20250305","name":"web_search"}],
+				"tool_choice":{"type":"tool","name":"get_weather"}}`,
+			check: func(t *testing.T, req *dto.GeminiChatRequest) {
+				tools := req.GetTools()
+				if len(tools) != 2 || tools[0].GoogleSearch == nil {
+					t.Fatalf("tools = %+v", tools)
+				}
+				functions, _ := common.Any2Type[[]dto.FunctionRequest](tools[1].FunctionDeclarations)
+				if len(functions) != 1 || functions[0].Name != "get_weather" {
+					t.Fatalf("function declarations = %+v", tools[1].FunctionDeclarations)
+				}
+				config := req.ToolConfig.FunctionCallingConfig
+				if config.Mode != "ANY" || len(config.AllowedFunctionNames) != 1 || config.AllowedFunctionNames[0] != "get_weather" {
+					t.Fatalf("function calling config = %+v", config)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestClaudeContext(t)
+			c.Set(fmt.Sprintf("file_download_%s", common.GenerateHMAC(imageUrl)), &types.LocalFileData{MimeType: "image/png", Base64Data: "iVBORw=="})
+			var claudeRequest dto.ClaudeRequest
+			if err := common.UnmarshalJsonStr(tt.body, &claudeRequest); err != nil {
+				t.Fatalf("parse request: %v", err)
+			}
+			geminiRequest, err := ConvertClaude2Gemini(c, &claudeRequest, newTestClaudeInfo())
+			if err != nil {
+				t.Fatalf("convert: %v", err)
+			}
+			tt.check(t, geminiRequest)
+		})
+	}
+}
+
+func TestConvertClaude2GeminiRejectsUnknownToolResult(t *testing.T) {
+	c, _ := newTestClaudeContext(t)
+	var claudeRequest dto.ClaudeRequest
+	body := `{"model":"m","messages":[{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_missing","content":"ok"}]}]}`
+	if err := common.UnmarshalJsonStr(body, &claudeRequest); err != nil {
+		t.Fatalf("parse request: %v", err)
+	}
+	_, err := ConvertClaude2Gemini(c, &claudeRequest, newTestClaudeInfo())
+	var apiErr *types.NewAPIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("err = %v, want 400", err)
+	}
+}
+
+const testGroundingMetadata = `"groundingMetadata":{
+	"webSearchQueries":["paris weather"],
+	"groundingChunks":[{"web":{"uri":"https://weather.example/paris","title":"Paris weather"}}],
+	"groundingSupports":[{"segment":{"startIndex":0,"endIndex":15,"text":"Paris is sunny"},"groundingChunkIndices":[0]}]}`
+
+func TestResponseGemini2Claude(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		check func(t *testing.T, resp *dto.ClaudeResponse)
+	}{
+		{
+			name: "thinking with signature",
+			body: `{"candidates":[{"content":{"role":"model","parts":[{"text":"plan","thought":true},{"text":"answer","thoughtSignature":"c2ln"}]},"finishReason":"STOP"}]}`,
+			check: func(t *testing.T, resp *dto.ClaudeResponse) {
+				if len(resp.Content) != 2 || resp.Content[0].Type != "thinking" || resp.Content[0].Signature != claudeSignaturePrefix+"c2ln" {
+					t.Fatalf("content = %+v", resp.Content)
+				}
+				if resp.Content[1].GetText() != "answer" || resp.StopReason != "end_turn" {
+					t.Fatalf("text = %q stop = %s", resp.Content[1].GetText(), resp.StopReason)
+				}
+			},
+		},
+		{
+			name: "function call",
+			body: `{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]},"finishReason":"STOP"}]}`,
+			check: func(t *testing.T, resp *dto.ClaudeResponse) {
+				if len(resp.Content) != 1 || resp.Content[0].Type != "tool_use" || resp.Content[0].Name != "get_weather" {
+					t.Fatalf("content = %+v", resp.Content)
+				}
+				if resp.StopReason != "tool_use" {
+					t.Fatalf("stop reason = %s", resp.StopReason)
+				}
+			},
+		},
+		{
+			name: "grounding citations",
+			body: `{"candidates":[{"content":{"role":"model","parts":[{"text":"Paris is sunny today."}]},"finishReason":"STOP",` + testGroundingMetadata + `}]}`,
+			check: func(t *testing.T, resp *dto.ClaudeResponse) {
+				citations, _ := resp.Content[0].Citations.([]dto.ClaudeWebSearchCitation)
+				if len(citations) != 1 {
+					t.Fatalf("citations = %+v", resp.Content[0].Citations)
+				}
+				citation := citations[0]
+				if citation.Type != "web_search_result_location" || citation.Url != "https://weather.example/paris" || citation.CitedText != "Paris is sunny" {
+					t.Fatalf("citation = %+v", citation)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestClaudeContext(t)
+			var geminiResponse dto.GeminiChatResponse
+			if err := common.UnmarshalJsonStr(tt.body, &geminiResponse); err != nil {
+				t.Fatalf("parse response: %v", err)
+			}
+			tt.check(t, responseGemini2Claude(c, &geminiResponse, newTestClaudeInfo()))
+		})
+	}
+}
+
+type claudeTestEvent struct {
+	Type         string                  `json:"type"`
+	Index        *int                    `json:"index"`
+	ContentBlock *dto.ClaudeMediaMessage `json:"content_block"`
+	Delta        *struct {
+		Type        string         `json:"type"`
+		Text        string         `json:"text"`
+		Thinking    string         `json:"thinking"`
+		Signature   string         `json:"signature"`
+		PartialJson string         `json:"partial_json"`
+		Citation    map[string]any `json:"citation"`
+	} `json:"delta"`
+}
+
+func parseClaudeEvents(t *testing.T, body string) []claudeTestEvent {
+	t.Helper()
+	var events []claudeTestEvent
+	for _, line := range strings.Split(body, "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var event claudeTestEvent
+		if err := common.UnmarshalJsonStr(data, &event); err != nil {
+			t.Fatalf("parse event %q: %v", data, err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestGeminiClaudeStreamState(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		check  func(t *testing.T, events []claudeTestEvent, state *geminiClaudeStreamState)
+	}{
+		{
+			name: "thinking with signature",
+			chunks: []string{
+				`{"candidates":[{"content":{"parts":[{"text":"plan","thought":true}]}}]}`,
+				`{"candidates":[{"content":{"parts":[{"text":"answer","thoughtSignature":"c2ln"}]}}]}`,
+			},
+			check: func(t *testing.T, events []claudeTestEvent, state *geminiClaudeStreamState) {
+				var signature, text string
+				for _, event := range events {
+					if event.Delta == nil {
+						continue
+					}
+					switch event.Delta.Type {
+					case "signature_delta":
+						signature = event.Delta.Signature
+					case "text_delta":
+						text += event.Delta.Text
+					}
+				}
+				if signature != claudeSignaturePrefix+"c2ln" || text != "answer" {
+					t.Fatalf("signature = %q text = %q", signature, text)
+				}
+				if events[0].ContentBlock == nil || events[0].ContentBlock.Type != "thinking" {
+					t.Fatalf("first block = %+v", events[0].ContentBlock)
+				}
+			},
+		},
+		{
+			name: "function call",
+			chunks: []string{
+				`{"candidates":[{"content":{"parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]}}]}`,
+			},
+			check: func(t *testing.T, events []claudeTestEvent, state *geminiClaudeStreamState) {
+				if !state.hasToolUse || events[0].ContentBlock == nil || events[0].ContentBlock.Name != "get_weather" {
+					t.Fatalf("events = %+v", events)
+				}
+				if events[1].Delta == nil || events[1].Delta.PartialJson != `{"city":"Paris"}` {
+					t.Fatalf("input delta = %+v", events[1].Delta)
+				}
+			},
+		},
+		{
+			name: "grounding citations",
+			chunks: []string{
+				`{"candidates":[{"content":{"parts":[{"text":"Paris is sunny today."}]}}]}`,
+				`{"candidates":[{"content":{"parts":[]},"finishReason":"STOP",` + testGroundingMetadata + `}]}`,
+			},
+			check: func(t *testing.T, events []claudeTestEvent, state *geminiClaudeStreamState) {
+				last := events[len(events)-1]
+				if last.Delta == nil || last.Delta.Type != "citations_delta" || last.Delta.Citation["url"] != "https://weather.example/paris" {
+					t.Fatalf("last event = %+v", last)
+				}
+				if *last.Index != 0 {
+					t.Fatalf("citation attached to block %d, want the open text block", *last.Index)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, recorder := newTestClaudeContext(t)
+			state := &geminiClaudeStreamState{c: c}
+			for _, chunk := range tt.chunks {
+				var geminiResponse dto.GeminiChatResponse
+				if err := common.UnmarshalJsonStr(chunk, &geminiResponse); err != nil {
+					t.Fatalf("parse chunk: %v", err)
+				}
+				candidate := geminiResponse.Candidates[0]
+				for i := range candidate.Content.Parts {
+					state.handlePart(&candidate.Content.Parts[i])
+				}
+				state.handleGrounding(candidate.GroundingMetadata)
+			}
+			tt.check(t, parseClaudeEvents(t, recorder.Body.String()), state)
+		})
+	}
+}
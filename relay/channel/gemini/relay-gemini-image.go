@@ -0,0 +1,197 @@
+package gemini
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Gemini 图片模型单次调用只生成一张图片，n 张图片需要多次调用，限制与 OpenAI 一致
+const geminiImageMaxN = 10
+
+// IsGeminiImageModel 判断是否为通过 generateContent 生成图片的 Gemini 模型，如 gemini-2.5-flash-image
+func IsGeminiImageModel(modelName string) bool {
+	return strings.HasPrefix(modelName, "gemini") && strings.Contains(modelName, "-image")
+}
+
+func imageRequestOpenAI2Gemini(info *relaycommon.RelayInfo, request dto.ImageRequest) (*dto.GeminiChatRequest, error) {
+	if info.RelayMode != constant.RelayModeImagesGenerations {
+		return nil, errors.New("only image generation is supported for gemini image models")
+	}
+	if request.N > geminiImageMaxN {
+		return nil, fmt.Errorf("n must be between 1 and %d", geminiImageMaxN)
+	}
+	geminiRequest := &dto.GeminiChatRequest{
+		Contents: []dto.GeminiChatContent{
+			{
+				Role:  "user",
+				Parts: []dto.GeminiPart{{Text: request.Prompt}},
+			},
+		},
+		SafetySettings: buildSafetySettings(),
+		GenerationConfig: dto.GeminiChatGenerationConfig{
+			ResponseModalities: []string{"TEXT", "IMAGE"},
+		},
+	}
+
+	imageConfig := make(map[string]string)
+	if aspectRatio := service.ImageSizeToAspectRatio(request.Size); aspectRatio != "" {
+		imageConfig["aspectRatio"] = aspectRatio
+	}
+	// 仅 Gemini 3 Pro Image 支持指定输出分辨率（1K/2K/4K）
+	if strings.HasPrefix(info.UpstreamModelName, "gemini-3") {
+		switch request.Quality {
+		case "hd", "high", "2K":
+			imageConfig["imageSize"] = "2K"
+		case "4K":
+			imageConfig["imageSize"] = "4K"
+		}
+	}
+	if len(imageConfig) > 0 {
+		imageConfigJson, err := common.Marshal(imageConfig)
+		if err != nil {
+			return nil, err
+		}
+		geminiRequest.GenerationConfig.ImageConfig = imageConfigJson
+	}
+	return geminiRequest, nil
+}
+
+// DoImageRequest 按请求的 n 重复调用 generateContent，各次返回的候选结果合并后交给 GeminiImageGenerationHandler 处理；
+// 透传时请求体由客户端按 generateContent 格式构造，去掉路由用的 model 字段后原样发送一次
+func DoImageRequest(a channel.Adaptor, c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("read image request body failed: %w", err)
+	}
+	if model_setting.GetGlobalSettings().PassThroughRequestEnabled || info.ChannelSetting.PassThroughBodyEnabled {
+		var data map[string]any
+		if err = common.Unmarshal(body, &data); err != nil {
+			return nil, fmt.Errorf("pass-through unmarshal request body failed: %w", err)
+		}
+		delete(data, "model")
+		if body, err = common.Marshal(data); err != nil {
+			return nil, err
+		}
+		return channel.DoApiRequest(a, c, info, bytes.NewReader(body))
+	}
+	n := 1
+	if request, ok := info.Request.(*dto.ImageRequest); ok && request.N > 1 {
+		n = int(request.N)
+	}
+	bodies := make([][]byte, n)
+	for i := range bodies {
+		bodies[i] = body
+	}
+	return channel.DoBatchApiRequestWithUsage(a, c, info, bodies, mergeGeminiImageResponses, geminiImagePartialUsage)
+}
+
+func mergeGeminiImageResponses(bodies [][]byte) ([]byte, error) {
+	var merged dto.GeminiChatResponse
+	for _, body := range bodies {
+		var geminiResponse dto.GeminiChatResponse
+		if err := common.Unmarshal(body, &geminiResponse); err != nil {
+			return nil, err
+		}
+		merged.Candidates = append(merged.Candidates, geminiResponse.Candidates...)
+		if geminiResponse.PromptFeedback != nil {
+			merged.PromptFeedback = geminiResponse.PromptFeedback
+		}
+		merged.UsageMetadata.PromptTokenCount += geminiResponse.UsageMetadata.PromptTokenCount
+		merged.UsageMetadata.CandidatesTokenCount += geminiResponse.UsageMetadata.CandidatesTokenCount
+		merged.UsageMetadata.ThoughtsTokenCount += geminiResponse.UsageMetadata.ThoughtsTokenCount
+		merged.UsageMetadata.TotalTokenCount += geminiResponse.UsageMetadata.TotalTokenCount
+	}
+	return common.Marshal(merged)
+}
+
+// geminiImageParts 返回响应中生成的图片，跳过思考过程中生成的草图
+func geminiImageParts(geminiResponse *dto.GeminiChatResponse) []*dto.GeminiInlineData {
+	var images []*dto.GeminiInlineData
+	for _, candidate := range geminiResponse.Candidates {
+		for _, part := range candidate.Content.Parts {
+			if part.Thought || part.InlineData == nil || !strings.HasPrefix(part.InlineData.MimeType, "image/") {
+				continue
+			}
+			images = append(images, part.InlineData)
+		}
+	}
+	return images
+}
+
+func geminiImageUsage(geminiResponse *dto.GeminiChatResponse) *dto.Usage {
+	usage := &dto.Usage{
+		PromptTokens:     geminiResponse.UsageMetadata.PromptTokenCount,
+		CompletionTokens: geminiResponse.UsageMetadata.TotalTokenCount - geminiResponse.UsageMetadata.PromptTokenCount,
+		TotalTokens:      geminiResponse.UsageMetadata.TotalTokenCount,
+	}
+	usage.CompletionTokenDetails.ReasoningTokens = geminiResponse.UsageMetadata.ThoughtsTokenCount
+	return usage
+}
+
+// geminiImagePartialUsage 计算拆分请求中已成功调用的用量，按次计费时只计已生成的图片
+func geminiImagePartialUsage(c *gin.Context, info *relaycommon.RelayInfo, body []byte) (*dto.Usage, error) {
+	var geminiResponse dto.GeminiChatResponse
+	if err := common.Unmarshal(body, &geminiResponse); err != nil {
+		return nil, err
+	}
+	helper.ImagePriceHelperPerCall(info, len(geminiImageParts(&geminiResponse)))
+	return geminiImageUsage(&geminiResponse), nil
+}
+
+// GeminiImageGenerationHandler 从 Gemini 图片模型的 generateContent 响应中提取图片，转换为 OpenAI images 格式
+func GeminiImageGenerationHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	service.CloseResponseBodyGracefully(resp)
+
+	var geminiResponse dto.GeminiChatResponse
+	if err = common.Unmarshal(responseBody, &geminiResponse); err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+
+	imageResponse := dto.ImageResponse{
+		Created: common.GetTimestamp(),
+		Data:    make([]dto.ImageData, 0, len(geminiResponse.Candidates)),
+	}
+	for _, image := range geminiImageParts(&geminiResponse) {
+		imageData, err := service.BuildImageData(c, info, image.MimeType, image.Data)
+		if err != nil {
+			return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+		}
+		imageResponse.Data = append(imageResponse.Data, imageData)
+	}
+	if len(imageResponse.Data) == 0 {
+		if geminiResponse.PromptFeedback != nil && geminiResponse.PromptFeedback.BlockReason != nil {
+			return nil, types.NewOpenAIError(errors.New("request blocked by Gemini API: "+*geminiResponse.PromptFeedback.BlockReason), types.ErrorCodePromptBlocked, http.StatusBadRequest)
+		}
+		return nil, types.NewOpenAIError(errors.New("no images generated"), types.ErrorCodeEmptyResponse, http.StatusInternalServerError)
+	}
+
+	usage := geminiImageUsage(&geminiResponse)
+	helper.ImagePriceHelperPerCall(info, len(imageResponse.Data))
+
+	responseBody, err = common.Marshal(imageResponse)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+	}
+	service.IOCopyBytesGracefully(c, resp, responseBody)
+	return usage, nil
+}
@@ -0,0 +1,102 @@
+package gemini
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testGeminiImageResponse = `{"candidates":[{"content":{"role":"model","parts":[{"inlineData":{"mimeType":"image/png","data":"aGVsbG8="}}]}}],"usageMetadata":{"promptTokenCount":10,"totalTokenCount":1300}}`
+
+// newGeminiImageTestServer 前 succeed 次请求返回一张图片，之后返回 500
+func newGeminiImageTestServer(t *testing.T, succeed int, bodies *[]map[string]any) *httptest.Server {
+	t.Helper()
+	service.InitHttpClient()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := common.DecodeJson(r.Body, &body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		*bodies = append(*bodies, body)
+		if len(*bodies) > succeed {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"error":{"code":500,"message":"internal error"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(testGeminiImageResponse))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newGeminiImageTestInfo(serverURL string, n uint) (*gin.Context, *relaycommon.RelayInfo) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/images/generations", nil)
+	info := &relaycommon.RelayInfo{
+		RelayMode: constant.RelayModeImagesGenerations,
+		Request:   &dto.ImageRequest{Model: "gemini-2.5-flash-image", Prompt: "a cat", N: n},
+		PriceData: types.PriceData{UsePrice: true, ModelPrice: 0.3},
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ChannelBaseUrl:    serverURL,
+			UpstreamModelName: "gemini-2.5-flash-image",
+		},
+	}
+	return c, info
+}
+
+func TestDoImageRequestRecordsPartialUsage(t *testing.T) {
+	var bodies []map[string]any
+	server := newGeminiImageTestServer(t, 1, &bodies)
+	c, info := newGeminiImageTestInfo(server.URL, 3)
+
+	resp, err := DoImageRequest(&Adaptor{}, c, info, bytes.NewReader([]byte(`{"contents":[]}`)))
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	if httpResp := resp.(*http.Response); httpResp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("status = %d", httpResp.StatusCode)
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("requests = %d, want 2", len(bodies))
+	}
+	if info.BatchPartialUsage == nil || info.BatchPartialUsage.PromptTokens != 10 || info.BatchPartialUsage.TotalTokens != 1300 {
+		t.Fatalf("partial usage = %+v", info.BatchPartialUsage)
+	}
+	// 请求 3 张只生成了 1 张，按次价格折算为三分之一
+	if price := info.PriceData.ModelPrice; price < 0.0999 || price > 0.1001 {
+		t.Fatalf("model price = %v", price)
+	}
+}
+
+func TestDoImageRequestPassThrough(t *testing.T) {
+	var bodies []map[string]any
+	server := newGeminiImageTestServer(t, 1, &bodies)
+	c, info := newGeminiImageTestInfo(server.URL, 3)
+	info.ChannelSetting.PassThroughBodyEnabled = true
+
+	body := []byte(`{"model":"gemini-2.5-flash-image","contents":[{"role":"user","parts":[{"text":"a cat"}]}]}`)
+	resp, err := DoImageRequest(&Adaptor{}, c, info, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	if httpResp := resp.(*http.Response); httpResp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", httpResp.StatusCode)
+	}
+	// 透传的请求体只发送一次，并去掉 model 字段
+	if len(bodies) != 1 {
+		t.Fatalf("requests = %d, want 1", len(bodies))
+	}
+	if _, ok := bodies[0]["model"]; ok || bodies[0]["contents"] == nil {
+		t.Fatalf("body = %v", bodies[0])
+	}
+}
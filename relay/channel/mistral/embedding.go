@@ -0,0 +1,27 @@
+package mistral
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/dto"
+)
+
+// MistralEmbeddingRequest Mistral 不接受未知字段，只保留其支持的参数
+type MistralEmbeddingRequest struct {
+	Model           string `json:"model"`
+	Input           any    `json:"input"`
+	OutputDimension int    `json:"output_dimension,omitempty"`
+	EncodingFormat  string `json:"encoding_format,omitempty"`
+}
+
+func embeddingRequestOpenAI2Mistral(request dto.EmbeddingRequest) (*MistralEmbeddingRequest, error) {
+	if len(request.ParseInput()) == 0 {
+		return nil, errors.New("input is empty")
+	}
+	return &MistralEmbeddingRequest{
+		Model:           request.Model,
+		Input:           request.Input,
+		OutputDimension: request.Dimensions,
+		EncodingFormat:  request.EncodingFormat,
+	}, nil
+}
@@ -1,6 +1,7 @@
 package openai
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -40,7 +41,8 @@ func OaiResponsesHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http
 		c.Set("image_generation_call_size", responsesResponse.GetSize())
 	}
 
-	// 写入新的 response body
+	// 先保存再写入新的 response body，客户端收到响应时即可引用该 id
+	service.StoreResponsesResult(c, info, responseBody)
 	service.IOCopyBytesGracefully(c, resp, responseBody)
 
 	// compute usage
@@ -84,6 +86,15 @@ func OaiResponsesStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp
 		// 检查当前数据是否包含 completed 状态和 usage 信息
 		var streamResponse dto.ResponsesStreamResponse
 		if err := common.UnmarshalJsonStr(data, &streamResponse); err == nil {
+			if streamResponse.Type == "response.completed" {
+				// 转发 completed 事件前保存，客户端收到后即可引用该 id
+				var completed struct {
+					Response json.RawMessage `json:"response"`
+				}
+				if err := common.UnmarshalJsonStr(data, &completed); err == nil && len(completed.Response) > 0 {
+					service.StoreResponsesResult(c, info, completed.Response)
+				}
+			}
 			sendResponsesStreamData(c, streamResponse, data)
 			switch streamResponse.Type {
 			case "response.completed":
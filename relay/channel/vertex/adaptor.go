@@ -56,6 +56,9 @@ func (a *Adaptor) ConvertGeminiRequest(c *gin.Context, info *relaycommon.RelayIn
 }
 
 func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (any, error) {
+	if a.RequestMode == RequestModeGemini {
+		return gemini.ConvertClaude2Gemini(c, request, info)
+	}
 	if v, ok := claudeModelMap[info.UpstreamModelName]; ok {
 		c.Set("request_model", v)
 	} else {
@@ -193,7 +196,7 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 			suffix = "generateContent"
 		}
 
-		if strings.HasPrefix(info.UpstreamModelName, "imagen") {
+		if strings.HasPrefix(info.UpstreamModelName, "imagen") || info.RelayMode == constant.RelayModeEmbeddings {
 			suffix = "predict"
 		}
 		return a.getRequestUrl(info, info.UpstreamModelName, suffix)
@@ -317,8 +320,10 @@ func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dt
 }
 
 func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.EmbeddingRequest) (any, error) {
-	//TODO implement me
-	return nil, errors.New("not implemented")
+	if a.RequestMode != RequestModeGemini {
+		return nil, errors.New("embedding is only supported for Google models on Vertex AI")
+	}
+	return embeddingRequestOpenAI2Vertex(request)
 }
 
 func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error) {
@@ -327,10 +332,23 @@ func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommo
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
+	if info.RelayMode == constant.RelayModeEmbeddings {
+		bodies, err := splitVertexEmbeddingRequest(requestBody, info.UpstreamModelName)
+		if err != nil {
+			return nil, err
+		}
+		return channel.DoBatchApiRequestWithUsage(a, c, info, bodies, mergeVertexEmbeddingResponses, vertexEmbeddingPartialUsage)
+	}
+	if info.RelayMode == constant.RelayModeImagesGenerations && gemini.IsGeminiImageModel(info.UpstreamModelName) {
+		return gemini.DoImageRequest(a, c, info, requestBody)
+	}
 	return channel.DoApiRequest(a, c, info, requestBody)
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *types.NewAPIError) {
+	if info.RelayMode == constant.RelayModeEmbeddings {
+		return vertexEmbeddingHandler(c, resp, info)
+	}
 	if info.IsStream {
 		switch a.RequestMode {
 		case RequestModeClaude:
@@ -338,6 +356,8 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycom
 		case RequestModeGemini:
 			if info.RelayMode == constant.RelayModeGemini {
 				return gemini.GeminiTextGenerationStreamHandler(c, info, resp)
+			} else if info.RelayFormat == types.RelayFormatClaude {
+				return gemini.GeminiClaudeStreamHandler(c, info, resp)
 			} else {
 				return gemini.GeminiChatStreamHandler(c, info, resp)
 			}
@@ -355,6 +375,12 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycom
 				if strings.HasPrefix(info.UpstreamModelName, "imagen") {
 					return gemini.GeminiImageHandler(c, info, resp)
 				}
+				if info.RelayMode == constant.RelayModeImagesGenerations && gemini.IsGeminiImageModel(info.UpstreamModelName) {
+					return gemini.GeminiImageGenerationHandler(c, info, resp)
+				}
+				if info.RelayFormat == types.RelayFormatClaude {
+					return gemini.GeminiClaudeHandler(c, info, resp)
+				}
 				return gemini.GeminiChatHandler(c, info, resp)
 			}
 		case RequestModeLlama:
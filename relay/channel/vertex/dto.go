@@ -35,3 +35,32 @@ func copyRequest(req *dto.ClaudeRequest, version string) *VertexAIClaudeRequest
 		Thinking:         req.Thinking,
 	}
 }
+
+type VertexEmbeddingInstance struct {
+	Content  string `json:"content"`
+	TaskType string `json:"task_type,omitempty"`
+}
+
+type VertexEmbeddingParameters struct {
+	AutoTruncate         bool `json:"autoTruncate"`
+	OutputDimensionality int  `json:"outputDimensionality,omitempty"`
+}
+
+type VertexEmbeddingRequest struct {
+	Instances  []VertexEmbeddingInstance `json:"instances"`
+	Parameters VertexEmbeddingParameters `json:"parameters"`
+}
+
+type VertexEmbeddingPrediction struct {
+	Embeddings struct {
+		Values     []float64 `json:"values"`
+		Statistics struct {
+			TokenCount int  `json:"token_count"`
+			Truncated  bool `json:"truncated"`
+		} `json:"statistics"`
+	} `json:"embeddings"`
+}
+
+type VertexEmbeddingResponse struct {
+	Predictions []VertexEmbeddingPrediction `json:"predictions"`
+}
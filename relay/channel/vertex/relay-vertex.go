@@ -1,6 +1,19 @@
 package vertex
 
-import "github.com/QuantumNous/new-api/common"
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
 
 func GetModelRegion(other string, localModelName string) string {
 	// if other is json string
@@ -20,3 +33,126 @@ func GetModelRegion(other string, localModelName string) string {
 	}
 	return other
 }
+
+// embeddingBatchSize Vertex 文本向量模型单次 predict 允许的最大实例数，gemini-embedding 仅支持单条输入
+func embeddingBatchSize(modelName string) int {
+	if strings.HasPrefix(modelName, "gemini-embedding") {
+		return 1
+	}
+	return 250
+}
+
+func embeddingRequestOpenAI2Vertex(request dto.EmbeddingRequest) (*VertexEmbeddingRequest, error) {
+	inputs := request.ParseInput()
+	if len(inputs) == 0 {
+		return nil, errors.New("input is empty")
+	}
+	vertexReq := &VertexEmbeddingRequest{
+		Instances: make([]VertexEmbeddingInstance, 0, len(inputs)),
+		Parameters: VertexEmbeddingParameters{
+			AutoTruncate:         true,
+			OutputDimensionality: request.Dimensions,
+		},
+	}
+	taskType := vertexEmbeddingTaskType(request.InputType)
+	for _, input := range inputs {
+		vertexReq.Instances = append(vertexReq.Instances, VertexEmbeddingInstance{Content: input, TaskType: taskType})
+	}
+	return vertexReq, nil
+}
+
+// vertexEmbeddingTaskType 将 input_type 转为 Vertex AI 的 task_type，也可直接传入 Vertex AI 的取值
+func vertexEmbeddingTaskType(inputType string) string {
+	switch inputType {
+	case "query", "search_query":
+		return "RETRIEVAL_QUERY"
+	case "document", "search_document":
+		return "RETRIEVAL_DOCUMENT"
+	}
+	return strings.ToUpper(inputType)
+}
+
+func splitVertexEmbeddingRequest(requestBody io.Reader, modelName string) ([][]byte, error) {
+	var vertexReq VertexEmbeddingRequest
+	if err := common.DecodeJson(requestBody, &vertexReq); err != nil {
+		return nil, err
+	}
+	batchSize := embeddingBatchSize(modelName)
+	instances := vertexReq.Instances
+	bodies := make([][]byte, 0, (len(instances)+batchSize-1)/batchSize)
+	for start := 0; start < len(instances); start += batchSize {
+		vertexReq.Instances = instances[start:min(start+batchSize, len(instances))]
+		body, err := common.Marshal(vertexReq)
+		if err != nil {
+			return nil, err
+		}
+		bodies = append(bodies, body)
+	}
+	if len(bodies) == 0 {
+		body, err := common.Marshal(vertexReq)
+		if err != nil {
+			return nil, err
+		}
+		bodies = append(bodies, body)
+	}
+	return bodies, nil
+}
+
+func mergeVertexEmbeddingResponses(bodies [][]byte) ([]byte, error) {
+	var merged VertexEmbeddingResponse
+	for _, body := range bodies {
+		var vertexResp VertexEmbeddingResponse
+		if err := common.Unmarshal(body, &vertexResp); err != nil {
+			return nil, err
+		}
+		merged.Predictions = append(merged.Predictions, vertexResp.Predictions...)
+	}
+	return common.Marshal(merged)
+}
+
+func vertexEmbeddingUsage(info *relaycommon.RelayInfo, vertexResp *VertexEmbeddingResponse) dto.Usage {
+	promptTokens := 0
+	for _, prediction := range vertexResp.Predictions {
+		promptTokens += prediction.Embeddings.Statistics.TokenCount
+	}
+	if promptTokens == 0 {
+		promptTokens = service.EstimateEmbeddingPromptTokens(info, len(vertexResp.Predictions))
+	}
+	return dto.Usage{
+		PromptTokens: promptTokens,
+		TotalTokens:  promptTokens,
+	}
+}
+
+// vertexEmbeddingPartialUsage 计算拆分请求中已成功批次的用量
+func vertexEmbeddingPartialUsage(c *gin.Context, info *relaycommon.RelayInfo, body []byte) (*dto.Usage, error) {
+	var vertexResp VertexEmbeddingResponse
+	if err := common.Unmarshal(body, &vertexResp); err != nil {
+		return nil, err
+	}
+	usage := vertexEmbeddingUsage(info, &vertexResp)
+	return &usage, nil
+}
+
+func vertexEmbeddingHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.Usage, *types.NewAPIError) {
+	defer service.CloseResponseBodyGracefully(resp)
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	var vertexResp VertexEmbeddingResponse
+	if err = common.Unmarshal(responseBody, &vertexResp); err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	embeddings := make([][]float64, 0, len(vertexResp.Predictions))
+	for _, prediction := range vertexResp.Predictions {
+		embeddings = append(embeddings, prediction.Embeddings.Values)
+	}
+	usage := vertexEmbeddingUsage(info, &vertexResp)
+	jsonResponse, err := common.Marshal(service.BuildEmbeddingResponse(info, embeddings, usage))
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	service.IOCopyBytesGracefully(c, resp, jsonResponse)
+	return &usage, nil
+}
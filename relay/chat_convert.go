@@ -0,0 +1,50 @@
+package relay
+
+import (
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+type chatConvertWriter interface {
+	gin.ResponseWriter
+	Finish() error
+	Fail(newAPIError *types.NewAPIError) bool
+}
+
+// relayViaChat 将其他格式的请求转换为 Chat Completions 后交给 TextHelper 处理，由 writer 把输出转换回客户端使用的格式
+func relayViaChat(c *gin.Context, info *relaycommon.RelayInfo, chatReq *dto.GeneralOpenAIRequest, writer chatConvertWriter) *types.NewAPIError {
+	originWriter := c.Writer
+	originRequest := info.Request
+	originMode := info.RelayMode
+	originFormat := info.RelayFormat
+	originPath := info.RequestURLPath
+
+	c.Writer = writer
+	info.Request = chatReq
+	info.RelayMode = relayconstant.RelayModeChatCompletions
+	info.RelayFormat = types.RelayFormatOpenAI
+	info.RequestURLPath = "/v1/chat/completions"
+
+	newAPIError := TextHelper(c, info)
+
+	// 还原请求信息，失败重试时仍按原格式处理
+	c.Writer = originWriter
+	info.Request = originRequest
+	info.RelayMode = originMode
+	info.RelayFormat = originFormat
+	info.RequestURLPath = originPath
+	if newAPIError != nil {
+		// 流式输出已经开始时，由 writer 以客户端的格式结束本次响应
+		writer.Fail(newAPIError)
+		return newAPIError
+	}
+	if err := writer.Finish(); err != nil {
+		logger.LogError(c, "failed to convert chat response: "+err.Error())
+	}
+	return nil
+}
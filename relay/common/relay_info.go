@@ -83,6 +83,7 @@ type RelayInfo struct {
 	TokenKey          string
 	TokenGroup        string
 	UserId            int
+	OrganizationId    int    // 组织令牌所属的组织，消耗从组织额度池扣除
 	UsingGroup        string // 使用的分组，当auto跨分组重试时，会变动
 	UserGroup         string // 用户所在分组
 	TokenUnlimited    bool
@@ -109,11 +110,19 @@ type RelayInfo struct {
 	ReasoningEffort        string
 	UserSetting            dto.UserSetting
 	UserEmail              string
-	UserQuota              int
+	UserQuota              int // 用户的真实余额，不含可透支额度
 	RelayFormat            types.RelayFormat
 	SendResponseCount      int
 	FinalPreConsumedQuota  int  // 最终预消耗的配额
 	IsClaudeBetaQuery      bool // /v1/messages?beta=true
+	// BillingQuota 本次请求可用的额度，后付费用户包含可透支额度，组织令牌为组织额度池的可用额度
+	BillingQuota int
+	// BudgetReservedAt 预占预算的时间，补扣与返还只计入该时间所在的预算周期
+	BudgetReservedAt time.Time
+	// BatchPartialUsage 拆分为多个上游请求时，后续请求失败前已成功的请求消耗的用量
+	BatchPartialUsage *dto.Usage
+	// ImageRequestedModelPrice 按请求张数计算的按次价格，按实际返回张数折算时以此为基准
+	ImageRequestedModelPrice float64
 
 	PriceData types.PriceData
 
@@ -408,6 +417,7 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		TokenKey:       common.GetContextKeyString(c, constant.ContextKeyTokenKey),
 		TokenUnlimited: common.GetContextKeyBool(c, constant.ContextKeyTokenUnlimited),
 		TokenGroup:     tokenGroup,
+		OrganizationId: common.GetContextKeyInt(c, constant.ContextKeyTokenOrganizationId),
 
 		isFirstResponse: true,
 		RelayMode:       relayconstant.Path2RelayMode(c.Request.URL.Path),
@@ -445,6 +455,7 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 }
 
 func GenRelayInfo(c *gin.Context, relayFormat types.RelayFormat, request dto.Request, ws *websocket.Conn) (*RelayInfo, error) {
+	common.SetContextKey(c, constant.ContextKeyRelayFormat, string(relayFormat))
 	switch relayFormat {
 	case types.RelayFormatOpenAI:
 		return GenRelayInfoOpenAI(c, request), nil
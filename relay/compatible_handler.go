@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/metrics"
+	"github.com/QuantumNous/new-api/common/tracing"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
@@ -68,6 +70,15 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 
 	info.ShouldIncludeUsage = includeUsage
 
+	responseCacheKey := service.GetResponseCacheKey(c, info, textReq)
+	if responseCacheKey != "" {
+		cached, ok := service.GetResponseCache(responseCacheKey)
+		metrics.RecordCacheResult("response", ok)
+		if ok {
+			return responseCacheHit(c, info, cached)
+		}
+	}
+
 	adaptor := GetAdaptor(info.ApiType)
 	if adaptor == nil {
 		return types.NewError(fmt.Errorf("invalid api type: %d", info.ApiType), types.ErrorCodeInvalidApiType, types.ErrOptionWithSkipRetry())
@@ -180,12 +191,25 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 		}
 	}
 
+	var captureWriter *service.ResponseCaptureWriter
+	if responseCacheKey != "" {
+		captureWriter = service.NewResponseCaptureWriter(c.Writer)
+		c.Writer = captureWriter
+	}
+	responseSpan := tracing.Start(c, "upstream.response")
 	usage, newApiErr := adaptor.DoResponse(c, httpResp, info)
+	responseSpan.End(newApiErr)
+	if captureWriter != nil {
+		c.Writer = captureWriter.ResponseWriter
+	}
 	if newApiErr != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(newApiErr, statusCodeMappingStr)
 		return newApiErr
 	}
+	if captureWriter != nil {
+		service.SaveCapturedResponse(responseCacheKey, captureWriter, info.IsStream, usage.(*dto.Usage))
+	}
 
 	if usage.(*dto.Usage).CompletionTokenDetails.AudioTokens > 0 || usage.(*dto.Usage).PromptTokensDetails.AudioTokens > 0 {
 		service.PostAudioConsumeQuota(c, info, usage.(*dto.Usage), "")
@@ -195,6 +219,17 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 	return nil
 }
 
+// logBatchPartialUsage 拆分请求中途失败时客户端拿不到已完成部分的结果，不向用户收费并允许重试，
+// 上游已为完成部分计费，记录下来便于核对渠道成本
+func logBatchPartialUsage(c *gin.Context, info *relaycommon.RelayInfo, newAPIError *types.NewAPIError) {
+	if newAPIError == nil || info.BatchPartialUsage == nil {
+		return
+	}
+	usage := info.BatchPartialUsage
+	info.BatchPartialUsage = nil
+	logger.LogWarn(c, fmt.Sprintf("batch request failed after partial completion, channel %d upstream usage not billed: prompt_tokens=%d, completion_tokens=%d", info.ChannelId, usage.PromptTokens, usage.CompletionTokens))
+}
+
 func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, extraContent string) {
 	if usage == nil {
 		usage = &dto.Usage{
@@ -234,7 +269,8 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 	dCacheRatio := decimal.NewFromFloat(cacheRatio)
 	dImageRatio := decimal.NewFromFloat(imageRatio)
 	dModelRatio := decimal.NewFromFloat(modelRatio)
-	dGroupRatio := decimal.NewFromFloat(groupRatio)
+	// 批处理折扣等附加倍率与分组倍率一同作用于各项费用
+	dGroupRatio := decimal.NewFromFloat(groupRatio).Mul(decimal.NewFromFloat(relayInfo.PriceData.OtherRatio()))
 	dModelPrice := decimal.NewFromFloat(modelPrice)
 	dCachedCreationRatio := decimal.NewFromFloat(cachedCreationRatio)
 	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
@@ -374,7 +410,10 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 			quota = 1
 		}
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
-		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		// 命中响应缓存时没有请求上游，不计入渠道用量
+		if !common.GetContextKeyBool(ctx, constant.ContextKeyResponseCacheHit) {
+			model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		}
 	}
 
 	quotaDelta := quota - relayInfo.FinalPreConsumedQuota
@@ -457,7 +496,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		other["image_generation_call"] = true
 		other["image_generation_call_price"] = imageGenerationCallPrice
 	}
-	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
+	service.RecordConsume(ctx, relayInfo, model.RecordConsumeLogParams{
 		ChannelId:        relayInfo.ChannelId,
 		PromptTokens:     promptTokens,
 		CompletionTokens: completionTokens,
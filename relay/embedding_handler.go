@@ -7,6 +7,7 @@ import (
 	"net/http"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/tracing"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
@@ -19,6 +20,9 @@ import (
 
 func EmbeddingHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types.NewAPIError) {
 	info.InitChannelMeta(c)
+	defer func() {
+		logBatchPartialUsage(c, info, newAPIError)
+	}()
 
 	embeddingReq, ok := info.Request.(*dto.EmbeddingRequest)
 	if !ok {
@@ -76,7 +80,9 @@ func EmbeddingHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 		}
 	}
 
+	responseSpan := tracing.Start(c, "upstream.response")
 	usage, newAPIError := adaptor.DoResponse(c, httpResp, info)
+	responseSpan.End(newAPIError)
 	if newAPIError != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
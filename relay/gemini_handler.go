@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/tracing"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
@@ -60,6 +61,11 @@ func GeminiHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *typ
 		return types.NewErrorWithStatusCode(fmt.Errorf("invalid request type, expected *dto.GeminiChatRequest, got %T", info.Request), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
 	}
 
+	passThrough := model_setting.GetGlobalSettings().PassThroughRequestEnabled || info.ChannelSetting.PassThroughBodyEnabled
+	if !passThrough && !supportsNativeGemini(info.ApiType) {
+		return geminiViaChatHelper(c, info, geminiReq)
+	}
+
 	request, err := common.DeepCopy(geminiReq)
 	if err != nil {
 		return types.NewError(fmt.Errorf("failed to copy request to GeminiChatRequest: %w", err), types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
@@ -137,7 +143,7 @@ func GeminiHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *typ
 	}
 
 	var requestBody io.Reader
-	if model_setting.GetGlobalSettings().PassThroughRequestEnabled || info.ChannelSetting.PassThroughBodyEnabled {
+	if passThrough {
 		body, err := common.GetRequestBody(c)
 		if err != nil {
 			return types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
@@ -187,7 +193,9 @@ func GeminiHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *typ
 		}
 	}
 
+	responseSpan := tracing.Start(c, "upstream.response")
 	usage, openaiErr := adaptor.DoResponse(c, resp.(*http.Response), info)
+	responseSpan.End(openaiErr)
 	if openaiErr != nil {
 		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
 		return openaiErr
@@ -197,6 +205,28 @@ func GeminiHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *typ
 	return nil
 }
 
+// supportsNativeGemini 原生支持 Gemini 格式的渠道类型，其余渠道通过 Chat Completions 转换。
+// OpenAI 渠道由适配器自行转换请求与响应
+func supportsNativeGemini(apiType int) bool {
+	switch apiType {
+	case constant.APITypeGemini, constant.APITypeVertexAi, constant.APITypeOpenAI:
+		return true
+	}
+	return false
+}
+
+// geminiViaChatHelper 将 Gemini 请求转换为 Chat Completions 交给 TextHelper 处理，输出再转换回 Gemini 格式
+func geminiViaChatHelper(c *gin.Context, info *relaycommon.RelayInfo, geminiReq *dto.GeminiChatRequest) *types.NewAPIError {
+	chatReq, err := service.GeminiToOpenAIRequest(geminiReq, info)
+	if err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeConvertRequestFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	if chatReq.Stream {
+		chatReq.StreamOptions = &dto.StreamOptions{IncludeUsage: true}
+	}
+	return relayViaChat(c, info, chatReq, service.NewGeminiConvertWriter(c.Writer, info))
+}
+
 func GeminiEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types.NewAPIError) {
 	info.InitChannelMeta(c)
 
@@ -286,7 +316,9 @@ func GeminiEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo) (newAPI
 		}
 	}
 
+	responseSpan := tracing.Start(c, "upstream.response")
 	usage, openaiErr := adaptor.DoResponse(c, resp.(*http.Response), info)
+	responseSpan.End(openaiErr)
 	if openaiErr != nil {
 		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
 		return openaiErr
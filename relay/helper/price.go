@@ -4,6 +4,8 @@ import (
 	"fmt"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
@@ -50,6 +52,14 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 
 	groupRatioInfo := HandleGroupRatio(c, info)
 
+	// 批处理折扣作为附加倍率单独记录，不并入分组倍率
+	var otherRatios map[string]float64
+	otherRatio := 1.0
+	if common.GetContextKeyString(c, constant.ContextKeyBatchId) != "" {
+		otherRatio = ratio_setting.GetBatchRatio(info.OriginModelName)
+		otherRatios = map[string]float64{types.OtherRatioBatch: otherRatio}
+	}
+
 	var preConsumedQuota int
 	var modelRatio float64
 	var completionRatio float64
@@ -88,12 +98,12 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		audioRatio = ratio_setting.GetAudioRatio(info.OriginModelName)
 		audioCompletionRatio = ratio_setting.GetAudioCompletionRatio(info.OriginModelName)
 		ratio := modelRatio * groupRatioInfo.GroupRatio
-		preConsumedQuota = int(float64(preConsumedTokens) * ratio)
+		preConsumedQuota = int(float64(preConsumedTokens) * ratio * otherRatio)
 	} else {
 		if meta.ImagePriceRatio != 0 {
 			modelPrice = modelPrice * meta.ImagePriceRatio
 		}
-		preConsumedQuota = int(modelPrice * common.QuotaPerUnit * groupRatioInfo.GroupRatio)
+		preConsumedQuota = int(modelPrice * common.QuotaPerUnit * groupRatioInfo.GroupRatio * otherRatio)
 	}
 
 	// check if free model pre-consume is disabled
@@ -126,6 +136,7 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		ImageRatio:           imageRatio,
 		AudioRatio:           audioRatio,
 		AudioCompletionRatio: audioCompletionRatio,
+		OtherRatios:          otherRatios,
 		CacheCreationRatio:   cacheCreationRatio,
 		CacheCreation5mRatio: cacheCreationRatio5m,
 		CacheCreation1hRatio: cacheCreationRatio1h,
@@ -162,6 +173,22 @@ func ModelPriceHelperPerCall(c *gin.Context, info *relaycommon.RelayInfo) types.
 	return priceData
 }
 
+// ImagePriceHelperPerCall 图片生成按实际返回的张数占请求张数的比例折算按次价格，被上游过滤的图片不计费；
+// 尺寸、品质倍率与分组倍率已在预扣费时计入，重复调用时始终以请求张数的价格为基准；按倍率计费的模型仍按 token 结算
+func ImagePriceHelperPerCall(info *relaycommon.RelayInfo, imageCount int) {
+	if !info.PriceData.UsePrice {
+		return
+	}
+	requested := 1
+	if request, ok := info.Request.(*dto.ImageRequest); ok && request.N > 1 {
+		requested = int(request.N)
+	}
+	if info.ImageRequestedModelPrice == 0 {
+		info.ImageRequestedModelPrice = info.PriceData.ModelPrice
+	}
+	info.PriceData.ModelPrice = info.ImageRequestedModelPrice * float64(min(imageCount, requested)) / float64(requested)
+}
+
 func ContainPriceOrRatio(modelName string) bool {
 	_, ok := ratio_setting.GetModelPrice(modelName, false)
 	if ok {
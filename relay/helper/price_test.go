@@ -0,0 +1,42 @@
+package helper
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+)
+
+func TestImagePriceHelperPerCall(t *testing.T) {
+	// 预扣费时的价格已包含 4 张图片、尺寸与品质倍率
+	info := &relaycommon.RelayInfo{
+		Request:   &dto.ImageRequest{N: 4},
+		PriceData: types.PriceData{UsePrice: true, ModelPrice: 0.32},
+	}
+	ImagePriceHelperPerCall(info, 1)
+	if price := info.PriceData.ModelPrice; price < 0.0799 || price > 0.0801 {
+		t.Fatalf("price after partial = %v", price)
+	}
+	// 再次调用仍以请求张数的价格为基准，不会重复折算
+	ImagePriceHelperPerCall(info, 3)
+	if price := info.PriceData.ModelPrice; price < 0.2399 || price > 0.2401 {
+		t.Fatalf("price after three images = %v", price)
+	}
+	// 返回张数超过请求张数时不多计费
+	ImagePriceHelperPerCall(info, 8)
+	if price := info.PriceData.ModelPrice; price != 0.32 {
+		t.Fatalf("price after extra images = %v", price)
+	}
+}
+
+func TestImagePriceHelperPerCallSkipsRatioPricing(t *testing.T) {
+	info := &relaycommon.RelayInfo{
+		Request:   &dto.ImageRequest{N: 2},
+		PriceData: types.PriceData{ModelRatio: 2},
+	}
+	ImagePriceHelperPerCall(info, 1)
+	if info.PriceData.ModelPrice != 0 || info.ImageRequestedModelPrice != 0 {
+		t.Fatalf("price data = %+v", info.PriceData)
+	}
+}
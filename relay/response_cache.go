@@ -0,0 +1,77 @@
+package relay
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// replayCachedStream 将缓存的完整响应按 chat.completion.chunk 格式重新输出
+func replayCachedStream(c *gin.Context, info *relaycommon.RelayInfo, response *dto.OpenAITextResponse) {
+	helper.SetEventStreamHeaders(c)
+	id := helper.GetResponseID(c)
+	createdAt := time.Now().Unix()
+	for _, choice := range response.Choices {
+		delta := dto.ChatCompletionsStreamResponseChoiceDelta{Role: "assistant"}
+		if choice.ReasoningContent != "" {
+			delta.SetReasoningContent(choice.ReasoningContent)
+		}
+		delta.SetContentString(choice.StringContent())
+		for i, toolCall := range choice.ParseToolCalls() {
+			delta.ToolCalls = append(delta.ToolCalls, dto.ToolCallResponse{
+				Index: common.GetPointer(i),
+				ID:    toolCall.ID,
+				Type:  toolCall.Type,
+				Function: dto.FunctionResponse{
+					Name:      toolCall.Function.Name,
+					Arguments: toolCall.Function.Arguments,
+				},
+			})
+		}
+		chunk := dto.ChatCompletionsStreamResponse{
+			Id:      id,
+			Object:  "chat.completion.chunk",
+			Created: createdAt,
+			Model:   response.Model,
+			Choices: []dto.ChatCompletionsStreamResponseChoice{
+				{Index: choice.Index, Delta: delta},
+			},
+		}
+		_ = helper.ObjectData(c, chunk)
+		stop := helper.GenerateStopResponse(id, createdAt, response.Model, choice.FinishReason)
+		stop.Choices[0].Index = choice.Index
+		_ = helper.ObjectData(c, stop)
+	}
+	if info.ShouldIncludeUsage {
+		_ = helper.ObjectData(c, helper.GenerateFinalUsageResponse(id, createdAt, response.Model, response.Usage))
+	}
+	helper.Done(c)
+}
+
+// responseCacheHit 直接返回缓存的响应，按设置的倍率计费，不请求上游
+func responseCacheHit(c *gin.Context, info *relaycommon.RelayInfo, response *dto.OpenAITextResponse) *types.NewAPIError {
+	logger.LogInfo(c, "response cache hit")
+	common.SetContextKey(c, constant.ContextKeyResponseCacheHit, true)
+	info.PriceData.GroupRatioInfo.GroupRatio *= operation_setting.GetResponseCacheSetting().CostRatio
+	info.SetFirstResponseTime()
+	if info.IsStream {
+		replayCachedStream(c, info, response)
+	} else {
+		response.Id = helper.GetResponseID(c)
+		response.Created = time.Now().Unix()
+		c.JSON(http.StatusOK, response)
+	}
+	usage := response.Usage
+	postConsumeQuota(c, info, &usage, "命中响应缓存")
+	return nil
+}
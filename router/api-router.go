@@ -86,6 +86,7 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.POST("/creem/pay", middleware.CriticalRateLimit(), controller.RequestCreemPay)
 				selfRoute.POST("/aff_transfer", controller.TransferAffQuota)
 				selfRoute.PUT("/setting", controller.UpdateUserSetting)
+				selfRoute.GET("/self/budgets", controller.GetSelfBudgets)
 
 				// 2FA routes
 				selfRoute.GET("/2fa/status", controller.Get2FAStatus)
@@ -108,6 +109,10 @@ func SetApiRouter(router *gin.Engine) {
 				adminRoute.PUT("/", controller.UpdateUser)
 				adminRoute.DELETE("/:id", controller.DeleteUser)
 				adminRoute.DELETE("/:id/reset_passkey", controller.AdminResetPasskey)
+				adminRoute.GET("/:id/budgets", controller.GetUserBudgets)
+				adminRoute.POST("/:id/budgets", controller.AddUserBudget)
+				adminRoute.PUT("/:id/budgets/:budget_id", controller.UpdateUserBudget)
+				adminRoute.DELETE("/:id/budgets/:budget_id", controller.DeleteUserBudget)
 
 				// Admin 2FA routes
 				adminRoute.GET("/2fa/stats", controller.Admin2FAStats)
@@ -135,6 +140,9 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/search", controller.SearchChannels)
 			channelRoute.GET("/models", controller.ChannelListModels)
 			channelRoute.GET("/models_enabled", controller.EnabledListModels)
+			channelRoute.GET("/stats", controller.GetChannelStats)
+			channelRoute.GET("/circuit_breakers", controller.GetChannelCircuitBreakers)
+			channelRoute.POST("/circuit_breakers/reset", controller.ResetChannelCircuitBreakers)
 			channelRoute.GET("/:id", controller.GetChannel)
 			channelRoute.POST("/:id/key", middleware.RootAuth(), middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.SecureVerificationRequired(), controller.GetChannelKey)
 			channelRoute.GET("/test", controller.TestAllChannels)
@@ -167,6 +175,80 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.PUT("/", controller.UpdateToken)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
 			tokenRoute.POST("/batch", controller.DeleteTokenBatch)
+			tokenRoute.GET("/:id/budgets", controller.GetTokenBudgets)
+			tokenRoute.POST("/:id/budgets", controller.AddTokenBudget)
+			tokenRoute.PUT("/:id/budgets/:budget_id", controller.UpdateTokenBudget)
+			tokenRoute.DELETE("/:id/budgets/:budget_id", controller.DeleteTokenBudget)
+		}
+
+		organizationRoute := apiRouter.Group("/organization")
+		organizationRoute.Use(middleware.UserAuth())
+		{
+			organizationRoute.GET("/", controller.GetSelfOrganizations)
+			organizationRoute.POST("/", controller.CreateOrganization)
+			organizationRoute.GET("/:id", controller.GetOrganization)
+			organizationRoute.PUT("/:id", controller.UpdateOrganization)
+			organizationRoute.DELETE("/:id", controller.DeleteOrganization)
+			organizationRoute.GET("/:id/members", controller.GetOrganizationMembers)
+			organizationRoute.POST("/:id/members", controller.AddOrganizationMember)
+			organizationRoute.PUT("/:id/members/:user_id", controller.UpdateOrganizationMember)
+			organizationRoute.DELETE("/:id/members/:user_id", controller.RemoveOrganizationMember)
+			organizationRoute.POST("/:id/transfer", controller.TransferOrganizationQuota)
+			organizationRoute.GET("/:id/logs", controller.GetOrganizationLogs)
+		}
+		organizationAdminRoute := apiRouter.Group("/organization_admin")
+		organizationAdminRoute.Use(middleware.AdminAuth())
+		{
+			organizationAdminRoute.GET("/", controller.GetAllOrganizations)
+			organizationAdminRoute.PUT("/:id", controller.AdminUpdateOrganization)
+			organizationAdminRoute.POST("/:id/quota", controller.AdminAdjustOrganizationQuota)
+		}
+
+		invoiceRoute := apiRouter.Group("/invoice")
+		{
+			invoiceRoute.GET("/self", middleware.UserAuth(), controller.GetSelfInvoices)
+			invoiceRoute.GET("/self/:id", middleware.UserAuth(), controller.GetSelfInvoice)
+			invoiceRoute.GET("/self/:id/download", middleware.UserAuth(), controller.DownloadSelfInvoice)
+			invoiceRoute.GET("/", middleware.AdminAuth(), controller.GetAllInvoices)
+			invoiceRoute.POST("/generate", middleware.AdminAuth(), controller.GenerateInvoices)
+			invoiceRoute.GET("/:id/download", middleware.AdminAuth(), controller.DownloadInvoice)
+			invoiceRoute.POST("/:id/email", middleware.AdminAuth(), controller.SendInvoiceEmail)
+		}
+
+		creditRoute := apiRouter.Group("/credit")
+		{
+			creditRoute.GET("/self", middleware.UserAuth(), controller.GetSelfCredit)
+			creditRoute.GET("/settlement/self", middleware.UserAuth(), controller.GetSelfCreditSettlements)
+			creditRoute.GET("/", middleware.AdminAuth(), controller.GetAllUserCredits)
+			creditRoute.PUT("/:user_id", middleware.AdminAuth(), controller.UpdateUserCredit)
+			creditRoute.DELETE("/:user_id", middleware.AdminAuth(), controller.DeleteUserCredit)
+			creditRoute.GET("/settlement", middleware.AdminAuth(), controller.GetAllCreditSettlements)
+			creditRoute.POST("/settlement/run", middleware.AdminAuth(), controller.GenerateCreditSettlements)
+			creditRoute.POST("/settlement/:id/settle", middleware.AdminAuth(), controller.SettleCreditSettlement)
+		}
+
+		subscriptionRoute := apiRouter.Group("/subscription")
+		{
+			subscriptionRoute.GET("/plans", middleware.UserAuth(), controller.GetSubscriptionPlans)
+			subscriptionRoute.GET("/self", middleware.UserAuth(), controller.GetSelfSubscription)
+			subscriptionRoute.POST("/self/subscribe", middleware.UserAuth(), middleware.CriticalRateLimit(), controller.SubscribeStripe)
+			subscriptionRoute.POST("/self/cancel", middleware.UserAuth(), controller.CancelSelfSubscription)
+			subscriptionRoute.GET("/", middleware.AdminAuth(), controller.GetAllUserSubscriptions)
+			subscriptionRoute.GET("/plan", middleware.AdminAuth(), controller.GetAllSubscriptionPlans)
+			subscriptionRoute.POST("/plan", middleware.AdminAuth(), controller.AddSubscriptionPlan)
+			subscriptionRoute.PUT("/plan", middleware.AdminAuth(), controller.UpdateSubscriptionPlan)
+			subscriptionRoute.DELETE("/plan/:id", middleware.AdminAuth(), controller.DeleteSubscriptionPlan)
+		}
+
+		alertRoute := apiRouter.Group("/alert")
+		alertRoute.Use(middleware.UserAuth())
+		{
+			alertRoute.GET("/", controller.GetSelfAlertRules)
+			alertRoute.POST("/", controller.AddAlertRule)
+			alertRoute.PUT("/", controller.UpdateAlertRule)
+			alertRoute.DELETE("/:id", controller.DeleteAlertRule)
+			alertRoute.POST("/:id/test", controller.TestAlertRule)
+			alertRoute.GET("/event", controller.GetSelfAlertEvents)
 		}
 
 		usageRoute := apiRouter.Group("/usage")
@@ -196,12 +278,20 @@ func SetApiRouter(router *gin.Engine) {
 		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
 		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
+		logRoute.GET("/body", middleware.AdminAuth(), controller.GetLogBody)
+		logRoute.GET("/archive", middleware.AdminAuth(), controller.GetLogArchives)
+		logRoute.POST("/archive/run", middleware.AdminAuth(), controller.RunLogArchive)
+		logRoute.POST("/archive/:id/restore", middleware.AdminAuth(), controller.RestoreLogArchive)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
+		logRoute.GET("/export", middleware.AdminAuth(), controller.ExportAllLogs)
+		logRoute.GET("/self/export", middleware.UserAuth(), controller.ExportUserLogs)
 
 		dataRoute := apiRouter.Group("/data")
 		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
 		dataRoute.GET("/self", middleware.UserAuth(), controller.GetUserQuotaDates)
+		dataRoute.GET("/export", middleware.AdminAuth(), controller.ExportAllQuotaDates)
+		dataRoute.GET("/self/export", middleware.UserAuth(), controller.ExportUserQuotaDates)
 
 		logRoute.Use(middleware.CORS())
 		{
@@ -0,0 +1,434 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	alertEventRetention = 30 * 24 * time.Hour
+	maxKnownTokenIps    = 100000
+)
+
+var (
+	// alertDedupStore 未启用 Redis 时的告警去重记录，值为过期时间
+	alertDedupStore sync.Map
+
+	// tokenIpSets 按令牌缓存已使用过的 IP，值为 *tokenIpSet，总数超过上限时清空重新加载
+	tokenIpSets        sync.Map
+	knownTokenIpsCount atomic.Int64
+
+	newIpRuleCache = struct {
+		sync.RWMutex
+		rules     map[int][]*model.AlertRule
+		updatedAt time.Time
+	}{}
+
+	// lastPricing 上一次检查时的模型价格，用于价格变动告警
+	lastPricing map[string]model.Pricing
+)
+
+// acquireAlertDedup 去重窗口内同一告警只发送一次
+func acquireAlertDedup(key string, window time.Duration) bool {
+	if common.RedisEnabled {
+		ok, err := common.RDB.SetNX(context.Background(), "alert_dedup:"+key, "1", window).Result()
+		if err != nil {
+			common.SysError("failed to set alert dedup key: " + err.Error())
+			return true
+		}
+		return ok
+	}
+	now := time.Now()
+	if value, ok := alertDedupStore.Load(key); ok && now.Before(value.(time.Time)) {
+		return false
+	}
+	alertDedupStore.Store(key, now.Add(window))
+	return true
+}
+
+func cleanupAlertDedup() {
+	now := time.Now()
+	alertDedupStore.Range(func(key, value interface{}) bool {
+		if now.After(value.(time.Time)) {
+			alertDedupStore.Delete(key)
+		}
+		return true
+	})
+}
+
+func getAlertDedupWindow(rule *model.AlertRule) time.Duration {
+	minutes := rule.DedupMinutes
+	if minutes <= 0 {
+		minutes = operation_setting.GetAlertSetting().DefaultDedupMinutes
+	}
+	return time.Duration(max(minutes, 1)) * time.Minute
+}
+
+// fireAlert 触发告警，subject 区分同一规则下的不同告警对象
+func fireAlert(rule *model.AlertRule, subject string, title string, content string) {
+	dedupKey := fmt.Sprintf("%d:%s", rule.Id, subject)
+	if !acquireAlertDedup(dedupKey, getAlertDedupWindow(rule)) {
+		return
+	}
+	if err := model.UpdateAlertRuleTriggeredAt(rule.Id); err != nil {
+		common.SysError(fmt.Sprintf("failed to update alert rule %d: %s", rule.Id, err.Error()))
+	}
+	event := &model.AlertEvent{
+		RuleId:  rule.Id,
+		UserId:  rule.UserId,
+		Type:    rule.Type,
+		Title:   title,
+		Content: content,
+	}
+	if err := event.Insert(); err != nil {
+		common.SysError(fmt.Sprintf("failed to record alert event of rule %d: %s", rule.Id, err.Error()))
+	}
+	if err := DeliverAlert(rule, title, content); err != nil {
+		common.SysError(fmt.Sprintf("failed to deliver alert of rule %d: %s", rule.Id, err.Error()))
+	}
+}
+
+// DeliverAlert 将告警发送到规则配置的所有渠道，未配置渠道时使用用户的通知设置
+func DeliverAlert(rule *model.AlertRule, title string, content string) error {
+	channels := rule.GetChannels()
+	if len(channels) == 0 {
+		channels = []model.AlertChannel{{Type: model.AlertChannelTypeNotify}}
+	}
+	var errs []error
+	for _, channel := range channels {
+		if err := sendAlert(rule.UserId, channel, title, content); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", channel.Type, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func getAlertWindow(rule *model.AlertRule) time.Duration {
+	return time.Duration(max(rule.WindowMinutes, 1)) * time.Minute
+}
+
+func describeAlertScope(rule *model.AlertRule) string {
+	if rule.TokenId == 0 {
+		return "所有令牌"
+	}
+	if token, err := model.GetTokenById(rule.TokenId); err == nil {
+		return fmt.Sprintf("令牌 %s", token.Name)
+	}
+	return fmt.Sprintf("令牌 #%d", rule.TokenId)
+}
+
+// alertLogTotals 规则统计范围内的消费额度与请求数
+type alertLogTotals struct {
+	quota   int64
+	success int64
+	failed  int64
+}
+
+type alertScopeKey struct {
+	userId  int
+	tokenId int
+}
+
+func checkSpendAlert(rule *model.AlertRule, totals alertLogTotals) {
+	if float64(totals.quota) < rule.Threshold*common.QuotaPerUnit {
+		return
+	}
+	title := fmt.Sprintf("[%s] 消费告警：%s", common.SystemName, rule.Name)
+	content := fmt.Sprintf("%s 最近 %d 分钟消费 %s，超过设定的阈值 %s。",
+		describeAlertScope(rule), int(getAlertWindow(rule).Minutes()), logger.FormatQuota(int(totals.quota)), logger.FormatQuota(int(rule.Threshold*common.QuotaPerUnit)))
+	fireAlert(rule, "spend", title, content)
+}
+
+func checkErrorRateAlert(rule *model.AlertRule, totals alertLogTotals) {
+	total := totals.success + totals.failed
+	if total == 0 || total < int64(rule.MinRequests) {
+		return
+	}
+	rate := float64(totals.failed) * 100 / float64(total)
+	if rate < rule.Threshold {
+		return
+	}
+	title := fmt.Sprintf("[%s] 错误率告警：%s", common.SystemName, rule.Name)
+	content := fmt.Sprintf("%s 最近 %d 分钟共 %d 次请求，失败 %d 次，错误率 %.1f%%，超过设定的阈值 %.1f%%。",
+		describeAlertScope(rule), int(getAlertWindow(rule).Minutes()), total, totals.failed, rate, rule.Threshold)
+	fireAlert(rule, "error_rate", title, content)
+}
+
+// checkLogAlerts 按统计窗口分组，每个窗口只查询一次日志，再按规则的用户与令牌汇总
+func checkLogAlerts(rules []*model.AlertRule) {
+	byWindow := make(map[time.Duration][]*model.AlertRule)
+	for _, rule := range rules {
+		// 未开启错误日志时失败请求不会被记录，跳过错误率规则
+		if rule.Type == model.AlertRuleTypeErrorRate && !constant.ErrorLogEnabled {
+			continue
+		}
+		window := getAlertWindow(rule)
+		byWindow[window] = append(byWindow[window], rule)
+	}
+	for window, windowRules := range byWindow {
+		userIds := types.NewSet[int]()
+		for _, rule := range windowRules {
+			userIds.Add(rule.UserId)
+		}
+		stats, err := model.GetAlertLogStats(userIds.Items(), time.Now().Add(-window))
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to get log stats for alert rules: %s", err.Error()))
+			continue
+		}
+		totals := make(map[alertScopeKey]*alertLogTotals)
+		add := func(key alertScopeKey, stat *model.AlertLogStat) {
+			total, ok := totals[key]
+			if !ok {
+				total = &alertLogTotals{}
+				totals[key] = total
+			}
+			switch stat.Type {
+			case model.LogTypeConsume:
+				total.quota += stat.Quota
+				total.success += stat.Count
+			case model.LogTypeError:
+				total.failed += stat.Count
+			}
+		}
+		for _, stat := range stats {
+			add(alertScopeKey{userId: stat.UserId}, stat)
+			if stat.TokenId != 0 {
+				add(alertScopeKey{userId: stat.UserId, tokenId: stat.TokenId}, stat)
+			}
+		}
+		for _, rule := range windowRules {
+			var total alertLogTotals
+			if t, ok := totals[alertScopeKey{userId: rule.UserId, tokenId: rule.TokenId}]; ok {
+				total = *t
+			}
+			switch rule.Type {
+			case model.AlertRuleTypeSpend:
+				checkSpendAlert(rule, total)
+			case model.AlertRuleTypeErrorRate:
+				checkErrorRateAlert(rule, total)
+			}
+		}
+	}
+}
+
+func describePricing(pricing model.Pricing) string {
+	if pricing.QuotaType == 1 {
+		return fmt.Sprintf("按次 $%g", pricing.ModelPrice)
+	}
+	return fmt.Sprintf("模型倍率 %g，补全倍率 %g", pricing.ModelRatio, pricing.CompletionRatio)
+}
+
+// checkPriceChangeAlerts 对比上一次检查时的模型价格，首次检查只记录不告警
+func checkPriceChangeAlerts() {
+	pricings := model.GetPricing()
+	current := make(map[string]model.Pricing, len(pricings))
+	for _, pricing := range pricings {
+		current[pricing.ModelName] = pricing
+	}
+	previous := lastPricing
+	lastPricing = current
+	if previous == nil {
+		return
+	}
+
+	changes := make(map[string]string)
+	for name, pricing := range current {
+		old, ok := previous[name]
+		if !ok {
+			continue
+		}
+		if old.QuotaType != pricing.QuotaType || old.ModelPrice != pricing.ModelPrice ||
+			old.ModelRatio != pricing.ModelRatio || old.CompletionRatio != pricing.CompletionRatio {
+			changes[name] = fmt.Sprintf("%s → %s", describePricing(old), describePricing(pricing))
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+	rules, err := model.GetEnabledAlertRules(model.AlertRuleTypePriceChange)
+	if err != nil {
+		common.SysError("failed to get price change alert rules: " + err.Error())
+		return
+	}
+	for _, rule := range rules {
+		for name, change := range changes {
+			if rule.ModelName != "" && rule.ModelName != name {
+				continue
+			}
+			title := fmt.Sprintf("[%s] 模型价格变动：%s", common.SystemName, name)
+			content := fmt.Sprintf("模型 %s 的价格已调整：%s。", name, change)
+			fireAlert(rule, "price:"+name+":"+change, title, content)
+		}
+	}
+}
+
+func getNewIpAlertRules(userId int) []*model.AlertRule {
+	newIpRuleCache.RLock()
+	fresh := newIpRuleCache.rules != nil && time.Since(newIpRuleCache.updatedAt) < time.Minute
+	rules := newIpRuleCache.rules[userId]
+	newIpRuleCache.RUnlock()
+	if fresh {
+		return rules
+	}
+
+	newIpRuleCache.Lock()
+	defer newIpRuleCache.Unlock()
+	if newIpRuleCache.rules != nil && time.Since(newIpRuleCache.updatedAt) < time.Minute {
+		return newIpRuleCache.rules[userId]
+	}
+	all, err := model.GetEnabledAlertRules(model.AlertRuleTypeNewIp)
+	if err != nil {
+		common.SysError("failed to get new ip alert rules: " + err.Error())
+	}
+	grouped := make(map[int][]*model.AlertRule)
+	for _, rule := range all {
+		grouped[rule.UserId] = append(grouped[rule.UserId], rule)
+	}
+	newIpRuleCache.rules = grouped
+	newIpRuleCache.updatedAt = time.Now()
+	return grouped[userId]
+}
+
+// InvalidateAlertRuleCache 规则变更后立即在本节点生效
+func InvalidateAlertRuleCache() {
+	newIpRuleCache.Lock()
+	newIpRuleCache.rules = nil
+	newIpRuleCache.Unlock()
+}
+
+// tokenIpSet 令牌使用过的 IP，首次用到时从数据库加载，之后只在内存中判断
+type tokenIpSet struct {
+	sync.Mutex
+	loaded bool
+	ips    map[string]struct{}
+}
+
+func (set *tokenIpSet) contains(ip string) bool {
+	set.Lock()
+	defer set.Unlock()
+	_, ok := set.ips[ip]
+	return ok
+}
+
+func getTokenIpSet(tokenId int) *tokenIpSet {
+	if value, ok := tokenIpSets.Load(tokenId); ok {
+		return value.(*tokenIpSet)
+	}
+	value, _ := tokenIpSets.LoadOrStore(tokenId, &tokenIpSet{ips: make(map[string]struct{})})
+	return value.(*tokenIpSet)
+}
+
+// addTokenIp 将 IP 加入令牌的集合，返回是否为新 IP 以及令牌此前是否使用过其他 IP
+func addTokenIp(tokenId int, ip string) (isNew bool, hasHistory bool, err error) {
+	set := getTokenIpSet(tokenId)
+	set.Lock()
+	defer set.Unlock()
+	if !set.loaded {
+		ips, err := model.GetAlertTokenIps(tokenId)
+		if err != nil {
+			return false, false, err
+		}
+		for _, known := range ips {
+			set.ips[known] = struct{}{}
+		}
+		set.loaded = true
+		knownTokenIpsCount.Add(int64(len(ips)))
+	}
+	if _, ok := set.ips[ip]; ok {
+		return false, false, nil
+	}
+	hasHistory = len(set.ips) > 0
+	if isNew, err = model.InsertAlertTokenIp(tokenId, ip); err != nil {
+		return false, false, err
+	}
+	set.ips[ip] = struct{}{}
+	knownTokenIpsCount.Add(1)
+	return isNew, hasHistory, nil
+}
+
+// CheckTokenNewIp 令牌首次被某个 IP 使用时触发 new_ip 告警，令牌的第一个 IP 不告警；
+// 只有用户配置了该类规则时才记录 IP
+func CheckTokenNewIp(userId int, tokenId int, tokenName string, ip string) {
+	if !operation_setting.GetAlertSetting().Enabled || ip == "" {
+		return
+	}
+	rules := getNewIpAlertRules(userId)
+	if len(rules) == 0 {
+		return
+	}
+	if getTokenIpSet(tokenId).contains(ip) {
+		return
+	}
+	gopool.Go(func() {
+		if knownTokenIpsCount.Load() > maxKnownTokenIps {
+			tokenIpSets.Clear()
+			knownTokenIpsCount.Store(0)
+		}
+		isNew, hasHistory, err := addTokenIp(tokenId, ip)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to record ip of token %d: %s", tokenId, err.Error()))
+			return
+		}
+		if !isNew || !hasHistory {
+			return
+		}
+		for _, rule := range rules {
+			if rule.TokenId != 0 && rule.TokenId != tokenId {
+				continue
+			}
+			title := fmt.Sprintf("[%s] 令牌新 IP 告警：%s", common.SystemName, rule.Name)
+			content := fmt.Sprintf("令牌 %s 首次被 IP %s 使用，时间 %s。如非本人操作，请及时禁用或重置令牌。",
+				tokenName, ip, time.Now().Format("2006-01-02 15:04:05"))
+			fireAlert(rule, fmt.Sprintf("ip:%d:%s", tokenId, ip), title, content)
+		}
+	})
+}
+
+func runAlertChecks() {
+	rules, err := model.GetEnabledAlertRules(model.AlertRuleTypeSpend, model.AlertRuleTypeErrorRate)
+	if err != nil {
+		common.SysError("failed to get alert rules: " + err.Error())
+		return
+	}
+	checkLogAlerts(rules)
+	checkPriceChangeAlerts()
+}
+
+// TestAlertRule 向规则的所有渠道发送测试消息
+func TestAlertRule(rule *model.AlertRule) error {
+	title := fmt.Sprintf("[%s] 告警测试：%s", common.SystemName, rule.Name)
+	content := "这是一条测试消息，收到说明告警渠道配置正确。"
+	return DeliverAlert(rule, title, content)
+}
+
+// AlertTask 定期检查消费、错误率与模型价格告警
+func AlertTask() {
+	lastCleanup := time.Time{}
+	for {
+		alertSetting := operation_setting.GetAlertSetting()
+		if alertSetting.Enabled {
+			runAlertChecks()
+		}
+		if time.Since(lastCleanup) > time.Hour {
+			cleanupAlertDedup()
+			if _, err := model.DeleteAlertEventsBefore(time.Now().Add(-alertEventRetention).Unix()); err != nil {
+				common.SysError("failed to delete expired alert events: " + err.Error())
+			}
+			lastCleanup = time.Now()
+		}
+		time.Sleep(time.Duration(max(alertSetting.CheckIntervalSeconds, 10)) * time.Second)
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+const telegramApiBase = "https://api.telegram.org"
+
+// ValidateAlertChannel 检查告警渠道的必填参数
+func ValidateAlertChannel(channel model.AlertChannel) error {
+	switch channel.Type {
+	case model.AlertChannelTypeNotify:
+		return nil
+	case model.AlertChannelTypeSlack, model.AlertChannelTypeDiscord, model.AlertChannelTypeFeishu, model.AlertChannelTypeDingTalk:
+		if channel.Url == "" {
+			return fmt.Errorf("%s 告警渠道缺少 webhook 地址", channel.Type)
+		}
+		return nil
+	case model.AlertChannelTypeTelegram:
+		if channel.Token == "" || channel.ChatId == "" {
+			return fmt.Errorf("telegram 告警渠道缺少 token 或 chat_id")
+		}
+		return nil
+	}
+	return fmt.Errorf("不支持的告警渠道：%s", channel.Type)
+}
+
+// sendAlert 通过指定渠道发送告警
+func sendAlert(userId int, channel model.AlertChannel, title string, content string) error {
+	text := title + "\n" + content
+	switch channel.Type {
+	case model.AlertChannelTypeNotify:
+		user, err := model.GetUserById(userId, false)
+		if err != nil {
+			return err
+		}
+		userSetting := user.GetSetting()
+		if userSetting.NotifyType == "" || userSetting.NotifyType == dto.NotifyTypeEmail {
+			content = strings.ReplaceAll(content, "\n", "<br/>")
+		}
+		return NotifyUser(user.Id, user.Email, userSetting, dto.NewNotify(dto.NotifyTypeAlert, title, content, nil))
+	case model.AlertChannelTypeSlack:
+		return postAlertJson(channel.Url, map[string]any{"text": text})
+	case model.AlertChannelTypeDiscord:
+		return postAlertJson(channel.Url, map[string]any{"content": text})
+	case model.AlertChannelTypeTelegram:
+		apiBase := telegramApiBase
+		if channel.Url != "" {
+			apiBase = strings.TrimSuffix(channel.Url, "/")
+		}
+		return postAlertJson(apiBase+"/bot"+channel.Token+"/sendMessage", map[string]any{
+			"chat_id": channel.ChatId,
+			"text":    text,
+		})
+	case model.AlertChannelTypeFeishu:
+		payload := map[string]any{
+			"msg_type": "text",
+			"content":  map[string]any{"text": text},
+		}
+		if channel.Secret != "" {
+			// 飞书签名：以 timestamp + "\n" + secret 为密钥对空串做 HmacSHA256
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			h := hmac.New(sha256.New, []byte(timestamp+"\n"+channel.Secret))
+			payload["timestamp"] = timestamp
+			payload["sign"] = base64.StdEncoding.EncodeToString(h.Sum(nil))
+		}
+		return postAlertJson(channel.Url, payload)
+	case model.AlertChannelTypeDingTalk:
+		targetUrl := channel.Url
+		if channel.Secret != "" {
+			// 钉钉签名：以 secret 为密钥对 timestamp + "\n" + secret 做 HmacSHA256
+			timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+			h := hmac.New(sha256.New, []byte(channel.Secret))
+			h.Write([]byte(timestamp + "\n" + channel.Secret))
+			sign := url.QueryEscape(base64.StdEncoding.EncodeToString(h.Sum(nil)))
+			separator := "?"
+			if strings.Contains(targetUrl, "?") {
+				separator = "&"
+			}
+			targetUrl += separator + "timestamp=" + timestamp + "&sign=" + sign
+		}
+		return postAlertJson(targetUrl, map[string]any{
+			"msgtype": "text",
+			"text":    map[string]any{"content": text},
+		})
+	}
+	return fmt.Errorf("unsupported alert channel: %s", channel.Type)
+}
+
+func postAlertJson(targetUrl string, payload any) error {
+	body, err := common.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert payload: %v", err)
+	}
+
+	var resp *http.Response
+	if system_setting.EnableWorker() {
+		resp, err = DoWorkerRequest(&WorkerRequest{
+			URL:    targetUrl,
+			Key:    system_setting.WorkerValidKey,
+			Method: http.MethodPost,
+			Headers: map[string]string{
+				"Content-Type": "application/json",
+			},
+			Body: body,
+		})
+	} else {
+		// SSRF防护：验证告警地址（非Worker模式）
+		fetchSetting := system_setting.GetFetchSetting()
+		if err := common.ValidateURLWithFetchSetting(targetUrl, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+			return fmt.Errorf("request reject: %v", err)
+		}
+		var req *http.Request
+		req, err = http.NewRequest(http.MethodPost, targetUrl, bytes.NewBuffer(body))
+		if err != nil {
+			return fmt.Errorf("failed to create alert request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err = GetHttpClient().Do(req)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to send alert request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("alert request failed with status code: %d", resp.StatusCode)
+	}
+	return nil
+}
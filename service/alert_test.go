@@ -0,0 +1,34 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+)
+
+func TestAddTokenIpLoadsKnownIpsOnce(t *testing.T) {
+	model.SetupTestDB(t, &model.AlertTokenIp{})
+	tokenIpSets.Clear()
+	t.Cleanup(tokenIpSets.Clear)
+	if _, err := model.InsertAlertTokenIp(1, "1.1.1.1"); err != nil {
+		t.Fatalf("insert ip: %v", err)
+	}
+
+	isNew, hasHistory, err := addTokenIp(1, "1.1.1.1")
+	if err != nil || isNew {
+		t.Fatalf("known ip: isNew=%v err=%v", isNew, err)
+	}
+	isNew, hasHistory, err = addTokenIp(1, "2.2.2.2")
+	if err != nil || !isNew || !hasHistory {
+		t.Fatalf("new ip: isNew=%v hasHistory=%v err=%v", isNew, hasHistory, err)
+	}
+	if !getTokenIpSet(1).contains("2.2.2.2") {
+		t.Fatalf("new ip not cached")
+	}
+
+	// 令牌的第一个 IP 不视为异常
+	isNew, hasHistory, err = addTokenIp(2, "3.3.3.3")
+	if err != nil || !isNew || hasHistory {
+		t.Fatalf("first ip: isNew=%v hasHistory=%v err=%v", isNew, hasHistory, err)
+	}
+}
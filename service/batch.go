@@ -0,0 +1,142 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/types"
+)
+
+const (
+	BatchFilePurpose       = "batch"
+	BatchOutputFilePurpose = "batch_output"
+	// 单行请求体的最大长度
+	batchMaxLineSize = 32 * 1024 * 1024
+)
+
+// batchEndpointFormats 支持批处理的接口及其对应的转发格式
+var batchEndpointFormats = map[string]types.RelayFormat{
+	"/v1/chat/completions": types.RelayFormatOpenAI,
+	"/v1/completions":      types.RelayFormatOpenAI,
+	"/v1/embeddings":       types.RelayFormatEmbedding,
+	"/v1/responses":        types.RelayFormatOpenAIResponses,
+}
+
+var ErrBatchStopped = errors.New("batch stopped")
+
+func GetBatchRelayFormat(endpoint string) (types.RelayFormat, bool) {
+	format, ok := batchEndpointFormats[endpoint]
+	return format, ok
+}
+
+// ScanBatchInput 逐行读取并校验批处理输入文件，fn 返回错误时停止读取
+func ScanBatchInput(ctx context.Context, file *model.File, endpoint string, fn func(lineNo int, line *dto.OpenAIBatchInputLine) error) error {
+	reader, err := OpenUserFileContent(ctx, file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), batchMaxLineSize)
+	customIds := make(map[string]struct{})
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var line dto.OpenAIBatchInputLine
+		if err = common.Unmarshal(raw, &line); err != nil {
+			return fmt.Errorf("line %d: invalid json: %w", lineNo, err)
+		}
+		if line.CustomId == "" {
+			return fmt.Errorf("line %d: custom_id is required", lineNo)
+		}
+		if _, ok := customIds[line.CustomId]; ok {
+			return fmt.Errorf("line %d: duplicate custom_id %s", lineNo, line.CustomId)
+		}
+		customIds[line.CustomId] = struct{}{}
+		if line.Method != "POST" {
+			return fmt.Errorf("line %d: method must be POST", lineNo)
+		}
+		if line.Url != endpoint {
+			return fmt.Errorf("line %d: url %s does not match batch endpoint %s", lineNo, line.Url, endpoint)
+		}
+		if common.GetJsonType(line.Body) != "object" {
+			return fmt.Errorf("line %d: body must be a json object", lineNo)
+		}
+		var body struct {
+			Stream bool `json:"stream"`
+		}
+		_ = common.Unmarshal(line.Body, &body)
+		if body.Stream {
+			return fmt.Errorf("line %d: streaming is not supported in batch requests", lineNo)
+		}
+		if err = fn(lineNo, &line); err != nil {
+			return err
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("line %d: %w", lineNo+1, err)
+	}
+	return nil
+}
+
+func BatchToOpenAIBatch(batch *model.Batch) dto.OpenAIBatch {
+	optionalTime := func(t int64) *int64 {
+		if t == 0 {
+			return nil
+		}
+		return &t
+	}
+	optionalString := func(s string) *string {
+		if s == "" {
+			return nil
+		}
+		return &s
+	}
+	openAIBatch := dto.OpenAIBatch{
+		ID:               batch.BatchId,
+		Object:           "batch",
+		Endpoint:         batch.Endpoint,
+		InputFileId:      batch.InputFileId,
+		CompletionWindow: batch.CompletionWindow,
+		Status:           batch.Status,
+		OutputFileId:     optionalString(batch.OutputFileId),
+		ErrorFileId:      optionalString(batch.ErrorFileId),
+		CreatedAt:        batch.CreatedAt,
+		InProgressAt:     optionalTime(batch.InProgressAt),
+		ExpiresAt:        optionalTime(batch.ExpiresAt),
+		FinalizingAt:     optionalTime(batch.FinalizingAt),
+		CompletedAt:      optionalTime(batch.CompletedAt),
+		FailedAt:         optionalTime(batch.FailedAt),
+		ExpiredAt:        optionalTime(batch.ExpiredAt),
+		CancellingAt:     optionalTime(batch.CancellingAt),
+		CancelledAt:      optionalTime(batch.CancelledAt),
+		RequestCounts: dto.OpenAIBatchRequestCounts{
+			Total:     batch.TotalCount,
+			Completed: batch.CompletedCount,
+			Failed:    batch.FailedCount,
+		},
+	}
+	if batch.Errors != "" {
+		openAIBatch.Errors = &dto.OpenAIBatchErrors{
+			Object: "list",
+			Data: []dto.OpenAIBatchError{
+				{Code: "batch_failed", Message: batch.Errors},
+			},
+		}
+	}
+	if batch.Metadata != "" {
+		_ = common.UnmarshalJsonStr(batch.Metadata, &openAIBatch.Metadata)
+	}
+	return openAIBatch
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+const redactedValue = "[REDACTED]"
+
+// 流式响应的 chunk 开销较大，记录时放宽到保存上限的数倍，合并后再截断
+const streamCaptureFactor = 4
+
+// BodyCaptureWriter 在写给客户端的同时记录响应内容，超过上限后只保留已记录的部分
+type BodyCaptureWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (w *BodyCaptureWriter) capture(data []byte) {
+	if w.truncated {
+		return
+	}
+	if w.body.Len()+len(data) > w.limit {
+		w.body.Write(data[:w.limit-w.body.Len()])
+		w.truncated = true
+		return
+	}
+	w.body.Write(data)
+}
+
+func (w *BodyCaptureWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *BodyCaptureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// shouldCaptureBody 令牌或分组开启且命中采样时记录
+func shouldCaptureBody(c *gin.Context) bool {
+	setting := operation_setting.GetBodyCaptureSetting()
+	if !setting.Enabled {
+		return false
+	}
+	group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+	if !common.GetContextKeyBool(c, constant.ContextKeyTokenBodyCapture) && !setting.IsGroupEnabled(group) {
+		return false
+	}
+	return setting.SampleRate >= 1 || rand.Float64() < setting.SampleRate
+}
+
+// StartBodyCapture 开始记录本次请求的响应内容，未开启时返回 nil，请求结束后需调用 FinishBodyCapture
+func StartBodyCapture(c *gin.Context, relayFormat types.RelayFormat) *BodyCaptureWriter {
+	if relayFormat == types.RelayFormatOpenAIRealtime || !shouldCaptureBody(c) {
+		return nil
+	}
+	writer := &BodyCaptureWriter{
+		ResponseWriter: c.Writer,
+		limit:          operation_setting.GetBodyCaptureSetting().GetMaxBodyBytes() * streamCaptureFactor,
+	}
+	c.Writer = writer
+	return writer
+}
+
+// SetBodyCaptureLogId 记录本次请求的消费或错误日志 id，保存请求内容时关联该日志
+func SetBodyCaptureLogId(c *gin.Context, logId int) {
+	if logId != 0 {
+		common.SetContextKey(c, constant.ContextKeyLogId, logId)
+	}
+}
+
+// FinishBodyCapture 脱敏并保存请求与响应内容，响应内容包括错误信息与合并后的流式输出
+func FinishBodyCapture(c *gin.Context, writer *BodyCaptureWriter) {
+	if writer == nil {
+		return
+	}
+	c.Writer = writer.ResponseWriter
+	var requestBody []byte
+	if cached, ok := c.Get(common.KeyRequestBody); ok {
+		requestBody, _ = cached.([]byte)
+	}
+	logBody := &model.LogBody{
+		LogId:     common.GetContextKeyInt(c, constant.ContextKeyLogId),
+		RequestId: c.GetString(common.RequestIdKey),
+		UserId:    common.GetContextKeyInt(c, constant.ContextKeyUserId),
+		TokenId:   common.GetContextKeyInt(c, constant.ContextKeyTokenId),
+		ModelName: common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+	}
+	requestContentType := c.Request.Header.Get("Content-Type")
+	responseContentType := writer.Header().Get("Content-Type")
+	isChatCompletions := types.RelayFormat(common.GetContextKeyString(c, constant.ContextKeyRelayFormat)) == types.RelayFormatOpenAI &&
+		strings.HasSuffix(c.Request.URL.Path, "/chat/completions")
+	responseBody := writer.body.Bytes()
+	truncated := writer.truncated
+	gopool.Go(func() {
+		setting := operation_setting.GetBodyCaptureSetting()
+		var requestTruncated, responseTruncated bool
+		logBody.RequestBody, requestTruncated = formatCapturedBody(requestBody, requestContentType, setting)
+		if truncated {
+			// 截断的内容无法解析，保存原始内容的开头部分
+			logBody.ResponseBody, _ = truncateCapturedBody(string(responseBody), setting.GetMaxBodyBytes())
+		} else {
+			if strings.HasPrefix(responseContentType, "text/event-stream") {
+				responseBody = assembleStreamBody(responseBody, isChatCompletions)
+			}
+			logBody.ResponseBody, responseTruncated = formatCapturedBody(responseBody, responseContentType, setting)
+		}
+		logBody.Truncated = truncated || requestTruncated || responseTruncated
+		if err := logBody.Insert(); err != nil {
+			common.SysError("failed to save captured body: " + err.Error())
+		}
+	})
+}
+
+// assembleStreamBody 将流式响应合并，chat completions 合并为完整响应，其他格式合并为事件数组
+func assembleStreamBody(body []byte, isChatCompletions bool) []byte {
+	if isChatCompletions {
+		if response, err := streamToTextResponse(body); err == nil {
+			if data, err := common.Marshal(response); err == nil {
+				return data
+			}
+		}
+	}
+	events := make([]any, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		var event any
+		if err := common.UnmarshalJsonStr(data, &event); err != nil {
+			event = data
+		}
+		events = append(events, event)
+	}
+	data, err := common.Marshal(events)
+	if err != nil {
+		return body
+	}
+	return data
+}
+
+// formatCapturedBody 对 JSON 内容脱敏后按上限截断，非 JSON 内容只记录长度
+func formatCapturedBody(body []byte, contentType string, setting *operation_setting.BodyCaptureSetting) (string, bool) {
+	if len(body) == 0 {
+		return "", false
+	}
+	var value any
+	if err := common.Unmarshal(body, &value); err != nil {
+		if strings.HasPrefix(contentType, "text/") && !strings.HasPrefix(contentType, "text/event-stream") {
+			return truncateCapturedBody(string(body), setting.GetMaxBodyBytes())
+		}
+		// 无法解析的内容可能包含未脱敏的敏感信息，不保存原文
+		return fmt.Sprintf("[non-JSON body omitted, %d bytes, content-type: %s]", len(body), contentType), false
+	}
+	redactKeys := make(map[string]struct{}, len(setting.RedactKeys))
+	for _, key := range setting.RedactKeys {
+		redactKeys[strings.ToLower(key)] = struct{}{}
+	}
+	value = redactKeysInValue(value, redactKeys)
+	for _, path := range setting.RedactPaths {
+		if path != "" {
+			value = redactPath(value, strings.Split(path, "."))
+		}
+	}
+	data, err := common.Marshal(value)
+	if err != nil {
+		return "", false
+	}
+	return truncateCapturedBody(string(data), setting.GetMaxBodyBytes())
+}
+
+func truncateCapturedBody(body string, maxBytes int) (string, bool) {
+	if len(body) <= maxBytes {
+		return body, false
+	}
+	// 截断可能切开多字节字符
+	return strings.ToValidUTF8(body[:maxBytes], ""), true
+}
+
+func redactKeysInValue(value any, keys map[string]struct{}) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if _, ok := keys[strings.ToLower(key)]; ok {
+				v[key] = redactedValue
+			} else {
+				v[key] = redactKeysInValue(item, keys)
+			}
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = redactKeysInValue(item, keys)
+		}
+	}
+	return value
+}
+
+// redactPath 按路径脱敏，* 匹配数组的所有元素或对象的所有字段
+func redactPath(value any, path []string) any {
+	if len(path) == 0 {
+		return redactedValue
+	}
+	segment, rest := path[0], path[1:]
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if segment == "*" || segment == key {
+				v[key] = redactPath(item, rest)
+			}
+		}
+	case []any:
+		for i, item := range v {
+			if segment == "*" || segment == fmt.Sprint(i) {
+				v[i] = redactPath(item, rest)
+			}
+		}
+	}
+	return value
+}
+
+// CleanExpiredLogBodies 定期删除超过保留天数的记录
+func CleanExpiredLogBodies() {
+	for {
+		retentionDays := operation_setting.GetBodyCaptureSetting().RetentionDays
+		if retentionDays > 0 {
+			before := time.Now().AddDate(0, 0, -retentionDays).Unix()
+			if n, err := model.DeleteLogBodiesBefore(before); err != nil {
+				common.SysError("failed to clean expired log bodies: " + err.Error())
+			} else if n > 0 {
+				common.SysLog(fmt.Sprintf("cleaned %d expired log bodies", n))
+			}
+		}
+		time.Sleep(time.Hour)
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// BudgetExceededError 令牌或用户的周期预算已用尽
+type BudgetExceededError struct {
+	Budget *model.Budget
+}
+
+func (e *BudgetExceededError) Error() string {
+	owner := "令牌"
+	if e.Budget.OwnerType == model.BudgetOwnerUser {
+		owner = "用户"
+	}
+	period := "每日"
+	switch e.Budget.Period {
+	case model.BudgetPeriodWeekly:
+		period = "每周"
+	case model.BudgetPeriodMonthly:
+		period = "每月"
+	}
+	scope := ""
+	if e.Budget.ModelName != "" {
+		scope = fmt.Sprintf("（模型 %s）", e.Budget.ModelName)
+	}
+	return fmt.Sprintf("%s%s预算已用尽%s：已使用 %s，限额 %s，将于 %s 重置", owner, period, scope,
+		logger.FormatQuota(e.Budget.Used), logger.FormatQuota(e.Budget.Limit), e.Budget.ResetAt().Format("2006-01-02 15:04:05"))
+}
+
+// ReserveBudgets 在令牌与用户当前周期的预算中预占本次预扣的额度，预算不足时返回 BudgetExceededError
+func ReserveBudgets(relayInfo *relaycommon.RelayInfo, quota int) error {
+	tokenId := relayInfo.TokenId
+	if relayInfo.IsPlayground {
+		tokenId = 0
+	}
+	relayInfo.BudgetReservedAt = time.Now()
+	budget, err := model.ReserveBudgets(tokenId, relayInfo.UserId, relayInfo.OriginModelName, quota, relayInfo.BudgetReservedAt)
+	if err != nil {
+		return err
+	}
+	if budget != nil {
+		return &BudgetExceededError{Budget: budget}
+	}
+	return nil
+}
+
+// chargeBudgets 将实际消耗计入预算，预扣与补扣、返还都会经过这里，累计结果即为实际花费；没有生效的预算时不写数据库
+func chargeBudgets(relayInfo *relaycommon.RelayInfo, quota int) {
+	if quota == 0 {
+		return
+	}
+	tokenId := relayInfo.TokenId
+	if relayInfo.IsPlayground {
+		tokenId = 0
+	}
+	userId := relayInfo.UserId
+	modelName := relayInfo.OriginModelName
+	reservedAt := relayInfo.BudgetReservedAt
+	if reservedAt.IsZero() {
+		// 未经过预占的结算（如异步任务）计入当前周期
+		reservedAt = time.Now()
+	}
+	gopool.Go(func() {
+		if err := model.ChargeBudgets(tokenId, userId, modelName, quota, reservedAt); err != nil {
+			common.SysError("failed to charge budgets: " + err.Error())
+		}
+	})
+}
+
+// ResetBudgetsTask 定期重置已进入新周期的预算
+func ResetBudgetsTask() {
+	for {
+		n, err := model.ResetExpiredBudgets()
+		if err != nil {
+			common.SysError("failed to reset budgets: " + err.Error())
+		} else if n > 0 {
+			common.SysLog(fmt.Sprintf("reset %d budgets", n))
+		}
+		time.Sleep(time.Minute)
+	}
+}
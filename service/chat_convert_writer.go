@@ -0,0 +1,128 @@
+package service
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// chatConvertWriter 包装 gin.ResponseWriter，拦截 chat 渠道写出的 Chat Completions 响应以便转换为其他格式。
+// 流式响应按行解析后交给 onStreamData（包括 [DONE]），非流式响应缓冲到 Finish 时统一转换
+type chatConvertWriter struct {
+	gin.ResponseWriter
+	status       int
+	decided      bool
+	stream       bool
+	buffer       bytes.Buffer
+	onStreamData func(data string)
+}
+
+func newChatConvertWriter(writer gin.ResponseWriter, onStreamData func(data string)) *chatConvertWriter {
+	return &chatConvertWriter{
+		ResponseWriter: writer,
+		onStreamData:   onStreamData,
+	}
+}
+
+func (w *chatConvertWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *chatConvertWriter) WriteHeaderNow() {}
+
+func (w *chatConvertWriter) Status() int {
+	if w.status != 0 {
+		return w.status
+	}
+	return w.ResponseWriter.Status()
+}
+
+func (w *chatConvertWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *chatConvertWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.decided = true
+		trimmed := bytes.TrimSpace(data)
+		w.stream = strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") ||
+			bytes.HasPrefix(trimmed, []byte("data:")) || bytes.HasPrefix(trimmed, []byte(":"))
+		if w.stream {
+			w.Header().Del("Content-Length")
+			w.flushHeader()
+		}
+	}
+	w.buffer.Write(data)
+	if w.stream {
+		w.processLines()
+	}
+	return len(data), nil
+}
+
+func (w *chatConvertWriter) flushHeader() {
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *chatConvertWriter) processLines() {
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			// 不完整的行放回缓冲区等待后续数据
+			rest := []byte(line)
+			w.buffer.Reset()
+			w.buffer.Write(rest)
+			return
+		}
+		w.handleLine(strings.TrimRight(line, "\r\n"))
+	}
+}
+
+func (w *chatConvertWriter) handleLine(line string) {
+	if strings.HasPrefix(line, ":") {
+		// 保活注释原样透传
+		w.writeRaw(line + "\n\n")
+		return
+	}
+	if !strings.HasPrefix(line, "data:") {
+		return
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if data == "" {
+		return
+	}
+	w.onStreamData(data)
+}
+
+// flushStream 处理缓冲区中最后一行没有换行符的数据
+func (w *chatConvertWriter) flushStream() {
+	if w.buffer.Len() > 0 {
+		w.handleLine(strings.TrimRight(w.buffer.String(), "\r\n"))
+		w.buffer.Reset()
+	}
+}
+
+func (w *chatConvertWriter) writeRaw(data string) {
+	_, _ = w.ResponseWriter.Write([]byte(data))
+}
+
+// Fail 流式输出开始后 chat 处理出错时写出目标格式的失败事件，默认不处理
+func (w *chatConvertWriter) Fail(newAPIError *types.NewAPIError) bool {
+	return false
+}
+
+// writeBody 写出转换后的非流式响应
+func (w *chatConvertWriter) writeBody(body []byte) error {
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "application/json")
+	w.flushHeader()
+	_, err := w.ResponseWriter.Write(body)
+	return err
+}
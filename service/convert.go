@@ -584,15 +584,30 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 
 	// 转换 messages
 	var messages []dto.Message
+	// functionResponse 优先按 id 匹配 tool_call_id，没有 id 时按位置匹配上一个模型回合中的调用
+	var turnCallIds []string
+	responseCount := 0
+	callCount := 0
 	for _, content := range geminiRequest.Contents {
 		message := dto.Message{
 			Role: convertGeminiRoleToOpenAI(content.Role),
 		}
+		for _, part := range content.Parts {
+			if part.FunctionCall != nil {
+				turnCallIds = nil
+				responseCount = 0
+				break
+			}
+		}
 
 		// 处理 parts
 		var mediaContents []dto.MediaContent
 		var toolCalls []dto.ToolCallRequest
 		for _, part := range content.Parts {
+			if part.Thought {
+				// 思考内容不回传给其他上游
+				continue
+			}
 			if part.Text != "" {
 				mediaContent := dto.MediaContent{
 					Type: "text",
@@ -621,8 +636,14 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 				mediaContents = append(mediaContents, mediaContent)
 			} else if part.FunctionCall != nil {
 				// 处理 Gemini 的工具调用
+				callCount++
+				callId := part.FunctionCall.ID
+				if callId == "" {
+					callId = fmt.Sprintf("call_%d", callCount)
+				}
+				turnCallIds = append(turnCallIds, callId)
 				toolCall := dto.ToolCallRequest{
-					ID:   fmt.Sprintf("call_%d", len(toolCalls)+1), // 生成唯一ID
+					ID:   callId,
 					Type: "function",
 					Function: dto.FunctionRequest{
 						Name:      part.FunctionCall.FunctionName,
@@ -632,9 +653,19 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 				toolCalls = append(toolCalls, toolCall)
 			} else if part.FunctionResponse != nil {
 				// 处理 Gemini 的工具响应，创建单独的 tool 消息
+				var callId string
+				_ = common.Unmarshal(part.FunctionResponse.ID, &callId)
+				if callId == "" && responseCount < len(turnCallIds) {
+					callId = turnCallIds[responseCount]
+				}
+				responseCount++
+				if callId == "" {
+					callCount++
+					callId = fmt.Sprintf("call_%d", callCount)
+				}
 				toolMessage := dto.Message{
 					Role:       "tool",
-					ToolCallId: fmt.Sprintf("call_%d", len(toolCalls)), // 使用对应的调用ID
+					ToolCallId: callId,
 				}
 				toolMessage.SetStringContent(toJSONString(part.FunctionResponse.Response))
 				messages = append(messages, toolMessage)
@@ -642,16 +673,16 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 		}
 
 		// 设置消息内容
-		if len(toolCalls) > 0 {
-			// 如果有工具调用，设置工具调用
-			message.SetToolCalls(toolCalls)
-		} else if len(mediaContents) == 1 && mediaContents[0].Type == "text" {
+		if len(mediaContents) == 1 && mediaContents[0].Type == "text" {
 			// 如果只有一个文本内容，直接设置字符串
 			message.Content = mediaContents[0].Text
 		} else if len(mediaContents) > 0 {
 			// 如果有多个内容或包含媒体，设置为数组
 			message.SetMediaContent(mediaContents)
 		}
+		if len(toolCalls) > 0 {
+			message.SetToolCalls(toolCalls)
+		}
 
 		// 只有当消息有内容或工具调用时才添加
 		if len(message.ParseContent()) > 0 || len(message.ToolCalls) > 0 {
@@ -674,8 +705,8 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 		openaiRequest.MaxTokens = geminiRequest.GenerationConfig.MaxOutputTokens
 	}
 	// gemini stop sequences 最多 5 个，openai stop 最多 4 个
-	if len(geminiRequest.GenerationConfig.StopSequences) > 0 {
-		openaiRequest.Stop = geminiRequest.GenerationConfig.StopSequences[:4]
+	if stopSequences := geminiRequest.GenerationConfig.StopSequences; len(stopSequences) > 0 {
+		openaiRequest.Stop = stopSequences[:min(len(stopSequences), 4)]
 	}
 	if geminiRequest.GenerationConfig.CandidateCount > 0 {
 		openaiRequest.N = geminiRequest.GenerationConfig.CandidateCount
@@ -685,26 +716,57 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 	if len(geminiRequest.GetTools()) > 0 {
 		var tools []dto.ToolCallRequest
 		for _, tool := range geminiRequest.GetTools() {
-			if tool.FunctionDeclarations != nil {
-				// 将 Gemini 的 FunctionDeclarations 转换为 OpenAI 的 ToolCallRequest
-				functionDeclarations, ok := tool.FunctionDeclarations.([]dto.FunctionRequest)
-				if ok {
-					for _, function := range functionDeclarations {
-						openAITool := dto.ToolCallRequest{
-							Type: "function",
-							Function: dto.FunctionRequest{
-								Name:        function.Name,
-								Description: function.Description,
-								Parameters:  function.Parameters,
-							},
-						}
-						tools = append(tools, openAITool)
-					}
+			if tool.FunctionDeclarations == nil {
+				continue
+			}
+			// 将 Gemini 的 FunctionDeclarations 转换为 OpenAI 的 ToolCallRequest
+			var functionDeclarations []struct {
+				Name                 string `json:"name"`
+				Description          string `json:"description,omitempty"`
+				Parameters           any    `json:"parameters,omitempty"`
+				ParametersJsonSchema any    `json:"parametersJsonSchema,omitempty"`
+			}
+			if err := common.Unmarshal([]byte(toJSONString(tool.FunctionDeclarations)), &functionDeclarations); err != nil {
+				return nil, fmt.Errorf("invalid function declarations: %w", err)
+			}
+			for _, function := range functionDeclarations {
+				parameters := function.ParametersJsonSchema
+				if parameters == nil {
+					parameters = normalizeGeminiSchema(function.Parameters)
+				}
+				openAITool := dto.ToolCallRequest{
+					Type: "function",
+					Function: dto.FunctionRequest{
+						Name:        function.Name,
+						Description: function.Description,
+						Parameters:  parameters,
+					},
 				}
+				tools = append(tools, openAITool)
 			}
 		}
 		if len(tools) > 0 {
 			openaiRequest.Tools = tools
+			openaiRequest.ToolChoice = convertGeminiToolConfigToOpenAI(geminiRequest.ToolConfig)
+		}
+	}
+
+	// gemini 的 JSON 输出配置
+	if geminiRequest.GenerationConfig.ResponseMimeType == "application/json" {
+		var schema any
+		if len(geminiRequest.GenerationConfig.ResponseJsonSchema) > 0 {
+			schema = geminiRequest.GenerationConfig.ResponseJsonSchema
+		} else if geminiRequest.GenerationConfig.ResponseSchema != nil {
+			schema = normalizeGeminiSchema(geminiRequest.GenerationConfig.ResponseSchema)
+		}
+		if schema != nil {
+			jsonSchema, err := common.Marshal(dto.FormatJsonSchema{Name: "response", Schema: schema})
+			if err != nil {
+				return nil, err
+			}
+			openaiRequest.ResponseFormat = &dto.ResponseFormat{Type: "json_schema", JsonSchema: jsonSchema}
+		} else {
+			openaiRequest.ResponseFormat = &dto.ResponseFormat{Type: "json_object"}
 		}
 	}
 
@@ -721,6 +783,51 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 	return openaiRequest, nil
 }
 
+// normalizeGeminiSchema Gemini 的 Schema 类型为大写（OBJECT、STRING），转换为 JSON Schema 的小写形式
+func normalizeGeminiSchema(schema any) any {
+	switch v := schema.(type) {
+	case map[string]any:
+		normalized := make(map[string]any, len(v))
+		for key, value := range v {
+			if typeName, ok := value.(string); ok && key == "type" {
+				normalized[key] = strings.ToLower(typeName)
+				continue
+			}
+			normalized[key] = normalizeGeminiSchema(value)
+		}
+		return normalized
+	case []any:
+		normalized := make([]any, len(v))
+		for i, value := range v {
+			normalized[i] = normalizeGeminiSchema(value)
+		}
+		return normalized
+	}
+	return schema
+}
+
+func convertGeminiToolConfigToOpenAI(toolConfig *dto.ToolConfig) any {
+	if toolConfig == nil || toolConfig.FunctionCallingConfig == nil {
+		return nil
+	}
+	config := toolConfig.FunctionCallingConfig
+	switch strings.ToUpper(string(config.Mode)) {
+	case "NONE":
+		return "none"
+	case "ANY":
+		if len(config.AllowedFunctionNames) == 1 {
+			return map[string]any{
+				"type":     "function",
+				"function": map[string]any{"name": config.AllowedFunctionNames[0]},
+			}
+		}
+		return "required"
+	case "AUTO":
+		return "auto"
+	}
+	return nil
+}
+
 func convertGeminiRoleToOpenAI(geminiRole string) string {
 	switch geminiRole {
 	case "user":
@@ -799,6 +906,7 @@ func ResponseOpenAI2Gemini(openAIResponse *dto.OpenAITextResponse, info *relayco
 
 				part := dto.GeminiPart{
 					FunctionCall: &dto.FunctionCall{
+						ID:           toolCall.ID,
 						FunctionName: toolCall.Function.Name,
 						Arguments:    args,
 					},
@@ -902,6 +1010,7 @@ func StreamResponseOpenAI2Gemini(openAIResponse *dto.ChatCompletionsStreamRespon
 
 				part := dto.GeminiPart{
 					FunctionCall: &dto.FunctionCall{
+						ID:           toolCall.ID,
 						FunctionName: toolCall.Function.Name,
 						Arguments:    args,
 					},
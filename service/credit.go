@@ -0,0 +1,199 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+func getCreditGraceDays(credit *model.UserCredit) int {
+	if credit.GraceDays > 0 {
+		return credit.GraceDays
+	}
+	return operation_setting.GetPostpaidSetting().GraceDays
+}
+
+// getCreditBalanceAtPeriodEnd 在当前额度上加回账期结束后的个人消费、扣除其后的退款，得到账期结束时的额度；
+// 账期结束后的充值与结清视为还款，仍计入余额。未开启消费日志时无法还原，按当前额度计算
+func getCreditBalanceAtPeriodEnd(userId int, periodEnd int64) (int, error) {
+	quota, err := model.GetUserQuota(userId, true)
+	if err != nil {
+		return 0, err
+	}
+	now := common.GetTimestamp() + 1
+	consumed, err := model.SumUserLogQuota(userId, model.LogTypeConsume, periodEnd, now)
+	if err != nil {
+		return 0, err
+	}
+	refunded, err := model.SumUserLogQuota(userId, model.LogTypeRefund, periodEnd, now)
+	if err != nil {
+		return 0, err
+	}
+	return quota + int(consumed) - int(refunded), nil
+}
+
+// GenerateCreditSettlements 为后付费用户生成某月的结算单，欠款为账期结束时用户额度的负数部分，
+// 之前未结清的结算单欠款已包含在内，写入时会被取代
+func GenerateCreditSettlements(year int, month time.Month) (int, error) {
+	periodStart, periodEnd := GetInvoicePeriod(year, month)
+	credits, err := model.GetUserCredits()
+	if err != nil {
+		return 0, err
+	}
+	invoiceEnabled := operation_setting.GetInvoiceSetting().Enabled
+	count := 0
+	for _, credit := range credits {
+		// 已有该账期或之后账期的结算单时跳过，避免旧账期的结算单取代新的
+		if latest, err := model.GetLatestCreditSettlement(credit.UserId); err == nil && latest.PeriodStart >= periodStart {
+			continue
+		}
+		balance, err := getCreditBalanceAtPeriodEnd(credit.UserId, periodEnd)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to get quota of user %d: %s", credit.UserId, err.Error()))
+			continue
+		}
+		settlement := &model.CreditSettlement{
+			UserId:      credit.UserId,
+			PeriodStart: periodStart,
+			PeriodEnd:   periodEnd,
+			Amount:      max(-balance, 0),
+			DueAt:       time.Unix(periodEnd, 0).AddDate(0, 0, getCreditGraceDays(credit)).Unix(),
+			Status:      model.SettlementStatusPending,
+		}
+		if settlement.Amount == 0 {
+			settlement.Status = model.SettlementStatusPaid
+			settlement.PaidAt = common.GetTimestamp()
+		}
+		if invoice, err := model.GetInvoiceByPeriod(credit.UserId, periodStart); err == nil {
+			settlement.InvoiceId = invoice.Id
+		} else if invoiceEnabled {
+			if invoice, err = GenerateInvoice(credit.UserId, year, month); err == nil {
+				settlement.InvoiceId = invoice.Id
+			}
+		}
+		if err = settlement.Insert(); err != nil {
+			common.SysError(fmt.Sprintf("failed to create settlement for user %d: %s", credit.UserId, err.Error()))
+			continue
+		}
+		count++
+		if settlement.Status == model.SettlementStatusOverdue {
+			refreshCreditStatus(credit.UserId)
+		}
+		if settlement.Status != model.SettlementStatusPaid && operation_setting.GetPostpaidSetting().SendEmail {
+			subject := fmt.Sprintf("%s %s 结算提醒", common.SystemName, time.Unix(periodStart, 0).Format("2006-01"))
+			content := fmt.Sprintf("<p>您好，截至 %s 账期结束，您的后付费账户共欠款 %s。</p><p>请在 %s 前结清，逾期后将暂停透支额度。</p>",
+				time.Unix(periodStart, 0).Format("2006-01"), logger.FormatQuota(settlement.Amount), time.Unix(settlement.DueAt, 0).Format("2006-01-02"))
+			sendCreditEmail(credit.UserId, subject, content)
+		}
+	}
+	return count, nil
+}
+
+// CheckCreditSettlements 用户额度恢复为非负数时视为结清；超过宽限期仍未结清时暂停透支，全部结清后恢复
+func CheckCreditSettlements() error {
+	settlements, err := model.GetUnpaidCreditSettlements()
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	changedUsers := make(map[int]bool)
+	for _, settlement := range settlements {
+		quota, err := model.GetUserQuota(settlement.UserId, true)
+		if err != nil {
+			continue
+		}
+		if quota >= 0 {
+			if err = model.UpdateCreditSettlementStatus(settlement.Id, model.SettlementStatusPaid); err == nil {
+				changedUsers[settlement.UserId] = true
+			}
+			continue
+		}
+		if settlement.Status == model.SettlementStatusPending && settlement.DueAt < now {
+			if err = model.UpdateCreditSettlementStatus(settlement.Id, model.SettlementStatusOverdue); err == nil {
+				changedUsers[settlement.UserId] = true
+			}
+		}
+	}
+	for userId := range changedUsers {
+		refreshCreditStatus(userId)
+	}
+	return nil
+}
+
+// refreshCreditStatus 有逾期结算单时暂停透支，否则恢复
+func refreshCreditStatus(userId int) {
+	credit, err := model.GetUserCredit(userId)
+	if err != nil {
+		return
+	}
+	overdue, err := model.CountOverdueCreditSettlements(userId)
+	if err != nil {
+		return
+	}
+	if overdue > 0 && credit.Status == model.UserCreditStatusActive {
+		if err = model.SetUserCreditStatus(userId, model.UserCreditStatusSuspended); err == nil {
+			model.RecordLog(userId, model.LogTypeSystem, "后付费结算单逾期未结清，已暂停透支额度")
+			sendCreditEmail(userId, fmt.Sprintf("%s 透支额度已暂停", common.SystemName),
+				"<p>您好，您的后付费结算单已逾期，透支额度已暂停，结清后将自动恢复。</p>")
+		}
+	} else if overdue == 0 && credit.Status == model.UserCreditStatusSuspended && credit.SuspendedAt > 0 {
+		if err = model.SetUserCreditStatus(userId, model.UserCreditStatusActive); err == nil {
+			model.RecordLog(userId, model.LogTypeSystem, "后付费结算单已结清，恢复透支额度")
+		}
+	}
+}
+
+// SettleCreditSettlement 管理员确认收款，结算金额计入用户额度后恢复透支
+func SettleCreditSettlement(settlement *model.CreditSettlement) error {
+	if err := model.SettleCreditSettlement(settlement); err != nil {
+		return err
+	}
+	model.RecordLog(settlement.UserId, model.LogTypeTopup, fmt.Sprintf("后付费结算单 %d 已结清，计入额度 %s", settlement.Id, logger.LogQuota(settlement.Amount)))
+	refreshCreditStatus(settlement.UserId)
+	return nil
+}
+
+func sendCreditEmail(userId int, subject string, content string) {
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		return
+	}
+	email := user.GetSetting().NotificationEmail
+	if email == "" {
+		email = user.Email
+	}
+	if email == "" {
+		return
+	}
+	if err = common.SendEmail(subject, email, content); err != nil {
+		common.SysError(fmt.Sprintf("failed to send credit email to user %d: %s", userId, err.Error()))
+	}
+}
+
+// CreditSettlementTask 每月初生成上月结算单，并定期检查付款与逾期
+func CreditSettlementTask() {
+	lastPeriod := int64(0)
+	for {
+		lastMonth := time.Now().AddDate(0, -1, 0)
+		periodStart, _ := GetInvoicePeriod(lastMonth.Year(), lastMonth.Month())
+		if periodStart != lastPeriod {
+			n, err := GenerateCreditSettlements(lastMonth.Year(), lastMonth.Month())
+			if err != nil {
+				common.SysError("failed to generate credit settlements: " + err.Error())
+			} else {
+				lastPeriod = periodStart
+				if n > 0 {
+					common.SysLog(fmt.Sprintf("generated %d credit settlements for %s", n, lastMonth.Format("2006-01")))
+				}
+			}
+		}
+		if err := CheckCreditSettlements(); err != nil {
+			common.SysError("failed to check credit settlements: " + err.Error())
+		}
+		time.Sleep(time.Hour)
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGenerateCreditSettlementsUsesPeriodEndBalance(t *testing.T) {
+	model.SetupTestDB(t, &model.User{}, &model.UserCredit{}, &model.CreditSettlement{}, &model.Log{}, &model.Invoice{})
+	lastMonth := time.Now().AddDate(0, -1, 0)
+	periodStart, periodEnd := GetInvoicePeriod(lastMonth.Year(), lastMonth.Month())
+
+	// 账期结束时欠款 500，之后又消费了 200 并退还了 50
+	user := &model.User{Id: 1, Username: "postpaid", Quota: -650}
+	model.CreateTestRecords(t, user, &model.UserCredit{UserId: 1, CreditLimit: 1000, GraceDays: 7, Status: model.UserCreditStatusActive})
+	logs := []*model.Log{
+		{UserId: 1, Type: model.LogTypeConsume, Quota: 500, CreatedAt: periodStart + 10},
+		{UserId: 1, Type: model.LogTypeConsume, Quota: 200, CreatedAt: periodEnd + 10},
+		{UserId: 1, Type: model.LogTypeRefund, Quota: 50, CreatedAt: periodEnd + 20},
+		// 组织额度池的消费不影响个人额度
+		{UserId: 1, Type: model.LogTypeConsume, Quota: 999, CreatedAt: periodEnd + 30, OrganizationId: 3},
+	}
+	model.CreateTestRecords(t, &logs)
+
+	n, err := GenerateCreditSettlements(lastMonth.Year(), lastMonth.Month())
+	if err != nil || n != 1 {
+		t.Fatalf("generate settlements: n=%d err=%v", n, err)
+	}
+	settlement, err := model.GetLatestCreditSettlement(1)
+	if err != nil {
+		t.Fatalf("get settlement: %v", err)
+	}
+	if settlement.Amount != 500 {
+		t.Fatalf("settlement amount = %d, want 500", settlement.Amount)
+	}
+	if want := time.Unix(periodEnd, 0).AddDate(0, 0, 7).Unix(); settlement.DueAt != want {
+		t.Fatalf("settlement due at %d, want %d", settlement.DueAt, want)
+	}
+	// 账单功能关闭时不生成账单
+	if settlement.InvoiceId != 0 {
+		t.Fatalf("settlement invoice id = %d", settlement.InvoiceId)
+	}
+
+	// 重复执行不会再次生成
+	if n, err = GenerateCreditSettlements(lastMonth.Year(), lastMonth.Month()); err != nil || n != 0 {
+		t.Fatalf("regenerate settlements: n=%d err=%v", n, err)
+	}
+}
+
+func TestPreConsumeQuotaTrustsOnlyRealBalance(t *testing.T) {
+	model.SetupTestDB(t, &model.User{}, &model.UserCredit{}, &model.Budget{})
+	// 真实余额低于信任额度，可透支额度远高于信任额度
+	creditLimit := common.GetTrustQuota() * 10
+	model.CreateTestRecords(t, &model.User{Id: 1, Username: "postpaid", Quota: 100},
+		&model.UserCredit{UserId: 1, CreditLimit: creditLimit, Status: model.UserCreditStatusActive})
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	info := &relaycommon.RelayInfo{UserId: 1, TokenUnlimited: true, IsPlayground: true}
+	if apiErr := PreConsumeQuota(c, 500, info); apiErr != nil {
+		t.Fatalf("pre consume: %v", apiErr)
+	}
+	if info.FinalPreConsumedQuota != 500 {
+		t.Fatalf("pre consumed = %d, want 500", info.FinalPreConsumedQuota)
+	}
+	if info.UserQuota != 100 || info.BillingQuota != 100+creditLimit {
+		t.Fatalf("user quota = %d, billing quota = %d", info.UserQuota, info.BillingQuota)
+	}
+	if user := model.GetTestRecord[model.User](t, 1); user.Quota != -400 {
+		t.Fatalf("user quota after pre consume = %d, want -400", user.Quota)
+	}
+}
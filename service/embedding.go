@@ -0,0 +1,103 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"math"
+
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
+
+// SplitEmbeddingInputs 按上游单次请求允许的最大条数拆分输入
+func SplitEmbeddingInputs(inputs []string, batchSize int) [][]string {
+	if batchSize <= 0 || len(inputs) <= batchSize {
+		return [][]string{inputs}
+	}
+	batches := make([][]string, 0, (len(inputs)+batchSize-1)/batchSize)
+	for start := 0; start < len(inputs); start += batchSize {
+		end := min(start+batchSize, len(inputs))
+		batches = append(batches, inputs[start:end])
+	}
+	return batches
+}
+
+// EncodeEmbeddingBase64 与 OpenAI 一致，将向量按 float32 小端序编码为 base64
+func EncodeEmbeddingBase64(embedding []float64) string {
+	buf := make([]byte, 4*len(embedding))
+	for i, value := range embedding {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(float32(value)))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// IsBase64EmbeddingRequest 原始请求是否要求以 base64 返回向量
+func IsBase64EmbeddingRequest(info *relaycommon.RelayInfo) bool {
+	request, ok := info.Request.(*dto.EmbeddingRequest)
+	return ok && request.EncodingFormat == "base64"
+}
+
+// CohereEmbeddingInputType 返回 Cohere embed 的 input_type，未指定时按文档处理，query/document 为 search_query/search_document 的简写
+func CohereEmbeddingInputType(inputType string) string {
+	switch inputType {
+	case "", "document":
+		return "search_document"
+	case "query":
+		return "search_query"
+	}
+	return inputType
+}
+
+// EstimateEmbeddingPromptTokens 上游未返回 token 数时使用预估值，只完成部分输入时按条数比例折算
+func EstimateEmbeddingPromptTokens(info *relaycommon.RelayInfo, completed int) int {
+	estimate := info.GetEstimatePromptTokens()
+	request, ok := info.Request.(*dto.EmbeddingRequest)
+	if !ok {
+		return estimate
+	}
+	if total := len(request.ParseInput()); total > completed {
+		return estimate * completed / total
+	}
+	return estimate
+}
+
+func newEmbeddingResponse(info *relaycommon.RelayInfo, size int, usage dto.Usage) *dto.FlexibleEmbeddingResponse {
+	return &dto.FlexibleEmbeddingResponse{
+		Object: "list",
+		Data:   make([]dto.FlexibleEmbeddingResponseItem, 0, size),
+		Model:  info.UpstreamModelName,
+		Usage:  usage,
+	}
+}
+
+// BuildEmbeddingResponse 将上游返回的向量组装为 OpenAI 格式的 embedding 响应；
+// 上游不支持 base64 输出时，按原始请求的 encoding_format 在本地编码
+func BuildEmbeddingResponse(info *relaycommon.RelayInfo, embeddings [][]float64, usage dto.Usage) *dto.FlexibleEmbeddingResponse {
+	encodeBase64 := IsBase64EmbeddingRequest(info)
+	response := newEmbeddingResponse(info, len(embeddings), usage)
+	for i, embedding := range embeddings {
+		item := dto.FlexibleEmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: embedding,
+		}
+		if encodeBase64 {
+			item.Embedding = EncodeEmbeddingBase64(embedding)
+		}
+		response.Data = append(response.Data, item)
+	}
+	return response
+}
+
+// BuildBase64EmbeddingResponse 上游已按 float32 小端序返回 base64 向量时原样组装为 OpenAI 格式的响应
+func BuildBase64EmbeddingResponse(info *relaycommon.RelayInfo, embeddings []string, usage dto.Usage) *dto.FlexibleEmbeddingResponse {
+	response := newEmbeddingResponse(info, len(embeddings), usage)
+	for i, embedding := range embeddings {
+		response.Data = append(response.Data, dto.FlexibleEmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: embedding,
+		})
+	}
+	return response
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
+
+func TestCohereEmbeddingInputType(t *testing.T) {
+	tests := map[string]string{
+		"":               "search_document",
+		"document":       "search_document",
+		"query":          "search_query",
+		"search_query":   "search_query",
+		"classification": "classification",
+	}
+	for inputType, want := range tests {
+		if got := CohereEmbeddingInputType(inputType); got != want {
+			t.Fatalf("CohereEmbeddingInputType(%q) = %q, want %q", inputType, got, want)
+		}
+	}
+}
+
+func TestEstimateEmbeddingPromptTokens(t *testing.T) {
+	info := &relaycommon.RelayInfo{Request: &dto.EmbeddingRequest{Input: []any{"a", "b", "c", "d"}}}
+	info.SetEstimatePromptTokens(100)
+	if got := EstimateEmbeddingPromptTokens(info, 4); got != 100 {
+		t.Fatalf("all completed = %d", got)
+	}
+	// 仅完成部分输入时按条数比例折算
+	if got := EstimateEmbeddingPromptTokens(info, 1); got != 25 {
+		t.Fatalf("one completed = %d", got)
+	}
+}
+
+func TestBuildEmbeddingResponseEncoding(t *testing.T) {
+	info := &relaycommon.RelayInfo{
+		Request:     &dto.EmbeddingRequest{Input: "a", EncodingFormat: "base64"},
+		ChannelMeta: &relaycommon.ChannelMeta{UpstreamModelName: "m"},
+	}
+	usage := dto.Usage{PromptTokens: 1, TotalTokens: 1}
+	local := BuildEmbeddingResponse(info, [][]float64{{1}}, usage)
+	upstream := BuildBase64EmbeddingResponse(info, []string{"AACAPw=="}, usage)
+	for _, response := range []*dto.FlexibleEmbeddingResponse{local, upstream} {
+		if len(response.Data) != 1 || response.Data[0].Embedding != "AACAPw==" || response.Model != "m" {
+			t.Fatalf("response = %+v", response)
+		}
+	}
+
+	info.Request = &dto.EmbeddingRequest{Input: "a"}
+	response := BuildEmbeddingResponse(info, [][]float64{{1}}, usage)
+	if embedding, ok := response.Data[0].Embedding.([]float64); !ok || embedding[0] != 1 {
+		t.Fatalf("float embedding = %v", response.Data[0].Embedding)
+	}
+}
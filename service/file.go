@@ -0,0 +1,376 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const fileIdPrefix = "file-"
+
+// fileStorageModelName 文件存储费用在预算匹配与消费日志中使用的模型名
+const fileStorageModelName = "file-storage"
+
+var (
+	ErrFileTooLarge          = errors.New("file exceeds the maximum allowed size")
+	ErrFileStorageExceeded   = errors.New("file storage limit exceeded")
+	ErrFileInsufficientQuota = errors.New("insufficient quota for file storage")
+	ErrFileInlineTooLarge    = errors.New("file is too large to be referenced in a request")
+)
+
+func GetFileStorage() (ObjectStorage, error) {
+	return NewObjectStorage(fileObjectStorageConfig())
+}
+
+// fileObjectStorageConfig 文件存储的对象存储配置，日志归档到 S3 时也使用其中的 S3 设置
+func fileObjectStorageConfig() ObjectStorageConfig {
+	fileSetting := system_setting.GetFileSetting()
+	return ObjectStorageConfig{
+		Type:              fileSetting.StorageType,
+		LocalPath:         fileSetting.LocalPath,
+		S3Endpoint:        fileSetting.S3Endpoint,
+		S3Region:          fileSetting.S3Region,
+		S3Bucket:          fileSetting.S3Bucket,
+		S3AccessKeyId:     fileSetting.S3AccessKeyId,
+		S3SecretAccessKey: fileSetting.S3SecretAccessKey,
+		S3PathStyle:       fileSetting.S3PathStyle,
+	}
+}
+
+// calcFileQuota 按 MB 向上取整计算文件存储费用
+func calcFileQuota(size int64) int {
+	quotaPerMB := system_setting.GetFileSetting().QuotaPerMB
+	if quotaPerMB <= 0 || size <= 0 {
+		return 0
+	}
+	mb := (size + 1024*1024 - 1) / (1024 * 1024)
+	return int(mb) * quotaPerMB
+}
+
+// SaveUserFile 校验大小与存储上限后将文件写入对象存储并记录到数据库，按配置经由常规计费流程扣除存储额度
+func SaveUserFile(c *gin.Context, filename string, mimeType string, purpose string, size int64, reader io.Reader) (*model.File, error) {
+	fileSetting := system_setting.GetFileSetting()
+	if fileSetting.MaxFileSizeMB > 0 && size > int64(fileSetting.MaxFileSizeMB)*1024*1024 {
+		return nil, ErrFileTooLarge
+	}
+	relayInfo := relaycommon.GenRelayInfoOpenAI(c, nil)
+	relayInfo.OriginModelName = fileStorageModelName
+	ok, err := model.ReserveUserFileStorage(relayInfo.UserId, size, int64(fileSetting.MaxStoragePerUserMB)*1024*1024)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrFileStorageExceeded
+	}
+	quota := calcFileQuota(size)
+	if err = chargeFileQuota(relayInfo, quota); err != nil {
+		releaseFileStorage(relayInfo.UserId, size)
+		return nil, err
+	}
+
+	file, err := storeUserFile(c.Request.Context(), &model.File{
+		UserId:         relayInfo.UserId,
+		TokenId:        relayInfo.TokenId,
+		OrganizationId: relayInfo.OrganizationId,
+		Filename:       filename,
+		Purpose:        purpose,
+		Bytes:          size,
+		MimeType:       mimeType,
+		Quota:          quota,
+	}, reader)
+	if err != nil {
+		releaseFileStorage(relayInfo.UserId, size)
+		if quota > 0 {
+			if refundErr := PostConsumeQuota(relayInfo, -quota, 0, false); refundErr != nil {
+				common.SysError(fmt.Sprintf("failed to refund file storage quota for user %d: %s", relayInfo.UserId, refundErr.Error()))
+			}
+		}
+		return nil, err
+	}
+	if quota > 0 {
+		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
+		RecordConsume(c, relayInfo, model.RecordConsumeLogParams{
+			ModelName: fileStorageModelName,
+			TokenName: c.GetString("token_name"),
+			Quota:     quota,
+			Content:   fmt.Sprintf("上传文件 %s（%d 字节），消耗 %s", file.FileId, size, logger.LogQuota(quota)),
+			TokenId:   relayInfo.TokenId,
+			Group:     relayInfo.UsingGroup,
+		})
+	}
+	return file, nil
+}
+
+// chargeFileQuota 与请求计费一致地扣除存储额度：预算与令牌额度先预占，账户余额（含组织额度池与可透支额度）条件扣减
+func chargeFileQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
+	if quota <= 0 {
+		return nil
+	}
+	billingQuota, err := GetBillingQuota(relayInfo)
+	if err != nil {
+		return err
+	}
+	if billingQuota < quota {
+		return ErrFileInsufficientQuota
+	}
+	if err = PreConsumeTokenQuota(relayInfo, quota); err != nil {
+		var budgetErr *BudgetExceededError
+		if errors.As(err, &budgetErr) {
+			return err
+		}
+		return fmt.Errorf("%w: %s", ErrFileInsufficientQuota, err.Error())
+	}
+	if err = model.ConsumeBillingQuota(relayInfo.OrganizationId, relayInfo.UserId, quota); err != nil {
+		chargeBudgets(relayInfo, -quota)
+		if refundErr := model.IncreaseTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, quota); refundErr != nil {
+			common.SysError("failed to return file storage token quota: " + refundErr.Error())
+		}
+		if errors.Is(err, model.ErrUserQuotaNotEnough) || errors.Is(err, model.ErrOrganizationQuotaNotEnough) {
+			return ErrFileInsufficientQuota
+		}
+		return err
+	}
+	return nil
+}
+
+func releaseFileStorage(userId int, size int64) {
+	if err := model.ReleaseUserFileStorage(userId, size); err != nil {
+		common.SysError(fmt.Sprintf("failed to release file storage for user %d: %s", userId, err.Error()))
+	}
+}
+
+// SaveSystemFile 保存网关生成的文件（如批处理结果），不做大小限制也不扣除额度
+func SaveSystemFile(ctx context.Context, userId int, tokenId int, filename string, mimeType string, purpose string, size int64, reader io.Reader) (*model.File, error) {
+	if _, err := model.ReserveUserFileStorage(userId, size, 0); err != nil {
+		return nil, err
+	}
+	file, err := storeUserFile(ctx, &model.File{
+		UserId:   userId,
+		TokenId:  tokenId,
+		Filename: filename,
+		Purpose:  purpose,
+		Bytes:    size,
+		MimeType: mimeType,
+	}, reader)
+	if err != nil {
+		releaseFileStorage(userId, size)
+		return nil, err
+	}
+	return file, nil
+}
+
+// storeUserFile 写入对象存储并插入文件记录，file 需填好归属与元信息
+func storeUserFile(ctx context.Context, file *model.File, reader io.Reader) (*model.File, error) {
+	storage, err := GetFileStorage()
+	if err != nil {
+		return nil, err
+	}
+	file.FileId = fileIdPrefix + common.GetRandomString(24)
+	file.StorageKey = fmt.Sprintf("files/%d/%s", file.UserId, file.FileId)
+	file.Status = model.FileStatusProcessed
+	if err = storage.Put(ctx, file.StorageKey, reader, file.Bytes, file.MimeType); err != nil {
+		return nil, err
+	}
+	if err = file.Insert(); err != nil {
+		_ = storage.Delete(ctx, file.StorageKey)
+		return nil, err
+	}
+	return file, nil
+}
+
+func OpenUserFileContent(ctx context.Context, file *model.File) (io.ReadCloser, error) {
+	storage, err := GetFileStorage()
+	if err != nil {
+		return nil, err
+	}
+	return storage.Get(ctx, file.StorageKey)
+}
+
+func DeleteUserFile(ctx context.Context, file *model.File) error {
+	storage, err := GetFileStorage()
+	if err != nil {
+		return err
+	}
+	if err = storage.Delete(ctx, file.StorageKey); err != nil {
+		return err
+	}
+	if err = file.Delete(); err != nil {
+		return err
+	}
+	releaseFileStorage(file.UserId, file.Bytes)
+	// 退还上传时扣除的存储额度，组织令牌上传的文件退还到组织额度池
+	if file.Quota > 0 {
+		if err = model.IncreaseBillingQuota(file.OrganizationId, file.UserId, file.Quota); err != nil {
+			common.SysError(fmt.Sprintf("failed to refund file storage quota for user %d: %s", file.UserId, err.Error()))
+			return nil
+		}
+		if token, err := model.GetTokenById(file.TokenId); err == nil {
+			if err = model.IncreaseTokenQuota(token.Id, token.Key, file.Quota); err != nil {
+				common.SysError(fmt.Sprintf("failed to refund file storage token quota for token %d: %s", token.Id, err.Error()))
+			}
+		}
+		model.RecordRefundLog(file.UserId, file.OrganizationId, file.Quota, fmt.Sprintf("删除文件 %s，退还 %s", file.FileId, logger.LogQuota(file.Quota)))
+	}
+	return nil
+}
+
+func FileToOpenAIFile(file *model.File) dto.OpenAIFile {
+	openAIFile := dto.OpenAIFile{
+		ID:        file.FileId,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    file.Status,
+	}
+	if file.ExpiresAt > 0 {
+		expiresAt := file.ExpiresAt
+		openAIFile.ExpiresAt = &expiresAt
+	}
+	return openAIFile
+}
+
+// loadUserFileAsDataURL 读取用户上传的文件并转为 base64 data url，文件不存在时返回 nil，超过内联上限时返回 ErrFileInlineTooLarge
+func loadUserFileAsDataURL(ctx context.Context, userId int, fileId string) (*model.File, string, error) {
+	if !strings.HasPrefix(fileId, fileIdPrefix) {
+		return nil, "", nil
+	}
+	file, err := model.GetUserFileByFileId(userId, fileId)
+	if err != nil {
+		// 不是网关保存的文件，交给上游处理
+		return nil, "", nil
+	}
+	maxBytes := system_setting.GetFileSetting().GetMaxInlineFileBytes()
+	if file.Bytes > maxBytes {
+		return nil, "", fmt.Errorf("%w: %s is %d bytes, limit is %d bytes", ErrFileInlineTooLarge, fileId, file.Bytes, maxBytes)
+	}
+	reader, err := OpenUserFileContent(ctx, file)
+	if err != nil {
+		return nil, "", err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(io.LimitReader(reader, maxBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, "", fmt.Errorf("%w: %s exceeds %d bytes", ErrFileInlineTooLarge, fileId, maxBytes)
+	}
+	mimeType := file.MimeType
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return file, fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data)), nil
+}
+
+// ResolveStoredFileReferences 将请求中引用的网关文件 id 替换为内联的文件内容，
+// 上游渠道无法访问网关保存的文件，因此需要在转发前展开
+func ResolveStoredFileReferences(c *gin.Context, request dto.Request) error {
+	if !system_setting.GetFileSetting().Enabled {
+		return nil
+	}
+	userId := c.GetInt("id")
+	switch req := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		return resolveChatFileReferences(c, userId, req)
+	case *dto.OpenAIResponsesRequest:
+		return resolveResponsesFileReferences(c, userId, req)
+	}
+	return nil
+}
+
+func resolveChatFileReferences(c *gin.Context, userId int, request *dto.GeneralOpenAIRequest) error {
+	for i := range request.Messages {
+		message := &request.Messages[i]
+		if message.IsStringContent() {
+			continue
+		}
+		contents := message.ParseContent()
+		changed := false
+		for j := range contents {
+			if contents[j].Type != dto.ContentTypeFile {
+				continue
+			}
+			messageFile := contents[j].GetFile()
+			if messageFile == nil || messageFile.FileId == "" {
+				continue
+			}
+			file, dataURL, err := loadUserFileAsDataURL(c.Request.Context(), userId, messageFile.FileId)
+			if err != nil {
+				return fmt.Errorf("failed to load file %s: %w", messageFile.FileId, err)
+			}
+			if file == nil {
+				continue
+			}
+			contents[j].File = &dto.MessageFile{
+				FileName: file.Filename,
+				FileData: dataURL,
+			}
+			changed = true
+		}
+		if changed {
+			message.SetMediaContent(contents)
+		}
+	}
+	return nil
+}
+
+func resolveResponsesFileReferences(c *gin.Context, userId int, request *dto.OpenAIResponsesRequest) error {
+	if common.GetJsonType(request.Input) != "array" {
+		return nil
+	}
+	var inputs []map[string]any
+	if err := common.Unmarshal(request.Input, &inputs); err != nil {
+		return nil
+	}
+	changed := false
+	for _, input := range inputs {
+		contents, ok := input["content"].([]any)
+		if !ok {
+			continue
+		}
+		for _, contentAny := range contents {
+			content, ok := contentAny.(map[string]any)
+			if !ok || content["type"] != "input_file" {
+				continue
+			}
+			fileId, _ := content["file_id"].(string)
+			if fileId == "" {
+				continue
+			}
+			file, dataURL, err := loadUserFileAsDataURL(c.Request.Context(), userId, fileId)
+			if err != nil {
+				return fmt.Errorf("failed to load file %s: %w", fileId, err)
+			}
+			if file == nil {
+				continue
+			}
+			delete(content, "file_id")
+			content["filename"] = file.Filename
+			content["file_data"] = dataURL
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	input, err := common.Marshal(inputs)
+	if err != nil {
+		return err
+	}
+	request.Input = input
+	return nil
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GeminiConvertWriter 将 chat 渠道写出的 Chat Completions 响应实时转换为 Gemini generateContent 格式。
+// Gemini 的 functionCall 需要完整的参数对象，流式工具调用在参数拼接成完整 JSON 或下一个调用开始时立即发出；
+// usage 块合并到结束块中
+type GeminiConvertWriter struct {
+	*chatConvertWriter
+	info         *relaycommon.RelayInfo
+	toolCalls    map[int]*dto.ToolCallResponse
+	emitted      map[int]bool
+	finishReason string
+	usage        *dto.Usage
+	finished     bool
+}
+
+func NewGeminiConvertWriter(writer gin.ResponseWriter, info *relaycommon.RelayInfo) *GeminiConvertWriter {
+	w := &GeminiConvertWriter{
+		info:      info,
+		toolCalls: make(map[int]*dto.ToolCallResponse),
+		emitted:   make(map[int]bool),
+	}
+	w.chatConvertWriter = newChatConvertWriter(writer, w.handleStreamData)
+	return w
+}
+
+func (w *GeminiConvertWriter) handleStreamData(data string) {
+	if data == "[DONE]" {
+		w.finishStream()
+		return
+	}
+	var chunk dto.ChatCompletionsStreamResponse
+	if err := common.UnmarshalJsonStr(data, &chunk); err != nil {
+		common.SysLog("failed to parse chat stream chunk for gemini conversion: " + err.Error())
+		return
+	}
+	if chunk.Usage != nil && (chunk.Usage.PromptTokens != 0 || chunk.Usage.CompletionTokens != 0) {
+		w.usage = chunk.Usage
+	}
+	chunk.Usage = nil
+	for i := range chunk.Choices {
+		choice := &chunk.Choices[i]
+		var ready []dto.ToolCallResponse
+		for j, toolCall := range choice.Delta.ToolCalls {
+			index := j
+			if toolCall.Index != nil {
+				index = *toolCall.Index
+			}
+			if w.emitted[index] {
+				continue
+			}
+			// 新的工具调用开始后，之前的调用不会再收到参数分片
+			ready = append(ready, w.takeToolCalls(func(i int) bool { return i < index })...)
+			existing, ok := w.toolCalls[index]
+			if ok {
+				existing.Function.Arguments += toolCall.Function.Arguments
+				if existing.Function.Name == "" {
+					existing.Function.Name = toolCall.Function.Name
+				}
+				if existing.ID == "" {
+					existing.ID = toolCall.ID
+				}
+			} else {
+				call := toolCall
+				existing = &call
+				w.toolCalls[index] = existing
+			}
+			if isCompleteToolArguments(existing.Function.Arguments) {
+				ready = append(ready, w.takeToolCalls(func(i int) bool { return i == index })...)
+			}
+		}
+		choice.Delta.ToolCalls = ready
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			w.finishReason = *choice.FinishReason
+		}
+		choice.FinishReason = nil
+	}
+	w.writeGeminiChunk(&chunk)
+}
+
+// isCompleteToolArguments 判断拼接中的工具参数是否已是完整的 JSON 对象
+func isCompleteToolArguments(arguments string) bool {
+	trimmed := strings.TrimSpace(arguments)
+	return strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed))
+}
+
+// takeToolCalls 按序号顺序取出满足条件的未发出工具调用
+func (w *GeminiConvertWriter) takeToolCalls(match func(index int) bool) []dto.ToolCallResponse {
+	indexes := make([]int, 0, len(w.toolCalls))
+	for index := range w.toolCalls {
+		if match(index) {
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Ints(indexes)
+	toolCalls := make([]dto.ToolCallResponse, 0, len(indexes))
+	for _, index := range indexes {
+		toolCalls = append(toolCalls, *w.toolCalls[index])
+		delete(w.toolCalls, index)
+		w.emitted[index] = true
+	}
+	return toolCalls
+}
+
+// finishStream 发出剩余的工具调用、结束原因与 usage 组成的最后一个 Gemini 响应块
+func (w *GeminiConvertWriter) finishStream() {
+	if w.finished {
+		return
+	}
+	w.finished = true
+	finishReason := w.finishReason
+	if finishReason == "" {
+		finishReason = "stop"
+	}
+	toolCalls := w.takeToolCalls(func(int) bool { return true })
+	chunk := dto.ChatCompletionsStreamResponse{
+		Choices: []dto.ChatCompletionsStreamResponseChoice{{FinishReason: &finishReason}},
+		Usage:   w.usage,
+	}
+	if len(toolCalls) > 0 {
+		chunk.Choices[0].Delta.ToolCalls = toolCalls
+	}
+	w.writeGeminiChunk(&chunk)
+}
+
+func (w *GeminiConvertWriter) writeGeminiChunk(chunk *dto.ChatCompletionsStreamResponse) {
+	geminiResponse := StreamResponseOpenAI2Gemini(chunk, w.info)
+	if geminiResponse == nil {
+		return
+	}
+	data, err := common.Marshal(geminiResponse)
+	if err != nil {
+		common.SysLog("failed to marshal gemini response: " + err.Error())
+		return
+	}
+	w.writeRaw("data: " + string(data) + "\n\n")
+	w.ResponseWriter.Flush()
+}
+
+// Finish 在 chat 处理结束后调用：流式响应补发结束块，非流式响应将缓冲的 chat 结果转换后写出
+func (w *GeminiConvertWriter) Finish() error {
+	if w.stream {
+		w.flushStream()
+		w.finishStream()
+		return nil
+	}
+	var chatResponse dto.OpenAITextResponse
+	if err := common.Unmarshal(w.buffer.Bytes(), &chatResponse); err != nil {
+		return fmt.Errorf("failed to parse chat response: %w", err)
+	}
+	body, err := common.Marshal(ResponseOpenAI2Gemini(&chatResponse, w.info))
+	if err != nil {
+		return err
+	}
+	return w.writeBody(body)
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGeminiToOpenAIRequestMatchesToolCallIds(t *testing.T) {
+	req := &dto.GeminiChatRequest{
+		Contents: []dto.GeminiChatContent{
+			{Role: "user", Parts: []dto.GeminiPart{{Text: "weather in two cities"}}},
+			{Role: "model", Parts: []dto.GeminiPart{
+				{FunctionCall: &dto.FunctionCall{ID: "fc_a", FunctionName: "get_weather", Arguments: map[string]any{"city": "Paris"}}},
+				{FunctionCall: &dto.FunctionCall{ID: "fc_b", FunctionName: "get_weather", Arguments: map[string]any{"city": "Rome"}}},
+			}},
+			// 同名函数的响应顺序与调用顺序不同，按 id 匹配
+			{Role: "user", Parts: []dto.GeminiPart{
+				{FunctionResponse: &dto.GeminiFunctionResponse{ID: json.RawMessage(`"fc_b"`), Name: "get_weather", Response: map[string]any{"temp": 20}}},
+				{FunctionResponse: &dto.GeminiFunctionResponse{ID: json.RawMessage(`"fc_a"`), Name: "get_weather", Response: map[string]any{"temp": 15}}},
+			}},
+			{Role: "model", Parts: []dto.GeminiPart{
+				{FunctionCall: &dto.FunctionCall{FunctionName: "lookup", Arguments: map[string]any{}}},
+				{FunctionCall: &dto.FunctionCall{FunctionName: "search", Arguments: map[string]any{}}},
+			}},
+			// 没有 id 时按上一个模型回合中的调用位置匹配，与函数名无关
+			{Role: "user", Parts: []dto.GeminiPart{
+				{FunctionResponse: &dto.GeminiFunctionResponse{Name: "lookup", Response: map[string]any{}}},
+				{FunctionResponse: &dto.GeminiFunctionResponse{Name: "search", Response: map[string]any{}}},
+			}},
+		},
+	}
+	chatReq, err := GeminiToOpenAIRequest(req, &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{}})
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	var callIds, toolCallIds []string
+	for _, message := range chatReq.Messages {
+		for _, call := range message.ParseToolCalls() {
+			callIds = append(callIds, call.ID)
+		}
+		if message.Role == "tool" {
+			toolCallIds = append(toolCallIds, message.ToolCallId)
+		}
+	}
+	if strings.Join(callIds, ",") != "fc_a,fc_b,call_3,call_4" {
+		t.Fatalf("call ids = %v", callIds)
+	}
+	if strings.Join(toolCallIds, ",") != "fc_b,fc_a,call_3,call_4" {
+		t.Fatalf("tool call ids = %v", toolCallIds)
+	}
+}
+
+func newTestGeminiWriter(t *testing.T) (*GeminiConvertWriter, *httptest.ResponseRecorder) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	return NewGeminiConvertWriter(c.Writer, &relaycommon.RelayInfo{}), recorder
+}
+
+func parseGeminiChunks(t *testing.T, body string) []dto.GeminiChatResponse {
+	t.Helper()
+	var chunks []dto.GeminiChatResponse
+	for _, line := range strings.Split(body, "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var chunk dto.GeminiChatResponse
+		if err := common.UnmarshalJsonStr(data, &chunk); err != nil {
+			t.Fatalf("parse chunk %q: %v", data, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+func TestGeminiConvertWriterStreamsToolCalls(t *testing.T) {
+	writer, recorder := newTestGeminiWriter(t)
+	_, _ = writer.Write([]byte(`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"get_weather","arguments":"{\"city\":"}}]}}]}` + "\n\n"))
+	if body := recorder.Body.String(); body != "" {
+		t.Fatalf("incomplete arguments written: %s", body)
+	}
+	_, _ = writer.Write([]byte(`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}}]}` + "\n\n"))
+	chunks := parseGeminiChunks(t, recorder.Body.String())
+	if len(chunks) != 1 {
+		t.Fatalf("chunks after first call = %d, want 1", len(chunks))
+	}
+	call := chunks[0].Candidates[0].Content.Parts[0].FunctionCall
+	if call == nil || call.ID != "call_a" || call.FunctionName != "get_weather" {
+		t.Fatalf("first call = %+v", call)
+	}
+	if args, _ := call.Arguments.(map[string]any); args["city"] != "Paris" {
+		t.Fatalf("first call args = %v", call.Arguments)
+	}
+
+	// 参数不是完整 JSON 的调用在下一个调用开始时发出
+	_, _ = writer.Write([]byte(`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"noop","arguments":""}}]}}]}` + "\n\n"))
+	_, _ = writer.Write([]byte(`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":2,"id":"call_c","type":"function","function":{"name":"search","arguments":"{\"q\""}}]},"finish_reason":"tool_calls"}]}` + "\n\n"))
+	_, _ = writer.Write([]byte(`data: {"choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}` + "\n\ndata: [DONE]\n\n"))
+	if err := writer.Finish(); err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+	chunks = parseGeminiChunks(t, recorder.Body.String())
+	if len(chunks) != 3 {
+		t.Fatalf("chunks = %d, want 3", len(chunks))
+	}
+	if call := chunks[1].Candidates[0].Content.Parts[0].FunctionCall; call == nil || call.ID != "call_b" {
+		t.Fatalf("second call = %+v", call)
+	}
+	last := chunks[2]
+	if call := last.Candidates[0].Content.Parts[0].FunctionCall; call == nil || call.ID != "call_c" {
+		t.Fatalf("last call = %+v", call)
+	}
+	if last.Candidates[0].FinishReason == nil || *last.Candidates[0].FinishReason != "STOP" || last.UsageMetadata.TotalTokenCount != 5 {
+		t.Fatalf("last chunk = %+v", last)
+	}
+}
+
+func TestGeminiConvertWriterNonStream(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	writer := NewGeminiConvertWriter(c.Writer, &relaycommon.RelayInfo{})
+	_, _ = writer.Write([]byte(`{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"f","arguments":"{\"a\":1}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`))
+	if err := writer.Finish(); err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+	var response dto.GeminiChatResponse
+	if err := common.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if len(response.Candidates) != 1 || len(response.Candidates[0].Content.Parts) != 1 {
+		t.Fatalf("response = %+v", response)
+	}
+	if call := response.Candidates[0].Content.Parts[0].FunctionCall; call == nil || call.ID != "call_1" || call.FunctionName != "f" {
+		t.Fatalf("call = %+v", call)
+	}
+}
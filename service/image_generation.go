@@ -0,0 +1,74 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// imageFilePurpose 生成的图片保存到文件存储时使用的 purpose
+const imageFilePurpose = "vision"
+
+// ImageSizeToAspectRatio 将 OpenAI 的 size 转换为宽高比，直接传入 "16:9" 形式的宽高比时原样返回，无法识别时返回空字符串
+func ImageSizeToAspectRatio(size string) string {
+	size = strings.TrimSpace(size)
+	if strings.Contains(size, ":") {
+		return size
+	}
+	switch size {
+	case "256x256", "512x512", "1024x1024":
+		return "1:1"
+	case "1536x1024":
+		return "3:2"
+	case "1024x1536":
+		return "2:3"
+	case "1024x1792":
+		return "9:16"
+	case "1792x1024":
+		return "16:9"
+	}
+	return ""
+}
+
+// CheckImageResponseFormat 上游只返回 base64 数据，url 格式需要将图片保存到文件存储，未启用文件存储时在请求上游前拒绝
+func CheckImageResponseFormat(request dto.ImageRequest) error {
+	if request.ResponseFormat == "url" && !system_setting.GetFileSetting().Enabled {
+		return types.NewErrorWithStatusCode(errors.New("response_format url is not supported for this model, use b64_json instead"), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	return nil
+}
+
+// BuildImageData 按原始请求的 response_format 组装单张图片；url 格式时将图片保存到文件存储，
+// 返回 /v1/files/{id}/content 地址，使用该用户的令牌即可下载
+func BuildImageData(c *gin.Context, info *relaycommon.RelayInfo, mimeType string, data string) (dto.ImageData, error) {
+	request, ok := info.Request.(*dto.ImageRequest)
+	if !ok || request.ResponseFormat != "url" {
+		return dto.ImageData{B64Json: data}, nil
+	}
+	if err := CheckImageResponseFormat(*request); err != nil {
+		return dto.ImageData{}, err
+	}
+	if mimeType == "" {
+		mimeType = "image/png"
+	}
+	image, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return dto.ImageData{}, fmt.Errorf("decode image failed: %w", err)
+	}
+	filename := "image." + strings.TrimPrefix(mimeType, "image/")
+	file, err := SaveSystemFile(c.Request.Context(), info.UserId, info.TokenId, filename, mimeType, imageFilePurpose, int64(len(image)), bytes.NewReader(image))
+	if err != nil {
+		return dto.ImageData{}, fmt.Errorf("save image failed: %w", err)
+	}
+	return dto.ImageData{Url: fmt.Sprintf("%s/v1/files/%s/content", system_setting.ServerAddress, file.FileId)}, nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newImageTestContext() *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/images/generations", nil)
+	return c
+}
+
+func TestBuildImageDataB64Json(t *testing.T) {
+	info := &relaycommon.RelayInfo{Request: &dto.ImageRequest{Prompt: "a cat"}}
+	imageData, err := BuildImageData(newImageTestContext(), info, "image/png", "aGVsbG8=")
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if imageData.B64Json != "aGVsbG8=" || imageData.Url != "" {
+		t.Fatalf("image data = %+v", imageData)
+	}
+}
+
+func TestBuildImageDataUrlRequiresFileStorage(t *testing.T) {
+	fileSetting := system_setting.GetFileSetting()
+	oldEnabled := fileSetting.Enabled
+	fileSetting.Enabled = false
+	t.Cleanup(func() { fileSetting.Enabled = oldEnabled })
+
+	request := dto.ImageRequest{Prompt: "a cat", ResponseFormat: "url"}
+	err := CheckImageResponseFormat(request)
+	if apiErr, ok := err.(*types.NewAPIError); !ok || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("check error = %v", err)
+	}
+	info := &relaycommon.RelayInfo{Request: &request}
+	if _, err = BuildImageData(newImageTestContext(), info, "image/png", "aGVsbG8="); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestBuildImageDataUrlStoresFile(t *testing.T) {
+	model.SetupTestDB(t, &model.File{}, &model.FileStorageUsage{})
+	fileSetting := system_setting.GetFileSetting()
+	oldSetting := *fileSetting
+	fileSetting.Enabled = true
+	fileSetting.StorageType = "local"
+	fileSetting.LocalPath = t.TempDir()
+	t.Cleanup(func() { *fileSetting = oldSetting })
+
+	info := &relaycommon.RelayInfo{
+		UserId:  7,
+		Request: &dto.ImageRequest{Prompt: "a cat", ResponseFormat: "url"},
+	}
+	imageData, err := BuildImageData(newImageTestContext(), info, "image/webp", "aGVsbG8=")
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if imageData.B64Json != "" || !strings.HasPrefix(imageData.Url, system_setting.ServerAddress+"/v1/files/file-") {
+		t.Fatalf("image data = %+v", imageData)
+	}
+	fileId := strings.TrimSuffix(strings.TrimPrefix(imageData.Url, system_setting.ServerAddress+"/v1/files/"), "/content")
+	file, err := model.GetUserFileByFileId(7, fileId)
+	if err != nil {
+		t.Fatalf("get file: %v", err)
+	}
+	if file.MimeType != "image/webp" || file.Filename != "image.webp" || file.Bytes != 5 {
+		t.Fatalf("file = %+v", file)
+	}
+	reader, err := OpenUserFileContent(newImageTestContext().Request.Context(), file)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer reader.Close()
+	if content, _ := io.ReadAll(reader); string(content) != "hello" {
+		t.Fatalf("content = %q", content)
+	}
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"sort"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/shopspring/decimal"
+)
+
+// QuotaToCurrency 按额度展示设置将额度换算为货币金额，以 tokens 展示时按美元计算
+func QuotaToCurrency(quota int64) (float64, string) {
+	usd := float64(quota) / common.QuotaPerUnit
+	currency := "USD"
+	switch operation_setting.GetQuotaDisplayType() {
+	case operation_setting.QuotaDisplayTypeCNY:
+		currency = "CNY"
+	case operation_setting.QuotaDisplayTypeCustom:
+		currency = operation_setting.GetCurrencySymbol()
+	}
+	return usd * operation_setting.GetUsdToCurrencyRate(operation_setting.USDExchangeRate), currency
+}
+
+func roundMoney(v float64) float64 {
+	return decimal.NewFromFloat(v).Round(2).InexactFloat64()
+}
+
+// GetInvoicePeriod 返回某月账期的起止时间，按服务器时区计算
+func GetInvoicePeriod(year int, month time.Month) (int64, int64) {
+	start := time.Date(year, month, 1, 0, 0, 0, 0, time.Local)
+	return start.Unix(), start.AddDate(0, 1, 0).Unix()
+}
+
+// GenerateInvoice 汇总用户某月的充值、兑换、退款与消费，生成账单
+func GenerateInvoice(userId int, year int, month time.Month) (*model.Invoice, error) {
+	periodStart, periodEnd := GetInvoicePeriod(year, month)
+	if periodEnd > time.Now().Unix() {
+		return nil, errors.New("账期尚未结束")
+	}
+	if _, err := model.GetInvoiceByPeriod(userId, periodStart); err == nil {
+		return nil, errors.New("该账期的账单已生成")
+	}
+	// 已归档的消费与退款日志不在数据库中，需要先恢复归档
+	archived, err := model.HasArchivedLogsInRange([]int{model.LogTypeConsume, model.LogTypeRefund}, periodStart, periodEnd)
+	if err != nil {
+		return nil, err
+	}
+	if archived {
+		return nil, errors.New("该账期的日志已归档，请先恢复归档后再生成账单")
+	}
+	setting := operation_setting.GetInvoiceSetting()
+	invoice := &model.Invoice{
+		UserId:      userId,
+		PeriodStart: periodStart,
+		PeriodEnd:   periodEnd,
+		TaxRate:     setting.TaxRate,
+	}
+	if invoice.TopUpCount, invoice.TopUpMoney, err = model.GetTopUpStats(userId, periodStart, periodEnd); err != nil {
+		return nil, err
+	}
+	if invoice.RedemptionCount, invoice.RedemptionQuota, err = model.GetRedemptionStats(userId, periodStart, periodEnd); err != nil {
+		return nil, err
+	}
+	if invoice.RefundQuota, err = model.SumUserLogQuota(userId, model.LogTypeRefund, periodStart, periodEnd); err != nil {
+		return nil, err
+	}
+	summaries, err := model.GetLogUsageSummary(&model.LogExportFilter{
+		UserId:         userId,
+		LogType:        model.LogTypeConsume,
+		StartTimestamp: periodStart,
+		EndTimestamp:   periodEnd - 1,
+		PersonalOnly:   true,
+	}, []string{model.ExportGroupModel})
+	if err != nil {
+		return nil, err
+	}
+	items := make([]model.InvoiceItem, 0, len(summaries))
+	for _, summary := range summaries {
+		amount, _ := QuotaToCurrency(summary.Quota)
+		items = append(items, model.InvoiceItem{
+			ModelName:        summary.ModelName,
+			Count:            summary.Count,
+			PromptTokens:     summary.PromptTokens,
+			CompletionTokens: summary.CompletionTokens,
+			Quota:            summary.Quota,
+			Amount:           roundMoney(amount),
+		})
+		invoice.ConsumeCount += summary.Count
+		invoice.ConsumeQuota += summary.Quota
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Quota > items[j].Quota
+	})
+	itemsJson, err := common.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	invoice.Items = string(itemsJson)
+
+	// 退款从消费中扣除后计税
+	subtotal, currency := QuotaToCurrency(max(invoice.ConsumeQuota-invoice.RefundQuota, 0))
+	invoice.Currency = currency
+	invoice.Subtotal = roundMoney(subtotal)
+	invoice.Tax = roundMoney(invoice.Subtotal * setting.TaxRate / 100)
+	invoice.Total = roundMoney(invoice.Subtotal + invoice.Tax)
+	if err = invoice.Insert(setting.NumberPrefix); err != nil {
+		return nil, err
+	}
+	if setting.SendEmail {
+		if err = SendInvoiceEmail(invoice); err != nil {
+			common.SysError(fmt.Sprintf("failed to send invoice %s: %s", invoice.Number, err.Error()))
+		}
+	}
+	return invoice, nil
+}
+
+// GenerateMonthlyInvoices 为某月有账目的用户生成账单，已生成的跳过
+func GenerateMonthlyInvoices(year int, month time.Month) (int, error) {
+	periodStart, periodEnd := GetInvoicePeriod(year, month)
+	userIds, err := model.GetBillableUserIds(periodStart, periodEnd)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, userId := range userIds {
+		if _, err = model.GetInvoiceByPeriod(userId, periodStart); err == nil {
+			continue
+		}
+		if _, err = GenerateInvoice(userId, year, month); err != nil {
+			common.SysError(fmt.Sprintf("failed to generate invoice for user %d: %s", userId, err.Error()))
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// InvoiceTask 每月初为上月生成账单
+func InvoiceTask() {
+	lastPeriod := int64(0)
+	for {
+		setting := operation_setting.GetInvoiceSetting()
+		if setting.Enabled && setting.AutoGenerate {
+			lastMonth := time.Now().AddDate(0, -1, 0)
+			periodStart, _ := GetInvoicePeriod(lastMonth.Year(), lastMonth.Month())
+			if periodStart != lastPeriod {
+				n, err := GenerateMonthlyInvoices(lastMonth.Year(), lastMonth.Month())
+				if err != nil {
+					common.SysError("failed to generate invoices: " + err.Error())
+				} else {
+					lastPeriod = periodStart
+					if n > 0 {
+						common.SysLog(fmt.Sprintf("generated %d invoices for %s", n, lastMonth.Format("2006-01")))
+					}
+				}
+			}
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+type invoiceView struct {
+	*model.Invoice
+	Setting      *operation_setting.InvoiceSetting
+	SystemName   string
+	Username     string
+	Email        string
+	Period       string
+	CreatedDate  string
+	Items        []model.InvoiceItem
+	RedeemAmount float64
+	RefundAmount float64
+}
+
+func newInvoiceView(invoice *model.Invoice) (*invoiceView, error) {
+	user, err := model.GetUserById(invoice.UserId, false)
+	if err != nil {
+		return nil, err
+	}
+	view := &invoiceView{
+		Invoice:     invoice,
+		Setting:     operation_setting.GetInvoiceSetting(),
+		SystemName:  common.SystemName,
+		Username:    user.Username,
+		Email:       user.Email,
+		Period:      time.Unix(invoice.PeriodStart, 0).Format("2006-01"),
+		CreatedDate: time.Unix(invoice.CreatedAt, 0).Format("2006-01-02"),
+		Items:       invoice.GetItems(),
+	}
+	redeemAmount, _ := QuotaToCurrency(invoice.RedemptionQuota)
+	refundAmount, _ := QuotaToCurrency(invoice.RefundQuota)
+	view.RedeemAmount = roundMoney(redeemAmount)
+	view.RefundAmount = roundMoney(refundAmount)
+	return view, nil
+}
+
+var invoiceTemplate = template.Must(template.New("invoice").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Number}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", "PingFang SC", "Microsoft YaHei", sans-serif; color: #222; max-width: 800px; margin: 24px auto; padding: 0 16px; }
+h1 { font-size: 22px; margin-bottom: 4px; }
+table { width: 100%; border-collapse: collapse; margin: 16px 0; }
+th, td { border-bottom: 1px solid #e5e5e5; padding: 6px 8px; text-align: left; font-size: 13px; }
+td.num, th.num { text-align: right; }
+.muted { color: #666; font-size: 13px; }
+.header { display: flex; justify-content: space-between; }
+.total td { font-weight: bold; }
+</style>
+</head>
+<body>
+<div class="header">
+<div>
+<h1>{{if .Setting.CompanyName}}{{.Setting.CompanyName}}{{else}}{{.SystemName}}{{end}}</h1>
+{{if .Setting.CompanyAddress}}<div class="muted">{{.Setting.CompanyAddress}}</div>{{end}}
+{{if .Setting.CompanyTaxId}}<div class="muted">税号：{{.Setting.CompanyTaxId}}</div>{{end}}
+{{if .Setting.CompanyEmail}}<div class="muted">{{.Setting.CompanyEmail}}</div>{{end}}
+</div>
+<div class="muted">
+<div>账单编号：{{.Number}}</div>
+<div>账期：{{.Period}}</div>
+<div>开具日期：{{.CreatedDate}}</div>
+<div>用户：{{.Username}}{{if .Email}}（{{.Email}}）{{end}}</div>
+</div>
+</div>
+
+<table>
+<tr><th>模型</th><th class="num">请求数</th><th class="num">输入 tokens</th><th class="num">输出 tokens</th><th class="num">金额（{{.Currency}}）</th></tr>
+{{range .Items}}<tr><td>{{.ModelName}}</td><td class="num">{{.Count}}</td><td class="num">{{.PromptTokens}}</td><td class="num">{{.CompletionTokens}}</td><td class="num">{{printf "%.2f" .Amount}}</td></tr>
+{{else}}<tr><td colspan="5" class="muted">本期无消费</td></tr>
+{{end}}
+</table>
+
+<table>
+<tr><td>退款</td><td class="num">-{{printf "%.2f" .RefundAmount}}</td></tr>
+<tr><td>小计</td><td class="num">{{printf "%.2f" .Subtotal}}</td></tr>
+<tr><td>税额（{{.TaxRate}}%）</td><td class="num">{{printf "%.2f" .Tax}}</td></tr>
+<tr class="total"><td>合计（{{.Currency}}）</td><td class="num">{{printf "%.2f" .Total}}</td></tr>
+</table>
+
+<table>
+<tr><th>充值</th><th class="num">笔数</th><th class="num">金额</th></tr>
+<tr><td>在线充值</td><td class="num">{{.TopUpCount}}</td><td class="num">{{printf "%.2f" .TopUpMoney}}</td></tr>
+<tr><td>兑换码</td><td class="num">{{.RedemptionCount}}</td><td class="num">{{printf "%.2f" .RedeemAmount}}</td></tr>
+</table>
+
+{{if .Setting.Footer}}<p class="muted">{{.Setting.Footer}}</p>{{end}}
+</body>
+</html>
+`))
+
+// RenderInvoiceHTML 生成账单的 HTML
+func RenderInvoiceHTML(invoice *model.Invoice) (string, error) {
+	view, err := newInvoiceView(invoice)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err = invoiceTemplate.Execute(&buf, view); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// SendInvoiceEmail 将账单发送到用户的通知邮箱或账户邮箱
+func SendInvoiceEmail(invoice *model.Invoice) error {
+	user, err := model.GetUserById(invoice.UserId, false)
+	if err != nil {
+		return err
+	}
+	email := user.GetSetting().NotificationEmail
+	if email == "" {
+		email = user.Email
+	}
+	if email == "" {
+		return errors.New("用户未设置邮箱")
+	}
+	content, err := RenderInvoiceHTML(invoice)
+	if err != nil {
+		return err
+	}
+	subject := fmt.Sprintf("%s %s 账单", common.SystemName, time.Unix(invoice.PeriodStart, 0).Format("2006-01"))
+	if err = common.SendEmail(subject, email, content); err != nil {
+		return err
+	}
+	return model.MarkInvoiceEmailSent(invoice.Id)
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// RenderInvoicePDF 生成账单的 PDF，未配置字体时使用内置字体，中文等非拉丁字符无法显示
+func RenderInvoicePDF(invoice *model.Invoice) ([]byte, error) {
+	view, err := newInvoiceView(invoice)
+	if err != nil {
+		return nil, err
+	}
+	pdf := fpdf.New("P", "mm", "A4", "")
+	family := "Helvetica"
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	if view.Setting.PdfFontPath != "" {
+		family = "invoice"
+		pdf.AddUTF8Font(family, "", view.Setting.PdfFontPath)
+		if pdf.Err() {
+			return nil, fmt.Errorf("failed to load invoice font: %w", pdf.Error())
+		}
+		tr = func(s string) string { return s }
+	}
+	pdf.AddPage()
+
+	title := view.SystemName
+	if view.Setting.CompanyName != "" {
+		title = view.Setting.CompanyName
+	}
+	pdf.SetFont(family, "", 18)
+	pdf.CellFormat(0, 10, tr(title), "", 1, "L", false, 0, "")
+	pdf.SetFont(family, "", 10)
+	for _, line := range []string{view.Setting.CompanyAddress, view.Setting.CompanyTaxId, view.Setting.CompanyEmail} {
+		if line != "" {
+			pdf.CellFormat(0, 5, tr(line), "", 1, "L", false, 0, "")
+		}
+	}
+	pdf.Ln(4)
+	for _, line := range []string{
+		"Invoice No.: " + view.Number,
+		"Period: " + view.Period,
+		"Date: " + view.CreatedDate,
+		"Customer: " + view.Username + " " + view.Email,
+	} {
+		pdf.CellFormat(0, 5, tr(line), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	widths := []float64{70, 25, 30, 30, 35}
+	header := []string{"Model", "Requests", "Input tokens", "Output tokens", "Amount (" + view.Currency + ")"}
+	for i, text := range header {
+		pdf.CellFormat(widths[i], 7, tr(text), "B", 0, "L", false, 0, "")
+	}
+	pdf.Ln(-1)
+	for _, item := range view.Items {
+		pdf.CellFormat(widths[0], 6, tr(item.ModelName), "", 0, "L", false, 0, "")
+		pdf.CellFormat(widths[1], 6, fmt.Sprint(item.Count), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[2], 6, fmt.Sprint(item.PromptTokens), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[3], 6, fmt.Sprint(item.CompletionTokens), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[4], 6, fmt.Sprintf("%.2f", item.Amount), "", 1, "R", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	summary := [][2]string{
+		{"Refunds", fmt.Sprintf("-%.2f", view.RefundAmount)},
+		{"Subtotal", fmt.Sprintf("%.2f", view.Subtotal)},
+		{fmt.Sprintf("Tax (%g%%)", view.TaxRate), fmt.Sprintf("%.2f", view.Tax)},
+		{"Total (" + view.Currency + ")", fmt.Sprintf("%.2f", view.Total)},
+	}
+	for _, row := range summary {
+		pdf.CellFormat(155, 6, tr(row[0]), "", 0, "R", false, 0, "")
+		pdf.CellFormat(35, 6, row[1], "", 1, "R", false, 0, "")
+	}
+	pdf.Ln(4)
+	pdf.CellFormat(0, 6, fmt.Sprintf("Top-ups: %d, paid %.2f", view.TopUpCount, view.TopUpMoney), "", 1, "L", false, 0, "")
+	pdf.CellFormat(0, 6, fmt.Sprintf("Redemptions: %d, %.2f %s", view.RedemptionCount, view.RedeemAmount, tr(view.Currency)), "", 1, "L", false, 0, "")
+	if view.Setting.Footer != "" {
+		pdf.Ln(6)
+		pdf.MultiCell(0, 5, tr(view.Setting.Footer), "", "L", false)
+	}
+
+	var buf bytes.Buffer
+	if err = pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// 归档文件在对象存储中的路径前缀
+const logArchiveKeyPrefix = "logs/"
+
+// getLogArchiveStorage 返回归档使用的对象存储，s3 与文件存储共用 file_setting 中的 S3 配置
+func getLogArchiveStorage(storage string) (ObjectStorage, error) {
+	switch storage {
+	case operation_setting.LogArchiveStorageLocal:
+		localDir := operation_setting.GetLogArchiveSetting().LocalDir
+		if localDir == "" {
+			return nil, errors.New("未配置日志归档目录")
+		}
+		return NewObjectStorage(ObjectStorageConfig{Type: ObjectStorageTypeLocal, LocalPath: localDir})
+	case operation_setting.LogArchiveStorageS3:
+		config := fileObjectStorageConfig()
+		config.Type = ObjectStorageTypeS3
+		return NewObjectStorage(config)
+	default:
+		return nil, fmt.Errorf("不支持的日志归档存储方式：%s", storage)
+	}
+}
+
+var logArchiveRunning atomic.Bool
+
+// RunLogArchive 将超过保留期的日志分批导出到归档存储，导出成功后再从数据库删除
+func RunLogArchive(ctx context.Context) (int, error) {
+	if !logArchiveRunning.CompareAndSwap(false, true) {
+		return 0, errors.New("日志归档正在进行中")
+	}
+	defer logArchiveRunning.Store(false)
+
+	setting := operation_setting.GetLogArchiveSetting()
+	restored, err := expireRestoredLogs(setting.RestoreKeepDays)
+	if err != nil {
+		return 0, err
+	}
+	storage, err := getLogArchiveStorage(setting.Storage)
+	if err != nil {
+		return 0, err
+	}
+	batchSize := setting.BatchSize
+	if batchSize <= 0 {
+		batchSize = 10000
+	}
+	total := 0
+	for logType, name := range model.LogTypeNames {
+		days := setting.GetRetentionDays(name)
+		if days <= 0 {
+			continue
+		}
+		before := time.Now().AddDate(0, 0, -days).Unix()
+		lastId := 0
+		for {
+			if ctx.Err() != nil {
+				return total, ctx.Err()
+			}
+			logs, err := model.GetLogsForArchive(logType, before, lastId, batchSize, restored)
+			if err != nil {
+				return total, err
+			}
+			if len(logs) == 0 {
+				break
+			}
+			if err = archiveLogs(ctx, storage, setting.Storage, logType, logs); err != nil {
+				return total, err
+			}
+			total += len(logs)
+			lastId = logs[len(logs)-1].Id
+			if len(logs) < batchSize {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+func archiveLogs(ctx context.Context, storage ObjectStorage, storageName string, logType int, logs []*model.Log) error {
+	ids := make([]int, 0, len(logs))
+	archive := &model.LogArchive{
+		LogType:   logType,
+		FirstId:   logs[0].Id,
+		LastId:    logs[len(logs)-1].Id,
+		StartTime: logs[0].CreatedAt,
+		EndTime:   logs[0].CreatedAt,
+		Count:     len(logs),
+		Storage:   storageName,
+	}
+	for _, log := range logs {
+		ids = append(ids, log.Id)
+		archive.StartTime = min(archive.StartTime, log.CreatedAt)
+		archive.EndTime = max(archive.EndTime, log.CreatedAt)
+	}
+	data, err := encodeJSONLArchive(logs)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s%s/%s/%d-%d.jsonl.gz", logArchiveKeyPrefix, model.LogTypeNames[logType],
+		time.Unix(archive.StartTime, 0).Format("2006-01-02"), archive.FirstId, archive.LastId)
+	if err = storage.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "application/gzip"); err != nil {
+		return fmt.Errorf("failed to upload log archive %s: %w", key, err)
+	}
+	archive.Location = key
+	archive.Size = int64(len(data))
+	if err = archive.Insert(); err != nil {
+		return err
+	}
+	return model.DeleteLogsByIds(ids)
+}
+
+func encodeJSONLArchive(logs []*model.Log) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	for _, log := range logs {
+		line, err := common.Marshal(log)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = gz.Write(append(line, '\n')); err != nil {
+			return nil, err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeJSONLArchive(data io.Reader, count int) ([]*model.Log, error) {
+	gz, err := gzip.NewReader(data)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	logs := make([]*model.Log, 0, count)
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var log model.Log
+		if err = common.UnmarshalJsonStr(line, &log); err != nil {
+			return nil, err
+		}
+		logs = append(logs, &log)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// expireRestoredLogs 删除恢复期已过的日志，返回仍在恢复期内的归档
+func expireRestoredLogs(keepDays int) ([]*model.LogArchive, error) {
+	archives, err := model.GetRestoredLogArchives()
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().AddDate(0, 0, -keepDays).Unix()
+	kept := make([]*model.LogArchive, 0, len(archives))
+	for _, archive := range archives {
+		if archive.RestoredAt >= deadline {
+			kept = append(kept, archive)
+			continue
+		}
+		if err = model.ExpireRestoredLogs(archive); err != nil {
+			return nil, err
+		}
+	}
+	return kept, nil
+}
+
+// RestoreLogArchive 将归档文件中的日志写回数据库，供临时查询
+func RestoreLogArchive(ctx context.Context, id int) (int, error) {
+	archive, err := model.GetLogArchiveById(id)
+	if err != nil {
+		return 0, err
+	}
+	storage, err := getLogArchiveStorage(archive.Storage)
+	if err != nil {
+		return 0, err
+	}
+	reader, err := storage.Get(ctx, archive.Location)
+	if err != nil {
+		return 0, fmt.Errorf("failed to download log archive: %w", err)
+	}
+	defer reader.Close()
+	logs, err := decodeJSONLArchive(reader, archive.Count)
+	if err != nil {
+		return 0, err
+	}
+	if err = model.RestoreArchivedLogs(archive, logs); err != nil {
+		return 0, err
+	}
+	return len(logs), nil
+}
+
+// LogArchiveTask 每小时执行一次日志归档
+func LogArchiveTask() {
+	for {
+		if operation_setting.GetLogArchiveSetting().Enabled {
+			n, err := RunLogArchive(context.Background())
+			if err != nil {
+				common.SysError("failed to archive logs: " + err.Error())
+			}
+			if n > 0 {
+				common.SysLog(fmt.Sprintf("archived %d logs", n))
+			}
+		}
+		time.Sleep(time.Hour)
+	}
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+)
+
+func TestJSONLArchiveRoundTrip(t *testing.T) {
+	logs := []*model.Log{
+		{Id: 1, UserId: 1, Type: model.LogTypeConsume, Content: "a", Quota: 10, CreatedAt: 100},
+		{Id: 2, UserId: 2, Type: model.LogTypeConsume, Content: "b\nc", Quota: 20, CreatedAt: 200},
+	}
+	data, err := encodeJSONLArchive(logs)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	decoded, err := decodeJSONLArchive(bytes.NewReader(data), len(logs))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(decoded) != 2 || decoded[1].Content != "b\nc" || decoded[1].Quota != 20 || decoded[0].CreatedAt != 100 {
+		t.Fatalf("decoded = %+v", decoded)
+	}
+}
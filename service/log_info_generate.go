@@ -50,6 +50,15 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
 
+	if batchId := common.GetContextKeyString(ctx, constant.ContextKeyBatchId); batchId != "" {
+		other["batch_id"] = batchId
+		other["batch_ratio"] = relayInfo.PriceData.OtherRatios[types.OtherRatioBatch]
+	}
+
+	if common.GetContextKeyBool(ctx, constant.ContextKeyResponseCacheHit) {
+		other["response_cache_hit"] = true
+	}
+
 	isSystemPromptOverwritten := common.GetContextKeyBool(ctx, constant.ContextKeySystemPromptOverride)
 	if isSystemPromptOverwritten {
 		other["is_system_prompt_overwritten"] = true
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/metrics"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 队列深度需要查询数据库，缓存一段时间避免频繁采集给数据库带来压力
+const queueDepthCacheDuration = 10 * time.Second
+
+type queueDepthCollector struct {
+	desc *prometheus.Desc
+
+	mu        sync.Mutex
+	updatedAt time.Time
+	depths    map[string]int64
+}
+
+func init() {
+	metrics.MustRegister(&queueDepthCollector{
+		desc: prometheus.NewDesc("newapi_task_queue_depth", "Unfinished async tasks, midjourney tasks and batches.", []string{"queue"}, nil),
+	})
+}
+
+func (q *queueDepthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- q.desc
+}
+
+func (q *queueDepthCollector) Collect(ch chan<- prometheus.Metric) {
+	for queue, depth := range q.getDepths() {
+		ch <- prometheus.MustNewConstMetric(q.desc, prometheus.GaugeValue, float64(depth), queue)
+	}
+}
+
+func (q *queueDepthCollector) getDepths() map[string]int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.depths != nil && time.Since(q.updatedAt) < queueDepthCacheDuration {
+		return q.depths
+	}
+	if model.DB == nil {
+		return nil
+	}
+	depths, err := model.CountUnfinishedTasksByPlatform()
+	if err != nil {
+		common.SysError("failed to count unfinished tasks: " + err.Error())
+		depths = make(map[string]int64)
+	}
+	if count, err := model.CountUnfinishedMidjourneyTasks(); err == nil {
+		depths["midjourney"] = count
+	}
+	if count, err := model.CountUnfinishedBatches(); err == nil {
+		depths["batch"] = count
+	}
+	q.depths = depths
+	q.updatedAt = time.Now()
+	return depths
+}
+
+// RecordConsumeMetrics 记录请求结算后的额度与 token 消耗，与是否开启消费日志无关
+func RecordConsumeMetrics(relayInfo *relaycommon.RelayInfo, modelName string, quota int, promptTokens int, completionTokens int) {
+	metrics.RecordConsume(modelName, relayInfo.UsingGroup, relayInfo.ChannelId, quota, promptTokens, completionTokens)
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+const (
+	ObjectStorageTypeLocal = "local"
+	ObjectStorageTypeS3    = "s3"
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStorage 对象存储，本地磁盘和 S3 兼容存储实现相同的接口
+type ObjectStorage interface {
+	Put(ctx context.Context, key string, data io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// ObjectStorageConfig 对象存储配置
+type ObjectStorageConfig struct {
+	Type              string `json:"type"` // local / s3
+	LocalPath         string `json:"local_path"`
+	S3Endpoint        string `json:"s3_endpoint"`
+	S3Region          string `json:"s3_region"`
+	S3Bucket          string `json:"s3_bucket"`
+	S3AccessKeyId     string `json:"s3_access_key_id"`
+	S3SecretAccessKey string `json:"s3_secret_access_key"`
+	S3PathStyle       bool   `json:"s3_path_style"` // MinIO 等需要使用 path style
+}
+
+func NewObjectStorage(config ObjectStorageConfig) (ObjectStorage, error) {
+	switch config.Type {
+	case ObjectStorageTypeS3:
+		if config.S3Bucket == "" || config.S3Endpoint == "" {
+			return nil, errors.New("s3 endpoint and bucket are required")
+		}
+		region := config.S3Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		return &s3ObjectStorage{
+			endpoint:  strings.TrimSuffix(config.S3Endpoint, "/"),
+			region:    region,
+			bucket:    config.S3Bucket,
+			pathStyle: config.S3PathStyle,
+			credentials: aws.Credentials{
+				AccessKeyID:     config.S3AccessKeyId,
+				SecretAccessKey: config.S3SecretAccessKey,
+			},
+			signer: v4.NewSigner(),
+		}, nil
+	case ObjectStorageTypeLocal, "":
+		if config.LocalPath == "" {
+			return nil, errors.New("local storage path is required")
+		}
+		return &localObjectStorage{root: config.LocalPath}, nil
+	default:
+		return nil, fmt.Errorf("unsupported object storage type: %s", config.Type)
+	}
+}
+
+type localObjectStorage struct {
+	root string
+}
+
+func (s *localObjectStorage) path(key string) (string, error) {
+	cleaned := filepath.Clean("/" + key)
+	if cleaned == "/" {
+		return "", errors.New("invalid object key")
+	}
+	return filepath.Join(s.root, cleaned), nil
+}
+
+func (s *localObjectStorage) Put(ctx context.Context, key string, data io.Reader, size int64, contentType string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err = f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func (s *localObjectStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrObjectNotFound
+	}
+	return f, err
+}
+
+func (s *localObjectStorage) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// s3ObjectStorage S3 兼容存储，直接使用 SigV4 签名的 HTTP 请求，避免引入完整的 S3 SDK
+type s3ObjectStorage struct {
+	endpoint    string
+	region      string
+	bucket      string
+	pathStyle   bool
+	credentials aws.Credentials
+	signer      *v4.Signer
+}
+
+func (s *s3ObjectStorage) objectURL(key string) (string, error) {
+	u, err := url.Parse(s.endpoint)
+	if err != nil {
+		return "", err
+	}
+	escapedKey := (&url.URL{Path: strings.TrimPrefix(key, "/")}).EscapedPath()
+	if s.pathStyle {
+		u.Path = "/" + s.bucket + "/" + escapedKey
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = "/" + escapedKey
+	}
+	return u.String(), nil
+}
+
+func (s *s3ObjectStorage) do(ctx context.Context, method string, key string, body io.Reader, size int64, contentType string) (*http.Response, error) {
+	objectURL, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, objectURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	const payloadHash = "UNSIGNED-PAYLOAD"
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if err = s.signer.SignHTTP(ctx, s.credentials, req, payloadHash, "s3", s.region, time.Now()); err != nil {
+		return nil, err
+	}
+	return GetHttpClient().Do(req)
+}
+
+func s3ResponseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 request failed with status %d: %s", resp.StatusCode, string(body))
+}
+
+func (s *s3ObjectStorage) Put(ctx context.Context, key string, data io.Reader, size int64, contentType string) error {
+	resp, err := s.do(ctx, http.MethodPut, key, data, size, contentType)
+	if err != nil {
+		return err
+	}
+	defer CloseResponseBodyGracefully(resp)
+	if resp.StatusCode/100 != 2 {
+		return s3ResponseError(resp)
+	}
+	return nil
+}
+
+func (s *s3ObjectStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		CloseResponseBodyGracefully(resp)
+		return nil, ErrObjectNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		defer CloseResponseBodyGracefully(resp)
+		return nil, s3ResponseError(resp)
+	}
+	return resp.Body, nil
+}
+
+func (s *s3ObjectStorage) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	defer CloseResponseBodyGracefully(resp)
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return s3ResponseError(resp)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
+
+// GetBillingQuota 返回请求可用的额度，后付费用户包含可透支额度，组织令牌取组织额度池余额与成员剩余上限中的较小值
+func GetBillingQuota(relayInfo *relaycommon.RelayInfo) (int, error) {
+	if relayInfo.OrganizationId == 0 {
+		return model.GetUserAvailableQuota(relayInfo.UserId)
+	}
+	org, err := model.GetOrganizationById(relayInfo.OrganizationId)
+	if err != nil {
+		return 0, err
+	}
+	member, err := model.GetOrganizationMember(relayInfo.OrganizationId, relayInfo.UserId)
+	if err != nil {
+		return 0, err
+	}
+	quota := org.Quota
+	if remain := member.RemainQuota(); remain >= 0 && remain < quota {
+		quota = remain
+	}
+	return quota, nil
+}
+
+// decreaseBillingQuota 扣除用户额度，组织令牌扣除组织额度池
+func decreaseBillingQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
+	return model.DecreaseBillingQuota(relayInfo.OrganizationId, relayInfo.UserId, quota)
+}
+
+// increaseBillingQuota 返还用户额度，组织令牌返还组织额度池
+func increaseBillingQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
+	return model.IncreaseBillingQuota(relayInfo.OrganizationId, relayInfo.UserId, quota)
+}
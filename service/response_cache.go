@@ -0,0 +1,298 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+)
+
+const responseCacheRedisPrefix = "response_cache:"
+
+// isDeterministicRequest temperature 为 0、只生成一个结果且没有使用白名单外工具的请求才认为结果可以复用
+func isDeterministicRequest(request *dto.GeneralOpenAIRequest, allowedTools []string) bool {
+	if request.Temperature == nil || *request.Temperature != 0 {
+		return false
+	}
+	if request.N > 1 {
+		return false
+	}
+	for _, tool := range request.Tools {
+		name := tool.Function.Name
+		if name == "" {
+			name = tool.Type
+		}
+		if !lo.Contains(allowedTools, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetResponseCacheKey 返回请求的缓存 key，未开启缓存或请求不可缓存时返回空字符串
+func GetResponseCacheKey(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) string {
+	setting := operation_setting.GetResponseCacheSetting()
+	if !setting.Enabled || setting.TTLSeconds <= 0 {
+		return ""
+	}
+	if info.RelayFormat != types.RelayFormatOpenAI || info.RelayMode != relayconstant.RelayModeChatCompletions {
+		return ""
+	}
+	if !common.GetContextKeyBool(c, constant.ContextKeyTokenResponseCache) && !setting.IsGroupEnabled(info.UsingGroup) {
+		return ""
+	}
+	if !isDeterministicRequest(request, setting.AllowedTools) {
+		return ""
+	}
+	// 流式与非流式共用同一份缓存
+	normalized := *request
+	normalized.Stream = false
+	normalized.StreamOptions = nil
+	normalized.User = ""
+	normalized.Model = info.OriginModelName
+	data, err := common.Marshal(&normalized)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d|%s|", info.UserId, info.UsingGroup) + string(data)))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetResponseCache 读取缓存的完整 chat completion 响应
+func GetResponseCache(cacheKey string) (*dto.OpenAITextResponse, bool) {
+	var data []byte
+	if common.RedisEnabled {
+		value, err := common.RedisGet(responseCacheRedisPrefix + cacheKey)
+		if err != nil || value == "" {
+			return nil, false
+		}
+		data = []byte(value)
+	} else {
+		cache, err := model.GetResponseCache(cacheKey)
+		if err != nil {
+			return nil, false
+		}
+		data = cache.Response
+	}
+	var response dto.OpenAITextResponse
+	if err := common.Unmarshal(data, &response); err != nil {
+		return nil, false
+	}
+	return &response, true
+}
+
+func saveResponseCache(cacheKey string, response *dto.OpenAITextResponse) {
+	setting := operation_setting.GetResponseCacheSetting()
+	data, err := common.Marshal(response)
+	if err != nil {
+		return
+	}
+	if setting.MaxResponseBytes > 0 && len(data) > setting.MaxResponseBytes {
+		return
+	}
+	ttl := time.Duration(setting.TTLSeconds) * time.Second
+	gopool.Go(func() {
+		if common.RedisEnabled {
+			err = common.RedisSet(responseCacheRedisPrefix+cacheKey, string(data), ttl)
+		} else {
+			now := common.GetTimestamp()
+			err = model.SaveResponseCache(&model.ResponseCache{
+				CacheKey:  cacheKey,
+				Response:  data,
+				CreatedAt: now,
+				ExpiresAt: now + int64(setting.TTLSeconds),
+			})
+		}
+		if err != nil {
+			common.SysError("failed to save response cache: " + err.Error())
+		}
+	})
+}
+
+// ResponseCaptureWriter 在写给客户端的同时记录响应内容，超过上限后停止记录
+type ResponseCaptureWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func NewResponseCaptureWriter(writer gin.ResponseWriter) *ResponseCaptureWriter {
+	return &ResponseCaptureWriter{
+		ResponseWriter: writer,
+		// 流式响应的 chunk 开销较大，记录上限放宽到缓存上限的数倍
+		limit: operation_setting.GetResponseCacheSetting().MaxResponseBytes * 4,
+	}
+}
+
+func (w *ResponseCaptureWriter) capture(data []byte) {
+	if w.overflow {
+		return
+	}
+	if w.limit > 0 && w.body.Len()+len(data) > w.limit {
+		w.overflow = true
+		w.body.Reset()
+		return
+	}
+	w.body.Write(data)
+}
+
+func (w *ResponseCaptureWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *ResponseCaptureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// streamToTextResponse 将流式 chunk 合并为完整的 chat completion 响应
+func streamToTextResponse(body []byte) (*dto.OpenAITextResponse, error) {
+	response := &dto.OpenAITextResponse{Object: "chat.completion"}
+	type choiceState struct {
+		content   strings.Builder
+		reasoning strings.Builder
+		toolCalls []dto.ToolCallResponse
+		finish    string
+	}
+	choices := make(map[int]*choiceState)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		var chunk dto.ChatCompletionsStreamResponse
+		if err := common.UnmarshalJsonStr(data, &chunk); err != nil {
+			return nil, err
+		}
+		if response.Id == "" {
+			response.Id = chunk.Id
+			response.Model = chunk.Model
+			response.Created = chunk.Created
+		}
+		for _, choice := range chunk.Choices {
+			state, ok := choices[choice.Index]
+			if !ok {
+				state = &choiceState{}
+				choices[choice.Index] = state
+			}
+			if choice.Delta.Content != nil {
+				state.content.WriteString(*choice.Delta.Content)
+			}
+			if reasoning := choice.Delta.GetReasoningContent(); reasoning != "" {
+				state.reasoning.WriteString(reasoning)
+			}
+			for _, toolCall := range choice.Delta.ToolCalls {
+				index := len(state.toolCalls)
+				if toolCall.Index != nil {
+					index = *toolCall.Index
+				}
+				for len(state.toolCalls) <= index {
+					state.toolCalls = append(state.toolCalls, dto.ToolCallResponse{Type: "function"})
+				}
+				if toolCall.ID != "" {
+					state.toolCalls[index].ID = toolCall.ID
+				}
+				if toolCall.Function.Name != "" {
+					state.toolCalls[index].Function.Name = toolCall.Function.Name
+				}
+				state.toolCalls[index].Function.Arguments += toolCall.Function.Arguments
+			}
+			if choice.FinishReason != nil && *choice.FinishReason != "" {
+				state.finish = *choice.FinishReason
+			}
+		}
+		if chunk.Usage != nil {
+			response.Usage = *chunk.Usage
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(choices) == 0 {
+		return nil, fmt.Errorf("empty stream response")
+	}
+	for index := 0; index < len(choices); index++ {
+		state, ok := choices[index]
+		if !ok {
+			continue
+		}
+		choice := dto.OpenAITextResponseChoice{
+			Index:        index,
+			FinishReason: state.finish,
+		}
+		choice.Role = "assistant"
+		choice.Content = state.content.String()
+		choice.ReasoningContent = state.reasoning.String()
+		if len(state.toolCalls) > 0 {
+			choice.SetToolCalls(state.toolCalls)
+		}
+		response.Choices = append(response.Choices, choice)
+	}
+	return response, nil
+}
+
+// SaveCapturedResponse 解析记录到的响应并写入缓存，usage 以本次实际计费的用量为准
+func SaveCapturedResponse(cacheKey string, writer *ResponseCaptureWriter, isStream bool, usage *dto.Usage) {
+	if writer.overflow || writer.body.Len() == 0 {
+		return
+	}
+	var response *dto.OpenAITextResponse
+	if isStream {
+		var err error
+		response, err = streamToTextResponse(writer.body.Bytes())
+		if err != nil {
+			return
+		}
+	} else {
+		response = &dto.OpenAITextResponse{}
+		if err := common.Unmarshal(writer.body.Bytes(), response); err != nil {
+			return
+		}
+		if response.Error != nil || len(response.Choices) == 0 {
+			return
+		}
+	}
+	if usage != nil {
+		response.Usage = *usage
+	}
+	saveResponseCache(cacheKey, response)
+}
+
+// CleanExpiredResponseCaches 定期清理数据库中过期的响应缓存，Redis 由 TTL 自动过期
+func CleanExpiredResponseCaches() {
+	for {
+		if operation_setting.GetResponseCacheSetting().Enabled && !common.RedisEnabled {
+			n, err := model.DeleteExpiredResponseCaches()
+			if err != nil {
+				common.SysError("failed to clean expired response caches: " + err.Error())
+			} else if n > 0 {
+				common.SysLog(fmt.Sprintf("cleaned %d expired response caches", n))
+			}
+		}
+		time.Sleep(time.Hour)
+	}
+}
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+type responsesInputItem struct {
+	Type      string          `json:"type"`
+	Role      string          `json:"role"`
+	Content   json.RawMessage `json:"content"`
+	CallId    string          `json:"call_id"`
+	Name      string          `json:"name"`
+	Arguments string          `json:"arguments"`
+	Output    json.RawMessage `json:"output"`
+}
+
+type responsesInputContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	ImageUrl string `json:"image_url"`
+	Detail   string `json:"detail"`
+	FileId   string `json:"file_id"`
+	FileData string `json:"file_data"`
+	FileUrl  string `json:"file_url"`
+	Filename string `json:"filename"`
+}
+
+type responsesFunctionTool struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Parameters  any    `json:"parameters"`
+}
+
+type responsesTextFormat struct {
+	Format *struct {
+		Type        string          `json:"type"`
+		Name        string          `json:"name"`
+		Description string          `json:"description"`
+		Schema      any             `json:"schema"`
+		Strict      json.RawMessage `json:"strict"`
+	} `json:"format"`
+}
+
+// ResponsesRequestToChatRequest 将 Responses API 请求转换为 Chat Completions 请求，供只支持 chat 的渠道使用。
+// 无法解析的 previous_response_id、内置工具（web_search、file_search 等）、include 与 truncation 在 chat 渠道上无法实现，直接拒绝；
+// 没有加密内容的 reasoning 输入项无法在其他上游复用，会被忽略
+func ResponsesRequestToChatRequest(req *dto.OpenAIResponsesRequest) (*dto.GeneralOpenAIRequest, error) {
+	// 网关保存的 response 已在进入渠道前展开，仍然存在说明网关未开启保存或找不到该 response
+	if req.PreviousResponseID != "" {
+		return nil, fmt.Errorf("previous_response_id %s cannot be resolved: the response store is disabled or the response was not found, and this channel does not support the Responses API; send the full conversation in input instead", req.PreviousResponseID)
+	}
+	if len(req.Include) > 0 && common.GetJsonType(req.Include) == "array" {
+		var include []string
+		if err := common.Unmarshal(req.Include, &include); err != nil {
+			return nil, fmt.Errorf("invalid include: %w", err)
+		}
+		if len(include) > 0 {
+			return nil, fmt.Errorf("include %s is not supported on this channel because it does not support the Responses API", strings.Join(include, ", "))
+		}
+	}
+	if req.Truncation != "" && req.Truncation != "disabled" {
+		return nil, fmt.Errorf("truncation %q is not supported on this channel because it does not support the Responses API", req.Truncation)
+	}
+	chatReq := &dto.GeneralOpenAIRequest{
+		Model:     req.Model,
+		Stream:    req.Stream,
+		MaxTokens: req.MaxOutputTokens,
+		TopP:      req.TopP,
+		User:      req.User,
+	}
+	if req.Stream {
+		chatReq.StreamOptions = &dto.StreamOptions{IncludeUsage: true}
+	}
+	if req.Temperature != 0 {
+		temperature := req.Temperature
+		chatReq.Temperature = &temperature
+	}
+	if len(req.PromptCacheKey) > 0 {
+		_ = common.Unmarshal(req.PromptCacheKey, &chatReq.PromptCacheKey)
+	}
+	if req.Reasoning != nil {
+		chatReq.ReasoningEffort = req.Reasoning.Effort
+	}
+	if len(req.ParallelToolCalls) > 0 {
+		var parallel bool
+		if err := common.Unmarshal(req.ParallelToolCalls, &parallel); err == nil {
+			chatReq.ParallelTooCalls = &parallel
+		}
+	}
+
+	messages := make([]dto.Message, 0)
+	if len(req.Instructions) > 0 {
+		var instructions string
+		if err := common.Unmarshal(req.Instructions, &instructions); err != nil {
+			return nil, fmt.Errorf("invalid instructions: %w", err)
+		}
+		if instructions != "" {
+			message := dto.Message{Role: "system"}
+			message.SetStringContent(instructions)
+			messages = append(messages, message)
+		}
+	}
+	inputMessages, err := responsesInputToMessages(req.Input)
+	if err != nil {
+		return nil, err
+	}
+	chatReq.Messages = append(messages, inputMessages...)
+
+	if len(req.Tools) > 0 {
+		var tools []responsesFunctionTool
+		if err := common.Unmarshal(req.Tools, &tools); err != nil {
+			return nil, fmt.Errorf("invalid tools: %w", err)
+		}
+		for _, tool := range tools {
+			if tool.Type != "function" {
+				return nil, fmt.Errorf("built-in tool %q is not supported on this channel because it does not support the Responses API; only function tools are available", tool.Type)
+			}
+			chatReq.Tools = append(chatReq.Tools, dto.ToolCallRequest{
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:        tool.Name,
+					Description: tool.Description,
+					Parameters:  tool.Parameters,
+				},
+			})
+		}
+	}
+	if len(chatReq.Tools) > 0 {
+		chatReq.ToolChoice = responsesToolChoiceToChat(req.ToolChoice)
+	}
+
+	if len(req.Text) > 0 {
+		var text responsesTextFormat
+		if err := common.Unmarshal(req.Text, &text); err == nil && text.Format != nil {
+			switch text.Format.Type {
+			case "json_schema":
+				schema, err := common.Marshal(dto.FormatJsonSchema{
+					Name:        text.Format.Name,
+					Description: text.Format.Description,
+					Schema:      text.Format.Schema,
+					Strict:      text.Format.Strict,
+				})
+				if err != nil {
+					return nil, err
+				}
+				chatReq.ResponseFormat = &dto.ResponseFormat{Type: "json_schema", JsonSchema: schema}
+			case "json_object":
+				chatReq.ResponseFormat = &dto.ResponseFormat{Type: "json_object"}
+			}
+		}
+	}
+	return chatReq, nil
+}
+
+// responsesInputToMessages 将 input 中的消息、函数调用及其结果转换为 chat messages，连续的函数调用合并到同一条 assistant 消息
+func responsesInputToMessages(input json.RawMessage) ([]dto.Message, error) {
+	rawItems, err := normalizeResponsesInput(input)
+	if err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+	messages := make([]dto.Message, 0, len(rawItems))
+	var toolCalls []dto.ToolCallRequest
+	flushToolCalls := func() {
+		if len(toolCalls) == 0 {
+			return
+		}
+		last := len(messages) - 1
+		if last >= 0 && messages[last].Role == "assistant" && len(messages[last].ToolCalls) == 0 {
+			messages[last].SetToolCalls(toolCalls)
+		} else {
+			message := dto.Message{Role: "assistant"}
+			message.SetToolCalls(toolCalls)
+			messages = append(messages, message)
+		}
+		toolCalls = nil
+	}
+
+	for _, rawItem := range rawItems {
+		var item responsesInputItem
+		if err := common.Unmarshal(rawItem, &item); err != nil {
+			return nil, fmt.Errorf("invalid input item: %w", err)
+		}
+		if item.Type == "" && item.Role != "" {
+			item.Type = "message"
+		}
+		switch item.Type {
+		case "function_call":
+			toolCalls = append(toolCalls, dto.ToolCallRequest{
+				ID:   item.CallId,
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:      item.Name,
+					Arguments: item.Arguments,
+				},
+			})
+			continue
+		case "function_call_output":
+			flushToolCalls()
+			message := dto.Message{Role: "tool", ToolCallId: item.CallId}
+			message.SetStringContent(responsesOutputToString(item.Output))
+			messages = append(messages, message)
+		case "message":
+			flushToolCalls()
+			message, err := responsesMessageToChat(item)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, message)
+		}
+	}
+	flushToolCalls()
+	return messages, nil
+}
+
+func responsesMessageToChat(item responsesInputItem) (dto.Message, error) {
+	role := item.Role
+	if role == "developer" {
+		role = "system"
+	}
+	message := dto.Message{Role: role}
+	if common.GetJsonType(item.Content) == "string" {
+		var text string
+		if err := common.Unmarshal(item.Content, &text); err != nil {
+			return message, err
+		}
+		message.SetStringContent(text)
+		return message, nil
+	}
+
+	var parts []responsesInputContent
+	if len(item.Content) > 0 {
+		if err := common.Unmarshal(item.Content, &parts); err != nil {
+			return message, fmt.Errorf("invalid message content: %w", err)
+		}
+	}
+	contents := make([]dto.MediaContent, 0, len(parts))
+	texts := make([]string, 0, len(parts))
+	textOnly := true
+	for _, part := range parts {
+		switch part.Type {
+		case "input_text", "output_text", "text":
+			texts = append(texts, part.Text)
+			contents = append(contents, dto.MediaContent{Type: dto.ContentTypeText, Text: part.Text})
+		case "input_image":
+			if part.ImageUrl == "" {
+				continue
+			}
+			textOnly = false
+			contents = append(contents, dto.MediaContent{
+				Type:     dto.ContentTypeImageURL,
+				ImageUrl: &dto.MessageImageUrl{Url: part.ImageUrl, Detail: part.Detail},
+			})
+		case "input_file":
+			fileData := part.FileData
+			if fileData == "" {
+				fileData = part.FileUrl
+			}
+			textOnly = false
+			contents = append(contents, dto.MediaContent{
+				Type: dto.ContentTypeFile,
+				File: &dto.MessageFile{FileName: part.Filename, FileData: fileData, FileId: part.FileId},
+			})
+		}
+	}
+	// assistant 与 system 消息在多数上游只接受纯文本
+	if textOnly || role == "assistant" || role == "system" {
+		message.SetStringContent(strings.Join(texts, "\n"))
+	} else {
+		message.SetMediaContent(contents)
+	}
+	return message, nil
+}
+
+// responsesOutputToString function_call_output 的 output 可以是字符串或内容数组
+func responsesOutputToString(output json.RawMessage) string {
+	switch common.GetJsonType(output) {
+	case "string":
+		var text string
+		_ = common.Unmarshal(output, &text)
+		return text
+	case "array":
+		var parts []responsesInputContent
+		if err := common.Unmarshal(output, &parts); err == nil {
+			texts := make([]string, 0, len(parts))
+			for _, part := range parts {
+				if part.Text != "" {
+					texts = append(texts, part.Text)
+				}
+			}
+			return strings.Join(texts, "\n")
+		}
+	}
+	return string(output)
+}
+
+func responsesToolChoiceToChat(toolChoice json.RawMessage) any {
+	switch common.GetJsonType(toolChoice) {
+	case "string":
+		var choice string
+		_ = common.Unmarshal(toolChoice, &choice)
+		return choice
+	case "object":
+		var choice struct {
+			Type string `json:"type"`
+			Name string `json:"name"`
+		}
+		if err := common.Unmarshal(toolChoice, &choice); err == nil && choice.Type == "function" && choice.Name != "" {
+			return map[string]any{
+				"type":     "function",
+				"function": map[string]any{"name": choice.Name},
+			}
+		}
+	}
+	return nil
+}
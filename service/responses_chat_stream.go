@@ -0,0 +1,506 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	responsesItemTypeMessage      = "message"
+	responsesItemTypeReasoning    = "reasoning"
+	responsesItemTypeFunctionCall = "function_call"
+)
+
+type responsesChatItem struct {
+	outputIndex int
+	itemType    string
+	id          string
+	callId      string
+	name        string
+	text        strings.Builder
+}
+
+// ResponsesChatConverter 将 Chat Completions 的输出转换为 Responses API 的 output item 与流式事件
+type ResponsesChatConverter struct {
+	id        string
+	model     string
+	createdAt int64
+	emit      func(eventType string, event map[string]any)
+	// onComplete 在发出 response.completed 之前调用
+	onComplete func(response map[string]any)
+	sequence   int
+	started    bool
+	completed  bool
+
+	output    []map[string]any
+	reasoning *responsesChatItem
+	message   *responsesChatItem
+	toolCalls map[int]*responsesChatItem
+
+	finishReason string
+	usage        *dto.Usage
+	status       string
+	err          map[string]any
+}
+
+func NewResponsesChatConverter(model string) *ResponsesChatConverter {
+	return &ResponsesChatConverter{
+		id:        "resp_" + common.GetUUID(),
+		model:     model,
+		createdAt: common.GetTimestamp(),
+		toolCalls: make(map[int]*responsesChatItem),
+	}
+}
+
+func (c *ResponsesChatConverter) emitEvent(eventType string, event map[string]any) {
+	if c.emit == nil {
+		return
+	}
+	event["type"] = eventType
+	event["sequence_number"] = c.sequence
+	c.sequence++
+	c.emit(eventType, event)
+}
+
+func (c *ResponsesChatConverter) start() {
+	if c.started {
+		return
+	}
+	c.started = true
+	c.emitEvent("response.created", map[string]any{"response": c.buildResponse("in_progress")})
+	c.emitEvent("response.in_progress", map[string]any{"response": c.buildResponse("in_progress")})
+}
+
+func (c *ResponsesChatConverter) openItem(itemType string, prefix string) *responsesChatItem {
+	item := &responsesChatItem{
+		outputIndex: len(c.output),
+		itemType:    itemType,
+		id:          prefix + common.GetUUID(),
+	}
+	c.output = append(c.output, nil)
+	return item
+}
+
+func (c *ResponsesChatConverter) addReasoning(delta string) {
+	if delta == "" {
+		return
+	}
+	c.closeMessage()
+	if c.reasoning == nil {
+		c.reasoning = c.openItem(responsesItemTypeReasoning, "rs_")
+		c.emitEvent(dto.ResponsesOutputTypeItemAdded, map[string]any{
+			"output_index": c.reasoning.outputIndex,
+			"item":         c.reasoning.toOutput("in_progress"),
+		})
+		c.emitEvent("response.reasoning_summary_part.added", map[string]any{
+			"item_id":       c.reasoning.id,
+			"output_index":  c.reasoning.outputIndex,
+			"summary_index": 0,
+			"part":          map[string]any{"type": "summary_text", "text": ""},
+		})
+	}
+	c.reasoning.text.WriteString(delta)
+	c.emitEvent("response.reasoning_summary_text.delta", map[string]any{
+		"item_id":       c.reasoning.id,
+		"output_index":  c.reasoning.outputIndex,
+		"summary_index": 0,
+		"delta":         delta,
+	})
+}
+
+func (c *ResponsesChatConverter) closeReasoning() {
+	item := c.reasoning
+	if item == nil {
+		return
+	}
+	c.reasoning = nil
+	text := item.text.String()
+	c.emitEvent("response.reasoning_summary_text.done", map[string]any{
+		"item_id":       item.id,
+		"output_index":  item.outputIndex,
+		"summary_index": 0,
+		"text":          text,
+	})
+	c.emitEvent("response.reasoning_summary_part.done", map[string]any{
+		"item_id":       item.id,
+		"output_index":  item.outputIndex,
+		"summary_index": 0,
+		"part":          map[string]any{"type": "summary_text", "text": text},
+	})
+	c.finishItem(item)
+}
+
+func (c *ResponsesChatConverter) addText(delta string) {
+	if delta == "" {
+		return
+	}
+	c.closeReasoning()
+	if c.message == nil {
+		c.message = c.openItem(responsesItemTypeMessage, "msg_")
+		c.emitEvent(dto.ResponsesOutputTypeItemAdded, map[string]any{
+			"output_index": c.message.outputIndex,
+			"item":         c.message.toOutput("in_progress"),
+		})
+		c.emitEvent("response.content_part.added", map[string]any{
+			"item_id":       c.message.id,
+			"output_index":  c.message.outputIndex,
+			"content_index": 0,
+			"part":          map[string]any{"type": "output_text", "text": "", "annotations": []any{}},
+		})
+	}
+	c.message.text.WriteString(delta)
+	c.emitEvent("response.output_text.delta", map[string]any{
+		"item_id":       c.message.id,
+		"output_index":  c.message.outputIndex,
+		"content_index": 0,
+		"delta":         delta,
+	})
+}
+
+func (c *ResponsesChatConverter) closeMessage() {
+	item := c.message
+	if item == nil {
+		return
+	}
+	c.message = nil
+	text := item.text.String()
+	c.emitEvent("response.output_text.done", map[string]any{
+		"item_id":       item.id,
+		"output_index":  item.outputIndex,
+		"content_index": 0,
+		"text":          text,
+	})
+	c.emitEvent("response.content_part.done", map[string]any{
+		"item_id":       item.id,
+		"output_index":  item.outputIndex,
+		"content_index": 0,
+		"part":          map[string]any{"type": "output_text", "text": text, "annotations": []any{}},
+	})
+	c.finishItem(item)
+}
+
+func (c *ResponsesChatConverter) addToolCall(index int, callId string, name string, arguments string) {
+	c.closeReasoning()
+	c.closeMessage()
+	item, ok := c.toolCalls[index]
+	if !ok {
+		item = c.openItem(responsesItemTypeFunctionCall, "fc_")
+		item.callId = callId
+		item.name = name
+		if item.callId == "" {
+			item.callId = "call_" + common.GetUUID()
+		}
+		c.toolCalls[index] = item
+		c.emitEvent(dto.ResponsesOutputTypeItemAdded, map[string]any{
+			"output_index": item.outputIndex,
+			"item":         item.toOutput("in_progress"),
+		})
+	} else if item.name == "" && name != "" {
+		item.name = name
+	}
+	if arguments == "" {
+		return
+	}
+	item.text.WriteString(arguments)
+	c.emitEvent("response.function_call_arguments.delta", map[string]any{
+		"item_id":      item.id,
+		"output_index": item.outputIndex,
+		"delta":        arguments,
+	})
+}
+
+func (c *ResponsesChatConverter) closeToolCalls() {
+	indexes := make([]int, 0, len(c.toolCalls))
+	for index := range c.toolCalls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		item := c.toolCalls[index]
+		c.emitEvent("response.function_call_arguments.done", map[string]any{
+			"item_id":      item.id,
+			"output_index": item.outputIndex,
+			"arguments":    item.text.String(),
+		})
+		c.finishItem(item)
+	}
+	c.toolCalls = make(map[int]*responsesChatItem)
+}
+
+func (c *ResponsesChatConverter) finishItem(item *responsesChatItem) {
+	output := item.toOutput("completed")
+	c.output[item.outputIndex] = output
+	c.emitEvent(dto.ResponsesOutputTypeItemDone, map[string]any{
+		"output_index": item.outputIndex,
+		"item":         output,
+	})
+}
+
+func (item *responsesChatItem) toOutput(status string) map[string]any {
+	switch item.itemType {
+	case responsesItemTypeReasoning:
+		summary := []any{}
+		if status == "completed" {
+			summary = append(summary, map[string]any{"type": "summary_text", "text": item.text.String()})
+		}
+		return map[string]any{
+			"type":    responsesItemTypeReasoning,
+			"id":      item.id,
+			"summary": summary,
+		}
+	case responsesItemTypeFunctionCall:
+		return map[string]any{
+			"type":      responsesItemTypeFunctionCall,
+			"id":        item.id,
+			"call_id":   item.callId,
+			"name":      item.name,
+			"arguments": item.text.String(),
+			"status":    status,
+		}
+	default:
+		content := []any{}
+		if status == "completed" {
+			content = append(content, map[string]any{"type": "output_text", "text": item.text.String(), "annotations": []any{}})
+		}
+		return map[string]any{
+			"type":    responsesItemTypeMessage,
+			"id":      item.id,
+			"status":  status,
+			"role":    "assistant",
+			"content": content,
+		}
+	}
+}
+
+func (c *ResponsesChatConverter) buildResponse(status string) map[string]any {
+	output := make([]map[string]any, 0, len(c.output))
+	for _, item := range c.output {
+		if item != nil {
+			output = append(output, item)
+		}
+	}
+	response := map[string]any{
+		"id":                 c.id,
+		"object":             "response",
+		"created_at":         c.createdAt,
+		"status":             status,
+		"model":              c.model,
+		"output":             output,
+		"error":              nil,
+		"incomplete_details": nil,
+		"usage":              nil,
+	}
+	if status == "incomplete" {
+		response["incomplete_details"] = map[string]any{"reason": "max_output_tokens"}
+	}
+	if status == "failed" && c.err != nil {
+		response["error"] = c.err
+	}
+	if c.usage != nil {
+		totalTokens := c.usage.TotalTokens
+		if totalTokens == 0 {
+			totalTokens = c.usage.PromptTokens + c.usage.CompletionTokens
+		}
+		response["usage"] = map[string]any{
+			"input_tokens":          c.usage.PromptTokens,
+			"input_tokens_details":  map[string]any{"cached_tokens": c.usage.PromptTokensDetails.CachedTokens},
+			"output_tokens":         c.usage.CompletionTokens,
+			"output_tokens_details": map[string]any{"reasoning_tokens": c.usage.CompletionTokenDetails.ReasoningTokens},
+			"total_tokens":          totalTokens,
+		}
+	}
+	return response
+}
+
+// HandleStreamChunk 处理一个 chat.completion.chunk
+func (c *ResponsesChatConverter) HandleStreamChunk(chunk *dto.ChatCompletionsStreamResponse) {
+	c.start()
+	if chunk.Usage != nil && (chunk.Usage.PromptTokens != 0 || chunk.Usage.CompletionTokens != 0) {
+		c.usage = chunk.Usage
+	}
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		delta := choice.Delta
+		reasoning := delta.GetReasoningContent()
+		c.addReasoning(reasoning)
+		if delta.Content != nil {
+			c.addText(*delta.Content)
+		}
+		for i, toolCall := range delta.ToolCalls {
+			index := i
+			if toolCall.Index != nil {
+				index = *toolCall.Index
+			}
+			c.addToolCall(index, toolCall.ID, toolCall.Function.Name, toolCall.Function.Arguments)
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			c.finishReason = *choice.FinishReason
+		}
+	}
+}
+
+// Complete 结束所有未完成的 output item 并发出 response.completed（或 response.incomplete）
+func (c *ResponsesChatConverter) Complete() map[string]any {
+	c.start()
+	if !c.completed {
+		c.completed = true
+		c.closeReasoning()
+		c.closeMessage()
+		c.closeToolCalls()
+		c.status = "completed"
+		eventType := "response.completed"
+		if c.finishReason == "length" {
+			c.status = "incomplete"
+			eventType = "response.incomplete"
+		}
+		response := c.buildResponse(c.status)
+		if c.onComplete != nil {
+			c.onComplete(response)
+		}
+		c.emitEvent(eventType, map[string]any{"response": response})
+	}
+	return c.buildResponse(c.status)
+}
+
+// Fail 上游在输出中途出错时发出 response.failed，已完成的 output item 保留在响应中
+func (c *ResponsesChatConverter) Fail(code string, message string) map[string]any {
+	c.start()
+	if !c.completed {
+		c.completed = true
+		c.status = "failed"
+		c.err = map[string]any{"code": code, "message": message}
+		c.emitEvent("response.failed", map[string]any{"response": c.buildResponse(c.status)})
+	}
+	return c.buildResponse(c.status)
+}
+
+// ConvertTextResponse 将非流式的 chat completion 响应转换为 Responses API 的 response 对象
+func (c *ResponsesChatConverter) ConvertTextResponse(response *dto.OpenAITextResponse) map[string]any {
+	c.started = true
+	if response.Usage.PromptTokens != 0 || response.Usage.CompletionTokens != 0 {
+		usage := response.Usage
+		c.usage = &usage
+	}
+	for _, choice := range response.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		message := choice.Message
+		reasoning := message.ReasoningContent
+		if reasoning == "" {
+			reasoning = message.Reasoning
+		}
+		c.addReasoning(reasoning)
+		c.addText(message.StringContent())
+		for i, toolCall := range message.ParseToolCalls() {
+			c.addToolCall(i, toolCall.ID, toolCall.Function.Name, toolCall.Function.Arguments)
+		}
+		c.finishReason = choice.FinishReason
+	}
+	return c.Complete()
+}
+
+// ResponsesConvertWriter 将 chat 渠道写出的 Chat Completions 响应实时转换为 Responses API 格式
+type ResponsesConvertWriter struct {
+	*chatConvertWriter
+	converter *ResponsesChatConverter
+	result    map[string]any
+}
+
+func NewResponsesConvertWriter(writer gin.ResponseWriter, model string) *ResponsesConvertWriter {
+	w := &ResponsesConvertWriter{
+		converter: NewResponsesChatConverter(model),
+	}
+	w.chatConvertWriter = newChatConvertWriter(writer, w.handleStreamData)
+	w.converter.emit = w.writeEvent
+	return w
+}
+
+func (w *ResponsesConvertWriter) handleStreamData(data string) {
+	if data == "[DONE]" {
+		w.result = w.converter.Complete()
+		return
+	}
+	var chunk struct {
+		dto.ChatCompletionsStreamResponse
+		Error *types.OpenAIError `json:"error"`
+	}
+	if err := common.UnmarshalJsonStr(data, &chunk); err != nil {
+		common.SysLog("failed to parse chat stream chunk for responses conversion: " + err.Error())
+		return
+	}
+	// 部分上游在流中途以 error 对象报告错误
+	if chunk.Error != nil {
+		w.result = w.converter.Fail(fmt.Sprintf("%v", chunk.Error.Code), chunk.Error.Message)
+		return
+	}
+	w.converter.HandleStreamChunk(&chunk.ChatCompletionsStreamResponse)
+}
+
+func (w *ResponsesConvertWriter) writeEvent(eventType string, event map[string]any) {
+	data, err := common.Marshal(event)
+	if err != nil {
+		return
+	}
+	w.writeRaw(fmt.Sprintf("event: %s\ndata: %s\n\n", eventType, data))
+}
+
+// Finish 在 chat 处理结束后调用：流式响应补发 response.completed，上游没有给出结束原因就断开时发出 response.failed；
+// 非流式响应将缓冲的 chat 结果转换后写出
+func (w *ResponsesConvertWriter) Finish() error {
+	if w.stream {
+		w.flushStream()
+		if w.result == nil {
+			if w.converter.finishReason == "" {
+				w.result = w.converter.Fail("stream_interrupted", "upstream stream ended before the response was complete")
+			} else {
+				w.result = w.converter.Complete()
+			}
+		}
+		w.ResponseWriter.Flush()
+		return nil
+	}
+	var chatResponse dto.OpenAITextResponse
+	if err := common.Unmarshal(w.buffer.Bytes(), &chatResponse); err != nil {
+		return fmt.Errorf("failed to parse chat response: %w", err)
+	}
+	w.converter.emit = nil
+	w.result = w.converter.ConvertTextResponse(&chatResponse)
+	body, err := common.Marshal(w.result)
+	if err != nil {
+		return err
+	}
+	return w.writeBody(body)
+}
+
+// Fail 流式输出开始后 chat 处理出错时发出 response.failed，尚未开始输出时返回 false，由调用方按普通错误返回
+func (w *ResponsesConvertWriter) Fail(newAPIError *types.NewAPIError) bool {
+	if !w.stream {
+		return false
+	}
+	w.flushStream()
+	if w.result == nil || !w.converter.completed {
+		w.result = w.converter.Fail(string(newAPIError.GetErrorCode()), newAPIError.Error())
+	}
+	w.ResponseWriter.Flush()
+	return true
+}
+
+// OnComplete 注册在 response.completed 写出之前调用的回调，非流式响应在写出响应体之前调用，用于保存结果
+func (w *ResponsesConvertWriter) OnComplete(fn func(response json.RawMessage)) {
+	w.converter.onComplete = func(response map[string]any) {
+		if data, err := common.Marshal(response); err == nil {
+			fn(data)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestResponsesRequestToChatRequest(t *testing.T) {
+	req := &dto.OpenAIResponsesRequest{
+		Model:        "gpt-test",
+		Instructions: json.RawMessage(`"be brief"`),
+		Input: json.RawMessage(`[
+			{"role":"user","content":[{"type":"input_text","text":"weather?"},{"type":"input_image","image_url":"https://example.com/a.png"}]},
+			{"type":"function_call","call_id":"call_1","name":"get_weather","arguments":"{\"city\":\"Paris\"}"},
+			{"type":"function_call_output","call_id":"call_1","output":"sunny"}
+		]`),
+		Tools:      json.RawMessage(`[{"type":"function","name":"get_weather","parameters":{"type":"object"}}]`),
+		ToolChoice: json.RawMessage(`{"type":"function","name":"get_weather"}`),
+		Text:       json.RawMessage(`{"format":{"type":"json_object"}}`),
+	}
+	chatReq, err := ResponsesRequestToChatRequest(req)
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	if len(chatReq.Messages) != 4 {
+		t.Fatalf("messages = %d, want 4", len(chatReq.Messages))
+	}
+	roles := []string{"system", "user", "assistant", "tool"}
+	for i, role := range roles {
+		if chatReq.Messages[i].Role != role {
+			t.Fatalf("message %d role = %s, want %s", i, chatReq.Messages[i].Role, role)
+		}
+	}
+	if calls := chatReq.Messages[2].ParseToolCalls(); len(calls) != 1 || calls[0].ID != "call_1" || calls[0].Function.Name != "get_weather" {
+		t.Fatalf("tool calls = %+v", calls)
+	}
+	if chatReq.Messages[3].ToolCallId != "call_1" || chatReq.Messages[3].StringContent() != "sunny" {
+		t.Fatalf("tool message = %+v", chatReq.Messages[3])
+	}
+	if len(chatReq.Tools) != 1 || chatReq.ResponseFormat == nil || chatReq.ResponseFormat.Type != "json_object" {
+		t.Fatalf("tools=%d response format=%+v", len(chatReq.Tools), chatReq.ResponseFormat)
+	}
+}
+
+func TestResponsesRequestToChatRequestRejectsUnsupportedFields(t *testing.T) {
+	tests := []struct {
+		name string
+		req  dto.OpenAIResponsesRequest
+		want string
+	}{
+		{"previous response", dto.OpenAIResponsesRequest{PreviousResponseID: "resp_1"}, "previous_response_id"},
+		{"built-in tool", dto.OpenAIResponsesRequest{Tools: json.RawMessage(`[{"type":"web_search"}]`)}, "web_search"},
+		{"include", dto.OpenAIResponsesRequest{Include: json.RawMessage(`["reasoning.encrypted_content"]`)}, "reasoning.encrypted_content"},
+		{"truncation", dto.OpenAIResponsesRequest{Truncation: "auto"}, "truncation"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.Input = json.RawMessage(`"hi"`)
+			_, err := ResponsesRequestToChatRequest(&tt.req)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want mention of %s", err, tt.want)
+			}
+		})
+	}
+	// truncation 为 disabled 与默认行为一致
+	if _, err := ResponsesRequestToChatRequest(&dto.OpenAIResponsesRequest{Input: json.RawMessage(`"hi"`), Truncation: "disabled"}); err != nil {
+		t.Fatalf("truncation disabled: %v", err)
+	}
+}
+
+type responsesTestEvent struct {
+	Type     string         `json:"type"`
+	Delta    string         `json:"delta"`
+	Response map[string]any `json:"response"`
+}
+
+func newTestResponsesWriter(t *testing.T) (*ResponsesConvertWriter, *httptest.ResponseRecorder) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	return NewResponsesConvertWriter(c.Writer, "gpt-test"), recorder
+}
+
+func parseResponsesEvents(t *testing.T, body string) []responsesTestEvent {
+	t.Helper()
+	var events []responsesTestEvent
+	for _, line := range strings.Split(body, "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var event responsesTestEvent
+		if err := common.UnmarshalJsonStr(data, &event); err != nil {
+			t.Fatalf("parse event %q: %v", data, err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func eventTypes(events []responsesTestEvent) []string {
+	names := make([]string, 0, len(events))
+	for _, event := range events {
+		names = append(names, event.Type)
+	}
+	return names
+}
+
+func TestResponsesConvertWriterStream(t *testing.T) {
+	writer, recorder := newTestResponsesWriter(t)
+	_, _ = writer.Write([]byte(`data: {"choices":[{"index":0,"delta":{"content":"Hel"}}]}` + "\n\n"))
+	_, _ = writer.Write([]byte(`data: {"choices":[{"index":0,"delta":{"content":"lo"},"finish_reason":"stop"}]}` + "\n\n"))
+	_, _ = writer.Write([]byte(`data: {"choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}` + "\n\ndata: [DONE]\n\n"))
+	if err := writer.Finish(); err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+	events := parseResponsesEvents(t, recorder.Body.String())
+	names := eventTypes(events)
+	if names[0] != "response.created" || names[len(names)-1] != "response.completed" {
+		t.Fatalf("events = %v", names)
+	}
+	var text string
+	for _, event := range events {
+		if event.Type == "response.output_text.delta" {
+			text += event.Delta
+		}
+	}
+	if text != "Hello" {
+		t.Fatalf("text = %q", text)
+	}
+	usage, _ := events[len(events)-1].Response["usage"].(map[string]any)
+	if usage == nil || usage["total_tokens"] != float64(5) {
+		t.Fatalf("usage = %v", events[len(events)-1].Response["usage"])
+	}
+}
+
+func TestResponsesConvertWriterStreamFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		fail *types.NewAPIError
+		code string
+	}{
+		{
+			name: "error chunk",
+			body: `data: {"choices":[{"index":0,"delta":{"content":"Hi"}}]}` + "\n\n" + `data: {"error":{"message":"overloaded","code":"server_error"}}` + "\n\n",
+			code: "server_error",
+		},
+		{
+			name: "interrupted",
+			body: `data: {"choices":[{"index":0,"delta":{"content":"Hi"}}]}` + "\n\n",
+			code: "stream_interrupted",
+		},
+		{
+			name: "handler error",
+			body: `data: {"choices":[{"index":0,"delta":{"content":"Hi"}}]}` + "\n\n",
+			fail: types.NewErrorWithStatusCode(errors.New("read timeout"), types.ErrorCodeBadResponse, http.StatusInternalServerError),
+			code: string(types.ErrorCodeBadResponse),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer, recorder := newTestResponsesWriter(t)
+			_, _ = writer.Write([]byte(tt.body))
+			if tt.fail != nil {
+				if !writer.Fail(tt.fail) {
+					t.Fatalf("fail not handled after stream started")
+				}
+			} else if err := writer.Finish(); err != nil {
+				t.Fatalf("finish: %v", err)
+			}
+			events := parseResponsesEvents(t, recorder.Body.String())
+			last := events[len(events)-1]
+			if last.Type != "response.failed" || last.Response["status"] != "failed" {
+				t.Fatalf("events = %v", eventTypes(events))
+			}
+			errObj, _ := last.Response["error"].(map[string]any)
+			if errObj == nil || errObj["code"] != tt.code {
+				t.Fatalf("error = %v, want code %s", last.Response["error"], tt.code)
+			}
+			for _, event := range events {
+				if event.Type == "response.completed" {
+					t.Fatalf("unexpected response.completed after failure")
+				}
+			}
+		})
+	}
+}
+
+func TestResponsesConvertWriterNonStream(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	writer := NewResponsesConvertWriter(c.Writer, "gpt-test")
+	if writer.Fail(types.NewError(errors.New("bad"), types.ErrorCodeBadResponse)) {
+		t.Fatalf("fail handled before stream started")
+	}
+	_, _ = writer.Write([]byte(`{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"f","arguments":"{}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`))
+	if err := writer.Finish(); err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+	var response struct {
+		Status string           `json:"status"`
+		Output []map[string]any `json:"output"`
+	}
+	if err := common.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if response.Status != "completed" || len(response.Output) != 1 || response.Output[0]["call_id"] != "call_1" {
+		t.Fatalf("response = %+v", response)
+	}
+}
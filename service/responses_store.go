@@ -0,0 +1,212 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// normalizeResponsesInput 将 Responses API 的 input 统一为 item 数组
+func normalizeResponsesInput(input json.RawMessage) ([]json.RawMessage, error) {
+	switch common.GetJsonType(input) {
+	case "string":
+		var text string
+		if err := common.Unmarshal(input, &text); err != nil {
+			return nil, err
+		}
+		item, err := common.Marshal(map[string]any{
+			"type":    "message",
+			"role":    "user",
+			"content": text,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return []json.RawMessage{item}, nil
+	case "array":
+		var items []json.RawMessage
+		if err := common.Unmarshal(input, &items); err != nil {
+			return nil, err
+		}
+		return items, nil
+	default:
+		return nil, nil
+	}
+}
+
+// responseOutputToInputItems 将上一轮的 output 转换为下一轮可用的 input item。
+// 输出项的 id 只在生成它的上游存在，需要去掉；没有 encrypted_content 的 reasoning 无法跨上游复用，直接丢弃
+func responseOutputToInputItems(response json.RawMessage) []json.RawMessage {
+	var resp struct {
+		Output []map[string]any `json:"output"`
+	}
+	if err := common.Unmarshal(response, &resp); err != nil {
+		return nil
+	}
+	items := make([]json.RawMessage, 0, len(resp.Output))
+	for _, output := range resp.Output {
+		if output["type"] == "reasoning" {
+			if encrypted, _ := output["encrypted_content"].(string); encrypted == "" {
+				continue
+			}
+		} else {
+			delete(output, "id")
+		}
+		item, err := common.Marshal(output)
+		if err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// storedResponseChainItems 按时间顺序拼接对话各轮的输入与输出，includeLastOutput 为 false 时不包含最后一轮的输出
+func storedResponseChainItems(chain []*model.StoredResponse, includeLastOutput bool) ([]json.RawMessage, error) {
+	var items []json.RawMessage
+	for i, stored := range chain {
+		input, err := normalizeResponsesInput(stored.Input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load input of response %s: %w", stored.ResponseId, err)
+		}
+		items = append(items, input...)
+		if i < len(chain)-1 || includeLastOutput {
+			items = append(items, responseOutputToInputItems(stored.Response)...)
+		}
+	}
+	return items, nil
+}
+
+func isStoredResponseMissing(err error) bool {
+	return errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, model.ErrStoredResponseExpired)
+}
+
+// GetStoredResponseInputItems 返回生成该 response 时使用的完整输入，包括之前各轮的输入与输出
+func GetStoredResponseInputItems(userId int, stored *model.StoredResponse) ([]json.RawMessage, error) {
+	chain, err := model.GetUserStoredResponseChain(userId, stored.ConversationId, stored.PreviousResponseId)
+	if err != nil && !isStoredResponseMissing(err) {
+		return nil, err
+	}
+	return storedResponseChainItems(append(chain, stored), false)
+}
+
+// ExpandPreviousResponse 将 previous_response_id 展开为完整的对话输入，使后续请求可以路由到任意渠道。
+// 网关没有保存的 id 保持不变，交给上游处理
+func ExpandPreviousResponse(c *gin.Context, request dto.Request) error {
+	responsesReq, ok := request.(*dto.OpenAIResponsesRequest)
+	if !ok || responsesReq.PreviousResponseID == "" || !operation_setting.GetResponsesStoreSetting().Enabled {
+		return nil
+	}
+	userId := c.GetInt("id")
+	stored, err := model.GetUserStoredResponse(userId, responsesReq.PreviousResponseID)
+	if err != nil {
+		if isStoredResponseMissing(err) {
+			return nil
+		}
+		return types.NewErrorWithStatusCode(fmt.Errorf("failed to load previous response: %w", err), types.ErrorCodeQueryDataError, http.StatusInternalServerError, types.ErrOptionWithSkipRetry())
+	}
+	chain, err := model.GetUserStoredResponseChain(userId, stored.ConversationId, stored.PreviousResponseId)
+	if err != nil {
+		if isStoredResponseMissing(err) {
+			return types.NewErrorWithStatusCode(fmt.Errorf("an earlier response in the conversation of %s has expired or been deleted", responsesReq.PreviousResponseID), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+		return types.NewErrorWithStatusCode(fmt.Errorf("failed to load previous response: %w", err), types.ErrorCodeQueryDataError, http.StatusInternalServerError, types.ErrOptionWithSkipRetry())
+	}
+	items, err := storedResponseChainItems(append(chain, stored), true)
+	if err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeQueryDataError, http.StatusInternalServerError, types.ErrOptionWithSkipRetry())
+	}
+	current, err := normalizeResponsesInput(responsesReq.Input)
+	if err != nil {
+		return types.NewErrorWithStatusCode(fmt.Errorf("invalid input: %w", err), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	items = append(items, current...)
+	input, err := common.Marshal(items)
+	if err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeJsonMarshalFailed, http.StatusInternalServerError, types.ErrOptionWithSkipRetry())
+	}
+	// 保存时只记录本轮输入，历史由 previous_response_id 回溯
+	common.SetContextKey(c, constant.ContextKeyResponsesDeltaInput, responsesReq.Input)
+	responsesReq.Input = input
+	common.SetContextKey(c, constant.ContextKeyResponsesPreviousId, responsesReq.PreviousResponseID)
+	conversationId := stored.ConversationId
+	if conversationId == "" {
+		conversationId = stored.ResponseId
+	}
+	common.SetContextKey(c, constant.ContextKeyResponsesConversationId, conversationId)
+	responsesReq.PreviousResponseID = ""
+	return nil
+}
+
+// StoreResponsesResult 保存上游返回的完整 response 对象，用于 previous_response_id 展开与 GET /v1/responses/:id。
+// 需在响应结束前同步写入，客户端收到响应后立即引用该 id 时才能查到
+func StoreResponsesResult(c *gin.Context, info *relaycommon.RelayInfo, response json.RawMessage) {
+	if !operation_setting.GetResponsesStoreSetting().Enabled || info == nil {
+		return
+	}
+	responsesReq, ok := info.Request.(*dto.OpenAIResponsesRequest)
+	if !ok || string(responsesReq.Store) == "false" {
+		return
+	}
+	var resp map[string]json.RawMessage
+	if err := common.Unmarshal(response, &resp); err != nil {
+		return
+	}
+	var responseId string
+	if err := common.Unmarshal(resp["id"], &responseId); err != nil || responseId == "" {
+		return
+	}
+	previousId := common.GetContextKeyString(c, constant.ContextKeyResponsesPreviousId)
+	conversationId := common.GetContextKeyString(c, constant.ContextKeyResponsesConversationId)
+	if conversationId == "" {
+		conversationId = responseId
+	}
+	requestInput := responsesReq.Input
+	if previousId != "" {
+		// 上游看到的是展开后的输入，这里还原客户端传入的 previous_response_id 与本轮输入
+		resp["previous_response_id"], _ = common.Marshal(previousId)
+		if patched, err := common.Marshal(resp); err == nil {
+			response = patched
+		}
+		if deltaInput, ok := common.GetContextKeyType[json.RawMessage](c, constant.ContextKeyResponsesDeltaInput); ok {
+			requestInput = deltaInput
+		}
+	}
+	input, err := normalizeResponsesInput(requestInput)
+	if err != nil {
+		return
+	}
+	inputData, err := common.Marshal(input)
+	if err != nil {
+		return
+	}
+	stored := &model.StoredResponse{
+		ResponseId:         responseId,
+		PreviousResponseId: previousId,
+		ConversationId:     conversationId,
+		UserId:             info.UserId,
+		ModelName:          info.OriginModelName,
+		ChannelId:          info.ChannelId,
+		Input:              inputData,
+		Response:           response,
+		CreatedAt:          common.GetTimestamp(),
+	}
+	if retentionDays := operation_setting.GetResponsesStoreSetting().RetentionDays; retentionDays > 0 {
+		stored.ExpiresAt = stored.CreatedAt + int64(retentionDays)*24*3600
+	}
+	if err := stored.Insert(); err != nil {
+		common.SysError("failed to store response " + responseId + ": " + err.Error())
+	}
+}
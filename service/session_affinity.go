@@ -0,0 +1,222 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+)
+
+const sessionAffinityRedisPrefix = "session_affinity:"
+
+type sessionAffinityEntry struct {
+	ChannelId int
+	KeyIndex  int
+	Group     string
+	ExpiresAt time.Time
+}
+
+var (
+	sessionAffinityMap       = make(map[string]sessionAffinityEntry)
+	sessionAffinityLock      sync.Mutex
+	sessionAffinitySweepOnce sync.Once
+)
+
+// sweepSessionAffinity 定期清理内存中已过期的绑定关系
+func sweepSessionAffinity() {
+	for {
+		time.Sleep(time.Minute)
+		now := time.Now()
+		sessionAffinityLock.Lock()
+		for key, entry := range sessionAffinityMap {
+			if now.After(entry.ExpiresAt) {
+				delete(sessionAffinityMap, key)
+			}
+		}
+		sessionAffinityLock.Unlock()
+	}
+}
+
+func getSessionAffinity(key string) (*sessionAffinityEntry, bool) {
+	if common.RedisEnabled {
+		value, err := common.RedisGet(sessionAffinityRedisPrefix + key)
+		if err != nil || value == "" {
+			return nil, false
+		}
+		// channelId:keyIndex:group
+		parts := strings.SplitN(value, ":", 3)
+		if len(parts) != 3 {
+			return nil, false
+		}
+		channelId, err1 := strconv.Atoi(parts[0])
+		keyIndex, err2 := strconv.Atoi(parts[1])
+		if err1 != nil || err2 != nil {
+			return nil, false
+		}
+		return &sessionAffinityEntry{ChannelId: channelId, KeyIndex: keyIndex, Group: parts[2]}, true
+	}
+	sessionAffinityLock.Lock()
+	defer sessionAffinityLock.Unlock()
+	entry, ok := sessionAffinityMap[key]
+	if !ok || time.Now().After(entry.ExpiresAt) {
+		return nil, false
+	}
+	return &entry, true
+}
+
+func setSessionAffinity(key string, entry sessionAffinityEntry, ttl time.Duration) {
+	if common.RedisEnabled {
+		value := fmt.Sprintf("%d:%d:%s", entry.ChannelId, entry.KeyIndex, entry.Group)
+		if err := common.RedisSet(sessionAffinityRedisPrefix+key, value, ttl); err != nil {
+			common.SysError("failed to save session affinity: " + err.Error())
+		}
+		return
+	}
+	sessionAffinitySweepOnce.Do(func() {
+		go sweepSessionAffinity()
+	})
+	entry.ExpiresAt = time.Now().Add(ttl)
+	sessionAffinityLock.Lock()
+	sessionAffinityMap[key] = entry
+	sessionAffinityLock.Unlock()
+}
+
+// extractSystemPrompt 从 OpenAI / Claude / Gemini / Responses 格式的请求体中取出系统提示词
+func extractSystemPrompt(body []byte) []byte {
+	var req struct {
+		System             json.RawMessage `json:"system"`
+		Instructions       json.RawMessage `json:"instructions"`
+		SystemInstruction  json.RawMessage `json:"systemInstruction"`
+		SystemInstruction2 json.RawMessage `json:"system_instruction"`
+		Messages           []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if err := common.Unmarshal(body, &req); err != nil {
+		return nil
+	}
+	for _, prompt := range []json.RawMessage{req.System, req.Instructions, req.SystemInstruction, req.SystemInstruction2} {
+		if len(prompt) > 0 && string(prompt) != "null" {
+			return prompt
+		}
+	}
+	for _, message := range req.Messages {
+		if message.Role == "system" || message.Role == "developer" {
+			return message.Content
+		}
+	}
+	return nil
+}
+
+// GetSessionAffinityKey 计算请求的会话标识，未开启或无法识别会话时返回空字符串
+func GetSessionAffinityKey(c *gin.Context, modelName string, group string) string {
+	setting := operation_setting.GetSessionAffinitySetting()
+	if !setting.Enabled {
+		return ""
+	}
+	var source, value string
+	for _, s := range setting.Sources {
+		switch s {
+		case operation_setting.SessionAffinitySourceHeader:
+			value = c.GetHeader(setting.SessionHeader)
+		case operation_setting.SessionAffinitySourceSystemPrompt:
+			body, err := common.GetRequestBody(c)
+			if err != nil {
+				continue
+			}
+			prompt := extractSystemPrompt(body)
+			if setting.SystemPromptPrefixLength > 0 && len(prompt) > setting.SystemPromptPrefixLength {
+				prompt = prompt[:setting.SystemPromptPrefixLength]
+			}
+			value = string(prompt)
+		case operation_setting.SessionAffinitySourceToken:
+			value = strconv.Itoa(c.GetInt("token_id"))
+		}
+		if value != "" {
+			source = s
+			break
+		}
+	}
+	if value == "" {
+		return ""
+	}
+	// 会话只在同一令牌、分组、模型内生效
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d|%s|%s|%s|%s", c.GetInt("token_id"), group, modelName, source, value)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// GetSessionAffinityChannel 返回会话之前绑定的渠道，渠道不可用时返回 nil，由调用方按正常方式选择渠道
+func GetSessionAffinityChannel(c *gin.Context, modelName string, usingGroup string) *model.Channel {
+	key := GetSessionAffinityKey(c, modelName, usingGroup)
+	if key == "" {
+		return nil
+	}
+	common.SetContextKey(c, constant.ContextKeySessionAffinityKey, key)
+	entry, ok := getSessionAffinity(key)
+	if !ok {
+		return nil
+	}
+	if usingGroup == "auto" {
+		userGroup := common.GetContextKeyString(c, constant.ContextKeyUserGroup)
+		if !lo.Contains(GetUserAutoGroup(userGroup), entry.Group) {
+			return nil
+		}
+	} else if entry.Group != usingGroup {
+		return nil
+	}
+	channel, err := model.GetSatisfiedChannelById(entry.Group, modelName, entry.ChannelId)
+	if err != nil || channel == nil {
+		return nil
+	}
+	if usingGroup == "auto" {
+		common.SetContextKey(c, constant.ContextKeyAutoGroup, entry.Group)
+	}
+	common.SetContextKey(c, constant.ContextKeySessionAffinityChannelId, channel.Id)
+	common.SetContextKey(c, constant.ContextKeySessionAffinityKeyIndex, entry.KeyIndex)
+	logger.LogDebug(c, "session affinity hit: channel %d, key index %d", channel.Id, entry.KeyIndex)
+	return channel
+}
+
+// TakeSessionAffinityKeyIndex 返回会话绑定的 key 下标，只在第一次选中绑定渠道时生效，重试时按正常方式选择 key
+func TakeSessionAffinityKeyIndex(c *gin.Context, channelId int) (int, bool) {
+	pinnedChannelId := common.GetContextKeyInt(c, constant.ContextKeySessionAffinityChannelId)
+	if pinnedChannelId == 0 || pinnedChannelId != channelId {
+		return 0, false
+	}
+	common.SetContextKey(c, constant.ContextKeySessionAffinityChannelId, 0)
+	return common.GetContextKeyInt(c, constant.ContextKeySessionAffinityKeyIndex), true
+}
+
+// RecordSessionAffinity 请求成功后绑定会话到本次使用的渠道和 key，并续期
+func RecordSessionAffinity(c *gin.Context, channelId int, keyIndex int, group string) {
+	key := common.GetContextKeyString(c, constant.ContextKeySessionAffinityKey)
+	if key == "" {
+		return
+	}
+	ttl := operation_setting.GetSessionAffinitySetting().TTLSeconds
+	if ttl <= 0 {
+		return
+	}
+	if autoGroup := common.GetContextKeyString(c, constant.ContextKeyAutoGroup); autoGroup != "" {
+		group = autoGroup
+	}
+	setSessionAffinity(key, sessionAffinityEntry{
+		ChannelId: channelId,
+		KeyIndex:  keyIndex,
+		Group:     group,
+	}, time.Duration(ttl)*time.Second)
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/limiter"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 令牌桶以 1/60 token 为单位计数，使每秒的补充速率为整数
+	tpmBucketUnit = 60
+	// 单个请求占用并发名额的兜底过期时间，防止进程异常退出后名额无法释放
+	concurrencyMemberTTL = 10 * time.Minute
+)
+
+var (
+	memoryTPMLimiter         = limiter.NewMemoryLimiter()
+	memoryConcurrencyLimiter = limiter.NewMemoryConcurrencyLimiter()
+)
+
+type rateLimitScope struct {
+	name string
+	key  string
+	rule operation_setting.RateLimitRule
+}
+
+type rateLimitReservation struct {
+	tpmScopes         []rateLimitScope
+	concurrencyScopes []rateLimitScope
+	// 本次请求在各并发计数中的成员 id
+	concurrencyMember string
+	estimatedTokens   int
+	consumedTokens    int
+}
+
+// getRateLimitScopes 返回本次请求需要检查的限制：令牌、用户在分组内、用户在模型内
+func getRateLimitScopes(c *gin.Context, info *relaycommon.RelayInfo) []rateLimitScope {
+	setting := operation_setting.GetTokenRateLimitSetting()
+	scopes := make([]rateLimitScope, 0, 3)
+	tokenRule := operation_setting.RateLimitRule{
+		TPM:         common.GetContextKeyInt(c, constant.ContextKeyTokenTPMLimit),
+		Concurrency: common.GetContextKeyInt(c, constant.ContextKeyTokenConcurrencyLimit),
+	}
+	if tokenRule.TPM > 0 || tokenRule.Concurrency > 0 {
+		scopes = append(scopes, rateLimitScope{name: "token", key: fmt.Sprintf("token:%d", info.TokenId), rule: tokenRule})
+	}
+	group := info.UsingGroup
+	if autoGroup := common.GetContextKeyString(c, constant.ContextKeyAutoGroup); autoGroup != "" {
+		group = autoGroup
+	}
+	if rule, ok := setting.GroupLimits[group]; ok {
+		scopes = append(scopes, rateLimitScope{name: "group", key: fmt.Sprintf("group:%s:%d", group, info.UserId), rule: rule})
+	}
+	if rule, ok := setting.ModelLimits[info.OriginModelName]; ok {
+		scopes = append(scopes, rateLimitScope{name: "model", key: fmt.Sprintf("model:%s:%d", info.OriginModelName, info.UserId), rule: rule})
+	}
+	return scopes
+}
+
+func tpmLimiterOptions(tpm int, tokens int) []limiter.Option {
+	return []limiter.Option{
+		limiter.WithCapacity(int64(tpm) * tpmBucketUnit),
+		limiter.WithRate(int64(tpm)),
+		limiter.WithRequested(int64(tokens) * tpmBucketUnit),
+	}
+}
+
+func reserveTPM(scope rateLimitScope, tokens int) (bool, int64, error) {
+	key := "rateLimit:tpm:" + scope.key
+	if common.RedisEnabled {
+		ctx := context.Background()
+		return limiter.New(ctx, common.RDB).Reserve(ctx, key, tpmLimiterOptions(scope.rule.TPM, tokens)...)
+	}
+	allowed, remaining := memoryTPMLimiter.Reserve(key, tpmLimiterOptions(scope.rule.TPM, tokens)...)
+	return allowed, remaining, nil
+}
+
+// consumeTPM 不检查余量直接修正桶内令牌，tokens 为负数时返还
+func consumeTPM(scope rateLimitScope, tokens int) {
+	key := "rateLimit:tpm:" + scope.key
+	if common.RedisEnabled {
+		ctx := context.Background()
+		if _, err := limiter.New(ctx, common.RDB).Consume(ctx, key, tpmLimiterOptions(scope.rule.TPM, tokens)...); err != nil {
+			common.SysError("failed to adjust tpm rate limit: " + err.Error())
+		}
+		return
+	}
+	memoryTPMLimiter.Consume(key, tpmLimiterOptions(scope.rule.TPM, tokens)...)
+}
+
+func acquireConcurrency(scope rateLimitScope, member string) (bool, error) {
+	key := "rateLimit:concurrency:" + scope.key
+	if common.RedisEnabled {
+		ctx := context.Background()
+		return limiter.New(ctx, common.RDB).AcquireConcurrency(ctx, key, member, scope.rule.Concurrency, concurrencyMemberTTL)
+	}
+	return memoryConcurrencyLimiter.Acquire(key, member, scope.rule.Concurrency, concurrencyMemberTTL), nil
+}
+
+func releaseConcurrency(scope rateLimitScope, member string) {
+	key := "rateLimit:concurrency:" + scope.key
+	if common.RedisEnabled {
+		ctx := context.Background()
+		if err := limiter.New(ctx, common.RDB).ReleaseConcurrency(ctx, key, member); err != nil {
+			common.SysError("failed to release concurrency rate limit: " + err.Error())
+		}
+		return
+	}
+	memoryConcurrencyLimiter.Release(key, member)
+}
+
+// setTPMRateLimitHeaders 按 OpenAI 的格式返回剩余额度最少的 TPM 限制
+func setTPMRateLimitHeaders(c *gin.Context, tpm int, remaining int64) {
+	if remaining < 0 {
+		remaining = 0
+	}
+	capacity := int64(tpm) * tpmBucketUnit
+	reset := time.Duration((capacity-remaining)/int64(tpm)) * time.Second
+	c.Header("x-ratelimit-limit-tokens", strconv.Itoa(tpm))
+	c.Header("x-ratelimit-remaining-tokens", strconv.FormatInt(remaining/tpmBucketUnit, 10))
+	c.Header("x-ratelimit-reset-tokens", reset.String())
+}
+
+// CheckTokenRateLimit 按预估的输入 token 数检查 TPM 与并发限制，请求结束后需调用 ReleaseTokenRateLimit
+func CheckTokenRateLimit(c *gin.Context, info *relaycommon.RelayInfo, estimatedTokens int) *types.NewAPIError {
+	if !operation_setting.GetTokenRateLimitSetting().Enabled {
+		return nil
+	}
+	scopes := getRateLimitScopes(c, info)
+	if len(scopes) == 0 {
+		return nil
+	}
+	reservation := &rateLimitReservation{
+		estimatedTokens:   estimatedTokens,
+		concurrencyMember: common.GetRandomString(16),
+	}
+	rollback := func() {
+		for _, scope := range reservation.tpmScopes {
+			consumeTPM(scope, -estimatedTokens)
+		}
+		for _, scope := range reservation.concurrencyScopes {
+			releaseConcurrency(scope, reservation.concurrencyMember)
+		}
+	}
+
+	headerTPM := 0
+	var headerRemaining int64 = -1
+	for _, scope := range scopes {
+		if scope.rule.Concurrency > 0 {
+			allowed, err := acquireConcurrency(scope, reservation.concurrencyMember)
+			if err != nil {
+				// 限流存储不可用时放行，避免影响正常请求
+				logger.LogError(c, "failed to check concurrency rate limit: "+err.Error())
+			} else if !allowed {
+				rollback()
+				return types.NewErrorWithStatusCode(fmt.Errorf("已达到%s并发请求数限制：最多同时进行 %d 个请求", rateLimitScopeName(scope.name), scope.rule.Concurrency),
+					types.ErrorCodeRateLimitExceeded, http.StatusTooManyRequests, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+			} else {
+				reservation.concurrencyScopes = append(reservation.concurrencyScopes, scope)
+			}
+		}
+		if scope.rule.TPM > 0 {
+			allowed, remaining, err := reserveTPM(scope, estimatedTokens)
+			if err != nil {
+				logger.LogError(c, "failed to check tpm rate limit: "+err.Error())
+				continue
+			}
+			if !allowed {
+				rollback()
+				setTPMRateLimitHeaders(c, scope.rule.TPM, remaining)
+				return types.NewErrorWithStatusCode(fmt.Errorf("已达到%s每分钟 token 数限制：每分钟最多 %d tokens，本次请求预估 %d tokens", rateLimitScopeName(scope.name), scope.rule.TPM, estimatedTokens),
+					types.ErrorCodeRateLimitExceeded, http.StatusTooManyRequests, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+			}
+			reservation.tpmScopes = append(reservation.tpmScopes, scope)
+			if headerRemaining < 0 || remaining < headerRemaining {
+				headerTPM = scope.rule.TPM
+				headerRemaining = remaining
+			}
+		}
+	}
+	if headerTPM > 0 {
+		setTPMRateLimitHeaders(c, headerTPM, headerRemaining)
+	}
+	common.SetContextKey(c, constant.ContextKeyRateLimitReservation, reservation)
+	return nil
+}
+
+// RecordTokenRateLimitUsage 记录本次请求实际消耗的 token 数，由计费流程在结算后调用
+func RecordTokenRateLimitUsage(c *gin.Context, tokens int) {
+	reservation, ok := common.GetContextKeyType[*rateLimitReservation](c, constant.ContextKeyRateLimitReservation)
+	if !ok || reservation == nil {
+		return
+	}
+	reservation.consumedTokens = tokens
+}
+
+// ReleaseTokenRateLimit 释放并发计数，并按实际消耗的 token 数修正 TPM 令牌桶，请求失败时返还全部预估
+func ReleaseTokenRateLimit(c *gin.Context) {
+	reservation, ok := common.GetContextKeyType[*rateLimitReservation](c, constant.ContextKeyRateLimitReservation)
+	if !ok || reservation == nil {
+		return
+	}
+	common.SetContextKey(c, constant.ContextKeyRateLimitReservation, nil)
+	for _, scope := range reservation.concurrencyScopes {
+		releaseConcurrency(scope, reservation.concurrencyMember)
+	}
+	delta := reservation.consumedTokens - reservation.estimatedTokens
+	if delta == 0 {
+		return
+	}
+	for _, scope := range reservation.tpmScopes {
+		consumeTPM(scope, delta)
+	}
+}
+
+func rateLimitScopeName(name string) string {
+	switch name {
+	case "token":
+		return "令牌"
+	case "group":
+		return "分组"
+	default:
+		return "模型"
+	}
+}
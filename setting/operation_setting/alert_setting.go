@@ -0,0 +1,31 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// AlertSetting 用户自定义告警规则
+type AlertSetting struct {
+	Enabled bool `json:"enabled"`
+	// 用量与错误率规则的检查间隔（秒）
+	CheckIntervalSeconds int `json:"check_interval_seconds"`
+	// 规则未设置去重窗口时的默认值（分钟），窗口内同一告警只发送一次
+	DefaultDedupMinutes int `json:"default_dedup_minutes"`
+	// 每个用户最多可创建的规则数
+	MaxRulesPerUser int `json:"max_rules_per_user"`
+}
+
+// 默认配置
+var alertSetting = AlertSetting{
+	Enabled:              true,
+	CheckIntervalSeconds: 60,
+	DefaultDedupMinutes:  60,
+	MaxRulesPerUser:      20,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("alert_setting", &alertSetting)
+}
+
+func GetAlertSetting() *AlertSetting {
+	return &alertSetting
+}
@@ -0,0 +1,31 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// BatchSetting /v1/batches 批处理执行配置，计费折扣见 ratio_setting.BatchRatioSetting
+type BatchSetting struct {
+	Enabled bool `json:"enabled"`
+	// 单个批处理任务同时执行的请求数
+	Concurrency int `json:"concurrency"`
+	// 单个批处理任务允许的最大请求数
+	MaxRequests int `json:"max_requests"`
+	// 主节点同时运行的批处理任务数
+	MaxRunningBatches int `json:"max_running_batches"`
+}
+
+// 默认配置
+var batchSetting = BatchSetting{
+	Enabled:           false,
+	Concurrency:       4,
+	MaxRequests:       50000,
+	MaxRunningBatches: 2,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("batch_setting", &batchSetting)
+}
+
+func GetBatchSetting() *BatchSetting {
+	return &batchSetting
+}
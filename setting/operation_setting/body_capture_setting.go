@@ -0,0 +1,58 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// BodyCaptureSetting 记录请求与响应的完整内容，用于审计与排查问题
+type BodyCaptureSetting struct {
+	Enabled bool `json:"enabled"`
+	// 对这些分组的所有令牌开启，令牌也可以单独开启
+	Groups []string `json:"groups"`
+	// 采样率，取值 0 到 1
+	SampleRate float64 `json:"sample_rate"`
+	// 请求体与响应体各自保存的最大字节数，超出部分截断，不大于 0 时使用默认值
+	MaxBodyBytes int `json:"max_body_bytes"`
+	// 保留天数，过期的记录会被定期清理
+	RetentionDays int `json:"retention_days"`
+	// 名称匹配的 JSON 字段会被脱敏，不区分大小写
+	RedactKeys []string `json:"redact_keys"`
+	// 需要脱敏的 JSON 路径，以 . 分隔，* 匹配数组的所有元素或对象的所有字段，如 messages.*.content
+	RedactPaths []string `json:"redact_paths"`
+}
+
+const defaultCaptureMaxBodyBytes = 64 * 1024
+
+// 默认配置
+var bodyCaptureSetting = BodyCaptureSetting{
+	Enabled:       false,
+	Groups:        []string{},
+	SampleRate:    1,
+	MaxBodyBytes:  defaultCaptureMaxBodyBytes,
+	RetentionDays: 7,
+	RedactKeys:    []string{"api_key", "apikey", "authorization", "password", "secret", "access_token", "refresh_token", "client_secret"},
+	RedactPaths:   []string{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("body_capture_setting", &bodyCaptureSetting)
+}
+
+func GetBodyCaptureSetting() *BodyCaptureSetting {
+	return &bodyCaptureSetting
+}
+
+// GetMaxBodyBytes 返回保存的最大字节数，记录内容始终有上限
+func (s *BodyCaptureSetting) GetMaxBodyBytes() int {
+	if s.MaxBodyBytes <= 0 {
+		return defaultCaptureMaxBodyBytes
+	}
+	return s.MaxBodyBytes
+}
+
+func (s *BodyCaptureSetting) IsGroupEnabled(group string) bool {
+	return slices.Contains(s.Groups, group)
+}
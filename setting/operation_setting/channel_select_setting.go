@@ -0,0 +1,58 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// 渠道选择策略
+const (
+	// ChannelSelectStrategyWeightedRandom 按静态权重随机（默认，与旧版本行为一致）
+	ChannelSelectStrategyWeightedRandom = "weighted_random"
+	// ChannelSelectStrategyEWMA 按首字时间/延迟/错误率的指数滑动平均动态调整权重
+	ChannelSelectStrategyEWMA = "ewma"
+	// ChannelSelectStrategyLeastRequests 优先选择当前在途请求最少的渠道
+	ChannelSelectStrategyLeastRequests = "least_requests"
+)
+
+type ChannelSelectSetting struct {
+	// 默认选择策略
+	DefaultStrategy string `json:"default_strategy"`
+	// 分组 -> 选择策略，未配置的分组使用 DefaultStrategy
+	GroupStrategies map[string]string `json:"group_strategies"`
+	// EWMA 平滑系数，取值 (0, 1]，越大越偏向最近的请求
+	EWMAAlpha float64 `json:"ewma_alpha"`
+	// 统计数据过期时间（秒），超过该时间没有新请求的统计将被重置
+	StatsWindowSeconds int `json:"stats_window_seconds"`
+	// 样本数少于该值时视为冷启动，按平均水平参与选择
+	MinSamples int `json:"min_samples"`
+	// 错误率惩罚系数，得分 = 延迟 * (1 + 错误率 * ErrorPenalty)
+	ErrorPenalty float64 `json:"error_penalty"`
+}
+
+// 默认配置
+var channelSelectSetting = ChannelSelectSetting{
+	DefaultStrategy:    ChannelSelectStrategyWeightedRandom,
+	GroupStrategies:    map[string]string{},
+	EWMAAlpha:          0.3,
+	StatsWindowSeconds: 600,
+	MinSamples:         5,
+	ErrorPenalty:       10,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("channel_select_setting", &channelSelectSetting)
+}
+
+func GetChannelSelectSetting() *ChannelSelectSetting {
+	return &channelSelectSetting
+}
+
+// GetChannelSelectStrategy 返回分组使用的渠道选择策略
+func GetChannelSelectStrategy(group string) string {
+	if strategy, ok := channelSelectSetting.GroupStrategies[group]; ok && strategy != "" {
+		return strategy
+	}
+	if channelSelectSetting.DefaultStrategy == "" {
+		return ChannelSelectStrategyWeightedRandom
+	}
+	return channelSelectSetting.DefaultStrategy
+}
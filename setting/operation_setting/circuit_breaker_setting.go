@@ -0,0 +1,62 @@
+package operation_setting
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+type CircuitBreakerSetting struct {
+	Enabled bool `json:"enabled"`
+	// 连续失败多少次后熔断
+	FailureThreshold int `json:"failure_threshold"`
+	// 熔断后的冷却时间（秒），冷却结束后进入半开状态
+	CooldownSeconds int `json:"cooldown_seconds"`
+	// 半开状态下允许通过的探测请求数，全部成功后恢复
+	HalfOpenRequests int `json:"half_open_requests"`
+}
+
+// 默认配置
+var circuitBreakerSetting = CircuitBreakerSetting{
+	Enabled:          false,
+	FailureThreshold: 5,
+	CooldownSeconds:  60,
+	HalfOpenRequests: 3,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("circuit_breaker_setting", &circuitBreakerSetting)
+}
+
+func GetCircuitBreakerSetting() *CircuitBreakerSetting {
+	return &circuitBreakerSetting
+}
+
+// GetFailureThreshold 返回熔断阈值，配置为 0 或负数时按 1 处理
+func (s *CircuitBreakerSetting) GetFailureThreshold() int {
+	return max(s.FailureThreshold, 1)
+}
+
+// GetHalfOpenRequests 返回半开探测请求数，配置为 0 或负数时按 1 处理，否则熔断器永远无法恢复
+func (s *CircuitBreakerSetting) GetHalfOpenRequests() int {
+	return max(s.HalfOpenRequests, 1)
+}
+
+// ValidateCircuitBreakerOption 校验熔断器配置项
+func ValidateCircuitBreakerOption(key string, value string) error {
+	switch key {
+	case "circuit_breaker_setting.failure_threshold", "circuit_breaker_setting.half_open_requests":
+		v, err := strconv.Atoi(value)
+		if err != nil || v <= 0 {
+			return fmt.Errorf("%s 必须为正整数", key)
+		}
+	case "circuit_breaker_setting.cooldown_seconds":
+		v, err := strconv.Atoi(value)
+		if err != nil || v < 0 {
+			return fmt.Errorf("%s 必须为非负整数", key)
+		}
+	}
+	return nil
+}
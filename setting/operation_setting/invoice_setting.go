@@ -0,0 +1,42 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// InvoiceSetting 月度账单：汇总充值、兑换、退款与消费生成账单
+type InvoiceSetting struct {
+	Enabled bool `json:"enabled"`
+	// 每月初自动为上月有账目的用户生成账单
+	AutoGenerate bool `json:"auto_generate"`
+	// 生成后发送邮件给用户
+	SendEmail bool `json:"send_email"`
+	// 账单编号前缀
+	NumberPrefix string `json:"number_prefix"`
+	// 税率，百分比
+	TaxRate float64 `json:"tax_rate"`
+	// 开票方信息
+	CompanyName    string `json:"company_name"`
+	CompanyAddress string `json:"company_address"`
+	CompanyTaxId   string `json:"company_tax_id"`
+	CompanyEmail   string `json:"company_email"`
+	Footer         string `json:"footer"`
+	// PDF 使用的 TrueType 字体文件，未配置时只能正确显示拉丁字符
+	PdfFontPath string `json:"pdf_font_path"`
+}
+
+// 默认配置
+var invoiceSetting = InvoiceSetting{
+	Enabled:      false,
+	AutoGenerate: true,
+	SendEmail:    false,
+	NumberPrefix: "INV-",
+	TaxRate:      0,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("invoice_setting", &invoiceSetting)
+}
+
+func GetInvoiceSetting() *InvoiceSetting {
+	return &invoiceSetting
+}
@@ -0,0 +1,77 @@
+package operation_setting
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	LogArchiveStorageLocal = "local"
+	LogArchiveStorageS3    = "s3"
+)
+
+// 账单汇总上一个自然月的消费与退款日志，最长回溯 62 天；告警规则的统计窗口最长 7 天，
+// 保留期短于这些时间的日志会在被查询前归档
+var minLogArchiveRetentionDays = map[string]int{
+	"consume": 62,
+	"refund":  62,
+	"error":   7,
+}
+
+// LogArchiveSetting 日志归档：超过保留期的日志导出为 gzip 压缩的 JSONL 文件后从数据库删除
+type LogArchiveSetting struct {
+	Enabled bool `json:"enabled"`
+	// 各类日志的保留天数，键为 consume、error、topup、manage、system、refund，未配置或为 0 表示不归档
+	RetentionDays map[string]int `json:"retention_days"`
+	// 每个归档文件包含的最大日志条数
+	BatchSize int `json:"batch_size"`
+	// 恢复的日志保留天数，到期后直接删除，不再重复归档
+	RestoreKeepDays int `json:"restore_keep_days"`
+	// 存储方式：local 或 s3，s3 使用文件存储（file_setting）中的 S3 配置
+	Storage  string `json:"storage"`
+	LocalDir string `json:"local_dir"`
+}
+
+// 默认配置
+var logArchiveSetting = LogArchiveSetting{
+	Enabled:         false,
+	RetentionDays:   map[string]int{},
+	BatchSize:       10000,
+	RestoreKeepDays: 7,
+	Storage:         LogArchiveStorageLocal,
+	LocalDir:        "./archives",
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("log_archive_setting", &logArchiveSetting)
+}
+
+func GetLogArchiveSetting() *LogArchiveSetting {
+	return &logArchiveSetting
+}
+
+// GetRetentionDays 返回日志类型的保留天数，0 表示不归档；配置短于账单与告警的回溯时间时按最短保留期处理
+func (s *LogArchiveSetting) GetRetentionDays(name string) int {
+	days := s.RetentionDays[name]
+	if days <= 0 {
+		return 0
+	}
+	return max(days, minLogArchiveRetentionDays[name])
+}
+
+// ValidateLogArchiveRetentionDays 校验保留天数配置，不允许在账单与告警查询之前归档日志
+func ValidateLogArchiveRetentionDays(value string) error {
+	var retentionDays map[string]int
+	if err := common.UnmarshalJsonStr(value, &retentionDays); err != nil {
+		return fmt.Errorf("日志保留天数格式错误：%s", err.Error())
+	}
+	for name, days := range retentionDays {
+		if minDays := minLogArchiveRetentionDays[name]; days > 0 && days < minDays {
+			return fmt.Errorf("%s 日志的保留天数不能少于 %d 天，账单与告警需要查询这段时间内的日志", name, minDays)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+)
+
+// LogSetting 系统日志的输出格式、级别与日志文件轮转
+type LogSetting struct {
+	// text 为原有的单行文本格式，json 为每行一个 JSON 对象
+	Format string `json:"format"`
+	// 低于该级别的日志不输出，DEBUG 环境变量开启时始终输出 debug 日志
+	Level string `json:"level"`
+	// 单个日志文件的最大大小（MB），超过后切换到新文件，0 表示不限制
+	MaxFileSizeMB int `json:"max_file_size_mb"`
+	// 日志目录中最多保留的日志文件数量，0 表示不限制
+	MaxFiles int `json:"max_files"`
+}
+
+// 默认配置
+var logSetting = LogSetting{
+	Format:        LogFormatText,
+	Level:         LogLevelInfo,
+	MaxFileSizeMB: 100,
+	MaxFiles:      0,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("log_setting", &logSetting)
+}
+
+func GetLogSetting() *LogSetting {
+	return &logSetting
+}
+
+func (s *LogSetting) IsJSON() bool {
+	return s.Format == LogFormatJSON
+}
@@ -0,0 +1,25 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// MetricsSetting Prometheus 指标接口 /metrics
+type MetricsSetting struct {
+	Enabled bool `json:"enabled"`
+	// 采集时需要携带 Authorization: Bearer <token>，为空时不允许启用
+	Token string `json:"token"`
+}
+
+// 默认配置
+var metricsSetting = MetricsSetting{
+	Enabled: false,
+	Token:   "",
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("metrics_setting", &metricsSetting)
+}
+
+func GetMetricsSetting() *MetricsSetting {
+	return &metricsSetting
+}
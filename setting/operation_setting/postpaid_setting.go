@@ -0,0 +1,26 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// PostpaidSetting 后付费：信用额度用户每月结算，逾期未结清时暂停透支
+type PostpaidSetting struct {
+	// 结算单生成后的默认宽限天数，用户可单独设置
+	GraceDays int `json:"grace_days"`
+	// 生成结算单时发送邮件提醒
+	SendEmail bool `json:"send_email"`
+}
+
+// 默认配置
+var postpaidSetting = PostpaidSetting{
+	GraceDays: 15,
+	SendEmail: true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("postpaid_setting", &postpaidSetting)
+}
+
+func GetPostpaidSetting() *PostpaidSetting {
+	return &postpaidSetting
+}
@@ -0,0 +1,45 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ResponseCacheSetting 网关响应缓存：确定性的 chat completions 请求直接返回缓存的结果
+type ResponseCacheSetting struct {
+	Enabled bool `json:"enabled"`
+	// 对这些分组的所有令牌开启，令牌也可以单独开启
+	Groups []string `json:"groups"`
+	// 缓存有效期（秒）
+	TTLSeconds int `json:"ttl_seconds"`
+	// 超过该大小的响应不缓存（字节）
+	MaxResponseBytes int `json:"max_response_bytes"`
+	// 命中缓存时按原价的倍率计费，0 表示免费
+	CostRatio float64 `json:"cost_ratio"`
+	// 带有工具的请求只有全部工具都在白名单内时才缓存
+	AllowedTools []string `json:"allowed_tools"`
+}
+
+// 默认配置
+var responseCacheSetting = ResponseCacheSetting{
+	Enabled:          false,
+	Groups:           []string{},
+	TTLSeconds:       86400,
+	MaxResponseBytes: 1024 * 1024,
+	CostRatio:        0,
+	AllowedTools:     []string{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("response_cache_setting", &responseCacheSetting)
+}
+
+func GetResponseCacheSetting() *ResponseCacheSetting {
+	return &responseCacheSetting
+}
+
+func (s *ResponseCacheSetting) IsGroupEnabled(group string) bool {
+	return slices.Contains(s.Groups, group)
+}
@@ -0,0 +1,25 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// ResponsesStoreSetting 由网关保存 Responses API 的输入输出，使 previous_response_id 不依赖上游渠道
+type ResponsesStoreSetting struct {
+	Enabled bool `json:"enabled"`
+	// 保存天数，0 表示永久保存
+	RetentionDays int `json:"retention_days"`
+}
+
+// 默认配置
+var responsesStoreSetting = ResponsesStoreSetting{
+	Enabled:       false,
+	RetentionDays: 30,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("responses_store_setting", &responsesStoreSetting)
+}
+
+func GetResponsesStoreSetting() *ResponsesStoreSetting {
+	return &responsesStoreSetting
+}
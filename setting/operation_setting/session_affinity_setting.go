@@ -0,0 +1,44 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// 会话标识来源
+const (
+	// SessionAffinitySourceHeader 客户端传入的会话请求头
+	SessionAffinitySourceHeader = "header"
+	// SessionAffinitySourceSystemPrompt 系统提示词前缀
+	SessionAffinitySourceSystemPrompt = "system_prompt"
+	// SessionAffinitySourceToken 令牌
+	SessionAffinitySourceToken = "token"
+)
+
+// SessionAffinitySetting 会话亲和：同一会话在 TTL 内固定到同一渠道和 key，提高上游提示词缓存命中率
+type SessionAffinitySetting struct {
+	Enabled bool `json:"enabled"`
+	// 会话标识来源，按顺序使用第一个可用的来源
+	Sources []string `json:"sources"`
+	// 会话请求头名称
+	SessionHeader string `json:"session_header"`
+	// 参与计算的系统提示词前缀长度（字节）
+	SystemPromptPrefixLength int `json:"system_prompt_prefix_length"`
+	// 绑定关系的有效期（秒），每次成功请求后续期
+	TTLSeconds int `json:"ttl_seconds"`
+}
+
+// 默认配置
+var sessionAffinitySetting = SessionAffinitySetting{
+	Enabled:                  false,
+	Sources:                  []string{SessionAffinitySourceHeader, SessionAffinitySourceSystemPrompt},
+	SessionHeader:            "x-session-id",
+	SystemPromptPrefixLength: 2048,
+	TTLSeconds:               3600,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("session_affinity_setting", &sessionAffinitySetting)
+}
+
+func GetSessionAffinitySetting() *SessionAffinitySetting {
+	return &sessionAffinitySetting
+}
@@ -0,0 +1,37 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// RateLimitRule 0 表示不限制
+type RateLimitRule struct {
+	// 每分钟 token 数（输入与输出合计）
+	TPM int `json:"tpm"`
+	// 同时进行中的请求数
+	Concurrency int `json:"concurrency"`
+}
+
+// TokenRateLimitSetting 按 token 用量与并发数限流，与按请求数的 ModelRequestRateLimit 同时生效。
+// 分组与模型的限制对每个用户单独计算，令牌上的限制对该令牌单独计算
+type TokenRateLimitSetting struct {
+	Enabled bool `json:"enabled"`
+	// 分组 -> 限制
+	GroupLimits map[string]RateLimitRule `json:"group_limits"`
+	// 模型 -> 限制
+	ModelLimits map[string]RateLimitRule `json:"model_limits"`
+}
+
+// 默认配置
+var tokenRateLimitSetting = TokenRateLimitSetting{
+	Enabled:     false,
+	GroupLimits: map[string]RateLimitRule{},
+	ModelLimits: map[string]RateLimitRule{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("token_rate_limit_setting", &tokenRateLimitSetting)
+}
+
+func GetTokenRateLimitSetting() *TokenRateLimitSetting {
+	return &tokenRateLimitSetting
+}
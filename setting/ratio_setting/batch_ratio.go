@@ -0,0 +1,35 @@
+package ratio_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// BatchRatioSetting 批处理（/v1/batches）请求的计费折扣，在模型倍率与分组倍率之上再乘以该倍率
+type BatchRatioSetting struct {
+	// 默认折扣倍率
+	DefaultRatio float64 `json:"default_ratio"`
+	// 模型 -> 折扣倍率，未配置的模型使用 DefaultRatio
+	ModelRatio map[string]float64 `json:"model_ratio"`
+}
+
+var batchRatioSetting = BatchRatioSetting{
+	DefaultRatio: 0.5,
+	ModelRatio:   map[string]float64{},
+}
+
+func init() {
+	config.GlobalConfig.Register("batch_ratio_setting", &batchRatioSetting)
+}
+
+func GetBatchRatioSetting() *BatchRatioSetting {
+	return &batchRatioSetting
+}
+
+// GetBatchRatio 返回模型的批处理折扣倍率
+func GetBatchRatio(name string) float64 {
+	if ratio, ok := batchRatioSetting.ModelRatio[FormatMatchingModelName(name)]; ok && ratio >= 0 {
+		return ratio
+	}
+	if batchRatioSetting.DefaultRatio < 0 {
+		return 1
+	}
+	return batchRatioSetting.DefaultRatio
+}
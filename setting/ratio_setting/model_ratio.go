@@ -275,6 +275,15 @@ var defaultModelPrice = map[string]float64{
 	"suno_lyrics":                    0.01,
 	"dall-e-3":                       0.04,
 	"imagen-3.0-generate-002":        0.03,
+	"imagen-4.0-generate-001":        0.04,
+	"imagen-4.0-ultra-generate-001":  0.06,
+	"imagen-4.0-fast-generate-001":   0.02,
+	"titan-image-generator-v1":       0.01,
+	"titan-image-generator-v2":       0.01,
+	"nova-canvas-v1:0":               0.04,
+	"stable-image-core":              0.04,
+	"stable-diffusion-3-5-large":     0.08,
+	"stable-image-ultra":             0.14,
 	"black-forest-labs/flux-1.1-pro": 0.04,
 	"gpt-4-gizmo-*":                  0.1,
 	"mj_video":                       0.8,
@@ -0,0 +1,48 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// FileSetting /v1/files 文件存储配置
+type FileSetting struct {
+	Enabled             bool   `json:"enabled"`
+	StorageType         string `json:"storage_type"` // local / s3
+	LocalPath           string `json:"local_path"`
+	S3Endpoint          string `json:"s3_endpoint"`
+	S3Region            string `json:"s3_region"`
+	S3Bucket            string `json:"s3_bucket"`
+	S3AccessKeyId       string `json:"s3_access_key_id"`
+	S3SecretAccessKey   string `json:"s3_secret_access_key"`
+	S3PathStyle         bool   `json:"s3_path_style"`
+	MaxFileSizeMB       int    `json:"max_file_size_mb"`        // 单个文件大小上限
+	MaxInlineFileSizeMB int    `json:"max_inline_file_size_mb"` // 对话中引用文件时内联到请求体的大小上限
+	MaxStoragePerUserMB int    `json:"max_storage_per_user_mb"` // 每个用户的存储上限，0 表示不限制
+	QuotaPerMB          int    `json:"quota_per_mb"`            // 上传时按 MB 扣除的额度，0 表示不收费
+}
+
+var defaultFileSetting = FileSetting{
+	Enabled:             false,
+	StorageType:         "local",
+	LocalPath:           "./data/files",
+	S3Region:            "us-east-1",
+	MaxFileSizeMB:       512,
+	MaxInlineFileSizeMB: 32,
+	MaxStoragePerUserMB: 0,
+	QuotaPerMB:          0,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("file_setting", &defaultFileSetting)
+}
+
+func GetFileSetting() *FileSetting {
+	return &defaultFileSetting
+}
+
+// GetMaxInlineFileBytes 内联文件的字节上限，未配置时使用默认的 32MB
+func (s *FileSetting) GetMaxInlineFileBytes() int64 {
+	if s.MaxInlineFileSizeMB <= 0 {
+		return 32 * 1024 * 1024
+	}
+	return int64(s.MaxInlineFileSizeMB) * 1024 * 1024
+}
@@ -26,6 +26,18 @@ type PriceData struct {
 	GroupRatioInfo       GroupRatioInfo
 }
 
+// OtherRatioBatch 批处理请求的折扣倍率在 OtherRatios 中的键
+const OtherRatioBatch = "batch"
+
+// OtherRatio 返回 OtherRatios 中各项附加倍率的乘积，未设置时为 1
+func (p PriceData) OtherRatio() float64 {
+	ratio := 1.0
+	for _, r := range p.OtherRatios {
+		ratio *= r
+	}
+	return ratio
+}
+
 type PerCallPriceData struct {
 	ModelPrice     float64
 	Quota          int
@@ -62,6 +62,7 @@ const EditTokenModal = (props) => {
   const formApiRef = useRef(null);
   const [models, setModels] = useState([]);
   const [groups, setGroups] = useState([]);
+  const [organizations, setOrganizations] = useState([]);
   const isEdit = props.editingToken.id !== undefined;
 
   const getInitValues = () => ({
@@ -74,6 +75,11 @@ const EditTokenModal = (props) => {
     allow_ips: '',
     group: '',
     cross_group_retry: false,
+    response_cache: false,
+    body_capture: false,
+    tpm_limit: 0,
+    concurrency_limit: 0,
+    organization_id: 0,
     tokenCount: 1,
   });
 
@@ -149,6 +155,19 @@ const EditTokenModal = (props) => {
     }
   };
 
+  const loadOrganizations = async () => {
+    let res = await API.get(`/api/organization/`);
+    const { success, data } = res.data;
+    if (success) {
+      setOrganizations(
+        (data || []).map((item) => ({
+          label: item.organization.name,
+          value: item.organization.id,
+        })),
+      );
+    }
+  };
+
   const loadToken = async () => {
     setLoading(true);
     let res = await API.get(`/api/token/${props.editingToken.id}`);
@@ -179,6 +198,7 @@ const EditTokenModal = (props) => {
     }
     loadModels();
     loadGroups();
+    loadOrganizations();
   }, [props.editingToken.id]);
 
   useEffect(() => {
@@ -378,6 +398,23 @@ const EditTokenModal = (props) => {
                       />
                     )}
                   </Col>
+                  {organizations.length > 0 && (
+                    <Col span={24}>
+                      <Form.Select
+                        field='organization_id'
+                        label={t('所属组织')}
+                        optionList={[
+                          { label: t('个人'), value: 0 },
+                          ...organizations,
+                        ]}
+                        disabled={isEdit}
+                        extraText={t(
+                          '组织令牌的消耗从组织额度池扣除，创建后不可修改',
+                        )}
+                        style={{ width: '100%' }}
+                      />
+                    </Col>
+                  )}
                   <Col span={24} style={{ display: values.group === 'auto' ? 'block' : 'none' }}>
                     <Form.Switch
                       field='cross_group_retry'
@@ -388,6 +425,26 @@ const EditTokenModal = (props) => {
                       )}
                     />
                   </Col>
+                  <Col span={24}>
+                    <Form.Switch
+                      field='response_cache'
+                      label={t('响应缓存')}
+                      size='default'
+                      extraText={t(
+                        '开启后，temperature 为 0 的相同对话请求直接返回缓存结果（需管理员开启响应缓存）',
+                      )}
+                    />
+                  </Col>
+                  <Col span={24}>
+                    <Form.Switch
+                      field='body_capture'
+                      label={t('记录请求内容')}
+                      size='default'
+                      extraText={t(
+                        '开启后，脱敏后的请求与响应内容会被保存，供管理员审计与排查问题（需管理员开启请求内容记录）',
+                      )}
+                    />
+                  </Col>
                   <Col xs={24} sm={24} md={24} lg={10} xl={10}>
                     <Form.DatePicker
                       field='expired_time'
@@ -566,6 +623,24 @@ const EditTokenModal = (props) => {
                       style={{ width: '100%' }}
                     />
                   </Col>
+                  <Col span={12}>
+                    <Form.InputNumber
+                      field='tpm_limit'
+                      label={t('每分钟 token 数限制')}
+                      min={0}
+                      extraText={t('0 表示不限制')}
+                      style={{ width: '100%' }}
+                    />
+                  </Col>
+                  <Col span={12}>
+                    <Form.InputNumber
+                      field='concurrency_limit'
+                      label={t('并发请求数限制')}
+                      min={0}
+                      extraText={t('0 表示不限制')}
+                      style={{ width: '100%' }}
+                    />
+                  </Col>
                 </Row>
               </Card>
             </div>
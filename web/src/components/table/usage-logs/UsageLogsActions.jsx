@@ -18,7 +18,7 @@ For commercial licensing, please contact support@quantumnous.com
 */
 
 import React from 'react';
-import { Tag, Space, Skeleton } from '@douyinfe/semi-ui';
+import { Tag, Space, Skeleton, Button, Dropdown } from '@douyinfe/semi-ui';
 import { renderQuota } from '../../../helpers';
 import CompactModeToggle from '../../common/ui/CompactModeToggle';
 import { useMinimumLoadingTime } from '../../../hooks/common/useMinimumLoadingTime';
@@ -29,6 +29,7 @@ const LogsActions = ({
   showStat,
   compactMode,
   setCompactMode,
+  exportLogs,
   t,
 }) => {
   const showSkeleton = useMinimumLoadingTime(loadingStat);
@@ -83,11 +84,25 @@ const LogsActions = ({
         </Space>
       </Skeleton>
 
-      <CompactModeToggle
-        compactMode={compactMode}
-        setCompactMode={setCompactMode}
-        t={t}
-      />
+      <Space>
+        <Dropdown
+          trigger='click'
+          position='bottomRight'
+          menu={[
+            { node: 'item', name: 'CSV', onClick: () => exportLogs('csv') },
+            { node: 'item', name: 'JSONL', onClick: () => exportLogs('jsonl') },
+          ]}
+        >
+          <Button type='tertiary' size='small'>
+            {t('导出')}
+          </Button>
+        </Dropdown>
+        <CompactModeToggle
+          compactMode={compactMode}
+          setCompactMode={setCompactMode}
+          t={t}
+        />
+      </Space>
     </div>
   );
 };
@@ -547,6 +547,39 @@ export const useLogsData = () => {
     setLoading(false);
   };
 
+  // 按当前筛选条件导出日志
+  const exportLogs = async (format) => {
+    const {
+      username,
+      token_name,
+      model_name,
+      start_timestamp,
+      end_timestamp,
+      channel,
+      group,
+      logType: formLogType,
+    } = getFormValues();
+    const currentLogType = formLogType !== undefined ? formLogType : logType;
+    let localStartTimestamp = Date.parse(start_timestamp) / 1000;
+    let localEndTimestamp = Date.parse(end_timestamp) / 1000;
+    let url = '';
+    if (isAdminUser) {
+      url = `/api/log/export?format=${format}&type=${currentLogType}&username=${username}&token_name=${token_name}&model_name=${model_name}&start_timestamp=${localStartTimestamp}&end_timestamp=${localEndTimestamp}&channel=${channel}&group=${group}`;
+    } else {
+      url = `/api/log/self/export?format=${format}&type=${currentLogType}&token_name=${token_name}&model_name=${model_name}&start_timestamp=${localStartTimestamp}&end_timestamp=${localEndTimestamp}&group=${group}`;
+    }
+    try {
+      const res = await API.get(encodeURI(url), { responseType: 'blob' });
+      const link = document.createElement('a');
+      link.href = URL.createObjectURL(res.data);
+      link.download = `usage-logs.${format}`;
+      link.click();
+      URL.revokeObjectURL(link.href);
+    } catch (error) {
+      showError(error.message);
+    }
+  };
+
   // Page handlers
   const handlePageChange = (page) => {
     setActivePage(page);
@@ -648,6 +681,7 @@ export const useLogsData = () => {
 
     // Functions
     loadLogs,
+    exportLogs,
     handlePageChange,
     handlePageSizeChange,
     refresh,